@@ -13,9 +13,11 @@ import (
 	"github.com/autoget-project/autoget/backend/indexers"
 	"github.com/autoget-project/autoget/backend/indexers/mteam"
 	"github.com/autoget-project/autoget/backend/indexers/nyaa"
+	"github.com/autoget-project/autoget/backend/indexers/rsshelper"
 	"github.com/autoget-project/autoget/backend/indexers/sukebei"
 	"github.com/autoget-project/autoget/backend/internal/config"
 	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/events"
 	"github.com/autoget-project/autoget/backend/internal/handlers"
 	"github.com/autoget-project/autoget/backend/internal/notify/telegram"
 	"github.com/autoget-project/autoget/backend/organizer"
@@ -55,37 +57,51 @@ func main() {
 	cronjob := cron.New()
 	cronjob.Start()
 
+	bus := events.NewBus()
 	downloaderMap := map[string]downloaders.IDownloader{}
 	for name, dlCfg := range cfg.Downloaders {
-		downloader, err := downloaders.New(name, dlCfg, db, oc)
+		downloader, err := downloaders.New(name, dlCfg, db, oc, tg)
 		if err != nil {
 			log.Fatal().Err(err).Msg("failed to create downloader")
 		}
 		downloaderMap[name] = downloader
+		downloader.SetEvents(bus)
 		downloader.RegisterCronjobs(cronjob)
 	}
 
 	indexerMap := map[string]indexers.IIndexer{}
+	// RSS of these indexers are pulled once service is created.
+	rssIndexers := []indexers.IIndexer{}
 	if cfg.MTeam != nil {
-		normal := mteam.NewMTeam(cfg.MTeam, mteam.MTeamTypeNormal, downloaderMap[cfg.MTeam.Downloader].TorrentsDir(), db, tg)
-		normal.RegisterRSSCronjob(cronjob)
+		normal := mteam.NewMTeam(cfg.MTeam, mteam.MTeamTypeNormal, db, tg)
+		rssIndexers = append(rssIndexers, normal)
 		indexerMap[normal.Name()] = normal
 
-		adult := mteam.NewMTeam(cfg.MTeam, mteam.MTeamTypeAdult, downloaderMap[cfg.MTeam.Downloader].TorrentsDir(), db, tg)
+		adult := mteam.NewMTeam(cfg.MTeam, mteam.MTeamTypeAdult, db, tg)
 		indexerMap[adult.Name()] = adult
 	}
 	if cfg.Nyaa != nil {
-		i := nyaa.NewClient(cfg.Nyaa, downloaderMap[cfg.Nyaa.Downloader].TorrentsDir(), db, tg)
-		i.RegisterRSSCronjob(cronjob)
+		i := nyaa.NewClient(cfg.Nyaa, db, tg)
+		rssIndexers = append(rssIndexers, i)
 		indexerMap[i.Name()] = i
 	}
 	if cfg.Sukebei != nil {
-		i := sukebei.NewClient(cfg.Sukebei, downloaderMap[cfg.Sukebei.Downloader].TorrentsDir(), db, tg)
-		i.RegisterRSSCronjob(cronjob)
+		i := sukebei.NewClient(cfg.Sukebei, db, tg)
+		rssIndexers = append(rssIndexers, i)
 		indexerMap[i.Name()] = i
 	}
 
-	service := handlers.NewService(cfg, db, indexerMap, downloaderMap, oc)
+	rsshelper.RegisterSubscriptionCronjobs(cronjob, db, tg, cfg.Subscriptions)
+
+	service := handlers.NewService(cfg, db, indexerMap, downloaderMap, oc, tg, bus)
+	service.RegisterStalledReplacer(cronjob)
+	for _, i := range rssIndexers {
+		i.RegisterRSSCronjob(cronjob, service)
+	}
+
+	botCtx, stopBot := context.WithCancel(context.Background())
+	defer stopBot()
+	go tg.Start(botCtx, service)
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
@@ -0,0 +1,432 @@
+package aria2
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/autoget-project/autoget/backend/downloaders/common"
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/notify"
+	"github.com/autoget-project/autoget/backend/organizer"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxStopped is the max number of finished downloads to list.
+	maxStopped = 1000
+)
+
+var (
+	httpClient = http.DefaultClient
+
+	statusKeys = []string{"gid", "status", "totalLength", "completedLength", "uploadLength", "dir", "files", "infoHash", "followedBy", "bittorrent", "seeder", "connections"}
+)
+
+// Client talks to aria2 JSON-RPC. Torrents are addressed by info hash, direct
+// links by aria2 GID.
+type Client struct {
+	*common.Downloader
+
+	cfg *config.Aria2Config
+
+	mu     sync.Mutex
+	nextID int
+}
+
+func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, organizerClient *organizer.Client, notifier notify.INotifier) (*Client, error) {
+	c := &Client{
+		cfg: cfg.Aria2,
+	}
+	c.Downloader = common.New(name, c, common.Dirs{
+		TorrentsDir: cfg.Aria2.TorrentsDir,
+		DownloadDir: cfg.Aria2.DownloadDir,
+		FinishedDir: cfg.Aria2.FinishedDir,
+	}, cfg, db, organizerClient, notifier)
+	return c, nil
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+	ID      string `json:"id"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("aria2 error %d: %s", e.Code, e.Message)
+}
+
+func (c *Client) call(ctx context.Context, method string, params []any, out any) error {
+	if c.cfg.Secret != "" {
+		params = append([]any{"token:" + c.cfg.Secret}, params...)
+	}
+	if params == nil {
+		params = []any{}
+	}
+
+	c.mu.Lock()
+	c.nextID++
+	id := strconv.Itoa(c.nextID)
+	c.mu.Unlock()
+
+	body, err := json.Marshal(&rpcRequest{JSONRPC: "2.0", Method: method, Params: params, ID: id})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// aria2 replies errors with 4xx and an error body.
+	r := &rpcResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		return fmt.Errorf("aria2 %s returned %d: %w", method, resp.StatusCode, err)
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(r.Result, out)
+}
+
+// aria2 returns numbers as strings.
+type status struct {
+	GID             string `json:"gid"`
+	Status          string `json:"status"`
+	TotalLength     string `json:"totalLength"`
+	CompletedLength string `json:"completedLength"`
+	UploadLength    string `json:"uploadLength"`
+	Dir             string `json:"dir"`
+	Files           []file `json:"files"`
+	InfoHash        string `json:"infoHash"`
+	// FollowedBy is set on metadata downloads of magnets.
+	FollowedBy []string `json:"followedBy"`
+	BitTorrent *struct {
+		AnnounceList [][]string `json:"announceList"`
+		Info         *struct {
+			Name string `json:"name"`
+		} `json:"info"`
+	} `json:"bittorrent"`
+	Seeder      string `json:"seeder"`
+	Connections string `json:"connections"`
+}
+
+type file struct {
+	Path     string `json:"path"`
+	Selected string `json:"selected"`
+}
+
+type globalStat struct {
+	DownloadSpeed string `json:"downloadSpeed"`
+}
+
+func toInt(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+func toStatus(s *status) common.Status {
+	switch s.Status {
+	case "active":
+		if s.Seeder == "true" {
+			return common.StatusSeeding
+		}
+		return common.StatusDownloading
+	case "paused":
+		return common.StatusStopped
+	case "complete":
+		return common.StatusFinished
+	default:
+		return common.StatusOther
+	}
+}
+
+// gidToID keeps GID in Torrent.ID, GID is a 64 bit number in hex.
+func gidToID(gid string) int64 {
+	n, _ := strconv.ParseUint(gid, 16, 64)
+	return int64(n)
+}
+
+func idToGID(id int64) string {
+	return fmt.Sprintf("%016x", uint64(id))
+}
+
+func toTorrent(s *status) *common.Torrent {
+	t := &common.Torrent{
+		ID:       gidToID(s.GID),
+		Hash:     s.InfoHash,
+		Status:   toStatus(s),
+		Size:     toInt(s.TotalLength),
+		Uploaded: toInt(s.UploadLength),
+		Dir:      s.Dir,
+		Files:    []string{},
+		Peers:    int(toInt(s.Connections)),
+	}
+	if t.Hash == "" {
+		t.Hash = s.GID
+	}
+	if t.Size > 0 {
+		t.Progress = float64(toInt(s.CompletedLength)) / float64(t.Size)
+	}
+
+	for _, f := range s.Files {
+		if f.Selected == "false" || f.Path == "" {
+			continue
+		}
+		rel, err := filepath.Rel(s.Dir, f.Path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = filepath.Base(f.Path)
+		}
+		t.Files = append(t.Files, rel)
+	}
+
+	if s.BitTorrent != nil {
+		for _, tier := range s.BitTorrent.AnnounceList {
+			t.Trackers = append(t.Trackers, tier...)
+		}
+	}
+	if s.BitTorrent != nil && s.BitTorrent.Info != nil {
+		t.Name = s.BitTorrent.Info.Name
+	} else if len(t.Files) > 0 {
+		t.Name = filepath.Base(t.Files[0])
+	}
+	return t
+}
+
+func (c *Client) Torrents(ctx context.Context) ([]*common.Torrent, error) {
+	all := []status{}
+	for _, q := range []struct {
+		method string
+		params []any
+	}{
+		{method: "aria2.tellActive", params: []any{statusKeys}},
+		{method: "aria2.tellWaiting", params: []any{0, maxStopped, statusKeys}},
+		{method: "aria2.tellStopped", params: []any{0, maxStopped, statusKeys}},
+	} {
+		ss := []status{}
+		if err := c.call(ctx, q.method, q.params, &ss); err != nil {
+			return nil, err
+		}
+		all = append(all, ss...)
+	}
+
+	ts := []*common.Torrent{}
+	for _, s := range all {
+		// metadata of magnets, the torrent itself is in FollowedBy.
+		if len(s.FollowedBy) > 0 || s.Status == "removed" {
+			continue
+		}
+		ts = append(ts, toTorrent(&s))
+	}
+	return ts, nil
+}
+
+// Files is a no-op, tell* already returns files.
+func (c *Client) Files(ctx context.Context, t *common.Torrent) error {
+	return nil
+}
+
+func (c *Client) DownloadSpeed(ctx context.Context) (int64, error) {
+	stat := &globalStat{}
+	if err := c.call(ctx, "aria2.getGlobalStat", nil, stat); err != nil {
+		return 0, err
+	}
+	return toInt(stat.DownloadSpeed), nil
+}
+
+func (c *Client) Stop(ctx context.Context, torrents []*common.Torrent) error {
+	for _, t := range torrents {
+		if err := c.call(ctx, "aria2.pause", []any{idToGID(t.ID)}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) Start(ctx context.Context, torrents []*common.Torrent) error {
+	for _, t := range torrents {
+		if err := c.call(ctx, "aria2.unpause", []any{idToGID(t.ID)}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recheck is not supported, aria2 only checks integrity when adding.
+func (c *Client) Recheck(ctx context.Context, torrents []*common.Torrent) error {
+	return common.ErrNotSupported
+}
+
+// Announce is not supported, aria2 has no reannounce.
+func (c *Client) Announce(ctx context.Context, torrents []*common.Torrent) error {
+	return common.ErrNotSupported
+}
+
+// SetLocation is not supported, aria2 doesn't move started downloads.
+func (c *Client) SetLocation(ctx context.Context, torrents []*common.Torrent, dir string) error {
+	return common.ErrNotSupported
+}
+
+// SetSpeedLimits sets global limits, "0" for unlimited.
+func (c *Client) SetSpeedLimits(ctx context.Context, limits *common.SpeedLimits) error {
+	if limits.AltSpeed {
+		return common.ErrNotSupported
+	}
+	return c.call(ctx, "aria2.changeGlobalOption", []any{map[string]string{
+		"max-overall-download-limit": fmt.Sprintf("%dK", limits.DownloadKB),
+		"max-overall-upload-limit":   fmt.Sprintf("%dK", limits.UploadKB),
+	}}, nil)
+}
+
+// Remove removes downloads from aria2, aria2 never deletes data so files
+// are removed here.
+func (c *Client) Remove(ctx context.Context, torrents []*common.Torrent, deleteData bool) error {
+	for _, t := range torrents {
+		gid := idToGID(t.ID)
+		stopped, err := c.stopped(ctx, t)
+		if err != nil {
+			return err
+		}
+		// stopped downloads only have results, others are removed first.
+		if !stopped {
+			if err := c.call(ctx, "aria2.forceRemove", []any{gid}, nil); err != nil {
+				return err
+			}
+		}
+		// a download is stopped shortly after forceRemove, aria2 purges its
+		// result later if it is not yet.
+		if err := c.call(ctx, "aria2.removeDownloadResult", []any{gid}, nil); err != nil && stopped {
+			return err
+		}
+
+		if deleteData {
+			common.RemoveData(t)
+		}
+	}
+	return nil
+}
+
+// stopped tells if t is complete, failed or removed in aria2, asking its
+// status if t doesn't tell it.
+func (c *Client) stopped(ctx context.Context, t *common.Torrent) (bool, error) {
+	switch t.Status {
+	case common.StatusFinished:
+		return true, nil
+	case common.StatusOther:
+		s := &status{}
+		if err := c.call(ctx, "aria2.tellStatus", []any{idToGID(t.ID), []string{"status"}}, s); err != nil {
+			return false, err
+		}
+		return s.Status == "complete" || s.Status == "error" || s.Status == "removed", nil
+	}
+	return false, nil
+}
+
+func (c *Client) options() map[string]string {
+	return map[string]string{"dir": c.cfg.DownloadDir}
+}
+
+// AddTorrentFile adds torrent files dropped in TorrentsDir.
+func (c *Client) AddTorrentFile(ctx context.Context, name string, data []byte) error {
+	return c.call(ctx, "aria2.addTorrent", []any{base64.StdEncoding.EncodeToString(data), []string{}, c.options()}, nil)
+}
+
+// AddURI adds a magnet or a direct link. Magnets are tracked by info hash
+// like torrent files, links by GID.
+func (c *Client) AddURI(ctx context.Context, uri string) (string, error) {
+	id := ""
+	if strings.HasPrefix(uri, "magnet:") {
+		m, err := metainfo.ParseMagnetUri(uri)
+		if err != nil {
+			return "", err
+		}
+		id = m.InfoHash.HexString()
+	}
+
+	gid := ""
+	if err := c.call(ctx, "aria2.addUri", []any{[]string{uri}, c.options()}, &gid); err != nil {
+		return "", err
+	}
+
+	if id == "" {
+		id = gid
+	}
+	return id, nil
+}
+
+// AddTorrent adds the torrent or magnet, high priority ones go to the front
+// of the waiting queue. aria2 has no labels.
+func (c *Client) AddTorrent(ctx context.Context, req *common.AddRequest) (string, error) {
+	hash, err := req.Hash()
+	if err != nil {
+		return "", err
+	}
+
+	options := c.options()
+	if req.Dir != "" {
+		options["dir"] = req.Dir
+	}
+	if req.Paused {
+		options["pause"] = "true"
+	}
+	wanted, err := req.Wanted()
+	if err != nil {
+		return "", err
+	}
+	if wanted != nil {
+		// select-file takes 1 based indexes.
+		selected := []string{}
+		for i, w := range wanted {
+			if w {
+				selected = append(selected, strconv.Itoa(i+1))
+			}
+		}
+		options["select-file"] = strings.Join(selected, ",")
+	}
+
+	params := []any{[]string{req.Magnet}, options}
+	method := "aria2.addUri"
+	if len(req.Torrent) > 0 {
+		params = []any{base64.StdEncoding.EncodeToString(req.Torrent), []string{}, options}
+		method = "aria2.addTorrent"
+	}
+	if req.Priority > common.PriorityNormal {
+		params = append(params, 0)
+	}
+
+	if err := c.call(ctx, method, params, nil); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
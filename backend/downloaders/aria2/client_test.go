@@ -0,0 +1,392 @@
+package aria2
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/autoget-project/autoget/backend/downloaders/common"
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	magnetHash = "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+)
+
+// fake aria2 JSON-RPC
+type fakeAria2 struct {
+	reqs []*rpcRequest
+
+	active  []status
+	waiting []status
+	stopped []status
+	speed   string
+
+	// removeDownloadResult fails for these GIDs, until forceRemove
+	running map[string]bool
+}
+
+func (f *fakeAria2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &rpcRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.reqs = append(f.reqs, req)
+
+	write := func(result any) {
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}
+	writeErr := func(msg string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "error": rpcError{Code: 1, Message: msg}})
+	}
+
+	if len(req.Params) == 0 || req.Params[0] != "token:secret" {
+		writeErr("Unauthorized")
+		return
+	}
+	params := req.Params[1:]
+
+	switch req.Method {
+	case "aria2.tellActive":
+		write(f.active)
+	case "aria2.tellWaiting":
+		write(f.waiting)
+	case "aria2.tellStopped":
+		write(f.stopped)
+	case "aria2.getGlobalStat":
+		write(globalStat{DownloadSpeed: f.speed})
+	case "aria2.addTorrent":
+		write("0000000000000003")
+	case "aria2.addUri":
+		write("0000000000000004")
+	case "aria2.removeDownloadResult":
+		if f.running[params[0].(string)] {
+			writeErr("Could not remove download result")
+			return
+		}
+		write("OK")
+	case "aria2.tellStatus":
+		for _, s := range slices.Concat(f.active, f.waiting, f.stopped) {
+			if s.GID == params[0] {
+				write(status{GID: s.GID, Status: s.Status})
+				return
+			}
+		}
+		writeErr("GID is not found")
+	case "aria2.forceRemove":
+		delete(f.running, params[0].(string))
+		write(params[0])
+	case "aria2.pause", "aria2.unpause", "aria2.changeGlobalOption":
+		write(params[0])
+	default:
+		writeErr("No such method")
+	}
+}
+
+func (f *fakeAria2) methods() []string {
+	methods := []string{}
+	for _, r := range f.reqs {
+		methods = append(methods, r.Method)
+	}
+	return methods
+}
+
+func newFake(t *testing.T) (*fakeAria2, *httptest.Server) {
+	t.Helper()
+
+	fake := &fakeAria2{speed: "0", running: map[string]bool{}}
+	serv := httptest.NewServer(fake)
+	t.Cleanup(serv.Close)
+	return fake, serv
+}
+
+func newConfig(url string) *config.DownloaderConfig {
+	return &config.DownloaderConfig{
+		Aria2: &config.Aria2Config{
+			URL:    url,
+			Secret: "secret",
+		},
+	}
+}
+
+func TestTorrents(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		fake, serv := newFake(t)
+		fake.active = []status{
+			{GID: "0000000000000001", Status: "active", TotalLength: "1000", CompletedLength: "500", Dir: "/dl",
+				InfoHash: "1", Files: []file{{Path: "/dl/show/ep1.mkv", Selected: "true"}, {Path: "/dl/show/skip.txt", Selected: "false"}}},
+			{GID: "0000000000000002", Status: "active", Seeder: "true", TotalLength: "1000", CompletedLength: "1000", UploadLength: "20", Dir: "/dl", InfoHash: "2"},
+		}
+		fake.stopped = []status{
+			{GID: "00000000000000ff", Status: "complete", TotalLength: "10", CompletedLength: "10", Dir: "/dl",
+				Files: []file{{Path: "/dl/file.zip", Selected: "true"}}},
+			// metadata of magnet
+			{GID: "0000000000000005", Status: "complete", InfoHash: "2", FollowedBy: []string{"0000000000000002"}},
+		}
+
+		client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+		require.NoError(t, err)
+
+		torrents, err := client.Torrents(t.Context())
+		require.NoError(t, err)
+		require.Len(t, torrents, 3)
+
+		assert.Equal(t, "1", torrents[0].Hash)
+		assert.Equal(t, int64(1), torrents[0].ID)
+		assert.Equal(t, 0.5, torrents[0].Progress)
+		assert.Equal(t, []string{"show/ep1.mkv"}, torrents[0].Files)
+
+		assert.Equal(t, "2", torrents[1].Hash)
+		assert.Equal(t, int64(20), torrents[1].Uploaded)
+
+		// direct links are addressed by GID.
+		assert.Equal(t, "00000000000000ff", torrents[2].Hash)
+		assert.Equal(t, "file.zip", torrents[2].Name)
+		assert.Equal(t, int64(255), torrents[2].ID)
+
+		fake.speed = "1000000"
+		speed, err := client.DownloadSpeed(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1000*1000), speed)
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		_, serv := newFake(t)
+		conf := newConfig(serv.URL)
+		conf.Aria2.Secret = "wrong"
+
+		client, err := New("test", conf, nil, nil, nil)
+		require.NoError(t, err)
+
+		_, err = client.Torrents(t.Context())
+		assert.EqualError(t, err, "aria2 error 1: Unauthorized")
+	})
+}
+
+func TestAddWatchedFiles(t *testing.T) {
+	fake, serv := newFake(t)
+
+	conf := newConfig(serv.URL)
+	conf.Aria2.DownloadDir = "/downloads"
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, client.AddTorrentFile(t.Context(), "3.torrent", []byte("torrent 3")))
+	// magnets are tracked by info hash, links by GID.
+	id, err := client.AddURI(t.Context(), "magnet:?xt=urn:btih:"+magnetHash)
+	require.NoError(t, err)
+	assert.Equal(t, magnetHash, id)
+	id, err = client.AddURI(t.Context(), "https://example.com/file.zip")
+	require.NoError(t, err)
+	assert.Equal(t, "0000000000000004", id)
+
+	assert.Equal(t, []string{"aria2.addTorrent", "aria2.addUri", "aria2.addUri"}, fake.methods())
+	assert.Equal(t, []any{
+		"token:secret",
+		base64.StdEncoding.EncodeToString([]byte("torrent 3")),
+		[]any{},
+		map[string]any{"dir": "/downloads"},
+	}, fake.reqs[0].Params)
+	assert.Equal(t, []any{"magnet:?xt=urn:btih:" + magnetHash}, fake.reqs[1].Params[1])
+	assert.Equal(t, []any{"https://example.com/file.zip"}, fake.reqs[2].Params[1])
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name    string
+		torrent *common.Torrent
+		waiting []status
+		stopped []status
+		want    []string
+	}{
+		{
+			// removeDownloadResult fails until removed.
+			name:    "paused",
+			torrent: &common.Torrent{ID: 3, Status: common.StatusStopped},
+			waiting: []status{{GID: "0000000000000003", Status: "paused"}},
+			want:    []string{"aria2.forceRemove", "aria2.removeDownloadResult"},
+		},
+		{
+			name:    "complete",
+			torrent: &common.Torrent{ID: 3, Status: common.StatusFinished},
+			stopped: []status{{GID: "0000000000000003", Status: "complete"}},
+			want:    []string{"aria2.removeDownloadResult"},
+		},
+		{
+			name:    "waiting",
+			torrent: &common.Torrent{ID: 3, Status: common.StatusOther},
+			waiting: []status{{GID: "0000000000000003", Status: "waiting"}},
+			want:    []string{"aria2.tellStatus", "aria2.forceRemove", "aria2.removeDownloadResult"},
+		},
+		{
+			name:    "failed",
+			torrent: &common.Torrent{ID: 3, Status: common.StatusOther},
+			stopped: []status{{GID: "0000000000000003", Status: "error"}},
+			want:    []string{"aria2.tellStatus", "aria2.removeDownloadResult"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, serv := newFake(t)
+			fake.waiting, fake.stopped = tt.waiting, tt.stopped
+			if tt.torrent.Status != common.StatusFinished && tt.torrent.Status != common.StatusOther {
+				fake.running["0000000000000003"] = true
+			}
+
+			client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+			require.NoError(t, err)
+
+			require.NoError(t, client.Remove(t.Context(), []*common.Torrent{tt.torrent}, false))
+			assert.Equal(t, tt.want, fake.methods())
+			for _, r := range fake.reqs {
+				assert.Equal(t, "0000000000000003", r.Params[1])
+			}
+		})
+	}
+
+	t.Run("with data", func(t *testing.T) {
+		_, serv := newFake(t)
+		client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+		require.NoError(t, err)
+
+		downloadDir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(downloadDir, "show"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(downloadDir, "show", "ep1.mkv"), []byte("episode 1"), 0644))
+
+		// data is removed by AutoGet, aria2 never deletes it.
+		tr := &common.Torrent{ID: 3, Status: common.StatusFinished, Dir: downloadDir, Files: []string{"show/ep1.mkv"}}
+		require.NoError(t, client.Remove(t.Context(), []*common.Torrent{tr}, true))
+		_, err = os.Stat(filepath.Join(downloadDir, "show"))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestControl(t *testing.T) {
+	fake, serv := newFake(t)
+
+	client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+	require.NoError(t, err)
+
+	// downloads are addressed by GID.
+	torrents := []*common.Torrent{{ID: 255, Hash: "1"}}
+
+	require.NoError(t, client.Stop(t.Context(), torrents))
+	require.NoError(t, client.Start(t.Context(), torrents))
+	assert.Equal(t, []string{"aria2.pause", "aria2.unpause"}, fake.methods())
+	for _, r := range fake.reqs {
+		assert.Equal(t, []any{"token:secret", "00000000000000ff"}, r.Params)
+	}
+
+	assert.ErrorIs(t, client.Recheck(t.Context(), torrents), common.ErrNotSupported)
+	assert.ErrorIs(t, client.Announce(t.Context(), torrents), common.ErrNotSupported)
+	assert.ErrorIs(t, client.SetLocation(t.Context(), torrents, "/downloads/tv"), common.ErrNotSupported)
+}
+
+func TestAddTorrent(t *testing.T) {
+	fake, serv := newFake(t)
+
+	conf := newConfig(serv.URL)
+	conf.Aria2.DownloadDir = "/downloads"
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+
+	magnet := "magnet:?xt=urn:btih:" + magnetHash
+	hash, err := client.AddTorrent(t.Context(), &common.AddRequest{
+		Magnet:   magnet,
+		Dir:      "/downloads/tv",
+		Paused:   true,
+		Priority: common.PriorityHigh,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, magnetHash, hash)
+
+	_, err = client.AddTorrent(t.Context(), &common.AddRequest{Magnet: magnet})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"aria2.addUri", "aria2.addUri"}, fake.methods())
+	assert.Equal(t, []any{
+		"token:secret",
+		[]any{magnet},
+		map[string]any{"dir": "/downloads/tv", "pause": "true"},
+		float64(0),
+	}, fake.reqs[0].Params)
+	assert.Equal(t, []any{
+		"token:secret",
+		[]any{magnet},
+		map[string]any{"dir": "/downloads"},
+	}, fake.reqs[1].Params)
+
+	// broken torrents are rejected before reaching aria2.
+	_, err = client.AddTorrent(t.Context(), &common.AddRequest{Torrent: []byte("broken")})
+	assert.Error(t, err)
+	assert.Len(t, fake.reqs, 2)
+}
+
+// newMultiFileTorrent returns a torrent of show/ep1.mkv, show/Sample/sample.mkv
+// and show/notes.txt.
+func newMultiFileTorrent(t *testing.T) []byte {
+	t.Helper()
+
+	info := metainfo.Info{Name: "show", PieceLength: 16 * 1024, Pieces: make([]byte, 20)}
+	for _, p := range [][]string{{"ep1.mkv"}, {"Sample", "sample.mkv"}, {"notes.txt"}} {
+		info.Files = append(info.Files, metainfo.FileInfo{Path: p, Length: 1})
+	}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+	mi := &metainfo.MetaInfo{InfoBytes: infoBytes}
+
+	data := &bytes.Buffer{}
+	require.NoError(t, mi.Write(data))
+	return data.Bytes()
+}
+
+func TestAddTorrentFileSelection(t *testing.T) {
+	fake, serv := newFake(t)
+
+	conf := newConfig(serv.URL)
+	conf.Aria2.DownloadDir = "/downloads"
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+
+	data := newMultiFileTorrent(t)
+	_, err = client.AddTorrent(t.Context(), &common.AddRequest{Torrent: data, Skip: []string{"sample"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"aria2.addTorrent"}, fake.methods())
+	assert.Equal(t, []any{
+		"token:secret",
+		base64.StdEncoding.EncodeToString(data),
+		[]any{},
+		map[string]any{"dir": "/downloads", "select-file": "1,3"},
+	}, fake.reqs[0].Params)
+}
+
+func TestSetSpeedLimits(t *testing.T) {
+	fake, serv := newFake(t)
+
+	client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, client.SetSpeedLimits(t.Context(), &common.SpeedLimits{UploadKB: 50}))
+	last := fake.reqs[len(fake.reqs)-1]
+	assert.Equal(t, "aria2.changeGlobalOption", last.Method)
+	assert.Equal(t, []any{"token:secret", map[string]any{
+		"max-overall-download-limit": "0K",
+		"max-overall-upload-limit":   "50K",
+	}}, last.Params)
+
+	assert.ErrorIs(t, client.SetSpeedLimits(t.Context(), &common.SpeedLimits{AltSpeed: true}), common.ErrNotSupported)
+}
@@ -0,0 +1,222 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+var (
+	ErrInvalidAddRequest = errors.New("one of torrent or magnet is required")
+	ErrInvalidPriority   = errors.New("priority must be -1, 0 or 1")
+	ErrSelectionMagnet   = errors.New("file selection needs a torrent file")
+	ErrNoFileSelected    = errors.New("no file is selected")
+)
+
+// Bandwidth priority of added torrents, as transmission defines it.
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// AddRequest adds a torrent file or a magnet to the backend. Torrent is
+// parsed once, it is not to be changed after Validate.
+type AddRequest struct {
+	// Torrent is the content of a .torrent file.
+	Torrent []byte
+	Magnet  string
+
+	// Dir overrides the backend's download dir, as the backend sees it.
+	Dir string
+	// Labels are set on backends supporting many labels, backends with a
+	// single label use their configured one, or the first of Labels.
+	Labels []string
+	Paused bool
+	// Priority is the bandwidth priority in the backend.
+	Priority int
+	// QueuePriority orders the download while queued, higher is released
+	// first.
+	QueuePriority int
+
+	// Files are indexes of files in the torrent to download, all files if
+	// empty.
+	Files []int
+	// Skip are patterns of files not to download, matched case insensitive
+	// against the path and each of its parts, e.g. "*.txt" or "sample".
+	Skip []string
+
+	// mi and info are Torrent parsed.
+	mi   *metainfo.MetaInfo
+	info *metainfo.Info
+}
+
+// metaInfo parses Torrent, once.
+func (r *AddRequest) metaInfo() (*metainfo.MetaInfo, *metainfo.Info, error) {
+	if r.mi != nil {
+		return r.mi, r.info, nil
+	}
+	mi, err := metainfo.Load(bytes.NewReader(r.Torrent))
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	r.mi, r.info = mi, &info
+	return r.mi, r.info, nil
+}
+
+func (r *AddRequest) Validate() error {
+	if (len(r.Torrent) == 0) == (r.Magnet == "") {
+		return ErrInvalidAddRequest
+	}
+	if r.Priority < PriorityLow || r.Priority > PriorityHigh {
+		return ErrInvalidPriority
+	}
+	if _, err := r.Wanted(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Wanted tells files in the torrent to download by Files and Skip, in the
+// order of the torrent. It is nil without selection.
+func (r *AddRequest) Wanted() ([]bool, error) {
+	if len(r.Files) == 0 && len(r.Skip) == 0 {
+		return nil, nil
+	}
+	if len(r.Torrent) == 0 {
+		return nil, ErrSelectionMagnet
+	}
+	for _, pattern := range r.Skip {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid skip pattern %q: %w", pattern, err)
+		}
+	}
+
+	_, info, err := r.metaInfo()
+	if err != nil {
+		return nil, err
+	}
+	files := info.UpvertedFiles()
+
+	wanted := make([]bool, len(files))
+	for i := range wanted {
+		wanted[i] = len(r.Files) == 0
+	}
+	for _, i := range r.Files {
+		if i < 0 || i >= len(files) {
+			return nil, fmt.Errorf("file index %d out of range", i)
+		}
+		wanted[i] = true
+	}
+	for i, f := range files {
+		if wanted[i] && skipped(f.DisplayPath(info), r.Skip) {
+			wanted[i] = false
+		}
+	}
+
+	for _, w := range wanted {
+		if w {
+			return wanted, nil
+		}
+	}
+	return nil, ErrNoFileSelected
+}
+
+// skipped tells if p matches one of patterns.
+func skipped(p string, patterns []string) bool {
+	p = strings.ToLower(p)
+	names := append([]string{p}, strings.Split(p, "/")...)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Unwanted returns indexes of files not wanted.
+func Unwanted(wanted []bool) []int {
+	unwanted := []int{}
+	for i, w := range wanted {
+		if !w {
+			unwanted = append(unwanted, i)
+		}
+	}
+	return unwanted
+}
+
+// MetaInfo is Torrent parsed.
+func (r *AddRequest) MetaInfo() (*metainfo.MetaInfo, error) {
+	mi, _, err := r.metaInfo()
+	return mi, err
+}
+
+// size is the length of wanted files of Torrent, 0 for magnets.
+func (r *AddRequest) size() (int64, error) {
+	if len(r.Torrent) == 0 {
+		return 0, nil
+	}
+	_, info, err := r.metaInfo()
+	if err != nil {
+		return 0, err
+	}
+	wanted, err := r.Wanted()
+	if err != nil {
+		return 0, err
+	}
+	size := int64(0)
+	for i, f := range info.UpvertedFiles() {
+		if wanted == nil || wanted[i] {
+			size += f.Length
+		}
+	}
+	return size, nil
+}
+
+// Hash is the lowercase info hash of the torrent or magnet.
+func (r *AddRequest) Hash() (string, error) {
+	if r.Magnet != "" {
+		m, err := metainfo.ParseMagnetUri(r.Magnet)
+		if err != nil {
+			return "", err
+		}
+		return strings.ToLower(m.InfoHash.HexString()), nil
+	}
+
+	mi, _, err := r.metaInfo()
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(mi.HashInfoBytes().HexString()), nil
+}
+
+// Add adds the torrent to the backend and returns its hash.
+func (d *Downloader) Add(req *AddRequest) (string, error) {
+	if err := req.Validate(); err != nil {
+		return "", err
+	}
+	if d.diskSpace != nil {
+		if err := d.CheckDiskSpace(0); err != nil {
+			return "", err
+		}
+	}
+
+	hash, err := d.backend.AddTorrent(context.Background(), req)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to add torrent")
+		return "", err
+	}
+	return hash, nil
+}
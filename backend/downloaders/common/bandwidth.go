@@ -0,0 +1,162 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var ErrInvalidSpeedLimits = errors.New("speed limits can not be negative and override needs a positive duration")
+
+// SpeedLimits are global limits of a backend in KB/s, 0 for unlimited.
+type SpeedLimits struct {
+	UploadKB   int64 `json:"upload_kb"`
+	DownloadKB int64 `json:"download_kb"`
+	// AltSpeed turns on the alternative speed mode of the backend instead.
+	AltSpeed bool `json:"alt_speed"`
+}
+
+// Sources of current speed limits.
+const (
+	// SpeedLimitsDefault are limits of the backend's own settings, never set
+	// by AutoGet.
+	SpeedLimitsDefault = "default"
+	// SpeedLimitsUnlimited are set out of schedule windows, or once an
+	// override ends without schedules. The backend's own limits are not
+	// restored.
+	SpeedLimitsUnlimited = "unlimited"
+	SpeedLimitsSchedule  = "schedule"
+	SpeedLimitsOverride  = "override"
+)
+
+type BandwidthStatus struct {
+	Limits SpeedLimits `json:"limits"`
+	Source string      `json:"source"`
+	// Until is the end of the override.
+	Until *time.Time `json:"until,omitempty"`
+}
+
+type bandwidthState struct {
+	mu            sync.Mutex
+	override      *SpeedLimits
+	overrideUntil time.Time
+	// applied are the last limits set on the backend, nil if never set.
+	applied *SpeedLimits
+}
+
+func (d *Downloader) RegisterBandwidthScheduler(cron *cron.Cron) {
+	jobID, err := cron.AddFunc("* * * * *", func() {
+		d.ApplyBandwidth()
+	})
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to add cron job")
+		return
+	}
+	d.logger.Info().Int64("jobID", int64(jobID)).Msg("added cron job")
+}
+
+// speedLimits resolves limits at now, nil to leave the backend alone. Caller
+// holds d.bandwidth.mu.
+func (d *Downloader) speedLimits(now time.Time) (*SpeedLimits, string) {
+	b := &d.bandwidth
+	if b.override != nil {
+		if now.Before(b.overrideUntil) {
+			return b.override, SpeedLimitsOverride
+		}
+		b.override = nil
+	}
+
+	for _, s := range d.schedules {
+		if s.Contains(now) {
+			return &SpeedLimits{
+				UploadKB:   s.UploadLimitKB,
+				DownloadKB: s.DownloadLimitKB,
+				AltSpeed:   s.AltSpeed,
+			}, SpeedLimitsSchedule
+		}
+	}
+
+	// out of windows, or an override expired without schedules.
+	if len(d.schedules) > 0 || b.applied != nil {
+		return &SpeedLimits{}, SpeedLimitsUnlimited
+	}
+	return nil, SpeedLimitsDefault
+}
+
+// apply sets limits resolved at now on the backend if they changed. Caller
+// holds d.bandwidth.mu.
+func (d *Downloader) apply(now time.Time) error {
+	limits, source := d.speedLimits(now)
+	if limits == nil || (d.bandwidth.applied != nil && *d.bandwidth.applied == *limits) {
+		return nil
+	}
+
+	if err := d.backend.SetSpeedLimits(context.Background(), limits); err != nil {
+		d.logger.Error().Err(err).Msg("failed to set speed limits")
+		return err
+	}
+	d.logger.Info().Str("source", source).Int64("upload_kb", limits.UploadKB).
+		Int64("download_kb", limits.DownloadKB).Bool("alt_speed", limits.AltSpeed).Msg("set speed limits")
+	l := *limits
+	d.bandwidth.applied = &l
+	return nil
+}
+
+// ApplyBandwidth sets limits of the current schedule window or override.
+func (d *Downloader) ApplyBandwidth() {
+	d.bandwidth.mu.Lock()
+	defer d.bandwidth.mu.Unlock()
+
+	d.apply(time.Now())
+}
+
+// BandwidthStatus returns current limits and where they come from.
+func (d *Downloader) BandwidthStatus() *BandwidthStatus {
+	d.bandwidth.mu.Lock()
+	defer d.bandwidth.mu.Unlock()
+
+	limits, source := d.speedLimits(time.Now())
+	status := &BandwidthStatus{Source: source}
+	if limits != nil {
+		status.Limits = *limits
+	}
+	if source == SpeedLimitsOverride {
+		until := d.bandwidth.overrideUntil
+		status.Until = &until
+	}
+	return status
+}
+
+// OverrideSpeedLimits sets limits for duration, over schedules.
+func (d *Downloader) OverrideSpeedLimits(limits *SpeedLimits, duration time.Duration) error {
+	if limits.UploadKB < 0 || limits.DownloadKB < 0 || duration <= 0 {
+		return ErrInvalidSpeedLimits
+	}
+
+	d.bandwidth.mu.Lock()
+	defer d.bandwidth.mu.Unlock()
+
+	prev, prevUntil := d.bandwidth.override, d.bandwidth.overrideUntil
+	now := time.Now()
+	l := *limits
+	d.bandwidth.override = &l
+	d.bandwidth.overrideUntil = now.Add(duration)
+
+	if err := d.apply(now); err != nil {
+		d.bandwidth.override, d.bandwidth.overrideUntil = prev, prevUntil
+		return err
+	}
+	return nil
+}
+
+// ClearSpeedLimitsOverride goes back to schedules.
+func (d *Downloader) ClearSpeedLimitsOverride() error {
+	d.bandwidth.mu.Lock()
+	defer d.bandwidth.mu.Unlock()
+
+	d.bandwidth.override = nil
+	return d.apply(time.Now())
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBandwidthSchedule(t *testing.T) {
+	backend := &fakeBackend{}
+	now := time.Now()
+	downloader, _ := newTestDownloader(t, backend, &config.DownloaderConfig{
+		BandwidthSchedules: []config.BandwidthSchedule{
+			{
+				Start:           now.Add(-time.Hour).Format("15:04"),
+				End:             now.Add(time.Hour).Format("15:04"),
+				UploadLimitKB:   50,
+				DownloadLimitKB: 100,
+			},
+		},
+	}, nil)
+
+	scheduled := &SpeedLimits{UploadKB: 50, DownloadKB: 100}
+
+	downloader.ApplyBandwidth()
+	assert.Equal(t, scheduled, backend.limits)
+	assert.Equal(t, &BandwidthStatus{Limits: *scheduled, Source: SpeedLimitsSchedule}, downloader.BandwidthStatus())
+
+	// unchanged limits are not set again.
+	downloader.ApplyBandwidth()
+	assert.Equal(t, 1, backend.setLimits)
+
+	require.NoError(t, downloader.OverrideSpeedLimits(&SpeedLimits{}, 2*time.Hour))
+	assert.Equal(t, &SpeedLimits{}, backend.limits)
+	status := downloader.BandwidthStatus()
+	assert.Equal(t, SpeedLimitsOverride, status.Source)
+	require.NotNil(t, status.Until)
+	assert.WithinDuration(t, now.Add(2*time.Hour), *status.Until, time.Minute)
+
+	assert.ErrorIs(t, downloader.OverrideSpeedLimits(&SpeedLimits{DownloadKB: -1}, time.Hour), ErrInvalidSpeedLimits)
+	assert.ErrorIs(t, downloader.OverrideSpeedLimits(&SpeedLimits{}, 0), ErrInvalidSpeedLimits)
+	assert.Equal(t, 2, backend.setLimits)
+
+	require.NoError(t, downloader.ClearSpeedLimitsOverride())
+	assert.Equal(t, scheduled, backend.limits)
+	assert.Equal(t, SpeedLimitsSchedule, downloader.BandwidthStatus().Source)
+}
+
+func TestBandwidthWithoutSchedule(t *testing.T) {
+	backend := &fakeBackend{}
+	downloader, _ := newTestDownloader(t, backend, &config.DownloaderConfig{}, nil)
+
+	// limits of the backend itself are left alone.
+	downloader.ApplyBandwidth()
+	assert.Zero(t, backend.setLimits)
+	assert.Equal(t, &BandwidthStatus{Source: SpeedLimitsDefault}, downloader.BandwidthStatus())
+
+	require.NoError(t, downloader.OverrideSpeedLimits(&SpeedLimits{AltSpeed: true}, time.Hour))
+	assert.Equal(t, &SpeedLimits{AltSpeed: true}, backend.limits)
+
+	// unlimited once the override ends, not back to limits of the backend.
+	require.NoError(t, downloader.ClearSpeedLimitsOverride())
+	assert.Equal(t, &SpeedLimits{}, backend.limits)
+	assert.Equal(t, &BandwidthStatus{Source: SpeedLimitsUnlimited}, downloader.BandwidthStatus())
+}
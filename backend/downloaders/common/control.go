@@ -0,0 +1,80 @@
+package common
+
+import (
+	"context"
+
+	"github.com/autoget-project/autoget/backend/internal/db"
+)
+
+// torrent returns the torrent of hash in the backend.
+func (d *Downloader) torrent(hash string) (*Torrent, error) {
+	torrents, err := d.backend.Torrents(context.Background())
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to get all torrents")
+		return nil, err
+	}
+
+	t, ok := toTorrentsByHash(torrents)[hash]
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+	return t, nil
+}
+
+// control runs action on the torrent of hash.
+func (d *Downloader) control(hash, name string, action func(ctx context.Context, torrents []*Torrent) error) (*Torrent, error) {
+	t, err := d.torrent(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := action(context.Background(), []*Torrent{t}); err != nil {
+		d.logger.Error().Err(err).Str("hash", hash).Msgf("failed to %s torrent", name)
+		return nil, err
+	}
+	return t, nil
+}
+
+// Pause stops the torrent until resumed, a paused download done downloading
+// is still transferred and organized, but never removed by seeding checks.
+func (d *Downloader) Pause(hash string) error {
+	if _, err := d.control(hash, "pause", d.backend.Stop); err != nil {
+		return err
+	}
+	return db.UpdateDownloadStateFrom(d.db, hash, []db.DownloadState{db.DownloadStarted, db.DownloadSeeding}, db.DownloadPaused)
+}
+
+// Resume starts the torrent, a paused or stopped download goes back to
+// downloading or seeding by its progress.
+func (d *Downloader) Resume(hash string) error {
+	t, err := d.control(hash, "resume", d.backend.Start)
+	if err != nil {
+		return err
+	}
+
+	state := db.DownloadStarted
+	if t.Progress >= 1 {
+		state = db.DownloadSeeding
+	}
+	return db.UpdateDownloadStateFrom(d.db, hash, []db.DownloadState{db.DownloadPaused, db.DownloadStopped}, state)
+}
+
+// Verify rechecks downloaded data of the torrent.
+func (d *Downloader) Verify(hash string) error {
+	_, err := d.control(hash, "verify", d.backend.Recheck)
+	return err
+}
+
+// Reannounce asks trackers for peers of the torrent now.
+func (d *Downloader) Reannounce(hash string) error {
+	_, err := d.control(hash, "reannounce", d.backend.Announce)
+	return err
+}
+
+// Move moves data of the torrent to dir, as the backend sees it.
+func (d *Downloader) Move(hash, dir string) error {
+	_, err := d.control(hash, "move", func(ctx context.Context, torrents []*Torrent) error {
+		return d.backend.SetLocation(ctx, torrents, dir)
+	})
+	return err
+}
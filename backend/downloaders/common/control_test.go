@@ -0,0 +1,51 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestControl(t *testing.T) {
+	backend := &fakeBackend{torrents: []*Torrent{
+		{Hash: "1", Status: StatusDownloading, Progress: 0.5},
+		{Hash: "2", Status: StatusSeeding, Progress: 1},
+	}}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{}, nil)
+	require.NoError(t, d.Create(&db.DownloadStatus{ID: "1", Downloader: "test", State: db.DownloadStarted}).Error)
+	require.NoError(t, d.Create(&db.DownloadStatus{ID: "2", Downloader: "test", State: db.DownloadSeeding}).Error)
+
+	tests := []struct {
+		name   string
+		action func() error
+		call   string
+		id     string
+		state  db.DownloadState
+	}{
+		{name: "pause", action: func() error { return downloader.Pause("1") }, call: "stop 1", id: "1", state: db.DownloadPaused},
+		{name: "resume", action: func() error { return downloader.Resume("1") }, call: "start 1", id: "1", state: db.DownloadStarted},
+		{name: "verify", action: func() error { return downloader.Verify("1") }, call: "recheck 1", id: "1", state: db.DownloadStarted},
+		{name: "reannounce", action: func() error { return downloader.Reannounce("1") }, call: "announce 1", id: "1", state: db.DownloadStarted},
+		{name: "move", action: func() error { return downloader.Move("1", "/downloads/tv") }, call: "move 1", id: "1", state: db.DownloadStarted},
+		// a seeding download is paused until resumed too.
+		{name: "pause seeding", action: func() error { return downloader.Pause("2") }, call: "stop 2", id: "2", state: db.DownloadPaused},
+		{name: "resume seeding", action: func() error { return downloader.Resume("2") }, call: "start 2", id: "2", state: db.DownloadSeeding},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend.calls = nil
+			require.NoError(t, tt.action())
+			assert.Equal(t, []string{tt.call}, backend.calls)
+
+			r, err := db.GetDownloadStatus(d, tt.id)
+			require.NoError(t, err)
+			assert.Equal(t, tt.state, r.State)
+		})
+	}
+
+	assert.ErrorIs(t, downloader.Pause("3"), ErrTorrentNotFound)
+}
@@ -0,0 +1,153 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+var ErrLowDiskSpace = errors.New("not enough free disk space")
+
+const mb = 1000 * 1000
+
+// DiskUsage of a dir of the downloader, in bytes.
+type DiskUsage struct {
+	// Dir is "download" or "finished".
+	Dir   string `json:"dir"`
+	Path  string `json:"path"`
+	Total uint64 `json:"total"`
+	Free  uint64 `json:"free"`
+	Error string `json:"error,omitempty"`
+
+	// dev tells dirs on the same file system.
+	dev uint64
+}
+
+type DiskStatus struct {
+	Dirs      []DiskUsage `json:"dirs"`
+	MinFreeMB int64       `json:"min_free_mb"`
+	// IntakePaused is set while a dir has less than MinFreeMB free, new
+	// downloads are refused.
+	IntakePaused bool `json:"intake_paused"`
+}
+
+type diskState struct {
+	intakePaused atomic.Bool
+}
+
+func (d *Downloader) minFree() uint64 {
+	if d.diskSpace == nil {
+		return 0
+	}
+	return uint64(d.diskSpace.MinFreeMB) * mb
+}
+
+func (d *Downloader) diskUsage() []DiskUsage {
+	usage := []DiskUsage{
+		{Dir: "download", Path: d.dirs.DownloadDir},
+		{Dir: "finished", Path: d.dirs.FinishedDir},
+	}
+	for i := range usage {
+		u := &usage[i]
+		if err := statDisk(u); err != nil {
+			u.Error = err.Error()
+		}
+	}
+	return usage
+}
+
+// DiskStatus returns usage of download and finished dirs.
+func (d *Downloader) DiskStatus() *DiskStatus {
+	status := &DiskStatus{
+		Dirs:         d.diskUsage(),
+		IntakePaused: d.disk.intakePaused.Load(),
+	}
+	if d.diskSpace != nil {
+		status.MinFreeMB = d.diskSpace.MinFreeMB
+	}
+	return status
+}
+
+// CheckDiskSpace returns ErrLowDiskSpace if a download of size bytes leaves
+// less than the watermark free, counting the transfer to the finished dir if
+// it takes space. Dirs failed to stat are not checked.
+func (d *Downloader) CheckDiskSpace(size int64) error {
+	usage := d.diskUsage()
+
+	need := map[uint64]uint64{}
+	download, finished := &usage[0], &usage[1]
+	if download.Error == "" {
+		need[download.dev] += uint64(max(size, 0))
+	}
+	if finished.Error == "" && (download.Error != "" || d.takesSpace(download, finished)) {
+		need[finished.dev] += uint64(max(size, 0))
+	}
+	for _, u := range usage {
+		if u.Error != "" {
+			d.logger.Warn().Str("dir", u.Path).Str("error", u.Error).Msg("failed to get disk usage")
+			continue
+		}
+		if want := need[u.dev] + d.minFree(); u.Free < want {
+			return fmt.Errorf("%w: %s has %d MB free, needs %d MB", ErrLowDiskSpace, u.Path, u.Free/mb, want/mb)
+		}
+	}
+	return nil
+}
+
+// checkDiskSpace pauses intake while a dir is under the watermark, and
+// notifies when it pauses or resumes.
+func (d *Downloader) checkDiskSpace() {
+	if d.diskSpace == nil {
+		return
+	}
+
+	err := d.CheckDiskSpace(0)
+	paused := err != nil
+	if d.disk.intakePaused.Swap(paused) == paused {
+		return
+	}
+
+	var msg string
+	if paused {
+		d.logger.Warn().Err(err).Msg("low disk space, intake paused")
+		msg = fmt.Sprintf("💾 Low disk space: new downloads of %s are paused, %v.", d.name, err)
+	} else {
+		d.logger.Info().Msg("disk space recovered, intake resumed")
+		msg = fmt.Sprintf("💾 Disk space recovered: new downloads of %s are resumed.", d.name)
+	}
+	if d.notifier == nil {
+		return
+	}
+	if err := d.notifier.SendMessage(msg); err != nil {
+		d.logger.Error().Err(err).Msg("failed to send disk space notification")
+	}
+}
+
+// enoughSpaceToCopy tells if the finished dir has room for files of t, over
+// the watermark.
+func (d *Downloader) enoughSpaceToCopy(t *Torrent) bool {
+	from := DiskUsage{Path: t.Dir}
+	u := DiskUsage{Path: d.dirs.FinishedDir}
+	if statDisk(&from) != nil || statDisk(&u) != nil {
+		// let the transfer report it.
+		return true
+	}
+	if !d.takesSpace(&from, &u) {
+		return true
+	}
+
+	var size uint64
+	for _, name := range t.Files {
+		if fi, err := os.Stat(filepath.Join(t.Dir, name)); err == nil {
+			size += uint64(fi.Size())
+		}
+	}
+	if u.Free < size+d.minFree() {
+		d.logger.Error().Str("hash", t.Hash).Uint64("free_mb", u.Free/mb).Uint64("size_mb", size/mb).Uint64("min_free_mb", d.minFree()/mb).
+			Msg("not enough space in finished dir to copy files")
+		return false
+	}
+	return true
+}
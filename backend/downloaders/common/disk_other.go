@@ -0,0 +1,8 @@
+//go:build !unix
+
+package common
+
+// statDisk is not supported, disk space is not checked.
+func statDisk(u *DiskUsage) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskSpace(t *testing.T) {
+	// busy, skip copying
+	backend := &fakeBackend{speed: 3 * 1000 * 1000}
+	notifier := &fakeNotifier{}
+	cfg := &config.DownloaderConfig{
+		// more than any disk.
+		DiskSpace: &config.DiskSpace{MinFreeMB: 1 << 40},
+	}
+	downloader, d := newTestDownloader(t, backend, cfg, notifier)
+
+	downloader.ProgressChecker()
+	status := downloader.DiskStatus()
+	assert.True(t, status.IntakePaused)
+	require.Len(t, status.Dirs, 2)
+	assert.Equal(t, "download", status.Dirs[0].Dir)
+	assert.Positive(t, status.Dirs[0].Total)
+	require.Len(t, notifier.messages, 1)
+	assert.Contains(t, notifier.messages[0], "new downloads of test are paused")
+
+	_, err := downloader.Add(&AddRequest{Magnet: "magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567"})
+	assert.ErrorIs(t, err, ErrLowDiskSpace)
+	assert.Empty(t, backend.added)
+
+	// notified once.
+	downloader.ProgressChecker()
+	assert.Len(t, notifier.messages, 1)
+
+	cfg.DiskSpace.MinFreeMB = 1
+	downloader.ProgressChecker()
+	assert.False(t, downloader.DiskStatus().IntakePaused)
+	require.Len(t, notifier.messages, 2)
+	assert.Contains(t, notifier.messages[1], "new downloads of test are resumed")
+
+	assert.NoError(t, downloader.CheckDiskSpace(1000))
+	assert.ErrorIs(t, downloader.CheckDiskSpace(1<<62), ErrLowDiskSpace)
+
+	// queued downloads larger than free space are held.
+	data, hash := newTorrentFile(t, "huge", 1<<62)
+	require.NoError(t, d.Create(&db.DownloadStatus{ID: hash, Downloader: "test", State: db.DownloadQueued}).Error)
+	require.NoError(t, db.SaveTorrentFile(d, hash, data))
+
+	downloader.ProgressChecker()
+	assert.Empty(t, backend.added)
+	r, err := db.GetDownloadStatus(d, hash)
+	require.NoError(t, err)
+	assert.Equal(t, db.DownloadQueued, r.State)
+}
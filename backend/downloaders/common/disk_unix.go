@@ -0,0 +1,22 @@
+//go:build unix
+
+package common
+
+import "syscall"
+
+// statDisk fills size, free space and device of u.Path.
+func statDisk(u *DiskUsage) error {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(u.Path, &fs); err != nil {
+		return err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Stat(u.Path, &st); err != nil {
+		return err
+	}
+
+	u.Total = uint64(fs.Blocks) * uint64(fs.Bsize)
+	u.Free = uint64(fs.Bavail) * uint64(fs.Bsize)
+	u.dev = uint64(st.Dev)
+	return nil
+}
@@ -0,0 +1,507 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/events"
+	"github.com/autoget-project/autoget/backend/internal/notify"
+	"github.com/autoget-project/autoget/backend/organizer"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTorrentNotFound = errors.New("torrent not found")
+	ErrNotSupported    = errors.New("not supported by the downloader")
+)
+
+type Status int
+
+const (
+	StatusOther Status = iota
+	StatusDownloading
+	StatusSeeding
+	StatusStopped
+	// StatusFinished is a completed download not seeding, e.g. a direct link.
+	StatusFinished
+)
+
+// Torrent is a torrent reported by the backend.
+type Torrent struct {
+	// ID is for backends not addressing torrents by hash.
+	ID       int64
+	Hash     string
+	Name     string
+	Status   Status
+	Progress float64 // 0 to 1
+	Size     int64
+	Uploaded int64
+	// Trackers are announce urls, for seeding policies by tracker.
+	Trackers []string
+	// Peers connected, -1 if the backend doesn't report it.
+	Peers int
+
+	// Dir is the local directory Files are relative to.
+	Dir   string
+	Files []string
+}
+
+// Backend talks to a downloader, the shared flow lives in Downloader.
+type Backend interface {
+	Torrents(ctx context.Context) ([]*Torrent, error)
+	// Files fills Dir and Files of t, if Torrents doesn't.
+	Files(ctx context.Context, t *Torrent) error
+	// DownloadSpeed in bytes per second.
+	DownloadSpeed(ctx context.Context) (int64, error)
+	Stop(ctx context.Context, torrents []*Torrent) error
+	Remove(ctx context.Context, torrents []*Torrent, deleteData bool) error
+	// AddTorrent returns the lowercase info hash of the added torrent.
+	AddTorrent(ctx context.Context, req *AddRequest) (string, error)
+	// Start resumes stopped torrents.
+	Start(ctx context.Context, torrents []*Torrent) error
+	// Recheck verifies downloaded data.
+	Recheck(ctx context.Context, torrents []*Torrent) error
+	// Announce reannounces to trackers.
+	Announce(ctx context.Context, torrents []*Torrent) error
+	// SetLocation moves data to dir, as the backend sees it.
+	SetLocation(ctx context.Context, torrents []*Torrent, dir string) error
+	// SetSpeedLimits sets global limits of the backend.
+	SetSpeedLimits(ctx context.Context, limits *SpeedLimits) error
+}
+
+type Dirs struct {
+	TorrentsDir string
+	DownloadDir string
+	FinishedDir string
+}
+
+// Downloader tracks torrents of a backend: updates progress, copies finished
+// files, asks organizer for plans and stops seeding by policy.
+type Downloader struct {
+	backend         Backend
+	name            string
+	dirs            Dirs
+	seedingPolicies []config.SeedingPolicy
+	hitAndRun       *config.HitAndRun
+	diskSpace       *config.DiskSpace
+	transferMode    string
+	transferWorkers int
+	postProcessing  *config.PostProcessing
+	maxActive       int
+	stalled         *config.Stalled
+	schedules       []config.BandwidthSchedule
+	db              *gorm.DB
+	organizerClient *organizer.Client
+	notifier        notify.INotifier
+	events          *events.Bus
+	logger          zerolog.Logger
+
+	bandwidth bandwidthState
+	disk      diskState
+	transfers transferJobs
+	// queueMu serializes counting active downloads and adding to the
+	// backend, for max active downloads.
+	queueMu sync.Mutex
+	// postProcessState is of the last post-processing check.
+	postProcessState postProcessState
+	// lastSeedCheck is when seed time was last tracked.
+	lastSeedCheck time.Time
+	// reconciled are orphans found by the last reconciliation.
+	reconciled map[string]bool
+}
+
+func New(name string, backend Backend, dirs Dirs, cfg *config.DownloaderConfig, db *gorm.DB, organizerClient *organizer.Client, notifier notify.INotifier) *Downloader {
+	return &Downloader{
+		backend:         backend,
+		name:            name,
+		dirs:            dirs,
+		seedingPolicies: cfg.Policies(),
+		hitAndRun:       cfg.HitAndRun,
+		diskSpace:       cfg.DiskSpace,
+		transferMode:    cfg.TransferMode,
+		transferWorkers: cfg.PostProcessing.Workers(),
+		postProcessing:  cfg.PostProcessing,
+		maxActive:       cfg.MaxActiveDownloads,
+		stalled:         cfg.Stalled,
+		schedules:       cfg.BandwidthSchedules,
+		db:              db,
+		organizerClient: organizerClient,
+		notifier:        notifier,
+		logger:          log.With().Str("component", "downloader").Str("name", name).Logger(),
+	}
+}
+
+// SetEvents publishes download events to bus.
+func (d *Downloader) SetEvents(bus *events.Bus) {
+	d.events = bus
+}
+
+func (d *Downloader) publish(typ string, id, title string) {
+	d.events.Publish(events.Event{Type: typ, Downloader: d.name, ID: id, Title: title})
+}
+
+func (d *Downloader) RegisterCronjobs(cron *cron.Cron) {
+	d.RegisterDailySeedingChecker(cron)
+	d.RegisterBandwidthScheduler(cron)
+	d.RegisterReconciler(cron)
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			d.ProgressChecker()
+		}
+	}()
+}
+
+func toTorrentsByHash(torrents []*Torrent) map[string]*Torrent {
+	torrentsByHash := make(map[string]*Torrent)
+	for _, t := range torrents {
+		torrentsByHash[t.Hash] = t
+	}
+	return torrentsByHash
+}
+
+func (d *Downloader) ProgressChecker() {
+	d.checkDiskSpace()
+	d.addWatchedFiles()
+
+	torrents, err := d.backend.Torrents(context.Background())
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to get all torrents")
+		return
+	}
+
+	torrentsByHash := toTorrentsByHash(torrents)
+
+	d.updateDownloadProgress(torrentsByHash)
+	d.trackSeedTime(torrentsByHash)
+	d.checkStalled(torrentsByHash)
+	d.releaseQueued()
+
+	// post-processing waits while downloader is actively downloading.
+	speed, err := d.backend.DownloadSpeed(context.Background())
+	if err != nil {
+		d.logger.Err(err).Msg("failed to get download speed")
+	}
+	d.postProcess(torrentsByHash, speed)
+}
+
+func (d *Downloader) updateDownloadProgress(torrentsByHash map[string]*Torrent) {
+	statuses, err := db.GetUnfinishedDownloadStatusByDownloader(d.db, d.name)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to get download status")
+		return
+	}
+
+	now := time.Now()
+	for _, s := range statuses {
+		t, ok := torrentsByHash[s.ID]
+		if !ok {
+			continue
+		}
+
+		progress := uint16(t.Progress * 1000)
+		moved := progress != s.DownloadProgress
+		if moved {
+			d.events.Publish(events.Event{Type: events.DownloadProgress, Downloader: d.name, ID: s.ID, Title: s.ResTitle, Progress: progress})
+		}
+		trackStall(&s, t, moved, now)
+		s.DownloadProgress = progress
+		s.Size = uint64(t.Size)
+		if t.Progress >= 1 && s.CompletedAt == nil {
+			s.CompletedAt = &now
+			d.publish(events.DownloadCompleted, s.ID, s.ResTitle)
+		}
+		switch t.Status {
+		case StatusDownloading:
+			// resumed out of autoget.
+			s.State = db.DownloadStarted
+		case StatusSeeding:
+			s.State = db.DownloadSeeding
+		case StatusFinished:
+			s.State = db.DownloadStopped
+		case StatusStopped:
+			// paused out of autoget, or stopped by the backend once done.
+			// Paused downloads stay paused.
+			if s.State == db.DownloadStarted {
+				s.State = db.DownloadPaused
+				if t.Progress >= 1 {
+					s.State = db.DownloadStopped
+				}
+			}
+		}
+		db.SaveDownloadStatus(d.db, &s)
+	}
+}
+
+// RemoveData removes top level files and dirs of t, with .aria2 control
+// files, for backends not deleting data themselves.
+func RemoveData(t *Torrent) {
+	for _, f := range t.Files {
+		top := strings.Split(filepath.ToSlash(f), "/")[0]
+		path := filepath.Join(t.Dir, top)
+		os.RemoveAll(path)
+		os.Remove(path + ".aria2")
+	}
+}
+
+// createPlans asks organizer for plans of copied downloads, reasons get why
+// downloads not planned wait.
+func (d *Downloader) createPlans(speed int64, now time.Time, reasons map[string]string) {
+	statuses, err := db.GetMovedAndOrganizeStateDownloadStatusByDownloader(d.db, d.name, db.Unplaned)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to get moved & unplaned download status")
+		return
+	}
+
+	for _, st := range statuses {
+		if r := d.waitReason(speed, waitingSince(&st), now); r != "" {
+			reasons[st.ID] = r
+			continue
+		}
+		d.setPlanning(st.ID)
+		d.createPlan(&st)
+		d.setPlanning("")
+	}
+}
+
+func (d *Downloader) createPlan(st *db.DownloadStatus) {
+	resp, err := d.organizerClient.Plan(&organizer.PlanRequest{
+		Dir:      st.ID,
+		Files:    st.FileList,
+		Metadata: st.Metadata,
+	})
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to create organizer plan")
+		st.OrganizeState = db.CreatePlanFailed
+		db.SaveDownloadStatus(d.db, st)
+		d.events.Publish(events.Event{Type: events.DownloadFailed, Downloader: d.name, ID: st.ID, Title: st.ResTitle, Error: "create plan: " + err.Error()})
+		return
+	}
+	st.OrganizePlans = resp
+	st.OrganizeState = db.Planed
+	db.SaveDownloadStatus(d.db, st)
+	d.publish(events.DownloadPlanned, st.ID, st.ResTitle)
+}
+
+func (d *Downloader) RegisterDailySeedingChecker(cron *cron.Cron) {
+	if len(d.seedingPolicies) == 0 {
+		d.logger.Info().Msg("seeding policy is not configured")
+		return
+	}
+
+	jobID, err := cron.AddFunc("0 8 * * *", func() {
+		d.CheckDailySeeding()
+	})
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to add cron job")
+		return
+	}
+	d.logger.Info().Int64("jobID", int64(jobID)).Msg("added cron job")
+}
+
+// CheckDailySeeding stops torrents not uploading enough by the seeding policy
+// and removes stopped torrents already copied.
+func (d *Downloader) CheckDailySeeding() {
+	d.logger.Info().Msg("checking daily seeding")
+
+	torrents, err := d.backend.Torrents(context.Background())
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to get all torrents")
+		return
+	}
+
+	torrentsByHash := toTorrentsByHash(torrents)
+
+	d.stopTorrents(torrents)
+	d.removeTorrents(torrentsByHash)
+}
+
+func (d *Downloader) stopTorrents(torrents []*Torrent) {
+	done := map[string][]*Torrent{}
+
+	for _, t := range torrents {
+		// only check seeding torrents
+		if t.Status != StatusSeeding {
+			continue
+		}
+
+		now := time.Now()
+		ss, err := db.GetDownloadStatus(d.db, t.Hash)
+		if err != nil {
+			// untracked torrents are left to reconciliation.
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				d.logger.Error().Err(err).Str("hash", t.Hash).Msg("failed to get download status")
+			}
+			continue
+		}
+		// resumed out of autoget since the last progress check.
+		if ss.State == db.DownloadPaused {
+			continue
+		}
+		if ss.UploadHistories == nil {
+			ss.UploadHistories = make(map[string]int64)
+		}
+		ss.CleanupHistory()
+		ss.AddToday(t.Uploaded)
+		// seeding before seed time was tracked.
+		if ss.CompletedAt == nil {
+			ss.CompletedAt = &now
+		}
+
+		if err := db.UpdateUploadHistories(d.db, ss); err != nil {
+			d.logger.Error().Err(err).Str("hash", t.Hash).Msg("failed to save upload history")
+		}
+
+		p := d.seedingPolicy(t, ss)
+		if p == nil || !doneSeeding(p, t, ss, now) {
+			continue
+		}
+		if d.protected(ss, t) {
+			d.logger.Info().Str("hash", t.Hash).Msg("keep seeding for hit-and-run")
+			continue
+		}
+
+		action := p.Action
+		if action == "" {
+			action = config.SeedingActionStop
+		}
+		// removing waits for files copied to finished dir.
+		if action != config.SeedingActionStop && ss.MoveState < db.Moved {
+			continue
+		}
+		done[action] = append(done[action], t)
+	}
+
+	d.finishSeeding(done[config.SeedingActionStop], db.DownloadStopped, d.backend.Stop)
+	d.finishSeeding(done[config.SeedingActionRemove], db.DownloadDeleted, func(ctx context.Context, torrents []*Torrent) error {
+		return d.backend.Remove(ctx, torrents, false)
+	})
+	d.finishSeeding(done[config.SeedingActionRemoveData], db.DownloadDeleted, func(ctx context.Context, torrents []*Torrent) error {
+		return d.backend.Remove(ctx, torrents, true)
+	})
+}
+
+// finishSeeding runs action on torrents done seeding and moves them to state.
+func (d *Downloader) finishSeeding(torrents []*Torrent, state db.DownloadState, action func(ctx context.Context, torrents []*Torrent) error) {
+	// nothing to do
+	if len(torrents) == 0 {
+		return
+	}
+
+	if err := action(context.Background(), torrents); err != nil {
+		d.logger.Error().Err(err).Msg("failed to finish seeding torrents")
+		return
+	}
+
+	ids := []string{}
+	for _, t := range torrents {
+		ids = append(ids, t.Hash)
+	}
+	// update state in db
+	if err := db.UpdateDownloadStateForStatuses(d.db, ids, state); err != nil {
+		d.logger.Error().Err(err).Msg("failed to update download status")
+		return
+	}
+	if state == db.DownloadDeleted {
+		for _, t := range torrents {
+			d.publish(events.DownloadDeleted, t.Hash, t.Name)
+		}
+	}
+}
+
+func (d *Downloader) removeTorrents(torrentsByHash map[string]*Torrent) {
+	statuses, err := db.GetStoppedMovedDownloadStatusByDownloader(d.db, d.name)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to get stopped download status")
+		return
+	}
+
+	deleteStatusIDs := []string{}
+	deleteTorrents := []*Torrent{}
+	for _, s := range statuses {
+		t, ok := torrentsByHash[s.ID]
+		if !ok || d.protected(&s, t) {
+			continue
+		}
+
+		deleteTorrents = append(deleteTorrents, t)
+		deleteStatusIDs = append(deleteStatusIDs, s.ID)
+	}
+
+	// nothing to delete
+	if len(deleteTorrents) == 0 {
+		return
+	}
+
+	// delete torrents
+	if err := d.backend.Remove(context.Background(), deleteTorrents, true); err != nil {
+		d.logger.Error().Err(err).Msg("failed to delete torrents")
+		return
+	}
+
+	if err := db.UpdateDownloadStateForStatuses(d.db, deleteStatusIDs, db.DownloadDeleted); err != nil {
+		d.logger.Error().Err(err).Msg("failed to update download status")
+		return
+	}
+	for _, t := range deleteTorrents {
+		d.publish(events.DownloadDeleted, t.Hash, t.Name)
+	}
+}
+
+func (d *Downloader) TorrentsDir() string {
+	return d.dirs.TorrentsDir
+}
+
+func (d *Downloader) DownloadDir() string {
+	return d.dirs.DownloadDir
+}
+
+// DeleteTorrent removes the torrent with data, torrents protected from
+// hit-and-run are kept unless force.
+func (d *Downloader) DeleteTorrent(hash string, force bool) error {
+	// queued downloads are not in the backend yet.
+	if s, err := db.GetDownloadStatus(d.db, hash); err == nil && s.State == db.DownloadQueued {
+		if err := db.UpdateDownloadStateForStatuses(d.db, []string{hash}, db.DownloadDeleted); err != nil {
+			return err
+		}
+		d.publish(events.DownloadDeleted, hash, s.ResTitle)
+		return nil
+	}
+
+	t, err := d.torrent(hash)
+	if err != nil {
+		return err
+	}
+
+	if !force {
+		if s, err := db.GetDownloadStatus(d.db, hash); err == nil && d.protected(s, t) {
+			return ErrHitAndRun
+		}
+	}
+
+	if err := d.backend.Remove(context.Background(), []*Torrent{t}, true); err != nil {
+		d.logger.Error().Err(err).Str("hash", hash).Msg("failed to delete torrent")
+		return err
+	}
+
+	// Update the download status in database
+	if err := db.UpdateDownloadStateForStatuses(d.db, []string{hash}, db.DownloadDeleted); err != nil {
+		d.logger.Error().Err(err).Str("hash", hash).Msg("failed to update download status")
+		return err
+	}
+
+	d.logger.Info().Str("hash", hash).Msg("successfully deleted torrent")
+	d.publish(events.DownloadDeleted, hash, t.Name)
+	return nil
+}
@@ -0,0 +1,358 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/events"
+	"github.com/autoget-project/autoget/backend/internal/notify"
+	"github.com/autoget-project/autoget/backend/organizer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// fakeBackend keeps torrents in memory, calls are recorded as "method hash",
+// removing with data as "delete hash".
+type fakeBackend struct {
+	mu       sync.Mutex
+	torrents []*Torrent
+	speed    int64
+	// limits are the last set, setLimits counts them.
+	limits    *SpeedLimits
+	setLimits int
+	calls     []string
+	// added are torrents added by AddTorrent, addErr fails it.
+	added  []*AddRequest
+	addErr error
+}
+
+func (f *fakeBackend) record(method string, torrents []*Torrent) {
+	for _, t := range torrents {
+		f.calls = append(f.calls, method+" "+t.Hash)
+	}
+}
+
+func (f *fakeBackend) Torrents(ctx context.Context) ([]*Torrent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	torrents := []*Torrent{}
+	for _, t := range f.torrents {
+		c := *t
+		torrents = append(torrents, &c)
+	}
+	return torrents, nil
+}
+
+func (f *fakeBackend) Files(ctx context.Context, t *Torrent) error {
+	return nil
+}
+
+func (f *fakeBackend) DownloadSpeed(ctx context.Context) (int64, error) {
+	return f.speed, nil
+}
+
+// set sets status of torrents in the backend.
+func (f *fakeBackend) set(torrents []*Torrent, status func(t *Torrent) Status) {
+	for _, t := range torrents {
+		for _, ft := range f.torrents {
+			if ft.Hash == t.Hash {
+				ft.Status = status(ft)
+			}
+		}
+	}
+}
+
+func (f *fakeBackend) Stop(ctx context.Context, torrents []*Torrent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("stop", torrents)
+	f.set(torrents, func(*Torrent) Status { return StatusStopped })
+	return nil
+}
+
+func (f *fakeBackend) Start(ctx context.Context, torrents []*Torrent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("start", torrents)
+	f.set(torrents, func(t *Torrent) Status {
+		if t.Progress >= 1 {
+			return StatusSeeding
+		}
+		return StatusDownloading
+	})
+	return nil
+}
+
+func (f *fakeBackend) Remove(ctx context.Context, torrents []*Torrent, deleteData bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if deleteData {
+		f.record("delete", torrents)
+	} else {
+		f.record("remove", torrents)
+	}
+	for _, t := range torrents {
+		f.torrents = slices.DeleteFunc(f.torrents, func(ft *Torrent) bool { return ft.Hash == t.Hash })
+		if deleteData {
+			RemoveData(t)
+		}
+	}
+	return nil
+}
+
+func (f *fakeBackend) AddTorrent(ctx context.Context, req *AddRequest) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.addErr != nil {
+		return "", f.addErr
+	}
+	hash, err := req.Hash()
+	if err != nil {
+		return "", err
+	}
+	f.added = append(f.added, req)
+	f.torrents = append(f.torrents, &Torrent{Hash: hash, Status: StatusDownloading, Peers: -1})
+	return hash, nil
+}
+
+func (f *fakeBackend) Recheck(ctx context.Context, torrents []*Torrent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("recheck", torrents)
+	return nil
+}
+
+func (f *fakeBackend) Announce(ctx context.Context, torrents []*Torrent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("announce", torrents)
+	return nil
+}
+
+func (f *fakeBackend) SetLocation(ctx context.Context, torrents []*Torrent, dir string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("move", torrents)
+	for _, t := range torrents {
+		for _, ft := range f.torrents {
+			if ft.Hash == t.Hash {
+				ft.Dir = dir
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fakeBackend) SetSpeedLimits(ctx context.Context, limits *SpeedLimits) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.limits = limits
+	f.setLimits++
+	return nil
+}
+
+type fakeNotifier struct {
+	messages []string
+}
+
+func (f *fakeNotifier) SendMessage(message string) error {
+	f.messages = append(f.messages, message)
+	return nil
+}
+
+func (f *fakeNotifier) SendMarkdownMessage(message string) error {
+	f.messages = append(f.messages, message)
+	return nil
+}
+
+func (f *fakeNotifier) SendRSSMatch(match *notify.RSSMatch) error {
+	return nil
+}
+
+// newTorrentFile returns a torrent of a single file, with its hash.
+func newTorrentFile(t *testing.T, name string, length int64) ([]byte, string) {
+	t.Helper()
+
+	info := metainfo.Info{Name: name, PieceLength: 16 * 1024, Pieces: make([]byte, 20), Length: length}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+	mi := &metainfo.MetaInfo{InfoBytes: infoBytes}
+
+	data := &bytes.Buffer{}
+	require.NoError(t, mi.Write(data))
+	return data.Bytes(), mi.HashInfoBytes().HexString()
+}
+
+// newTestDownloader returns a downloader of backend named test, with its db
+// and an organizer planning nothing.
+func newTestDownloader(t *testing.T, backend Backend, cfg *config.DownloaderConfig, notifier notify.INotifier) (*Downloader, *gorm.DB) {
+	t.Helper()
+
+	d, err := db.SqliteForTest()
+	require.NoError(t, err)
+
+	organizerServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(organizer.PlanResponse{})
+	}))
+	t.Cleanup(organizerServ.Close)
+	organizerClient, err := organizer.NewClient(organizerServ.URL, nil)
+	require.NoError(t, err)
+
+	dirs := Dirs{DownloadDir: t.TempDir(), FinishedDir: t.TempDir()}
+	return New("test", backend, dirs, cfg, d, organizerClient, notifier), d
+}
+
+func TestPausedDownloadKept(t *testing.T) {
+	backend := &fakeBackend{}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{
+		// done seeding long ago, by any measure.
+		SeedingPolicy: &config.SeedingPolicy{MaxSeedHours: 1, Action: config.SeedingActionRemoveData},
+	}, nil)
+
+	completedAt := time.Now().AddDate(0, 0, -2)
+	for _, hash := range []string{"paused", "seeding"} {
+		require.NoError(t, os.WriteFile(filepath.Join(downloader.dirs.DownloadDir, hash+".mkv"), []byte(hash), 0644))
+		backend.torrents = append(backend.torrents, &Torrent{
+			Hash: hash, Status: StatusSeeding, Progress: 1,
+			Dir: downloader.dirs.DownloadDir, Files: []string{hash + ".mkv"},
+		})
+		require.NoError(t, d.Create(&db.DownloadStatus{
+			ID: hash, Downloader: "test", State: db.DownloadSeeding, MoveState: db.Moved, CompletedAt: &completedAt,
+		}).Error)
+	}
+
+	require.NoError(t, downloader.Pause("paused"))
+	r, err := db.GetDownloadStatus(d, "paused")
+	require.NoError(t, err)
+	assert.Equal(t, db.DownloadPaused, r.State)
+
+	downloader.ProgressChecker()
+	downloader.CheckDailySeeding()
+
+	// only the seeding one is removed.
+	assert.Equal(t, []string{"stop paused", "delete seeding"}, backend.calls)
+	assert.FileExists(t, filepath.Join(downloader.dirs.DownloadDir, "paused.mkv"))
+	assert.NoFileExists(t, filepath.Join(downloader.dirs.DownloadDir, "seeding.mkv"))
+	r, err = db.GetDownloadStatus(d, "paused")
+	require.NoError(t, err)
+	assert.Equal(t, db.DownloadPaused, r.State)
+}
+
+func TestPausedDownloadTransferred(t *testing.T) {
+	backend := &fakeBackend{}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{}, nil)
+
+	require.NoError(t, os.WriteFile(filepath.Join(downloader.dirs.DownloadDir, "ep1.mkv"), []byte("ep1"), 0644))
+	backend.torrents = []*Torrent{{
+		Hash: "1", Status: StatusStopped, Progress: 1,
+		Dir: downloader.dirs.DownloadDir, Files: []string{"ep1.mkv"},
+	}}
+	// paused before done, done since.
+	require.NoError(t, d.Create(&db.DownloadStatus{ID: "1", Downloader: "test", State: db.DownloadPaused}).Error)
+
+	downloader.ProgressChecker()
+	downloader.WaitTransfers()
+
+	r, err := db.GetDownloadStatus(d, "1")
+	require.NoError(t, err)
+	assert.Equal(t, db.DownloadPaused, r.State)
+	assert.NotNil(t, r.CompletedAt)
+	assert.Equal(t, db.Moved, r.MoveState)
+	assert.FileExists(t, filepath.Join(downloader.dirs.FinishedDir, "1", "ep1.mkv"))
+}
+
+func TestProgressCheckerSyncsPausedState(t *testing.T) {
+	backend := &fakeBackend{
+		torrents: []*Torrent{
+			// paused out of autoget
+			{Hash: "1", Status: StatusStopped, Progress: 0.5},
+			// resumed out of autoget
+			{Hash: "2", Status: StatusDownloading, Progress: 0.5},
+			// stopped after done
+			{Hash: "3", Status: StatusStopped, Progress: 1},
+			// paused after done, stays paused
+			{Hash: "4", Status: StatusStopped, Progress: 1},
+			// still paused
+			{Hash: "5", Status: StatusStopped, Progress: 0.5},
+		},
+		// busy, skip copying
+		speed: 3 * 1000 * 1000,
+	}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{}, nil)
+	for id, state := range map[string]db.DownloadState{
+		"1": db.DownloadStarted,
+		"2": db.DownloadPaused,
+		"3": db.DownloadStarted,
+		"4": db.DownloadPaused,
+		"5": db.DownloadPaused,
+	} {
+		require.NoError(t, d.Create(&db.DownloadStatus{ID: id, Downloader: "test", State: state}).Error)
+	}
+
+	downloader.ProgressChecker()
+
+	want := map[string]db.DownloadState{
+		"1": db.DownloadPaused,
+		"2": db.DownloadStarted,
+		"3": db.DownloadStopped,
+		"4": db.DownloadPaused,
+		"5": db.DownloadPaused,
+	}
+	for id, state := range want {
+		r, err := db.GetDownloadStatus(d, id)
+		require.NoError(t, err)
+		assert.Equal(t, state, r.State, id)
+		// seed time starts once done.
+		assert.Equal(t, id == "3" || id == "4", r.CompletedAt != nil, id)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	backend := &fakeBackend{
+		torrents: []*Torrent{
+			{Hash: "1", Status: StatusDownloading, Progress: 0.5},
+			{Hash: "2", Status: StatusSeeding, Progress: 1},
+			// unchanged progress
+			{Hash: "3", Status: StatusDownloading, Progress: 0.5},
+		},
+		// busy, skip copying
+		speed: 3 * 1000 * 1000,
+	}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{}, nil)
+	require.NoError(t, d.Create(&db.DownloadStatus{ID: "1", Downloader: "test", State: db.DownloadStarted, ResTitle: "Show"}).Error)
+	require.NoError(t, d.Create(&db.DownloadStatus{ID: "2", Downloader: "test", State: db.DownloadStarted, ResTitle: "Movie"}).Error)
+	require.NoError(t, d.Create(&db.DownloadStatus{ID: "3", Downloader: "test", State: db.DownloadStarted, DownloadProgress: 500}).Error)
+
+	bus := events.NewBus()
+	downloader.SetEvents(bus)
+	ch, cancel := bus.Subscribe("test")
+	defer cancel()
+
+	downloader.ProgressChecker()
+
+	got := []events.Event{}
+	for len(ch) > 0 {
+		e := <-ch
+		e.Time = time.Time{}
+		got = append(got, e)
+	}
+	assert.ElementsMatch(t, []events.Event{
+		{Type: events.DownloadProgress, Downloader: "test", ID: "1", Title: "Show", Progress: 500},
+		{Type: events.DownloadProgress, Downloader: "test", ID: "2", Title: "Movie", Progress: 1000},
+		{Type: events.DownloadCompleted, Downloader: "test", ID: "2", Title: "Movie"},
+	}, got)
+}
@@ -0,0 +1,84 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/internal/db"
+)
+
+var ErrHitAndRun = errors.New("torrent has not seeded enough for hit-and-run rules")
+
+// maxSeedCheckInterval caps seed time added by a check, time the service was
+// down is not counted.
+const maxSeedCheckInterval = 5 * time.Minute
+
+// protected tells if stopping or removing the completed download of a
+// private indexer risks hit-and-run. t is nil if not in the backend.
+func (d *Downloader) protected(s *db.DownloadStatus, t *Torrent) bool {
+	if d.hitAndRun == nil || !s.Private || s.CompletedAt == nil {
+		return false
+	}
+	if s.SeedTime >= time.Duration(d.hitAndRun.MinSeedHours)*time.Hour {
+		return false
+	}
+	if d.hitAndRun.MinRatio > 0 && t != nil && t.Size > 0 && float64(t.Uploaded)/float64(t.Size) >= d.hitAndRun.MinRatio {
+		return false
+	}
+	return true
+}
+
+// trackSeedTime adds seed time to private downloads seeding since the last
+// check, and notifies ones not seeding before they are safe from
+// hit-and-run.
+func (d *Downloader) trackSeedTime(torrentsByHash map[string]*Torrent) {
+	if d.hitAndRun == nil {
+		return
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(d.lastSeedCheck)
+	if d.lastSeedCheck.IsZero() || elapsed > maxSeedCheckInterval {
+		elapsed = 0
+	}
+	d.lastSeedCheck = now
+
+	statuses, err := db.GetPrivateCompletedDownloadStatusByDownloader(d.db, d.name)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to get private download status")
+		return
+	}
+
+	for _, s := range statuses {
+		t := torrentsByHash[s.ID]
+		seeding := t != nil && t.Status == StatusSeeding
+		if seeding {
+			s.SeedTime += elapsed
+		}
+
+		switch {
+		case seeding:
+			s.HitAndRunNotified = false
+		case !s.HitAndRunNotified && d.protected(&s, t):
+			d.notifyHitAndRun(&s)
+			s.HitAndRunNotified = true
+		}
+		if err := db.UpdateSeedTime(d.db, &s); err != nil {
+			d.logger.Error().Err(err).Str("hash", s.ID).Msg("failed to save seed time")
+		}
+	}
+}
+
+func (d *Downloader) notifyHitAndRun(s *db.DownloadStatus) {
+	d.logger.Warn().Str("hash", s.ID).Dur("seed_time", s.SeedTime).Msg("torrent at risk of hit-and-run")
+	if d.notifier == nil {
+		return
+	}
+
+	msg := fmt.Sprintf("⚠️ Hit-and-run risk: %s from %s is not seeding in %s, seeded %s of %dh.",
+		s.ResTitle, s.ResIndexer, d.name, s.SeedTime.Round(time.Minute), d.hitAndRun.MinSeedHours)
+	if err := d.notifier.SendMessage(msg); err != nil {
+		d.logger.Error().Err(err).Msg("failed to send hit-and-run notification")
+	}
+}
@@ -0,0 +1,108 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHitAndRun(t *testing.T) {
+	backend := &fakeBackend{torrents: []*Torrent{
+		{Hash: "1", Status: StatusSeeding, Progress: 1, Size: 8000, Uploaded: 100},
+		{Hash: "2", Status: StatusSeeding, Progress: 1, Size: 8000, Uploaded: 100},
+		{Hash: "3", Status: StatusSeeding, Progress: 1, Size: 8000, Uploaded: 16000},
+		{Hash: "4", Status: StatusSeeding, Progress: 1, Size: 8000, Uploaded: 100},
+	}}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{
+		SeedingPolicy: &config.SeedingPolicy{
+			IntervalInDays:    3,
+			UploadAtLeastInMB: 1,
+		},
+		HitAndRun: &config.HitAndRun{MinSeedHours: 72, MinRatio: 2},
+	}, nil)
+
+	completedAt := time.Now().AddDate(0, 0, -5)
+	threeDaysAgo := time.Now().AddDate(0, 0, -3).Format("2006-01-02")
+	statuses := []*db.DownloadStatus{
+		// private seeded 10 hours, protected.
+		{ID: "1", Private: true, SeedTime: 10 * time.Hour},
+		// private seeded 80 hours, stopped.
+		{ID: "2", Private: true, SeedTime: 80 * time.Hour},
+		// private seeded 10 hours with ratio 2, stopped.
+		{ID: "3", Private: true, SeedTime: 10 * time.Hour},
+		// public, stopped.
+		{ID: "4"},
+	}
+	for _, s := range statuses {
+		s.Downloader = "test"
+		s.State = db.DownloadSeeding
+		s.CompletedAt = &completedAt
+		s.UploadHistories = map[string]int64{threeDaysAgo: 0}
+		require.NoError(t, d.Create(s).Error)
+	}
+
+	downloader.CheckDailySeeding()
+	assert.Equal(t, []string{"stop 2", "stop 3", "stop 4"}, backend.calls)
+
+	backend.calls = nil
+	assert.ErrorIs(t, downloader.DeleteTorrent("1", false), ErrHitAndRun)
+	assert.Empty(t, backend.calls)
+
+	require.NoError(t, downloader.DeleteTorrent("1", true))
+	assert.Equal(t, []string{"delete 1"}, backend.calls)
+}
+
+func TestTrackSeedTime(t *testing.T) {
+	backend := &fakeBackend{
+		torrents: []*Torrent{
+			{Hash: "1", Status: StatusSeeding, Progress: 1},
+			{Hash: "2", Status: StatusStopped, Progress: 1},
+			{Hash: "3", Status: StatusStopped, Progress: 1},
+		},
+		// busy, skip copying
+		speed: 3 * 1000 * 1000,
+	}
+	notifier := &fakeNotifier{}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{
+		HitAndRun: &config.HitAndRun{MinSeedHours: 72},
+		// no forced post-processing of downloads done a day ago.
+		PostProcessing: &config.PostProcessing{MaxWaitMinutes: -1},
+	}, notifier)
+
+	completedAt := time.Now().AddDate(0, 0, -1)
+	for _, s := range []*db.DownloadStatus{
+		// seeding.
+		{ID: "1", Private: true},
+		// stopped out of autoget before seeding enough.
+		{ID: "2", Private: true, ResTitle: "Movie", ResIndexer: "m-team"},
+		// public.
+		{ID: "3"},
+	} {
+		s.Downloader = "test"
+		s.State = db.DownloadSeeding
+		s.CompletedAt = &completedAt
+		require.NoError(t, d.Create(s).Error)
+	}
+
+	downloader.ProgressChecker()
+	time.Sleep(10 * time.Millisecond)
+	downloader.ProgressChecker()
+
+	r, err := db.GetDownloadStatus(d, "1")
+	require.NoError(t, err)
+	assert.Positive(t, r.SeedTime)
+	assert.False(t, r.HitAndRunNotified)
+
+	r, err = db.GetDownloadStatus(d, "2")
+	require.NoError(t, err)
+	assert.Zero(t, r.SeedTime)
+	assert.True(t, r.HitAndRunNotified)
+
+	// notified once.
+	require.Len(t, notifier.messages, 1)
+	assert.Contains(t, notifier.messages[0], "Movie from m-team is not seeding in test")
+}
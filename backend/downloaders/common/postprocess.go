@@ -0,0 +1,160 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/internal/db"
+)
+
+// Stages of post-processing a finished download.
+const (
+	StageTransfer = "transfer"
+	StagePlan     = "plan"
+)
+
+// States of a download in post-processing.
+const (
+	PostProcessWaiting = "waiting"
+	PostProcessQueued  = "queued"
+	PostProcessRunning = "running"
+)
+
+// PostProcessItem is a finished download not post-processed yet.
+type PostProcessItem struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Stage string `json:"stage"`
+	State string `json:"state"`
+	// Reason tells why a waiting download waits.
+	Reason string `json:"reason,omitempty"`
+	// Since is when the download waits from, its completion.
+	Since time.Time `json:"since"`
+}
+
+// PostProcessStatus is the post-processing queue of a downloader.
+type PostProcessStatus struct {
+	// TransferWorkers run transfers in parallel, plans are made one at a time.
+	TransferWorkers int `json:"transfer_workers"`
+	// Speed is the download speed of the last check, in bytes per second.
+	Speed int64 `json:"speed"`
+	// BusySpeed is the speed post-processing waits over, 0 for never.
+	BusySpeed int64 `json:"busy_speed"`
+	InWindow  bool  `json:"in_window"`
+	// MaxWaitMinutes forces waiting downloads, 0 for never.
+	MaxWaitMinutes int               `json:"max_wait_minutes"`
+	Items          []PostProcessItem `json:"items"`
+}
+
+type postProcessState struct {
+	mu    sync.Mutex
+	speed int64
+	// reasons of waiting downloads by ID, of the last check.
+	reasons map[string]string
+	// planning is the ID of the download asking organizer for a plan.
+	planning string
+}
+
+func (d *Downloader) setPlanning(id string) {
+	d.postProcessState.mu.Lock()
+	d.postProcessState.planning = id
+	d.postProcessState.mu.Unlock()
+}
+
+// waitingSince returns when post-processing of s waits from.
+func waitingSince(s *db.DownloadStatus) time.Time {
+	if s.CompletedAt != nil {
+		return *s.CompletedAt
+	}
+	return s.CreatedAt
+}
+
+// waitReason tells why post-processing of a download waiting since waits at
+// download speed, empty if it can go on. A busy downloader holds it, except
+// in IO windows or after the max wait.
+func (d *Downloader) waitReason(speed int64, since, now time.Time) string {
+	busy := d.postProcessing.BusySpeed()
+	if busy == 0 || speed <= busy || d.postProcessing.InWindow(now) {
+		return ""
+	}
+	maxWait := d.postProcessing.MaxWait()
+	if maxWait > 0 && now.Sub(since) >= maxWait {
+		return ""
+	}
+	reason := fmt.Sprintf("downloader busy at %.1f MB/s, over %d MB/s", float64(speed)/mb, busy/mb)
+	if maxWait > 0 {
+		reason += fmt.Sprintf(", forced at %s", since.Add(maxWait).Format(time.DateTime))
+	}
+	return reason
+}
+
+// postProcess queues transfers of finished downloads and plans of moved
+// ones, unless they have to wait.
+func (d *Downloader) postProcess(torrentsByHash map[string]*Torrent, speed int64) {
+	now := time.Now()
+	reasons := map[string]string{}
+
+	d.copyFinishedDownloads(torrentsByHash, speed, now, reasons)
+	d.createPlans(speed, now, reasons)
+
+	d.postProcessState.mu.Lock()
+	d.postProcessState.speed = speed
+	d.postProcessState.reasons = reasons
+	d.postProcessState.mu.Unlock()
+}
+
+// PostProcessStatus lists downloads waiting for or in post-processing.
+func (d *Downloader) PostProcessStatus() (*PostProcessStatus, error) {
+	transfers, err := db.GetFinishedUnmoveedDownloadStatusByDownloader(d.db, d.name)
+	if err != nil {
+		return nil, err
+	}
+	plans, err := db.GetMovedAndOrganizeStateDownloadStatusByDownloader(d.db, d.name, db.Unplaned)
+	if err != nil {
+		return nil, err
+	}
+
+	d.postProcessState.mu.Lock()
+	defer d.postProcessState.mu.Unlock()
+
+	status := &PostProcessStatus{
+		TransferWorkers: d.transferWorkers,
+		Speed:           d.postProcessState.speed,
+		BusySpeed:       d.postProcessing.BusySpeed(),
+		InWindow:        d.postProcessing.InWindow(time.Now()),
+		MaxWaitMinutes:  int(d.postProcessing.MaxWait() / time.Minute),
+		Items:           []PostProcessItem{},
+	}
+	item := func(s *db.DownloadStatus, stage, state string) {
+		it := PostProcessItem{
+			ID:    s.ID,
+			Title: s.ResTitle,
+			Stage: stage,
+			State: state,
+			Since: waitingSince(s),
+		}
+		if state == PostProcessWaiting {
+			it.Reason = d.postProcessState.reasons[s.ID]
+			if it.Reason == "" {
+				it.Reason = "waiting for the next check"
+			}
+		}
+		status.Items = append(status.Items, it)
+	}
+	for _, s := range transfers {
+		state := d.transferState(s.ID)
+		if state == "" {
+			state = PostProcessWaiting
+		}
+		item(&s, StageTransfer, state)
+	}
+	for _, s := range plans {
+		state := PostProcessWaiting
+		if s.ID == d.postProcessState.planning {
+			state = PostProcessRunning
+		}
+		item(&s, StagePlan, state)
+	}
+	return status, nil
+}
@@ -0,0 +1,129 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/organizer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitReason(t *testing.T) {
+	// 2025-01-06 is a monday.
+	now := time.Date(2025, 1, 6, 12, 0, 0, 0, time.Local)
+	lunch := []config.TimeWindow{{Start: "11:30", End: "13:00"}}
+
+	tests := []struct {
+		name     string
+		cfg      *config.PostProcessing
+		speed    int64
+		waited   time.Duration
+		wantWait bool
+	}{
+		{name: "idle", speed: 1000 * 1000},
+		{name: "busy", speed: 3 * 1000 * 1000, wantWait: true},
+		{name: "forced after default max wait", speed: 3 * 1000 * 1000, waited: 6 * time.Hour},
+		{name: "under busy speed", cfg: &config.PostProcessing{BusySpeedMB: 5}, speed: 3 * 1000 * 1000},
+		{name: "never busy", cfg: &config.PostProcessing{BusySpeedMB: -1}, speed: 100 * 1000 * 1000},
+		{name: "in window", cfg: &config.PostProcessing{Windows: lunch}, speed: 3 * 1000 * 1000},
+		{name: "out of window", cfg: &config.PostProcessing{Windows: []config.TimeWindow{{Start: "01:00", End: "07:00"}}}, speed: 3 * 1000 * 1000, wantWait: true},
+		{name: "max wait", cfg: &config.PostProcessing{MaxWaitMinutes: 30}, speed: 3 * 1000 * 1000, waited: time.Hour},
+		{name: "waits forever", cfg: &config.PostProcessing{MaxWaitMinutes: -1}, speed: 3 * 1000 * 1000, waited: 30 * 24 * time.Hour, wantWait: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Downloader{postProcessing: tt.cfg}
+			reason := d.waitReason(tt.speed, now.Add(-tt.waited), now)
+			assert.Equal(t, tt.wantWait, reason != "", reason)
+		})
+	}
+
+	d := &Downloader{}
+	assert.Equal(t, "downloader busy at 3.0 MB/s, over 2 MB/s, forced at 2025-01-06 18:00:00", d.waitReason(3*1000*1000, now, now))
+}
+
+func TestPostProcessStatus(t *testing.T) {
+	backend := &fakeBackend{
+		torrents: []*Torrent{
+			{Hash: "1", Status: StatusSeeding, Progress: 1},
+			{Hash: "2", Status: StatusSeeding, Progress: 1},
+		},
+		speed: 3 * 1000 * 1000,
+	}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{
+		PostProcessing: &config.PostProcessing{BusySpeedMB: 1, MaxWaitMinutes: 120},
+	}, nil)
+	completedAt := time.Now().Add(-time.Hour)
+	require.NoError(t, d.Create(&db.DownloadStatus{ID: "1", Downloader: "test", State: db.DownloadSeeding, ResTitle: "Show", CompletedAt: &completedAt}).Error)
+	require.NoError(t, d.Create(&db.DownloadStatus{ID: "2", Downloader: "test", State: db.DownloadSeeding, ResTitle: "Movie", CompletedAt: &completedAt, MoveState: db.Moved}).Error)
+
+	downloader.ProgressChecker()
+
+	status, err := downloader.PostProcessStatus()
+	require.NoError(t, err)
+	assert.Equal(t, 2, status.TransferWorkers)
+	assert.Equal(t, int64(3*1000*1000), status.Speed)
+	assert.Equal(t, int64(1000*1000), status.BusySpeed)
+	assert.Equal(t, 120, status.MaxWaitMinutes)
+
+	reason := "downloader busy at 3.0 MB/s, over 1 MB/s, forced at " + completedAt.Add(2*time.Hour).Format(time.DateTime)
+	for i := range status.Items {
+		status.Items[i].Since = time.Time{}
+	}
+	assert.Equal(t, []PostProcessItem{
+		{ID: "1", Title: "Show", Stage: StageTransfer, State: PostProcessWaiting, Reason: reason},
+		{ID: "2", Title: "Movie", Stage: StagePlan, State: PostProcessWaiting, Reason: reason},
+	}, status.Items)
+}
+
+func TestPostProcessStatusPlanning(t *testing.T) {
+	backend := &fakeBackend{}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{}, nil)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slowServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		json.NewEncoder(w).Encode(organizer.PlanResponse{})
+	}))
+	t.Cleanup(slowServ.Close)
+	slowClient, err := organizer.NewClient(slowServ.URL, nil)
+	require.NoError(t, err)
+	downloader.organizerClient = slowClient
+
+	require.NoError(t, d.Create(&db.DownloadStatus{
+		ID:         "1",
+		Downloader: "test",
+		State:      db.DownloadSeeding,
+		MoveState:  db.Moved,
+		FileList:   []string{"movie.mkv"},
+	}).Error)
+
+	done := make(chan struct{})
+	go func() {
+		downloader.ProgressChecker()
+		close(done)
+	}()
+	<-started
+
+	// running while planned.
+	status, err := downloader.PostProcessStatus()
+	require.NoError(t, err)
+	require.Len(t, status.Items, 1)
+	assert.Equal(t, StagePlan, status.Items[0].Stage)
+	assert.Equal(t, PostProcessRunning, status.Items[0].State)
+
+	close(release)
+	<-done
+	status, err = downloader.PostProcessStatus()
+	require.NoError(t, err)
+	assert.Empty(t, status.Items)
+}
@@ -0,0 +1,269 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"gorm.io/gorm"
+)
+
+var ErrNotQueued = errors.New("download is not queued")
+
+// QueuedDownload is a download held until a slot is free.
+type QueuedDownload struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Priority int    `json:"priority"`
+}
+
+// QueueStatus is the download queue of a downloader, in release order.
+type QueueStatus struct {
+	// MaxActive downloads, 0 for unlimited.
+	MaxActive int              `json:"max_active"`
+	Active    int64            `json:"active"`
+	Items     []QueuedDownload `json:"items"`
+}
+
+// Queue adds the torrent like Add, or holds it while max active downloads
+// are downloading or others are queued. track saves the download before
+// another one is counted, see MarkQueued, the added torrent is removed if it
+// fails. It returns ErrAlreadyTracked for a tracked torrent, which is left
+// as is.
+func (d *Downloader) Queue(req *AddRequest, track func(hash string, queued bool) error) (string, bool, error) {
+	if err := req.Validate(); err != nil {
+		return "", false, err
+	}
+	hash, err := req.Hash()
+	if err != nil {
+		return "", false, err
+	}
+
+	d.queueMu.Lock()
+	defer d.queueMu.Unlock()
+
+	if _, err := db.GetDownloadStatus(d.db, hash); err == nil {
+		return hash, false, ErrAlreadyTracked
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, err
+	}
+	queued, err := d.mustQueue()
+	if err != nil {
+		return "", false, err
+	}
+	if !queued {
+		if hash, err = d.Add(req); err != nil {
+			return "", false, err
+		}
+	}
+
+	if err := track(hash, queued); err != nil {
+		if !queued {
+			d.removeAdded(hash)
+		}
+		return hash, queued, err
+	}
+	if queued {
+		d.logger.Info().Str("hash", hash).Msg("queued download")
+	}
+	return hash, queued, nil
+}
+
+// mustQueue tells if a new download is to be queued, while max active
+// downloads are downloading or others are queued.
+func (d *Downloader) mustQueue() (bool, error) {
+	if d.maxActive <= 0 {
+		return false, nil
+	}
+	active, err := db.CountActiveDownloads(d.db, d.name)
+	if err != nil {
+		return false, err
+	}
+	queued, err := db.GetQueuedDownloadStatusByDownloader(d.db, d.name)
+	if err != nil {
+		return false, err
+	}
+	return active >= int64(d.maxActive) || len(queued) > 0, nil
+}
+
+// removeAdded removes a torrent added but not tracked.
+func (d *Downloader) removeAdded(hash string) {
+	t, err := d.torrent(hash)
+	if err == nil {
+		err = d.backend.Remove(context.Background(), []*Torrent{t}, true)
+	}
+	if err != nil {
+		d.logger.Error().Err(err).Str("hash", hash).Msg("failed to remove untracked torrent")
+	}
+}
+
+// MarkQueued sets s queued to be added by req, after queued downloads of the
+// same priority.
+func (req *AddRequest) MarkQueued(s *db.DownloadStatus) {
+	s.State = db.DownloadQueued
+	s.QueuePriority = req.QueuePriority
+	s.QueuePosition = time.Now().UnixNano()
+	s.AddOptions = &db.AddOptions{
+		Magnet:   req.Magnet,
+		Dir:      req.Dir,
+		Labels:   req.Labels,
+		Paused:   req.Paused,
+		Priority: req.Priority,
+		Files:    req.Files,
+		Skip:     req.Skip,
+	}
+}
+
+// releaseQueued adds queued downloads to the backend while slots are free.
+func (d *Downloader) releaseQueued() {
+	d.queueMu.Lock()
+	defer d.queueMu.Unlock()
+
+	queued, err := db.GetQueuedDownloadStatusByDownloader(d.db, d.name)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to get queued downloads")
+		return
+	}
+	if len(queued) == 0 || d.disk.intakePaused.Load() {
+		return
+	}
+
+	free := len(queued)
+	if d.maxActive > 0 {
+		active, err := db.CountActiveDownloads(d.db, d.name)
+		if err != nil {
+			d.logger.Error().Err(err).Msg("failed to count active downloads")
+			return
+		}
+		free = min(free, d.maxActive-int(active))
+	}
+
+	// one failing is tried again by the next check, others go on.
+	for i := 0; i < len(queued) && free > 0; i++ {
+		s := &queued[i]
+		if err := d.release(s); err != nil {
+			d.logger.Error().Err(err).Str("hash", s.ID).Msg("failed to release queued download")
+			continue
+		}
+		// paused ones take no slot.
+		if s.State == db.DownloadStarted {
+			free--
+		}
+		d.logger.Info().Str("hash", s.ID).Str("title", s.ResTitle).Msg("released queued download")
+	}
+}
+
+func (d *Downloader) release(s *db.DownloadStatus) error {
+	req := &AddRequest{}
+	if o := s.AddOptions; o != nil {
+		req = &AddRequest{
+			Magnet:   o.Magnet,
+			Dir:      o.Dir,
+			Labels:   o.Labels,
+			Paused:   o.Paused,
+			Priority: o.Priority,
+			Files:    o.Files,
+			Skip:     o.Skip,
+		}
+	}
+	if req.Magnet == "" {
+		data, err := db.GetTorrentFile(d.db, s.ID)
+		if err != nil {
+			return err
+		}
+		req.Torrent = data
+	}
+	if d.diskSpace != nil {
+		size, err := req.size()
+		if err != nil {
+			return err
+		}
+		if err := d.CheckDiskSpace(size); err != nil {
+			return err
+		}
+	}
+
+	if _, err := d.backend.AddTorrent(context.Background(), req); err != nil {
+		return err
+	}
+
+	// progress is picked up by the next check.
+	s.State = db.DownloadStarted
+	if req.Paused {
+		s.State = db.DownloadPaused
+	}
+	s.AddOptions = nil
+	return db.SaveDownloadStatus(d.db, s)
+}
+
+// QueueStatus lists queued downloads in release order.
+func (d *Downloader) QueueStatus() (*QueueStatus, error) {
+	active, err := db.CountActiveDownloads(d.db, d.name)
+	if err != nil {
+		return nil, err
+	}
+	queued, err := db.GetQueuedDownloadStatusByDownloader(d.db, d.name)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &QueueStatus{MaxActive: d.maxActive, Active: active, Items: []QueuedDownload{}}
+	for _, s := range queued {
+		status.Items = append(status.Items, QueuedDownload{ID: s.ID, Title: s.ResTitle, Priority: s.QueuePriority})
+	}
+	return status, nil
+}
+
+// ReorderQueue puts queued downloads of ids first in their order, the others
+// after them. Priority still goes first.
+func (d *Downloader) ReorderQueue(ids []string) error {
+	queued, err := db.GetQueuedDownloadStatusByDownloader(d.db, d.name)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if !slices.ContainsFunc(queued, func(s db.DownloadStatus) bool { return s.ID == id }) {
+			return ErrNotQueued
+		}
+	}
+
+	slices.SortStableFunc(queued, func(a, b db.DownloadStatus) int {
+		ia, ib := slices.Index(ids, a.ID), slices.Index(ids, b.ID)
+		switch {
+		case ia < 0 && ib < 0:
+			return 0
+		case ia < 0:
+			return 1
+		case ib < 0:
+			return -1
+		}
+		return ia - ib
+	})
+
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		for i, s := range queued {
+			if err := tx.Model(&db.DownloadStatus{}).Where("id = ?", s.ID).Update("queue_position", i).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetQueuePriority sets priority of a queued download, higher is released
+// first.
+func (d *Downloader) SetQueuePriority(id string, priority int) error {
+	s, err := db.GetDownloadStatus(d.db, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotQueued
+		}
+		return err
+	}
+	if s.Downloader != d.name || s.State != db.DownloadQueued {
+		return ErrNotQueued
+	}
+	return d.db.Model(&db.DownloadStatus{}).Where("id = ?", id).Update("queue_priority", priority).Error
+}
@@ -0,0 +1,179 @@
+package common
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueMaxActive(t *testing.T) {
+	backend := &fakeBackend{}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{MaxActiveDownloads: 1}, nil)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	added := 0
+	for _, c := range "abcde" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := &AddRequest{Magnet: "magnet:?xt=urn:btih:" + strings.Repeat(string(c), 40)}
+			_, queued, err := downloader.Queue(req, func(hash string, queued bool) error {
+				s := &db.DownloadStatus{ID: hash, Downloader: "test", State: db.DownloadStarted}
+				if queued {
+					req.MarkQueued(s)
+				}
+				return d.Create(s).Error
+			})
+			assert.NoError(t, err)
+			if !queued {
+				mu.Lock()
+				added++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the slot is counted as soon as one is tracked.
+	assert.Equal(t, 1, added)
+	assert.Len(t, backend.added, 1)
+}
+
+func TestQueueTrackFailed(t *testing.T) {
+	backend := &fakeBackend{}
+	downloader, _ := newTestDownloader(t, backend, &config.DownloaderConfig{}, nil)
+
+	hash := strings.Repeat("a", 40)
+	_, queued, err := downloader.Queue(&AddRequest{Magnet: "magnet:?xt=urn:btih:" + hash}, func(string, bool) error {
+		return errors.New("db is gone")
+	})
+	require.Error(t, err)
+	assert.False(t, queued)
+
+	// not left in the backend untracked.
+	assert.Equal(t, []string{"delete " + hash}, backend.calls)
+	assert.Empty(t, backend.torrents)
+}
+
+func TestReleaseQueued(t *testing.T) {
+	backend := &fakeBackend{}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{MaxActiveDownloads: 1}, nil)
+
+	hashA := strings.Repeat("a", 40)
+	hashB := strings.Repeat("b", 40)
+	for _, s := range []*db.DownloadStatus{
+		// first to release, but its torrent file is missing.
+		{ID: "broken", QueuePriority: 1},
+		// paused, takes no slot.
+		{ID: hashB, QueuePosition: 1, AddOptions: &db.AddOptions{Magnet: "magnet:?xt=urn:btih:" + hashB, Paused: true}},
+		{ID: hashA, QueuePosition: 2, AddOptions: &db.AddOptions{Magnet: "magnet:?xt=urn:btih:" + hashA}},
+	} {
+		s.Downloader = "test"
+		s.State = db.DownloadQueued
+		if s.AddOptions == nil {
+			s.AddOptions = &db.AddOptions{}
+		}
+		require.NoError(t, d.Create(s).Error)
+	}
+
+	downloader.releaseQueued()
+
+	require.Len(t, backend.added, 2)
+	assert.True(t, backend.added[0].Paused)
+	for hash, want := range map[string]db.DownloadState{
+		"broken": db.DownloadQueued,
+		hashB:    db.DownloadPaused,
+		hashA:    db.DownloadStarted,
+	} {
+		r, err := db.GetDownloadStatus(d, hash)
+		require.NoError(t, err)
+		assert.Equal(t, want, r.State, hash)
+	}
+}
+
+func TestQueueTracked(t *testing.T) {
+	backend := &fakeBackend{}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{}, nil)
+
+	hash := strings.Repeat("a", 40)
+	require.NoError(t, d.Create(&db.DownloadStatus{ID: hash, Downloader: "test", State: db.DownloadSeeding}).Error)
+
+	_, _, err := downloader.Queue(&AddRequest{Magnet: "magnet:?xt=urn:btih:" + hash}, func(string, bool) error {
+		t.Fatal("tracked again")
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrAlreadyTracked)
+	// the torrent of the tracked download is kept.
+	assert.Empty(t, backend.added)
+	assert.Empty(t, backend.calls)
+}
+
+func TestQueue(t *testing.T) {
+	hashA := strings.Repeat("a", 40)
+	hashB := strings.Repeat("b", 40)
+
+	backend := &fakeBackend{
+		torrents: []*Torrent{{Hash: "1", Status: StatusDownloading, Progress: 0.5}},
+		// busy, skip copying
+		speed: 3 * 1000 * 1000,
+	}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{MaxActiveDownloads: 1}, nil)
+	require.NoError(t, d.Create(&db.DownloadStatus{ID: "1", Downloader: "test", State: db.DownloadStarted}).Error)
+
+	queue := func(req *AddRequest, title string) {
+		_, queued, err := downloader.Queue(req, func(hash string, queued bool) error {
+			s := &db.DownloadStatus{ID: hash, Downloader: "test", ResTitle: title}
+			req.MarkQueued(s)
+			return d.Create(s).Error
+		})
+		require.NoError(t, err)
+		assert.True(t, queued)
+	}
+	queue(&AddRequest{Magnet: "magnet:?xt=urn:btih:" + hashA, Labels: []string{"tv"}}, "Show")
+	queue(&AddRequest{Magnet: "magnet:?xt=urn:btih:" + hashB, QueuePriority: 1}, "Movie")
+	// not added while the slot is taken.
+	assert.Empty(t, backend.added)
+
+	status, err := downloader.QueueStatus()
+	require.NoError(t, err)
+	assert.Equal(t, &QueueStatus{MaxActive: 1, Active: 1, Items: []QueuedDownload{
+		{ID: hashB, Title: "Movie", Priority: 1},
+		{ID: hashA, Title: "Show"},
+	}}, status)
+
+	require.NoError(t, downloader.SetQueuePriority(hashB, 0))
+	require.NoError(t, downloader.ReorderQueue([]string{hashA}))
+	assert.ErrorIs(t, downloader.SetQueuePriority("1", 1), ErrNotQueued)
+	assert.ErrorIs(t, downloader.ReorderQueue([]string{"1"}), ErrNotQueued)
+
+	status, err = downloader.QueueStatus()
+	require.NoError(t, err)
+	assert.Equal(t, []QueuedDownload{{ID: hashA, Title: "Show"}, {ID: hashB, Title: "Movie"}}, status.Items)
+
+	// done, frees the slot.
+	backend.torrents[0].Status, backend.torrents[0].Progress = StatusSeeding, 1
+	downloader.ProgressChecker()
+
+	require.Len(t, backend.added, 1)
+	assert.Equal(t, "magnet:?xt=urn:btih:"+hashA, backend.added[0].Magnet)
+	assert.Equal(t, []string{"tv"}, backend.added[0].Labels)
+
+	r, err := db.GetDownloadStatus(d, hashA)
+	require.NoError(t, err)
+	assert.Equal(t, db.DownloadStarted, r.State)
+	assert.Nil(t, r.AddOptions)
+
+	// queued downloads are deleted without the backend.
+	require.NoError(t, downloader.DeleteTorrent(hashB, false))
+	r, err = db.GetDownloadStatus(d, hashB)
+	require.NoError(t, err)
+	assert.Equal(t, db.DownloadDeleted, r.State)
+	assert.Empty(t, backend.calls)
+}
@@ -0,0 +1,251 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/events"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlreadyTracked = errors.New("torrent is already tracked")
+	ErrNotMissing     = errors.New("torrent is in the downloader")
+	ErrNoTorrentFile  = errors.New("no stored torrent file to add again")
+)
+
+// UntrackedTorrent is in the backend without a tracked download.
+type UntrackedTorrent struct {
+	Hash     string  `json:"hash"`
+	Name     string  `json:"name"`
+	Progress float64 `json:"progress"`
+	Size     int64   `json:"size"`
+}
+
+// MissingDownload is tracked but gone from the backend.
+type MissingDownload struct {
+	ID      string           `json:"id"`
+	Title   string           `json:"title"`
+	Indexer string           `json:"indexer"`
+	State   db.DownloadState `json:"state"`
+	// CanReAdd is set if the .torrent is stored.
+	CanReAdd bool `json:"can_readd"`
+}
+
+// Reconciliation lists orphans between the backend and the database.
+type Reconciliation struct {
+	Untracked []UntrackedTorrent `json:"untracked"`
+	Missing   []MissingDownload  `json:"missing"`
+}
+
+func (r *Reconciliation) empty() bool {
+	return len(r.Untracked) == 0 && len(r.Missing) == 0
+}
+
+func (d *Downloader) RegisterReconciler(cron *cron.Cron) {
+	jobID, err := cron.AddFunc("0 * * * *", func() {
+		d.CheckReconciliation()
+	})
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to add cron job")
+		return
+	}
+	d.logger.Info().Int64("jobID", int64(jobID)).Msg("added cron job")
+}
+
+// Reconcile compares torrents of the backend with tracked downloads.
+func (d *Downloader) Reconcile() (*Reconciliation, error) {
+	torrents, err := d.backend.Torrents(context.Background())
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to get all torrents")
+		return nil, err
+	}
+	statuses, err := db.GetTrackedDownloadStatusByDownloader(d.db, d.name)
+	if err != nil {
+		return nil, err
+	}
+
+	torrentsByHash := toTorrentsByHash(torrents)
+	r := &Reconciliation{Untracked: []UntrackedTorrent{}, Missing: []MissingDownload{}}
+	tracked := map[string]bool{}
+	missingIDs := []string{}
+	for _, s := range statuses {
+		tracked[s.ID] = true
+		if torrentsByHash[s.ID] != nil {
+			continue
+		}
+		r.Missing = append(r.Missing, MissingDownload{
+			ID:      s.ID,
+			Title:   s.ResTitle,
+			Indexer: s.ResIndexer,
+			State:   s.State,
+		})
+		missingIDs = append(missingIDs, s.ID)
+	}
+	for _, t := range torrents {
+		if tracked[t.Hash] {
+			continue
+		}
+		r.Untracked = append(r.Untracked, UntrackedTorrent{
+			Hash:     t.Hash,
+			Name:     t.Name,
+			Progress: t.Progress,
+			Size:     t.Size,
+		})
+	}
+
+	if len(missingIDs) > 0 {
+		stored, err := db.TorrentFileIDs(d.db, missingIDs)
+		if err != nil {
+			return nil, err
+		}
+		for i := range r.Missing {
+			r.Missing[i].CanReAdd = stored[r.Missing[i].ID]
+		}
+	}
+	return r, nil
+}
+
+// CheckReconciliation logs orphans, and notifies ones not notified before.
+func (d *Downloader) CheckReconciliation() {
+	r, err := d.Reconcile()
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to reconcile")
+		return
+	}
+
+	seen := map[string]bool{}
+	fresh := 0
+	for _, t := range r.Untracked {
+		seen[t.Hash] = true
+		if !d.reconciled[t.Hash] {
+			fresh++
+		}
+	}
+	for _, m := range r.Missing {
+		seen[m.ID] = true
+		if !d.reconciled[m.ID] {
+			fresh++
+		}
+	}
+	d.reconciled = seen
+
+	if r.empty() {
+		return
+	}
+	d.logger.Warn().Int("untracked", len(r.Untracked)).Int("missing", len(r.Missing)).Msg("downloader and database are out of sync")
+	if fresh == 0 || d.notifier == nil {
+		return
+	}
+
+	msg := fmt.Sprintf("🔍 %s is out of sync: %d untracked torrents, %d missing downloads. See /downloaders/%s/reconcile.",
+		d.name, len(r.Untracked), len(r.Missing), d.name)
+	if err := d.notifier.SendMessage(msg); err != nil {
+		d.logger.Error().Err(err).Msg("failed to send reconciliation notification")
+	}
+}
+
+// Adopt tracks a torrent of the backend. s has optional resource info, title
+// is the torrent name if not set.
+func (d *Downloader) Adopt(hash string, s *db.DownloadStatus) error {
+	t, err := d.torrent(hash)
+	if err != nil {
+		return err
+	}
+
+	existing, err := db.GetDownloadStatus(d.db, hash)
+	switch {
+	case err == nil && existing.State != db.DownloadDeleted && existing.State != db.DownloadMissing:
+		return ErrAlreadyTracked
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	now := time.Now()
+	s.ID = t.Hash
+	s.CreatedAt = now
+	s.Downloader = d.name
+	s.DownloadProgress = uint16(t.Progress * 1000)
+	s.Size = uint64(t.Size)
+	s.UploadHistories = map[string]int64{}
+	s.AddToday(t.Uploaded)
+	if s.ResTitle == "" {
+		s.ResTitle = t.Name
+	}
+	if t.Progress >= 1 {
+		s.CompletedAt = &now
+	}
+	switch t.Status {
+	case StatusSeeding:
+		s.State = db.DownloadSeeding
+	case StatusStopped, StatusFinished:
+		s.State = db.DownloadPaused
+		if t.Progress >= 1 {
+			s.State = db.DownloadStopped
+		}
+	default:
+		s.State = db.DownloadStarted
+	}
+
+	if err := db.SaveDownloadStatus(d.db, s); err != nil {
+		return err
+	}
+	d.logger.Info().Str("hash", hash).Str("title", s.ResTitle).Msg("adopted torrent")
+	d.publish(events.DownloadAdded, hash, s.ResTitle)
+	return nil
+}
+
+// missingStatus returns the status of id if it is gone from the backend.
+func (d *Downloader) missingStatus(id string) (*db.DownloadStatus, error) {
+	s, err := db.GetDownloadStatus(d.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.Downloader != d.name {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if _, err := d.torrent(id); err == nil {
+		return nil, ErrNotMissing
+	} else if err != ErrTorrentNotFound {
+		return nil, err
+	}
+	return s, nil
+}
+
+// MarkMissing marks a download gone from the backend, it is not expected
+// there anymore.
+func (d *Downloader) MarkMissing(id string) error {
+	if _, err := d.missingStatus(id); err != nil {
+		return err
+	}
+	return db.UpdateDownloadStateForStatuses(d.db, []string{id}, db.DownloadMissing)
+}
+
+// ReAdd adds a download gone from the backend again from its stored .torrent.
+func (d *Downloader) ReAdd(id string) error {
+	s, err := d.missingStatus(id)
+	if err != nil {
+		return err
+	}
+	data, err := db.GetTorrentFile(d.db, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNoTorrentFile
+	} else if err != nil {
+		return err
+	}
+
+	if _, err := d.Add(&AddRequest{Torrent: data}); err != nil {
+		return err
+	}
+	// progress is picked up by the next check.
+	s.State = db.DownloadStarted
+	if err := db.SaveDownloadStatus(d.db, s); err != nil {
+		return err
+	}
+	d.publish(events.DownloadAdded, id, s.ResTitle)
+	return nil
+}
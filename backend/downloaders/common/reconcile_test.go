@@ -0,0 +1,77 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcile(t *testing.T) {
+	torrent2, hash2 := newTorrentFile(t, "movie.mkv", 1000)
+	backend := &fakeBackend{torrents: []*Torrent{
+		{Hash: "1", Name: "Torrent 1", Status: StatusSeeding, Progress: 1, Size: 8000},
+		{Hash: "4", Name: "Torrent 4", Status: StatusSeeding, Progress: 1, Size: 8000, Uploaded: 100},
+	}}
+	notifier := &fakeNotifier{}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{}, notifier)
+
+	for _, s := range []*db.DownloadStatus{
+		// in the backend.
+		{ID: "1", State: db.DownloadSeeding},
+		// gone, with the torrent file.
+		{ID: hash2, State: db.DownloadSeeding, ResTitle: "Movie", ResIndexer: "mteam"},
+		// gone, without the torrent file.
+		{ID: "3", State: db.DownloadStopped},
+		// deleted, not expected.
+		{ID: "5", State: db.DownloadDeleted},
+	} {
+		s.Downloader = "test"
+		require.NoError(t, d.Create(s).Error)
+	}
+	require.NoError(t, db.SaveTorrentFile(d, hash2, torrent2))
+
+	r, err := downloader.Reconcile()
+	require.NoError(t, err)
+	assert.Equal(t, []UntrackedTorrent{{Hash: "4", Name: "Torrent 4", Progress: 1, Size: 8000}}, r.Untracked)
+	assert.ElementsMatch(t, []MissingDownload{
+		{ID: hash2, Title: "Movie", Indexer: "mteam", State: db.DownloadSeeding, CanReAdd: true},
+		{ID: "3", State: db.DownloadStopped},
+	}, r.Missing)
+
+	// notified once.
+	downloader.CheckReconciliation()
+	downloader.CheckReconciliation()
+	require.Len(t, notifier.messages, 1)
+	assert.Contains(t, notifier.messages[0], "1 untracked torrents, 2 missing downloads")
+
+	// adopt
+	require.NoError(t, downloader.Adopt("4", &db.DownloadStatus{ResIndexer: "nyaa"}))
+	s, err := db.GetDownloadStatus(d, "4")
+	require.NoError(t, err)
+	assert.Equal(t, "test", s.Downloader)
+	assert.Equal(t, "Torrent 4", s.ResTitle)
+	assert.Equal(t, "nyaa", s.ResIndexer)
+	assert.Equal(t, db.DownloadSeeding, s.State)
+
+	assert.ErrorIs(t, downloader.Adopt("1", &db.DownloadStatus{}), ErrAlreadyTracked)
+	assert.ErrorIs(t, downloader.Adopt("9", &db.DownloadStatus{}), ErrTorrentNotFound)
+
+	// mark missing
+	assert.ErrorIs(t, downloader.MarkMissing("1"), ErrNotMissing)
+	require.NoError(t, downloader.MarkMissing("3"))
+	s, err = db.GetDownloadStatus(d, "3")
+	require.NoError(t, err)
+	assert.Equal(t, db.DownloadMissing, s.State)
+
+	// re-add
+	assert.ErrorIs(t, downloader.ReAdd("3"), ErrNoTorrentFile)
+	require.NoError(t, downloader.ReAdd(hash2))
+	require.Len(t, backend.added, 1)
+	assert.Equal(t, torrent2, backend.added[0].Torrent)
+	s, err = db.GetDownloadStatus(d, hash2)
+	require.NoError(t, err)
+	assert.Equal(t, db.DownloadStarted, s.State)
+}
@@ -0,0 +1,29 @@
+package common
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink clones from at target, sharing blocks.
+func reflink(from, target string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if err := unix.IoctlFileClone(int(dst.Fd()), int(src.Fd())); err != nil {
+		dst.Close()
+		os.Remove(target)
+		return err
+	}
+	return nil
+}
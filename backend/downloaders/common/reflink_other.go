@@ -0,0 +1,8 @@
+//go:build !linux
+
+package common
+
+// reflink is only supported on linux, copy is used instead.
+func reflink(from, target string) error {
+	return ErrNotSupported
+}
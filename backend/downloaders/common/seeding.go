@@ -0,0 +1,65 @@
+package common
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+)
+
+// seedingPolicy returns the most specific policy matching the torrent, the
+// first one on ties, nil if none matches.
+func (d *Downloader) seedingPolicy(t *Torrent, s *db.DownloadStatus) *config.SeedingPolicy {
+	var policy *config.SeedingPolicy
+	for i := range d.seedingPolicies {
+		p := &d.seedingPolicies[i]
+		if !matchPolicy(p, t, s) {
+			continue
+		}
+		if policy == nil || p.Specificity() > policy.Specificity() {
+			policy = p
+		}
+	}
+	return policy
+}
+
+func matchPolicy(p *config.SeedingPolicy, t *Torrent, s *db.DownloadStatus) bool {
+	if p.Indexer != "" && !strings.EqualFold(p.Indexer, s.ResIndexer) {
+		return false
+	}
+	if p.Category != "" && !strings.EqualFold(p.Category, s.Category) {
+		return false
+	}
+	if p.Tracker != "" && !slices.ContainsFunc(t.Trackers, func(url string) bool {
+		return strings.Contains(strings.ToLower(url), strings.ToLower(p.Tracker))
+	}) {
+		return false
+	}
+	return true
+}
+
+// doneSeeding tells if the torrent seeded enough by the policy at now.
+func doneSeeding(p *config.SeedingPolicy, t *Torrent, s *db.DownloadStatus, now time.Time) bool {
+	seeded := now.Sub(*s.CompletedAt)
+	if p.MaxSeedHours > 0 && seeded >= time.Duration(p.MaxSeedHours)*time.Hour {
+		return true
+	}
+	if p.MinSeedHours > 0 && seeded < time.Duration(p.MinSeedHours)*time.Hour {
+		return false
+	}
+	if p.MinRatio > 0 && (t.Size == 0 || float64(t.Uploaded)/float64(t.Size) < p.MinRatio) {
+		return false
+	}
+
+	// idle-upload rule.
+	if p.IntervalInDays > 0 {
+		before, ok := s.GetXDayBefore(p.IntervalInDays)
+		if !ok {
+			return false
+		}
+		return t.Uploaded-before <= p.UploadAtLeastInMB*1024*1024
+	}
+	return p.MinRatio > 0 || p.MinSeedHours > 0
+}
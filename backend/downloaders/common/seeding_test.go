@@ -0,0 +1,82 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDailySeedingPolicies(t *testing.T) {
+	private := []string{"https://tracker.private.org/announce"}
+	backend := &fakeBackend{torrents: []*Torrent{
+		{Hash: "1", Status: StatusSeeding, Progress: 1, Size: 8000, Uploaded: 12000},
+		{Hash: "2", Status: StatusSeeding, Progress: 1, Size: 8000, Uploaded: 4000},
+		{Hash: "3", Status: StatusSeeding, Progress: 1, Size: 8000, Trackers: private},
+		{Hash: "4", Status: StatusSeeding, Progress: 1, Size: 8000, Trackers: private},
+		{Hash: "5", Status: StatusSeeding, Progress: 1, Size: 8000, Uploaded: 12000, Trackers: private},
+		{Hash: "6", Status: StatusSeeding, Progress: 1, Size: 8000, Uploaded: 12000},
+		{Hash: "7", Status: StatusSeeding, Progress: 1, Size: 8000, Uploaded: 100},
+	}}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{
+		SeedingPolicy: &config.SeedingPolicy{
+			IntervalInDays:    3,
+			UploadAtLeastInMB: 1,
+		},
+		SeedingPolicies: []config.SeedingPolicy{
+			{Indexer: "mteam", MinRatio: 1, Action: config.SeedingActionRemove},
+			{Tracker: "tracker.private.org", MinSeedHours: 72, Action: config.SeedingActionRemoveData},
+			{Indexer: "mteam", Tracker: "tracker.private.org", MinRatio: 2, MaxSeedHours: 14 * 24},
+		},
+	}, nil)
+
+	daysAgo := func(n int) *time.Time {
+		t := time.Now().AddDate(0, 0, -n)
+		return &t
+	}
+	threeDaysAgo := time.Now().AddDate(0, 0, -3).Format("2006-01-02")
+
+	statuses := []*db.DownloadStatus{
+		// ratio 1.5 by mteam, removed keeping data.
+		{ID: "1", ResIndexer: "mteam", MoveState: db.Moved, CompletedAt: daysAgo(1)},
+		// ratio 0.5 by mteam, keeps seeding.
+		{ID: "2", ResIndexer: "mteam", MoveState: db.Moved, CompletedAt: daysAgo(1)},
+		// private tracker seeded 4 days, removed with data.
+		{ID: "3", ResIndexer: "nyaa", MoveState: db.Moved, CompletedAt: daysAgo(4)},
+		// private tracker seeded 1 day, keeps seeding.
+		{ID: "4", ResIndexer: "nyaa", MoveState: db.Moved, CompletedAt: daysAgo(1)},
+		// mteam on private tracker, ratio 1.5 under 2 but seeded 15 days, stopped.
+		{ID: "5", ResIndexer: "mteam", CompletedAt: daysAgo(15)},
+		// ratio 1.5 by mteam, removing waits for the copy.
+		{ID: "6", ResIndexer: "mteam", CompletedAt: daysAgo(1)},
+		// idle by the catch-all policy, stopped.
+		{ID: "7", ResIndexer: "nyaa", CompletedAt: daysAgo(5), UploadHistories: map[string]int64{threeDaysAgo: 0}},
+	}
+	for _, s := range statuses {
+		s.Downloader = "test"
+		s.State = db.DownloadSeeding
+		require.NoError(t, d.Create(s).Error)
+	}
+
+	downloader.CheckDailySeeding()
+
+	assert.Equal(t, []string{"stop 5", "stop 7", "remove 1", "delete 3"}, backend.calls)
+
+	want := map[string]db.DownloadState{
+		"1": db.DownloadDeleted,
+		"2": db.DownloadSeeding,
+		"3": db.DownloadDeleted,
+		"4": db.DownloadSeeding,
+		"5": db.DownloadStopped,
+		"6": db.DownloadSeeding,
+		"7": db.DownloadStopped,
+	}
+	for id, state := range want {
+		r, err := db.GetDownloadStatus(d, id)
+		require.NoError(t, err)
+		assert.Equal(t, state, r.State, id)
+	}
+}
@@ -0,0 +1,114 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/events"
+)
+
+// trackStall updates when s last made progress and last had peers. Time
+// not downloading doesn't count, nor do peers of a backend not reporting
+// them.
+func trackStall(s *db.DownloadStatus, t *Torrent, moved bool, now time.Time) {
+	downloading := t.Status == StatusDownloading
+	if !downloading || moved || s.ProgressAt == nil {
+		s.ProgressAt = &now
+	}
+	if !downloading || t.Peers != 0 || s.PeersAt == nil {
+		s.PeersAt = &now
+	}
+	if moved && s.StalledAt != nil {
+		// recovered, it may stall again.
+		s.StalledAt = nil
+		s.ReplaceSearched = false
+	}
+}
+
+// stallReason tells why s is stalled, empty if it is not.
+func stallReason(s *db.DownloadStatus, after time.Duration, now time.Time) string {
+	switch {
+	case s.ProgressAt != nil && now.Sub(*s.ProgressAt) >= after:
+		return "no progress"
+	case s.PeersAt != nil && now.Sub(*s.PeersAt) >= after:
+		return "no peers"
+	}
+	return ""
+}
+
+// checkStalled marks downloads stalled for the configured hours, notifies
+// them and removes them if configured. Alternatives are searched by the
+// service.
+func (d *Downloader) checkStalled(torrentsByHash map[string]*Torrent) {
+	if d.stalled == nil {
+		return
+	}
+
+	statuses, err := db.GetDownloadStatusByDownloaderAndState(d.db, d.name, db.DownloadStarted)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to get started download status")
+		return
+	}
+
+	now := time.Now()
+	for _, s := range statuses {
+		t, ok := torrentsByHash[s.ID]
+		if !ok || s.StalledAt != nil || t.Status != StatusDownloading {
+			continue
+		}
+		reason := stallReason(&s, d.stalled.After(), now)
+		if reason == "" {
+			continue
+		}
+
+		s.StalledAt = &now
+		if err := db.SetStalled(d.db, s.ID, now); err != nil {
+			d.logger.Error().Err(err).Str("hash", s.ID).Msg("failed to save stalled download")
+			continue
+		}
+		d.logger.Warn().Str("hash", s.ID).Str("reason", reason).Msg("download stalled")
+		d.events.Publish(events.Event{Type: events.DownloadStalled, Downloader: d.name, ID: s.ID, Title: s.ResTitle, Progress: s.DownloadProgress, Error: reason})
+
+		removed := false
+		if d.stalled.Remove {
+			removed = d.removeStalled(&s, t)
+		}
+		d.notifyStalled(&s, reason, removed)
+	}
+}
+
+// removeStalled removes t with its data. Stalled downloads are unfinished,
+// hit-and-run protection doesn't apply.
+func (d *Downloader) removeStalled(s *db.DownloadStatus, t *Torrent) bool {
+	if err := d.backend.Remove(context.Background(), []*Torrent{t}, true); err != nil {
+		d.logger.Error().Err(err).Str("hash", s.ID).Msg("failed to remove stalled download")
+		return false
+	}
+	if err := db.UpdateDownloadStateForStatuses(d.db, []string{s.ID}, db.DownloadDeleted); err != nil {
+		d.logger.Error().Err(err).Str("hash", s.ID).Msg("failed to update download status")
+		return false
+	}
+	s.State = db.DownloadDeleted
+	d.publish(events.DownloadDeleted, s.ID, s.ResTitle)
+	return true
+}
+
+func (d *Downloader) notifyStalled(s *db.DownloadStatus, reason string, removed bool) {
+	if d.notifier == nil {
+		return
+	}
+
+	msg := fmt.Sprintf("🐌 Stalled: %s in %s at %.1f%%, %s for %dh.",
+		s.ResTitle, d.name, float64(s.DownloadProgress)/10, reason, d.stalled.AfterHours)
+	if removed {
+		msg += " It is removed."
+	}
+	if d.stalled.Replace != "" {
+		msg += " Searching for an alternative release."
+	}
+	if err := d.notifier.SendMessage(msg); err != nil {
+		d.logger.Error().Err(err).Msg("failed to send stalled notification")
+	}
+}
@@ -0,0 +1,61 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStalled(t *testing.T) {
+	backend := &fakeBackend{
+		torrents: []*Torrent{
+			{Hash: "1", Status: StatusDownloading, Progress: 0.03, Peers: 3},
+			{Hash: "2", Status: StatusDownloading, Progress: 0.03, Peers: 0},
+			{Hash: "3", Status: StatusDownloading, Progress: 0.05, Peers: 2},
+			{Hash: "4", Status: StatusStopped, Progress: 0.03, Peers: 0},
+		},
+		// busy, skip copying
+		speed: 3 * 1000 * 1000,
+	}
+	notifier := &fakeNotifier{}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{
+		Stalled: &config.Stalled{AfterHours: 24, Remove: true},
+	}, notifier)
+
+	recent := time.Now().Add(-time.Hour)
+	old := time.Now().AddDate(0, 0, -2)
+	for _, s := range []*db.DownloadStatus{
+		// no progress.
+		{ID: "1", DownloadProgress: 30, ProgressAt: &old, PeersAt: &recent, ResTitle: "Dead"},
+		// progress, but no peers.
+		{ID: "2", DownloadProgress: 30, ProgressAt: &recent, PeersAt: &old, ResTitle: "Lonely"},
+		// progress with peers.
+		{ID: "3", DownloadProgress: 30, ProgressAt: &old, PeersAt: &old},
+		// paused time doesn't count.
+		{ID: "4", DownloadProgress: 30, ProgressAt: &old, PeersAt: &old},
+	} {
+		s.Downloader = "test"
+		s.State = db.DownloadStarted
+		require.NoError(t, d.Create(s).Error)
+	}
+
+	downloader.ProgressChecker()
+
+	assert.Equal(t, []string{"delete 1", "delete 2"}, backend.calls)
+	for id, stalled := range map[string]bool{"1": true, "2": true, "3": false, "4": false} {
+		r, err := db.GetDownloadStatus(d, id)
+		require.NoError(t, err)
+		assert.Equal(t, stalled, r.StalledAt != nil, id)
+		if stalled {
+			assert.Equal(t, db.DownloadDeleted, r.State, id)
+		}
+	}
+
+	require.Len(t, notifier.messages, 2)
+	assert.Equal(t, "🐌 Stalled: Dead in test at 3.0%, no progress for 24h. It is removed.", notifier.messages[0])
+	assert.Equal(t, "🐌 Stalled: Lonely in test at 3.0%, no peers for 24h. It is removed.", notifier.messages[1])
+}
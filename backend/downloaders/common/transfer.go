@@ -0,0 +1,202 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+)
+
+// tailBlock is the size of the tail compared to tell a file left by an
+// interrupted run is of the source.
+const tailBlock = 64 * 1024
+
+// transferFile puts from at target by the transfer mode, falling back to copy
+// when the mode doesn't work across file systems or on this one, then checks
+// the size of target. progress is called with bytes transferred.
+func (d *Downloader) transferFile(from, target string, progress func(n int64)) error {
+	fromInfo, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	// done by an interrupted run.
+	if targetInfo, err := os.Lstat(target); err == nil && targetInfo.Mode().IsRegular() && targetInfo.Size() == fromInfo.Size() &&
+		sameTailOfFiles(from, target, fromInfo.Size()) {
+		progress(fromInfo.Size())
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	// a link can't replace a file left by a previous try.
+	os.Remove(target)
+
+	linked := true
+	switch d.transferMode {
+	case config.TransferHardlink:
+		err = os.Link(from, target)
+	case config.TransferReflink:
+		err = reflink(from, target)
+	case config.TransferSymlink:
+		var abs string
+		if abs, err = filepath.Abs(from); err == nil {
+			err = os.Symlink(abs, target)
+		}
+	default:
+		linked = false
+		err = copyFile(from, target, progress)
+	}
+	if err != nil && linked && copyInstead(err) {
+		d.logger.Debug().Err(err).Str("file", from).Str("mode", d.transferMode).Msg("fall back to copy")
+		linked = false
+		err = copyFile(from, target, progress)
+	}
+	if err != nil {
+		return err
+	}
+	if linked {
+		progress(fromInfo.Size())
+	}
+	return verifySize(from, target)
+}
+
+// copyInstead tells if a link or clone failed for the file system.
+func copyInstead(err error) bool {
+	return errors.Is(err, syscall.EXDEV) || errors.Is(err, syscall.EOPNOTSUPP) ||
+		errors.Is(err, syscall.EINVAL) || errors.Is(err, ErrNotSupported)
+}
+
+// copyFile copies from to target through target.part, resuming the part left
+// by an interrupted copy.
+func copyFile(from, target string, progress func(n int64)) error {
+	fromFile, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer fromFile.Close()
+
+	fromInfo, err := fromFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	part := target + ".part"
+	partFile, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	offset, err := resumeAt(partFile, fromFile, fromInfo.Size())
+	if err != nil {
+		partFile.Close()
+		return err
+	}
+	progress(offset)
+
+	_, err = io.Copy(partFile, &progressReader{r: fromFile, progress: progress})
+	if closeErr := partFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// the part is kept to resume.
+		return err
+	}
+	return os.Rename(part, target)
+}
+
+// resumeAt seeks both files to the end of the part, starting over if the part
+// is larger than the source or its tail differs.
+func resumeAt(part *os.File, from *os.File, size int64) (int64, error) {
+	offset, err := part.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if offset > size || !sameTail(part, from, offset) {
+		if err := part.Truncate(0); err != nil {
+			return 0, err
+		}
+		if offset, err = part.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := from.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return offset, nil
+}
+
+// sameTail tells if a and b have the same block ending at offset.
+func sameTail(a, b *os.File, offset int64) bool {
+	n := min(offset, tailBlock)
+	ba, bb := make([]byte, n), make([]byte, n)
+	if _, err := a.ReadAt(ba, offset-n); err != nil {
+		return false
+	}
+	if _, err := b.ReadAt(bb, offset-n); err != nil {
+		return false
+	}
+	return bytes.Equal(ba, bb)
+}
+
+func sameTailOfFiles(a, b string, size int64) bool {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false
+	}
+	defer fb.Close()
+	return sameTail(fa, fb, size)
+}
+
+type progressReader struct {
+	r        io.Reader
+	progress func(n int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.progress(int64(n))
+	}
+	return n, err
+}
+
+func verifySize(from, target string) error {
+	fromInfo, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	targetInfo, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if fromInfo.Size() != targetInfo.Size() {
+		os.Remove(target)
+		return fmt.Errorf("size of %s is %d, want %d", target, targetInfo.Size(), fromInfo.Size())
+	}
+	return nil
+}
+
+// takesSpace tells if transferring files from one dir to another uses space
+// of the latter. Reflinks are counted as copies, as not all file systems
+// support them.
+func (d *Downloader) takesSpace(from, to *DiskUsage) bool {
+	switch d.transferMode {
+	case config.TransferSymlink:
+		return false
+	case config.TransferHardlink:
+		return from.dev != to.dev
+	default:
+		return true
+	}
+}
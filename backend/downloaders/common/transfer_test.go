@@ -0,0 +1,178 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferFile(t *testing.T) {
+	tests := []struct {
+		mode      string
+		sameFile  bool
+		isSymlink bool
+	}{
+		{mode: ""},
+		{mode: config.TransferCopy},
+		{mode: config.TransferHardlink, sameFile: true},
+		// falls back to copy without reflink support.
+		{mode: config.TransferReflink},
+		{mode: config.TransferSymlink, sameFile: true, isSymlink: true},
+	}
+
+	for _, tt := range tests {
+		t.Run("mode "+tt.mode, func(t *testing.T) {
+			dir := t.TempDir()
+			from := filepath.Join(dir, "download", "file.mkv")
+			target := filepath.Join(dir, "finished", "hash", "sub", "file.mkv")
+			require.NoError(t, os.MkdirAll(filepath.Dir(from), 0755))
+			require.NoError(t, os.WriteFile(from, []byte("hello world"), 0644))
+
+			// left by a previous try.
+			require.NoError(t, os.MkdirAll(filepath.Dir(target), 0755))
+			require.NoError(t, os.WriteFile(target, []byte("hello"), 0644))
+
+			d := &Downloader{transferMode: tt.mode}
+			var transferred int64
+			require.NoError(t, d.transferFile(from, target, func(n int64) { transferred += n }))
+			assert.Equal(t, int64(len("hello world")), transferred)
+
+			got, err := os.ReadFile(target)
+			require.NoError(t, err)
+			assert.Equal(t, "hello world", string(got))
+
+			fromInfo, err := os.Stat(from)
+			require.NoError(t, err)
+			targetInfo, err := os.Stat(target)
+			require.NoError(t, err)
+			assert.Equal(t, tt.sameFile, os.SameFile(fromInfo, targetInfo))
+
+			linkInfo, err := os.Lstat(target)
+			require.NoError(t, err)
+			assert.Equal(t, tt.isSymlink, linkInfo.Mode()&os.ModeSymlink != 0)
+		})
+	}
+}
+
+func TestTransferFileDone(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		rewritten bool
+	}{
+		{name: "done", target: "hello world"},
+		{name: "same size other file", target: "hello earth", rewritten: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			from := filepath.Join(dir, "file.mkv")
+			target := filepath.Join(dir, "copy.mkv")
+			require.NoError(t, os.WriteFile(from, []byte("hello world"), 0644))
+			require.NoError(t, os.WriteFile(target, []byte(tt.target), 0644))
+			old := time.Now().Add(-time.Hour).Truncate(time.Second)
+			require.NoError(t, os.Chtimes(target, old, old))
+
+			d := &Downloader{transferMode: config.TransferCopy}
+			require.NoError(t, d.transferFile(from, target, func(n int64) {}))
+
+			got, err := os.ReadFile(target)
+			require.NoError(t, err)
+			assert.Equal(t, "hello world", string(got))
+			info, err := os.Stat(target)
+			require.NoError(t, err)
+			assert.Equal(t, tt.rewritten, !info.ModTime().Equal(old))
+		})
+	}
+}
+
+func TestTransferRetryAt(t *testing.T) {
+	failedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		attempts int
+		want     time.Time
+	}{
+		{attempts: 0, want: time.Time{}},
+		{attempts: 1, want: failedAt.Add(5 * time.Minute)},
+		{attempts: 2, want: failedAt.Add(10 * time.Minute)},
+		{attempts: 4, want: failedAt.Add(40 * time.Minute)},
+		{attempts: 100, want: failedAt.Add(6 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		s := &db.DownloadStatus{TransferAttempts: tt.attempts, TransferFailedAt: &failedAt}
+		assert.Equal(t, tt.want, transferRetryAt(s), "attempts %d", tt.attempts)
+	}
+}
+
+func TestTakesSpace(t *testing.T) {
+	sameDev := &DiskUsage{dev: 1}
+	otherDev := &DiskUsage{dev: 2}
+
+	tests := []struct {
+		mode string
+		to   *DiskUsage
+		want bool
+	}{
+		{mode: "", to: sameDev, want: true},
+		{mode: config.TransferCopy, to: sameDev, want: true},
+		{mode: config.TransferHardlink, to: sameDev, want: false},
+		{mode: config.TransferHardlink, to: otherDev, want: true},
+		{mode: config.TransferReflink, to: sameDev, want: true},
+		{mode: config.TransferSymlink, to: otherDev, want: false},
+	}
+
+	for _, tt := range tests {
+		d := &Downloader{transferMode: tt.mode}
+		assert.Equal(t, tt.want, d.takesSpace(sameDev, tt.to), "mode %q", tt.mode)
+	}
+}
+
+func TestCopyFileResume(t *testing.T) {
+	tests := []struct {
+		name        string
+		part        string
+		wantResumed int64
+	}{
+		{name: "no part", part: "", wantResumed: 0},
+		{name: "resume part", part: "hello", wantResumed: 5},
+		{name: "part larger than source", part: "hello world and more", wantResumed: 0},
+		{name: "part of other file", part: "jelly", wantResumed: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			from := filepath.Join(dir, "file.mkv")
+			target := filepath.Join(dir, "copy.mkv")
+			require.NoError(t, os.WriteFile(from, []byte("hello world"), 0644))
+			if tt.part != "" {
+				require.NoError(t, os.WriteFile(target+".part", []byte(tt.part), 0644))
+			}
+
+			var calls []int64
+			require.NoError(t, copyFile(from, target, func(n int64) { calls = append(calls, n) }))
+
+			got, err := os.ReadFile(target)
+			require.NoError(t, err)
+			assert.Equal(t, "hello world", string(got))
+			assert.NoFileExists(t, target+".part")
+
+			// the resumed offset is reported first.
+			require.NotEmpty(t, calls)
+			assert.Equal(t, tt.wantResumed, calls[0])
+			var total int64
+			for _, n := range calls {
+				total += n
+			}
+			assert.Equal(t, int64(len("hello world")), total)
+		})
+	}
+}
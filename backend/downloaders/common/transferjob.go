@@ -0,0 +1,223 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/events"
+)
+
+// transferQueueSize bounds queued transfers, downloads not queued are tried
+// again by the next progress check.
+const transferQueueSize = 64
+
+// minProgressInterval throttles saving transfer progress.
+const minProgressInterval = time.Second
+
+// A failed transfer is tried again after transferBackoff, doubled by each
+// other failure up to maxTransferBackoff.
+const (
+	transferBackoff    = 5 * time.Minute
+	maxTransferBackoff = 6 * time.Hour
+)
+
+// transferJobs transfers finished downloads to the finished dir in background
+// workers, one job per download.
+type transferJobs struct {
+	once  sync.Once
+	queue chan *transferJob
+
+	mu sync.Mutex
+	// pending are IDs of queued or running downloads.
+	pending map[string]bool
+	running map[string]bool
+	wg      sync.WaitGroup
+}
+
+type transferJob struct {
+	t  *Torrent
+	id string
+}
+
+func (d *Downloader) startTransferWorkers() {
+	d.transfers.queue = make(chan *transferJob, transferQueueSize)
+	d.transfers.pending = map[string]bool{}
+	d.transfers.running = map[string]bool{}
+	for range d.transferWorkers {
+		go func() {
+			for job := range d.transfers.queue {
+				d.transfers.mu.Lock()
+				d.transfers.running[job.id] = true
+				d.transfers.mu.Unlock()
+
+				d.runTransfer(job)
+
+				d.transfers.mu.Lock()
+				delete(d.transfers.pending, job.id)
+				delete(d.transfers.running, job.id)
+				d.transfers.mu.Unlock()
+				d.transfers.wg.Done()
+			}
+		}()
+	}
+}
+
+// enqueueTransfer queues a transfer unless the download is already queued,
+// it tells if the job is queued.
+func (d *Downloader) enqueueTransfer(job *transferJob) bool {
+	d.transfers.once.Do(d.startTransferWorkers)
+
+	d.transfers.mu.Lock()
+	defer d.transfers.mu.Unlock()
+
+	if d.transfers.pending[job.id] {
+		return false
+	}
+	select {
+	case d.transfers.queue <- job:
+		d.transfers.pending[job.id] = true
+		d.transfers.wg.Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitTransfers blocks until queued transfers are done.
+func (d *Downloader) WaitTransfers() {
+	d.transfers.wg.Wait()
+}
+
+// transferPending tells if the download is queued or running.
+func (d *Downloader) transferPending(id string) bool {
+	d.transfers.mu.Lock()
+	defer d.transfers.mu.Unlock()
+	return d.transfers.pending[id]
+}
+
+// transferState returns PostProcessQueued or PostProcessRunning for a
+// pending download, empty otherwise.
+func (d *Downloader) transferState(id string) string {
+	d.transfers.mu.Lock()
+	defer d.transfers.mu.Unlock()
+	switch {
+	case d.transfers.running[id]:
+		return PostProcessRunning
+	case d.transfers.pending[id]:
+		return PostProcessQueued
+	}
+	return ""
+}
+
+// copyFinishedDownloads queues transfers of finished downloads, reasons get
+// why downloads not queued wait.
+func (d *Downloader) copyFinishedDownloads(torrentsByHash map[string]*Torrent, speed int64, now time.Time, reasons map[string]string) {
+	statuses, err := db.GetFinishedUnmoveedDownloadStatusByDownloader(d.db, d.name)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to get seeding download status")
+		return
+	}
+
+	for _, s := range statuses {
+		if d.transferPending(s.ID) {
+			continue
+		}
+		if at := transferRetryAt(&s); now.Before(at) {
+			reasons[s.ID] = fmt.Sprintf("transfer failed %d times, retry at %s: %s", s.TransferAttempts, at.Format(time.DateTime), s.TransferError)
+			continue
+		}
+		t, ok := torrentsByHash[s.ID]
+		if !ok {
+			reasons[s.ID] = "torrent not in downloader"
+			continue
+		}
+		if r := d.waitReason(speed, waitingSince(&s), now); r != "" {
+			reasons[s.ID] = r
+			continue
+		}
+
+		if err := d.backend.Files(context.Background(), t); err != nil {
+			d.logger.Error().Err(err).Str("hash", t.Hash).Msg("failed to get torrent files")
+			reasons[s.ID] = "failed to get torrent files: " + err.Error()
+			continue
+		}
+
+		if !d.enqueueTransfer(&transferJob{t: t, id: s.ID}) {
+			reasons[s.ID] = "transfer queue full"
+		}
+	}
+}
+
+// transferRetryAt is when a failed transfer of s is tried again, zero if it
+// didn't fail.
+func transferRetryAt(s *db.DownloadStatus) time.Time {
+	if s.TransferAttempts == 0 || s.TransferFailedAt == nil {
+		return time.Time{}
+	}
+	backoff := transferBackoff
+	for i := 1; i < s.TransferAttempts && backoff < maxTransferBackoff; i++ {
+		backoff *= 2
+	}
+	return s.TransferFailedAt.Add(min(backoff, maxTransferBackoff))
+}
+
+// runTransfer transfers files of the job, saving progress on the download
+// status. Files done by an interrupted run are skipped and partial copies
+// resumed.
+func (d *Downloader) runTransfer(job *transferJob) {
+	t := job.t
+	if !d.enoughSpaceToCopy(t) {
+		return
+	}
+
+	var total int64
+	for _, name := range t.Files {
+		if fi, err := os.Stat(filepath.Join(t.Dir, name)); err == nil {
+			total += fi.Size()
+		}
+	}
+
+	var done int64
+	var saved uint16
+	var savedAt time.Time
+	progress := func(n int64) {
+		done += n
+		if total <= 0 || time.Since(savedAt) < minProgressInterval {
+			return
+		}
+		if p := uint16(min(done*1000/total, 999)); p != saved {
+			saved, savedAt = p, time.Now()
+			if err := db.UpdateMoveProgress(d.db, job.id, p); err != nil {
+				d.logger.Error().Err(err).Str("hash", t.Hash).Msg("failed to save transfer progress")
+			}
+		}
+	}
+
+	start := time.Now()
+	for _, name := range t.Files {
+		from := filepath.Join(t.Dir, name)
+		target := filepath.Join(d.dirs.FinishedDir, job.id, name)
+
+		if err := d.transferFile(from, target, progress); err != nil {
+			d.logger.Error().Err(err).Str("file", from).Msg("failed to transfer file")
+			if err := db.SetTransferFailed(d.db, job.id, err.Error(), time.Now()); err != nil {
+				d.logger.Error().Err(err).Str("hash", t.Hash).Msg("failed to save transfer failure")
+			}
+			d.events.Publish(events.Event{Type: events.DownloadFailed, Downloader: d.name, ID: job.id, Title: t.Name, Error: "transfer: " + err.Error()})
+			return
+		}
+	}
+
+	// add files based on path from downloader.
+	if err := db.SetMoved(d.db, job.id, t.Files); err != nil {
+		d.logger.Error().Err(err).Str("hash", t.Hash).Msg("failed to update download status")
+		return
+	}
+	d.logger.Info().Str("hash", t.Hash).Int64("bytes", total).Dur("took", time.Since(start)).Msg("transferred files")
+	d.publish(events.DownloadMoved, job.id, t.Name)
+}
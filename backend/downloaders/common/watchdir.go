@@ -0,0 +1,111 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"gorm.io/gorm"
+)
+
+// TorrentFileAdder is implemented by backends without a watch dir, Downloader
+// adds .torrent files found in TorrentsDir through it.
+type TorrentFileAdder interface {
+	AddTorrentFile(ctx context.Context, name string, data []byte) error
+}
+
+// URIAdder is implemented by backends downloading magnets and direct links,
+// Downloader adds URIs in .magnet and .url files in TorrentsDir through it.
+type URIAdder interface {
+	// AddURI returns ID of the download, used as its DownloadStatus ID.
+	AddURI(ctx context.Context, uri string) (string, error)
+}
+
+// addWatchedFiles adds files in TorrentsDir the backend can take, and renames
+// them to *.added like transmission does.
+func (d *Downloader) addWatchedFiles() {
+	torrentAdder, _ := d.backend.(TorrentFileAdder)
+	uriAdder, _ := d.backend.(URIAdder)
+	if torrentAdder == nil && uriAdder == nil {
+		return
+	}
+	// files are left in the dir until intake resumes.
+	if d.disk.intakePaused.Load() {
+		return
+	}
+
+	entries, err := os.ReadDir(d.dirs.TorrentsDir)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("failed to read torrents dir")
+		return
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		var add func(data []byte) error
+		switch filepath.Ext(e.Name()) {
+		case ".torrent":
+			if torrentAdder == nil {
+				continue
+			}
+			add = func(data []byte) error {
+				return torrentAdder.AddTorrentFile(context.Background(), e.Name(), data)
+			}
+		case ".magnet", ".url":
+			if uriAdder == nil {
+				continue
+			}
+			add = func(data []byte) error {
+				return d.addURI(uriAdder, strings.TrimSpace(string(data)))
+			}
+		default:
+			continue
+		}
+
+		path := filepath.Join(d.dirs.TorrentsDir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			d.logger.Error().Err(err).Str("file", path).Msg("failed to read watched file")
+			continue
+		}
+
+		if err := add(data); err != nil {
+			d.logger.Error().Err(err).Str("file", path).Msg("failed to add download")
+			continue
+		}
+
+		if err := os.Rename(path, path+".added"); err != nil {
+			d.logger.Error().Err(err).Str("file", path).Msg("failed to rename added file")
+		}
+	}
+}
+
+// addURI adds the uri and tracks it, magnets and links have no torrent file
+// for indexers to record the download with.
+func (d *Downloader) addURI(adder URIAdder, uri string) error {
+	id, err := adder.AddURI(context.Background(), uri)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.GetDownloadStatus(d.db, id)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return db.SaveDownloadStatus(d.db, &db.DownloadStatus{
+		ID:         id,
+		Downloader: d.name,
+		State:      db.DownloadStarted,
+		ResTitle:   uri,
+	})
+}
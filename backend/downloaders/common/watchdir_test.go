@@ -0,0 +1,70 @@
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWatchBackend takes files of the watch dir.
+type fakeWatchBackend struct {
+	*fakeBackend
+	files map[string][]byte
+	uris  []string
+}
+
+func (f *fakeWatchBackend) AddTorrentFile(ctx context.Context, name string, data []byte) error {
+	f.files[name] = data
+	return nil
+}
+
+func (f *fakeWatchBackend) AddURI(ctx context.Context, uri string) (string, error) {
+	f.uris = append(f.uris, uri)
+	return "gid1", nil
+}
+
+func TestAddWatchedFiles(t *testing.T) {
+	backend := &fakeWatchBackend{fakeBackend: &fakeBackend{}, files: map[string][]byte{}}
+	downloader, d := newTestDownloader(t, backend, &config.DownloaderConfig{}, nil)
+	downloader.dirs.TorrentsDir = t.TempDir()
+
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(downloader.dirs.TorrentsDir, name), []byte(content), 0644))
+	}
+	write("1.torrent", "torrent 1")
+	write("2.magnet", "magnet:?xt=urn:btih:2\n")
+	write("3.txt", "not a download")
+	// added before.
+	write("4.torrent.added", "torrent 4")
+
+	downloader.ProgressChecker()
+
+	assert.Equal(t, map[string][]byte{"1.torrent": []byte("torrent 1")}, backend.files)
+	assert.Equal(t, []string{"magnet:?xt=urn:btih:2"}, backend.uris)
+
+	entries, err := os.ReadDir(downloader.dirs.TorrentsDir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"1.torrent.added", "2.magnet.added", "3.txt", "4.torrent.added"}, names)
+
+	// uris are tracked, they have no torrent file to record them with.
+	r, err := db.GetDownloadStatus(d, "gid1")
+	require.NoError(t, err)
+	assert.Equal(t, db.DownloadStarted, r.State)
+	assert.Equal(t, "magnet:?xt=urn:btih:2", r.ResTitle)
+
+	// files taken are not added again.
+	backend.files = map[string][]byte{}
+	downloader.ProgressChecker()
+	assert.Empty(t, backend.files)
+	assert.Len(t, backend.uris, 1)
+}
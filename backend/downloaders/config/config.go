@@ -2,6 +2,9 @@ package config
 
 import (
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/autoget-project/autoget/backend/internal/db"
 )
@@ -31,42 +34,641 @@ func (c *TransmissionConfig) Validate() error {
 	return nil
 }
 
-// SeedingPolicy we use at least X MB uploaded in last Y days as
-// a condition to continue seeding.
+type QBittorrentConfig struct {
+	URL         string `yaml:"url"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	TorrentsDir string `yaml:"torrents_dir"`
+	DownloadDir string `yaml:"download_dir"`
+	FinishedDir string `yaml:"finished_dir"`
+
+	// Category limits AutoGet to torrents in this category, empty for all.
+	Category string `yaml:"category"`
+	// SavePath is DownloadDir as seen by qBittorrent, when qBittorrent runs
+	// with a different filesystem layout, e.g. in a container.
+	SavePath string `yaml:"save_path"`
+}
+
+func (c *QBittorrentConfig) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("qbittorrent Web API URL is required")
+	}
+	if c.TorrentsDir == "" {
+		return fmt.Errorf("torrents directory is required")
+	}
+	if c.DownloadDir == "" {
+		return fmt.Errorf("download directory is required")
+	}
+	if c.FinishedDir == "" {
+		return fmt.Errorf("finished directory is required")
+	}
+	return nil
+}
+
+type DelugeConfig struct {
+	// URL of Deluge Web UI, the JSON-RPC endpoint is URL/json.
+	URL         string `yaml:"url"`
+	Password    string `yaml:"password"`
+	TorrentsDir string `yaml:"torrents_dir"`
+	DownloadDir string `yaml:"download_dir"`
+	FinishedDir string `yaml:"finished_dir"`
+
+	// HostID of the daemon to connect Web UI to, the first host by default.
+	HostID string `yaml:"host_id"`
+	// Label is set on added torrents and limits AutoGet to torrents with it,
+	// requires the label plugin. Empty for all torrents.
+	Label string `yaml:"label"`
+}
+
+func (c *DelugeConfig) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("deluge Web UI URL is required")
+	}
+	if c.TorrentsDir == "" {
+		return fmt.Errorf("torrents directory is required")
+	}
+	if c.DownloadDir == "" {
+		return fmt.Errorf("download directory is required")
+	}
+	if c.FinishedDir == "" {
+		return fmt.Errorf("finished directory is required")
+	}
+	return nil
+}
+
+type Aria2Config struct {
+	// URL of aria2 JSON-RPC, e.g. http://aria2:6800/jsonrpc.
+	URL string `yaml:"url"`
+	// Secret is the --rpc-secret of aria2.
+	Secret      string `yaml:"secret"`
+	TorrentsDir string `yaml:"torrents_dir"`
+	DownloadDir string `yaml:"download_dir"`
+	FinishedDir string `yaml:"finished_dir"`
+}
+
+func (c *Aria2Config) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("aria2 RPC URL is required")
+	}
+	if c.TorrentsDir == "" {
+		return fmt.Errorf("torrents directory is required")
+	}
+	if c.DownloadDir == "" {
+		return fmt.Errorf("download directory is required")
+	}
+	if c.FinishedDir == "" {
+		return fmt.Errorf("finished directory is required")
+	}
+	return nil
+}
+
+type RTorrentConfig struct {
+	// URL of rTorrent XML-RPC: http(s)://host/RPC2 through a web server,
+	// scgi://host:port or scgi:///path/to/socket.
+	URL string `yaml:"url"`
+	// Username and Password for HTTP basic auth, optional.
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	TorrentsDir string `yaml:"torrents_dir"`
+	DownloadDir string `yaml:"download_dir"`
+	FinishedDir string `yaml:"finished_dir"`
+
+	// Label is set as custom1 (ruTorrent label) on added torrents and limits
+	// AutoGet to torrents with it. Empty for all torrents.
+	Label string `yaml:"label"`
+	// SavePath is DownloadDir as seen by rTorrent, when rTorrent runs with a
+	// different filesystem layout, e.g. in a container.
+	SavePath string `yaml:"save_path"`
+}
+
+func (c *RTorrentConfig) Validate() error {
+	if c.URL == "" {
+		return fmt.Errorf("rtorrent XML-RPC URL is required")
+	}
+	if c.TorrentsDir == "" {
+		return fmt.Errorf("torrents directory is required")
+	}
+	if c.DownloadDir == "" {
+		return fmt.Errorf("download directory is required")
+	}
+	if c.FinishedDir == "" {
+		return fmt.Errorf("finished directory is required")
+	}
+	return nil
+}
+
+// EmbeddedConfig runs a torrent engine in AutoGet itself.
+type EmbeddedConfig struct {
+	TorrentsDir string `yaml:"torrents_dir"`
+	DownloadDir string `yaml:"download_dir"`
+	FinishedDir string `yaml:"finished_dir"`
+	// DataDir keeps added torrents and resume state.
+	DataDir string `yaml:"data_dir"`
+
+	// ListenPort for peers, 0 picks a random port.
+	ListenPort int `yaml:"listen_port"`
+	// Rate limits in KB/s, 0 for unlimited.
+	UploadRateLimitKB   int  `yaml:"upload_rate_limit_kb"`
+	DownloadRateLimitKB int  `yaml:"download_rate_limit_kb"`
+	NoDHT               bool `yaml:"no_dht"`
+	NoUPnP              bool `yaml:"no_upnp"`
+}
+
+func (c *EmbeddedConfig) Validate() error {
+	if c.DataDir == "" {
+		return fmt.Errorf("data directory is required")
+	}
+	if c.TorrentsDir == "" {
+		return fmt.Errorf("torrents directory is required")
+	}
+	if c.DownloadDir == "" {
+		return fmt.Errorf("download directory is required")
+	}
+	if c.FinishedDir == "" {
+		return fmt.Errorf("finished directory is required")
+	}
+	if c.ListenPort < 0 || c.ListenPort > 65535 {
+		return fmt.Errorf("invalid listen port: %d", c.ListenPort)
+	}
+	if c.UploadRateLimitKB < 0 || c.DownloadRateLimitKB < 0 {
+		return fmt.Errorf("rate limits can not be negative")
+	}
+	return nil
+}
+
+// Actions on torrents done seeding.
+const (
+	SeedingActionStop       = "stop"
+	SeedingActionRemove     = "remove"
+	SeedingActionRemoveData = "remove_data"
+)
+
+// SeedingPolicy decides when a torrent is done seeding. Policies match
+// torrents by Indexer, Category and Tracker, empty ones match all, and the
+// most specific matching policy applies.
+//
+// A torrent is done seeding after MaxSeedHours, or once it reaches
+// MinRatio and MinSeedHours and, with an idle-upload rule, uploaded no more
+// than UploadAtLeastInMB in the last IntervalInDays.
 type SeedingPolicy struct {
+	Indexer  string `yaml:"indexer"`
+	Category string `yaml:"category"`
+	// Tracker is part of a tracker url, e.g. tracker.example.org.
+	Tracker string `yaml:"tracker"`
+
+	MinRatio     float64 `yaml:"min_ratio"`
+	MinSeedHours int     `yaml:"min_seed_hours"`
+	MaxSeedHours int     `yaml:"max_seed_hours"`
+
 	IntervalInDays    int   `yaml:"interval_in_days"`
 	UploadAtLeastInMB int64 `yaml:"upload_at_least_in_mb"`
+
+	// Action is stop, remove or remove_data, stop by default. Stopped
+	// torrents are removed with data once copied to finished dir, removing
+	// waits for the copy.
+	Action string `yaml:"action"`
 }
 
 func (p *SeedingPolicy) Validate() error {
-	if p.IntervalInDays == 0 {
-		return fmt.Errorf("interval in days is required")
+	if p.MinRatio < 0 || p.MinSeedHours < 0 || p.MaxSeedHours < 0 || p.IntervalInDays < 0 || p.UploadAtLeastInMB < 0 {
+		return fmt.Errorf("seeding policy values can not be negative")
 	}
 	if p.IntervalInDays > db.StoreMaxDays {
 		return fmt.Errorf("interval in days should be less than 30")
 	}
-	if p.UploadAtLeastInMB == 0 {
+	if p.IntervalInDays == 0 && p.UploadAtLeastInMB != 0 {
+		return fmt.Errorf("interval in days is required")
+	}
+	if p.IntervalInDays != 0 && p.UploadAtLeastInMB == 0 {
 		return fmt.Errorf("upload at least in MB is required")
 	}
+	if p.MinRatio == 0 && p.MinSeedHours == 0 && p.MaxSeedHours == 0 && p.IntervalInDays == 0 {
+		return fmt.Errorf("seeding policy needs a ratio, seed time or idle-upload rule")
+	}
+	if p.MaxSeedHours != 0 && p.MaxSeedHours < p.MinSeedHours {
+		return fmt.Errorf("max seed hours should not be less than min seed hours")
+	}
+	switch p.Action {
+	case "", SeedingActionStop, SeedingActionRemove, SeedingActionRemoveData:
+	default:
+		return fmt.Errorf("invalid seeding action %q", p.Action)
+	}
+	return nil
+}
+
+// Specificity is the number of fields the policy matches on.
+func (p *SeedingPolicy) Specificity() int {
+	n := 0
+	for _, f := range []string{p.Indexer, p.Category, p.Tracker} {
+		if f != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// HitAndRun protects torrents of private indexers from being stopped or
+// removed before they seeded MinSeedHours, or reached MinRatio if set.
+type HitAndRun struct {
+	MinSeedHours int     `yaml:"min_seed_hours"`
+	MinRatio     float64 `yaml:"min_ratio"`
+}
+
+func (h *HitAndRun) Validate() error {
+	if h.MinSeedHours <= 0 {
+		return fmt.Errorf("hit-and-run min seed hours is required")
+	}
+	if h.MinRatio < 0 {
+		return fmt.Errorf("hit-and-run min ratio can not be negative")
+	}
 	return nil
 }
 
+// Transfer modes of finished files to FinishedDir.
+const (
+	TransferCopy     = "copy"
+	TransferHardlink = "hardlink"
+	// TransferReflink clones files sharing blocks on file systems supporting
+	// it, e.g. btrfs or xfs.
+	TransferReflink = "reflink"
+	TransferSymlink = "symlink"
+)
+
+// DiskSpace pauses intake of new downloads while free space of the download
+// or finished dir is under MinFreeMB.
+type DiskSpace struct {
+	MinFreeMB int64 `yaml:"min_free_mb"`
+}
+
+func (d *DiskSpace) Validate() error {
+	if d.MinFreeMB <= 0 {
+		return fmt.Errorf("disk space min free MB is required")
+	}
+	return nil
+}
+
+// BandwidthSchedule limits speed of the downloader in a time window.
+type BandwidthSchedule struct {
+	// Days are weekdays of the window, e.g. mon or sat, every day if empty.
+	Days []string `yaml:"days"`
+	// Start and End in HH:MM, a window ending before it starts ends on the
+	// next day.
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+	// Limits in KB/s, 0 for unlimited.
+	UploadLimitKB   int64 `yaml:"upload_limit_kb"`
+	DownloadLimitKB int64 `yaml:"download_limit_kb"`
+	// AltSpeed turns on the alternative speed mode of Transmission or
+	// qBittorrent instead of limits.
+	AltSpeed bool `yaml:"alt_speed"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parseClock parses HH:MM to minutes of the day.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (s *BandwidthSchedule) Validate() error {
+	if err := validateWindow("bandwidth schedule", s.Days, s.Start, s.End); err != nil {
+		return err
+	}
+	if s.UploadLimitKB < 0 || s.DownloadLimitKB < 0 {
+		return fmt.Errorf("rate limits can not be negative")
+	}
+	return nil
+}
+
+// Contains tells if t is in the window, windows spanning midnight belong to
+// the day they start.
+func (s *BandwidthSchedule) Contains(t time.Time) bool {
+	return windowContains(s.Days, s.Start, s.End, t)
+}
+
+// TimeWindow is a time window of days, like in BandwidthSchedule.
+type TimeWindow struct {
+	Days  []string `yaml:"days"`
+	Start string   `yaml:"start"`
+	End   string   `yaml:"end"`
+}
+
+func (w *TimeWindow) Validate() error {
+	return validateWindow("time window", w.Days, w.Start, w.End)
+}
+
+func (w *TimeWindow) Contains(t time.Time) bool {
+	return windowContains(w.Days, w.Start, w.End, t)
+}
+
+func validateWindow(kind string, days []string, startClock, endClock string) error {
+	for _, d := range days {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("invalid day %q in %s", d, kind)
+		}
+	}
+	start, err := parseClock(startClock)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(endClock)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("%s %s-%s is empty", kind, startClock, endClock)
+	}
+	return nil
+}
+
+func windowContains(days []string, startClock, endClock string, t time.Time) bool {
+	start, _ := parseClock(startClock)
+	end, _ := parseClock(endClock)
+	now := t.Hour()*60 + t.Minute()
+
+	day := t.Weekday()
+	switch {
+	case start < end:
+		if now < start || now >= end {
+			return false
+		}
+	case now >= start:
+	case now < end:
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+
+	if len(days) == 0 {
+		return true
+	}
+	for _, d := range days {
+		if weekdays[strings.ToLower(d)] == day {
+			return true
+		}
+	}
+	return false
+}
+
 type DownloaderConfig struct {
 	Transmission  *TransmissionConfig `yaml:"transmission"`
+	QBittorrent   *QBittorrentConfig  `yaml:"qbittorrent"`
+	Deluge        *DelugeConfig       `yaml:"deluge"`
+	Aria2         *Aria2Config        `yaml:"aria2"`
+	RTorrent      *RTorrentConfig     `yaml:"rtorrent"`
+	Embedded      *EmbeddedConfig     `yaml:"embedded"`
 	SeedingPolicy *SeedingPolicy      `yaml:"seeding_policy"`
+	// SeedingPolicies are picked by the most specific match, the first one
+	// on ties. SeedingPolicy is kept as a policy matching all torrents.
+	SeedingPolicies []SeedingPolicy `yaml:"seeding_policies"`
+	HitAndRun       *HitAndRun      `yaml:"hit_and_run"`
+	DiskSpace       *DiskSpace      `yaml:"disk_space"`
+	// TransferMode puts finished files in FinishedDir, copy by default.
+	// Modes not working across file systems fall back to copy.
+	TransferMode   string          `yaml:"transfer_mode"`
+	PostProcessing *PostProcessing `yaml:"post_processing"`
+	// MaxActiveDownloads queues new downloads in AutoGet while as many are
+	// downloading, unlimited if 0.
+	MaxActiveDownloads int      `yaml:"max_active_downloads"`
+	Stalled            *Stalled `yaml:"stalled"`
+	// BandwidthSchedules apply in order, the first window containing now
+	// wins. Speed is unlimited out of windows.
+	BandwidthSchedules []BandwidthSchedule `yaml:"bandwidth_schedules"`
+}
+
+// Policies returns SeedingPolicies, then SeedingPolicy.
+func (c *DownloaderConfig) Policies() []SeedingPolicy {
+	policies := slices.Clone(c.SeedingPolicies)
+	if c.SeedingPolicy != nil {
+		policies = append(policies, *c.SeedingPolicy)
+	}
+	return policies
+}
+
+// Defaults of PostProcessing.
+const (
+	DefaultTransferWorkers = 2
+	DefaultBusySpeedMB     = 2
+	DefaultMaxWaitMinutes  = 6 * 60
+)
+
+// PostProcessing schedules transfers and organizer plans of finished
+// downloads. They wait while the downloader is busy downloading, except in
+// Windows or once a download waited MaxWaitMinutes.
+type PostProcessing struct {
+	// TransferWorkers transfer finished downloads in parallel,
+	// DefaultTransferWorkers if 0. Only transfers run in parallel, organizer
+	// plans are made one at a time.
+	TransferWorkers int `yaml:"transfer_workers"`
+	// BusySpeedMB is the download speed in MB/s the downloader is busy
+	// over, DefaultBusySpeedMB if 0, never busy if negative.
+	BusySpeedMB int64 `yaml:"busy_speed_mb"`
+	// Windows give post-processing IO priority, it runs in them however
+	// busy the downloader is.
+	Windows []TimeWindow `yaml:"windows"`
+	// MaxWaitMinutes forces post-processing of a download waiting longer,
+	// DefaultMaxWaitMinutes if 0, waits forever if negative.
+	MaxWaitMinutes int `yaml:"max_wait_minutes"`
+}
+
+func (p *PostProcessing) Validate() error {
+	if p.TransferWorkers < 0 {
+		return fmt.Errorf("transfer workers can not be negative")
+	}
+	for _, w := range p.Windows {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Workers returns the number of transfer workers.
+func (p *PostProcessing) Workers() int {
+	if p == nil || p.TransferWorkers == 0 {
+		return DefaultTransferWorkers
+	}
+	return p.TransferWorkers
+}
+
+// BusySpeed returns the busy download speed in bytes per second, 0 for
+// never busy.
+func (p *PostProcessing) BusySpeed() int64 {
+	switch {
+	case p == nil || p.BusySpeedMB == 0:
+		return DefaultBusySpeedMB * 1000 * 1000
+	case p.BusySpeedMB < 0:
+		return 0
+	}
+	return p.BusySpeedMB * 1000 * 1000
+}
+
+// MaxWait returns the wait forcing post-processing, 0 for forever.
+func (p *PostProcessing) MaxWait() time.Duration {
+	switch {
+	case p == nil || p.MaxWaitMinutes == 0:
+		return DefaultMaxWaitMinutes * time.Minute
+	case p.MaxWaitMinutes < 0:
+		return 0
+	}
+	return time.Duration(p.MaxWaitMinutes) * time.Minute
+}
+
+// InWindow tells if t is in one of Windows.
+func (p *PostProcessing) InWindow(t time.Time) bool {
+	if p == nil {
+		return false
+	}
+	for _, w := range p.Windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Replace modes of stalled downloads.
+const (
+	// ReplaceOffer notifies alternative releases to grab by hand.
+	ReplaceOffer = "offer"
+	// ReplaceGrab downloads the best alternative release, it requires Remove.
+	ReplaceGrab = "grab"
+)
+
+// Stalled detects downloads with no progress or no peers for AfterHours.
+// They are notified, then removed if Remove, and alternative releases of the
+// same title are searched if Replace is set.
+type Stalled struct {
+	AfterHours int  `yaml:"after_hours"`
+	Remove     bool `yaml:"remove"`
+	// Replace is ReplaceOffer, ReplaceGrab, or empty not to search.
+	Replace string `yaml:"replace"`
+	// Indexers to search, the indexer of the download if empty.
+	Indexers []string `yaml:"indexers"`
+}
+
+func (s *Stalled) Validate() error {
+	if s.AfterHours <= 0 {
+		return fmt.Errorf("stalled after hours must be positive")
+	}
+	switch s.Replace {
+	case "", ReplaceOffer:
+	case ReplaceGrab:
+		if !s.Remove {
+			return fmt.Errorf("stalled replace grab requires remove")
+		}
+	default:
+		return fmt.Errorf("invalid stalled replace %q", s.Replace)
+	}
+	return nil
+}
+
+// After returns AfterHours as a duration.
+func (s *Stalled) After() time.Duration {
+	return time.Duration(s.AfterHours) * time.Hour
 }
 
 func (c *DownloaderConfig) Validate() error {
-	if c.Transmission == nil {
-		return fmt.Errorf("transmission config is required")
+	backends := 0
+	if c.Transmission != nil {
+		backends++
+		if err := c.Transmission.Validate(); err != nil {
+			return err
+		}
 	}
-	if err := c.Transmission.Validate(); err != nil {
-		return err
+	if c.QBittorrent != nil {
+		backends++
+		if err := c.QBittorrent.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Deluge != nil {
+		backends++
+		if err := c.Deluge.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Aria2 != nil {
+		backends++
+		if err := c.Aria2.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.RTorrent != nil {
+		backends++
+		if err := c.RTorrent.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Embedded != nil {
+		backends++
+		if err := c.Embedded.Validate(); err != nil {
+			return err
+		}
+	}
+	if backends == 0 {
+		return fmt.Errorf("downloader backend config is required")
+	}
+	if backends > 1 {
+		return fmt.Errorf("only one downloader backend can be configured")
 	}
 	if c.SeedingPolicy != nil {
 		if err := c.SeedingPolicy.Validate(); err != nil {
 			return err
 		}
 	}
+	for _, p := range c.SeedingPolicies {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.HitAndRun != nil {
+		if err := c.HitAndRun.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.DiskSpace != nil {
+		if err := c.DiskSpace.Validate(); err != nil {
+			return err
+		}
+	}
+	switch c.TransferMode {
+	case "", TransferCopy, TransferHardlink, TransferReflink, TransferSymlink:
+	default:
+		return fmt.Errorf("invalid transfer mode %q", c.TransferMode)
+	}
+	if c.PostProcessing != nil {
+		if err := c.PostProcessing.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.MaxActiveDownloads < 0 {
+		return fmt.Errorf("max active downloads can not be negative")
+	}
+	if c.Stalled != nil {
+		if err := c.Stalled.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, s := range c.BandwidthSchedules {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+		if s.AltSpeed && c.Transmission == nil && c.QBittorrent == nil {
+			return fmt.Errorf("alt speed is only supported by transmission and qbittorrent")
+		}
+	}
 	return nil
 }
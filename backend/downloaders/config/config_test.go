@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBandwidthScheduleContains(t *testing.T) {
+	// 2025-01-06 is a monday.
+	at := func(day int, clock string) time.Time {
+		c, _ := time.Parse("15:04", clock)
+		return time.Date(2025, 1, day, c.Hour(), c.Minute(), 0, 0, time.Local)
+	}
+
+	workHours := &BandwidthSchedule{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "18:00"}
+	night := &BandwidthSchedule{Days: []string{"Fri"}, Start: "23:00", End: "07:00"}
+
+	tests := []struct {
+		name     string
+		schedule *BandwidthSchedule
+		time     time.Time
+		want     bool
+	}{
+		{name: "in work hours", schedule: workHours, time: at(6, "09:00"), want: true},
+		{name: "end is excluded", schedule: workHours, time: at(6, "18:00"), want: false},
+		{name: "before work hours", schedule: workHours, time: at(6, "08:59"), want: false},
+		{name: "weekend", schedule: workHours, time: at(11, "12:00"), want: false},
+		{name: "night starts on friday", schedule: night, time: at(10, "23:30"), want: true},
+		{name: "night goes on saturday", schedule: night, time: at(11, "06:59"), want: true},
+		{name: "night ends", schedule: night, time: at(11, "07:00"), want: false},
+		{name: "night of thursday", schedule: night, time: at(10, "06:00"), want: false},
+		{name: "every day", schedule: &BandwidthSchedule{Start: "22:00", End: "02:00"}, time: at(7, "01:00"), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, tt.schedule.Validate())
+			assert.Equal(t, tt.want, tt.schedule.Contains(tt.time))
+		})
+	}
+}
@@ -0,0 +1,455 @@
+package deluge
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/autoget-project/autoget/backend/downloaders/common"
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/notify"
+	"github.com/autoget-project/autoget/backend/organizer"
+	"gorm.io/gorm"
+)
+
+// errCodeNotAuthenticated is returned by Deluge Web when session is missing.
+const errCodeNotAuthenticated = 1
+
+var (
+	statusKeys = []string{"name", "state", "progress", "total_size", "total_uploaded", "save_path", "tracker_host", "num_peers", "num_seeds"}
+)
+
+// Client talks to Deluge Web JSON-RPC.
+type Client struct {
+	*common.Downloader
+
+	cfg    *config.DelugeConfig
+	rpcURL string
+	client *http.Client
+
+	mu     sync.Mutex
+	nextID int
+	// labels known to exist.
+	labels map[string]bool
+}
+
+func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, organizerClient *organizer.Client, notifier notify.INotifier) (*Client, error) {
+	u, err := url.Parse(cfg.Deluge.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	// session cookie from login is kept in jar.
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		cfg:    cfg.Deluge,
+		rpcURL: strings.TrimSuffix(u.String(), "/") + "/json",
+		client: &http.Client{Jar: jar},
+		labels: map[string]bool{},
+	}
+	c.Downloader = common.New(name, c, common.Dirs{
+		TorrentsDir: cfg.Deluge.TorrentsDir,
+		DownloadDir: cfg.Deluge.DownloadDir,
+		FinishedDir: cfg.Deluge.FinishedDir,
+	}, cfg, db, organizerClient, notifier)
+	return c, nil
+}
+
+type rpcRequest struct {
+	Method string `json:"method"`
+	Params []any  `json:"params"`
+	ID     int    `json:"id"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+	ID     int             `json:"id"`
+}
+
+type rpcError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("deluge error %d: %s", e.Code, e.Message)
+}
+
+func (c *Client) send(ctx context.Context, method string, params []any, out any) error {
+	if params == nil {
+		params = []any{}
+	}
+
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	c.mu.Unlock()
+
+	body, err := json.Marshal(&rpcRequest{Method: method, Params: params, ID: id})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.rpcURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("deluge %s returned %d", method, resp.StatusCode)
+	}
+
+	r := &rpcResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		return err
+	}
+	if r.Error != nil {
+		return r.Error
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(r.Result, out)
+}
+
+// call calls the method, logs in and connects to the daemon again when the
+// session expired.
+func (c *Client) call(ctx context.Context, method string, params []any, out any) error {
+	err := c.send(ctx, method, params, out)
+	if re, ok := err.(*rpcError); !ok || re.Code != errCodeNotAuthenticated {
+		return err
+	}
+
+	if err := c.login(ctx); err != nil {
+		return err
+	}
+	return c.send(ctx, method, params, out)
+}
+
+func (c *Client) login(ctx context.Context) error {
+	ok := false
+	if err := c.send(ctx, "auth.login", []any{c.cfg.Password}, &ok); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("deluge login failed")
+	}
+
+	connected := false
+	if err := c.send(ctx, "web.connected", nil, &connected); err != nil {
+		return err
+	}
+	if connected {
+		return nil
+	}
+
+	// each host is [id, host, port, status].
+	hosts := [][]any{}
+	if err := c.send(ctx, "web.get_hosts", nil, &hosts); err != nil {
+		return err
+	}
+
+	hostID := c.cfg.HostID
+	if hostID == "" {
+		if len(hosts) == 0 || len(hosts[0]) == 0 {
+			return fmt.Errorf("deluge has no daemon host")
+		}
+		hostID = fmt.Sprint(hosts[0][0])
+	}
+	return c.send(ctx, "web.connect", []any{hostID}, nil)
+}
+
+type torrentStatus struct {
+	Name          string  `json:"name"`
+	State         string  `json:"state"`
+	Progress      float64 `json:"progress"` // 0 to 100
+	TotalSize     int64   `json:"total_size"`
+	TotalUploaded int64   `json:"total_uploaded"`
+	SavePath      string  `json:"save_path"`
+	TrackerHost   string  `json:"tracker_host"`
+	// connected peers and seeds.
+	NumPeers int `json:"num_peers"`
+	NumSeeds int `json:"num_seeds"`
+}
+
+type updateUI struct {
+	Torrents map[string]torrentStatus `json:"torrents"`
+	Stats    struct {
+		DownloadRate float64 `json:"download_rate"`
+	} `json:"stats"`
+}
+
+type torrentFile struct {
+	Path string `json:"path"`
+}
+
+type torrentFiles struct {
+	Files    []torrentFile `json:"files"`
+	SavePath string        `json:"save_path"`
+	// FilePriorities by file index, 0 is not downloaded.
+	FilePriorities []int `json:"file_priorities"`
+}
+
+func toStatus(state string) common.Status {
+	switch state {
+	case "Downloading":
+		return common.StatusDownloading
+	case "Seeding":
+		return common.StatusSeeding
+	case "Paused":
+		return common.StatusStopped
+	default:
+		return common.StatusOther
+	}
+}
+
+func (c *Client) updateUI(ctx context.Context) (*updateUI, error) {
+	filter := map[string]string{}
+	if c.cfg.Label != "" {
+		filter["label"] = c.cfg.Label
+	}
+
+	ui := &updateUI{}
+	if err := c.call(ctx, "web.update_ui", []any{statusKeys, filter}, ui); err != nil {
+		return nil, err
+	}
+	return ui, nil
+}
+
+func (c *Client) Torrents(ctx context.Context) ([]*common.Torrent, error) {
+	ui, err := c.updateUI(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := []*common.Torrent{}
+	for hash, s := range ui.Torrents {
+		t := &common.Torrent{
+			Hash:     hash,
+			Name:     s.Name,
+			Status:   toStatus(s.State),
+			Progress: s.Progress / 100,
+			Size:     s.TotalSize,
+			Uploaded: s.TotalUploaded,
+			Dir:      s.SavePath,
+			Peers:    s.NumPeers + s.NumSeeds,
+		}
+		if s.TrackerHost != "" {
+			t.Trackers = []string{s.TrackerHost}
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+func (c *Client) Files(ctx context.Context, t *common.Torrent) error {
+	files := &torrentFiles{}
+	if err := c.call(ctx, "core.get_torrent_status", []any{t.Hash, []string{"files", "save_path", "file_priorities"}}, files); err != nil {
+		return err
+	}
+
+	t.Dir = files.SavePath
+	t.Files = []string{}
+	for i, f := range files.Files {
+		if i < len(files.FilePriorities) && files.FilePriorities[i] == 0 {
+			continue
+		}
+		t.Files = append(t.Files, f.Path)
+	}
+	return nil
+}
+
+func (c *Client) DownloadSpeed(ctx context.Context) (int64, error) {
+	ui, err := c.updateUI(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int64(ui.Stats.DownloadRate), nil
+}
+
+func toHashes(torrents []*common.Torrent) []string {
+	hashes := []string{}
+	for _, t := range torrents {
+		hashes = append(hashes, t.Hash)
+	}
+	return hashes
+}
+
+func (c *Client) Stop(ctx context.Context, torrents []*common.Torrent) error {
+	return c.call(ctx, "core.pause_torrents", []any{toHashes(torrents)}, nil)
+}
+
+func (c *Client) Start(ctx context.Context, torrents []*common.Torrent) error {
+	return c.call(ctx, "core.resume_torrents", []any{toHashes(torrents)}, nil)
+}
+
+func (c *Client) Recheck(ctx context.Context, torrents []*common.Torrent) error {
+	return c.call(ctx, "core.force_recheck", []any{toHashes(torrents)}, nil)
+}
+
+func (c *Client) Announce(ctx context.Context, torrents []*common.Torrent) error {
+	return c.call(ctx, "core.force_reannounce", []any{toHashes(torrents)}, nil)
+}
+
+func (c *Client) SetLocation(ctx context.Context, torrents []*common.Torrent, dir string) error {
+	return c.call(ctx, "core.move_storage", []any{toHashes(torrents), dir}, nil)
+}
+
+// SetSpeedLimits sets global limits in KiB/s, -1 for unlimited.
+func (c *Client) SetSpeedLimits(ctx context.Context, limits *common.SpeedLimits) error {
+	if limits.AltSpeed {
+		return common.ErrNotSupported
+	}
+	return c.call(ctx, "core.set_config", []any{map[string]any{
+		"max_download_speed": toDelugeLimit(limits.DownloadKB),
+		"max_upload_speed":   toDelugeLimit(limits.UploadKB),
+	}}, nil)
+}
+
+func toDelugeLimit(kb int64) float64 {
+	if kb == 0 {
+		return -1
+	}
+	return float64(kb)
+}
+
+func (c *Client) Remove(ctx context.Context, torrents []*common.Torrent, deleteData bool) error {
+	for _, t := range torrents {
+		if err := c.call(ctx, "core.remove_torrent", []any{t.Hash, deleteData}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddTorrentFile adds torrent files dropped in TorrentsDir, Deluge has no
+// watch dir of its own without the autoadd plugin.
+func (c *Client) AddTorrentFile(ctx context.Context, name string, data []byte) error {
+	_, err := c.add(ctx, name, &common.AddRequest{Torrent: data})
+	return err
+}
+
+func (c *Client) AddTorrent(ctx context.Context, req *common.AddRequest) (string, error) {
+	return c.add(ctx, "", req)
+}
+
+// toFilePriority is 0 to skip a file, and 1 for normal priority.
+func toFilePriority(wanted bool) int {
+	if wanted {
+		return 1
+	}
+	return 0
+}
+
+// add adds the torrent as file name, or the magnet, and labels it.
+func (c *Client) add(ctx context.Context, name string, req *common.AddRequest) (string, error) {
+	options := map[string]any{
+		"download_location": c.cfg.DownloadDir,
+	}
+	if req.Dir != "" {
+		options["download_location"] = req.Dir
+	}
+	if req.Paused {
+		options["add_paused"] = true
+	}
+	wanted, err := req.Wanted()
+	if err != nil {
+		return "", err
+	}
+	if wanted != nil {
+		priorities := []int{}
+		for _, w := range wanted {
+			priorities = append(priorities, toFilePriority(w))
+		}
+		options["file_priorities"] = priorities
+	}
+
+	hash := ""
+	if req.Magnet != "" {
+		if err := c.call(ctx, "core.add_torrent_magnet", []any{req.Magnet, options}, &hash); err != nil {
+			return "", err
+		}
+	} else {
+		if name == "" {
+			h, err := req.Hash()
+			if err != nil {
+				return "", err
+			}
+			name = h + ".torrent"
+		}
+		if err := c.call(ctx, "core.add_torrent_file", []any{name, base64.StdEncoding.EncodeToString(req.Torrent), options}, &hash); err != nil {
+			return "", err
+		}
+	}
+
+	switch {
+	case req.Priority > common.PriorityNormal:
+		if err := c.call(ctx, "core.queue_top", []any{[]string{hash}}, nil); err != nil {
+			return "", err
+		}
+	case req.Priority < common.PriorityNormal:
+		if err := c.call(ctx, "core.queue_bottom", []any{[]string{hash}}, nil); err != nil {
+			return "", err
+		}
+	}
+
+	label := c.cfg.Label
+	if label == "" && len(req.Labels) > 0 {
+		label = req.Labels[0]
+	}
+	if label == "" {
+		return hash, nil
+	}
+	if err := c.ensureLabel(ctx, label); err != nil {
+		return "", err
+	}
+	if err := c.call(ctx, "label.set_torrent", []any{hash, label}, nil); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func (c *Client) ensureLabel(ctx context.Context, label string) error {
+	c.mu.Lock()
+	added := c.labels[label]
+	c.mu.Unlock()
+	if added {
+		return nil
+	}
+
+	labels := []string{}
+	if err := c.call(ctx, "label.get_labels", nil, &labels); err != nil {
+		return err
+	}
+	if !slices.Contains(labels, label) {
+		if err := c.call(ctx, "label.add", []any{label}, nil); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.labels[label] = true
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,469 @@
+package deluge
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/autoget-project/autoget/backend/downloaders/common"
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fake Deluge Web JSON-RPC
+type fakeDeluge struct {
+	reqs []*rpcRequest
+
+	loggedIn  bool
+	connected bool
+	hosts     [][]any
+	labels    []string
+
+	torrents map[string]torrentStatus
+	// torrent labels by hash
+	torrentLabels map[string]string
+	files         map[string]torrentFiles
+	speed         float64
+	added         map[string][]byte
+}
+
+func (f *fakeDeluge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &rpcRequest{}
+	if r.URL.Path != "/json" || json.NewDecoder(r.Body).Decode(req) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.reqs = append(f.reqs, req)
+
+	write := func(result any) {
+		json.NewEncoder(w).Encode(map[string]any{"result": result, "error": nil, "id": req.ID})
+	}
+	writeErr := func(code int, msg string) {
+		json.NewEncoder(w).Encode(map[string]any{"result": nil, "error": rpcError{Code: code, Message: msg}, "id": req.ID})
+	}
+
+	if req.Method == "auth.login" {
+		if req.Params[0] != "secret" {
+			write(false)
+			return
+		}
+		f.loggedIn = true
+		http.SetCookie(w, &http.Cookie{Name: "_session_id", Value: "session", Path: "/"})
+		write(true)
+		return
+	}
+
+	if c, err := r.Cookie("_session_id"); err != nil || c.Value != "session" || !f.loggedIn {
+		writeErr(errCodeNotAuthenticated, "Not authenticated")
+		return
+	}
+
+	switch req.Method {
+	case "web.connected":
+		write(f.connected)
+	case "web.get_hosts":
+		write(f.hosts)
+	case "web.connect":
+		f.connected = true
+		write(nil)
+	case "web.update_ui":
+		filter := req.Params[1].(map[string]any)
+		ts := map[string]torrentStatus{}
+		for hash, t := range f.torrents {
+			if label, ok := filter["label"]; !ok || label == f.torrentLabels[hash] {
+				ts[hash] = t
+			}
+		}
+		write(map[string]any{"torrents": ts, "stats": map[string]any{"download_rate": f.speed}})
+	case "core.get_torrent_status":
+		write(f.files[req.Params[0].(string)])
+	case "core.add_torrent_file":
+		data, _ := base64.StdEncoding.DecodeString(req.Params[1].(string))
+		f.added[req.Params[0].(string)] = data
+		write("added")
+	case "core.add_torrent_magnet":
+		f.added[req.Params[0].(string)] = nil
+		write("magnet")
+	case "label.get_labels":
+		write(f.labels)
+	case "label.add":
+		f.labels = append(f.labels, req.Params[0].(string))
+		write(nil)
+	case "label.set_torrent":
+		f.torrentLabels[req.Params[0].(string)] = req.Params[1].(string)
+		write(nil)
+	case "core.pause_torrents", "core.resume_torrents", "core.force_recheck", "core.force_reannounce",
+		"core.move_storage", "core.remove_torrent", "core.queue_top", "core.queue_bottom", "core.set_config":
+		write(nil)
+	default:
+		writeErr(2, "Unknown method")
+	}
+}
+
+func (f *fakeDeluge) methods() []string {
+	methods := []string{}
+	for _, r := range f.reqs {
+		methods = append(methods, r.Method)
+	}
+	return methods
+}
+
+func newFake(t *testing.T) (*fakeDeluge, *httptest.Server) {
+	t.Helper()
+
+	fake := &fakeDeluge{
+		connected:     true,
+		torrents:      map[string]torrentStatus{},
+		torrentLabels: map[string]string{},
+		files:         map[string]torrentFiles{},
+		added:         map[string][]byte{},
+	}
+	serv := httptest.NewServer(fake)
+	t.Cleanup(serv.Close)
+	return fake, serv
+}
+
+func newConfig(url string) *config.DownloaderConfig {
+	return &config.DownloaderConfig{
+		Deluge: &config.DelugeConfig{
+			URL:      url,
+			Password: "secret",
+			Label:    "autoget",
+		},
+	}
+}
+
+func TestLogin(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		fake, serv := newFake(t)
+		fake.torrents = map[string]torrentStatus{
+			"1": {Name: "Torrent 1", State: "Downloading"},
+			"2": {Name: "Torrent 2", State: "Seeding"},
+		}
+		fake.torrentLabels["1"] = "autoget"
+
+		client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+		require.NoError(t, err)
+
+		torrents, err := client.Torrents(t.Context())
+		require.NoError(t, err)
+		require.Len(t, torrents, 1)
+		assert.Equal(t, "1", torrents[0].Hash)
+
+		// session cookie is reused.
+		_, err = client.Torrents(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"web.update_ui",
+			"auth.login",
+			"web.connected",
+			"web.update_ui",
+			"web.update_ui",
+		}, fake.methods())
+	})
+
+	t.Run("connect to daemon", func(t *testing.T) {
+		fake, serv := newFake(t)
+		fake.connected = false
+		fake.hosts = [][]any{{"host1", "127.0.0.1", 58846, "Online"}}
+
+		client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+		require.NoError(t, err)
+
+		_, err = client.Torrents(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"web.update_ui",
+			"auth.login",
+			"web.connected",
+			"web.get_hosts",
+			"web.connect",
+			"web.update_ui",
+		}, fake.methods())
+		assert.Equal(t, []any{"host1"}, fake.reqs[4].Params)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		_, serv := newFake(t)
+		conf := newConfig(serv.URL)
+		conf.Deluge.Password = "wrong"
+
+		client, err := New("test", conf, nil, nil, nil)
+		require.NoError(t, err)
+
+		_, err = client.Torrents(t.Context())
+		assert.EqualError(t, err, "deluge login failed")
+	})
+}
+
+func TestTorrents(t *testing.T) {
+	fake, serv := newFake(t)
+
+	client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+	require.NoError(t, err)
+
+	fake.torrents = map[string]torrentStatus{
+		"1": {Name: "Torrent 1", State: "Downloading", Progress: 50, TotalSize: 1000, SavePath: "/downloads", NumPeers: 1, NumSeeds: 2},
+		"2": {
+			Name: "Torrent 2", State: "Seeding", Progress: 100, TotalSize: 2000, TotalUploaded: 500,
+			SavePath: "/downloads", TrackerHost: "private.org",
+		},
+		"3": {Name: "Torrent 3", State: "Paused", SavePath: "/downloads"},
+		// other label.
+		"4": {Name: "Torrent 4", State: "Seeding"},
+	}
+	fake.torrentLabels["1"] = "autoget"
+	fake.torrentLabels["2"] = "autoget"
+	fake.torrentLabels["3"] = "autoget"
+	fake.files["2"] = torrentFiles{Files: []torrentFile{{Path: "show/ep1.mkv"}}, SavePath: "/downloads/tv"}
+	fake.speed = 1000 * 1000
+
+	torrents, err := client.Torrents(t.Context())
+	require.NoError(t, err)
+	slices.SortFunc(torrents, func(a, b *common.Torrent) int { return strings.Compare(a.Hash, b.Hash) })
+	assert.Equal(t, []*common.Torrent{
+		{Hash: "1", Name: "Torrent 1", Status: common.StatusDownloading, Progress: 0.5, Size: 1000, Peers: 3, Dir: "/downloads"},
+		{
+			Hash: "2", Name: "Torrent 2", Status: common.StatusSeeding, Progress: 1, Size: 2000, Uploaded: 500,
+			Trackers: []string{"private.org"}, Dir: "/downloads",
+		},
+		{Hash: "3", Name: "Torrent 3", Status: common.StatusStopped, Dir: "/downloads"},
+	}, torrents)
+
+	// files come with the save path.
+	require.NoError(t, client.Files(t.Context(), torrents[1]))
+	assert.Equal(t, []string{"show/ep1.mkv"}, torrents[1].Files)
+	assert.Equal(t, "/downloads/tv", torrents[1].Dir)
+
+	speed, err := client.DownloadSpeed(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000*1000), speed)
+}
+
+func TestControl(t *testing.T) {
+	fake, serv := newFake(t)
+
+	client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+	require.NoError(t, err)
+
+	torrents := []*common.Torrent{{Hash: "1"}, {Hash: "2"}}
+	tests := []struct {
+		name   string
+		action func() error
+		calls  []*rpcRequest
+	}{
+		{
+			name:   "stop",
+			action: func() error { return client.Stop(t.Context(), torrents) },
+			calls:  []*rpcRequest{{Method: "core.pause_torrents", Params: []any{[]any{"1", "2"}}}},
+		},
+		{
+			name:   "start",
+			action: func() error { return client.Start(t.Context(), torrents) },
+			calls:  []*rpcRequest{{Method: "core.resume_torrents", Params: []any{[]any{"1", "2"}}}},
+		},
+		{
+			name:   "recheck",
+			action: func() error { return client.Recheck(t.Context(), torrents) },
+			calls:  []*rpcRequest{{Method: "core.force_recheck", Params: []any{[]any{"1", "2"}}}},
+		},
+		{
+			name:   "announce",
+			action: func() error { return client.Announce(t.Context(), torrents) },
+			calls:  []*rpcRequest{{Method: "core.force_reannounce", Params: []any{[]any{"1", "2"}}}},
+		},
+		{
+			name:   "set location",
+			action: func() error { return client.SetLocation(t.Context(), torrents, "/downloads/tv") },
+			calls:  []*rpcRequest{{Method: "core.move_storage", Params: []any{[]any{"1", "2"}, "/downloads/tv"}}},
+		},
+		{
+			// Deluge removes one torrent at a time.
+			name:   "remove with data",
+			action: func() error { return client.Remove(t.Context(), torrents, true) },
+			calls: []*rpcRequest{
+				{Method: "core.remove_torrent", Params: []any{"1", true}},
+				{Method: "core.remove_torrent", Params: []any{"2", true}},
+			},
+		},
+	}
+
+	// logs in first.
+	_, err = client.Torrents(t.Context())
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.reqs = nil
+
+			require.NoError(t, tt.action())
+			require.Len(t, fake.reqs, len(tt.calls))
+			for i, call := range tt.calls {
+				assert.Equal(t, call.Method, fake.reqs[i].Method)
+				assert.Equal(t, call.Params, fake.reqs[i].Params)
+			}
+		})
+	}
+}
+
+func newTorrentFile(t *testing.T) ([]byte, string) {
+	t.Helper()
+
+	info := metainfo.Info{Name: "file.bin", PieceLength: 16 * 1024, Length: 7, Pieces: make([]byte, 20)}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+	mi := &metainfo.MetaInfo{InfoBytes: infoBytes}
+
+	data := &bytes.Buffer{}
+	require.NoError(t, mi.Write(data))
+	return data.Bytes(), mi.HashInfoBytes().HexString()
+}
+
+func TestAddTorrent(t *testing.T) {
+	fake, serv := newFake(t)
+	fake.labels = []string{"autoget"}
+
+	conf := newConfig(serv.URL)
+	conf.Deluge.DownloadDir = "/downloads"
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+
+	// configured label wins over requested ones.
+	data, hash := newTorrentFile(t)
+	got, err := client.AddTorrent(t.Context(), &common.AddRequest{
+		Torrent:  data,
+		Dir:      "/downloads/tv",
+		Labels:   []string{"tv"},
+		Paused:   true,
+		Priority: common.PriorityLow,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "added", got)
+	assert.Equal(t, data, fake.added[hash+".torrent"])
+	assert.Equal(t, []string{
+		"core.add_torrent_file",
+		"auth.login",
+		"web.connected",
+		"core.add_torrent_file",
+		"core.queue_bottom",
+		"label.get_labels",
+		"label.set_torrent",
+	}, fake.methods())
+	assert.Equal(t, map[string]any{"download_location": "/downloads/tv", "add_paused": true}, fake.reqs[3].Params[2])
+	assert.Equal(t, "autoget", fake.torrentLabels["added"])
+
+	// without configured label, the first requested label is used.
+	conf.Deluge.Label = ""
+	fake.reqs = nil
+	got, err = client.AddTorrent(t.Context(), &common.AddRequest{
+		Magnet:   "magnet:?xt=urn:btih:" + hash,
+		Labels:   []string{"tv", "anime"},
+		Priority: common.PriorityHigh,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "magnet", got)
+	assert.Equal(t, []string{
+		"core.add_torrent_magnet",
+		"core.queue_top",
+		"label.get_labels",
+		"label.add",
+		"label.set_torrent",
+	}, fake.methods())
+	assert.Equal(t, map[string]any{"download_location": "/downloads"}, fake.reqs[0].Params[1])
+	assert.Equal(t, "tv", fake.torrentLabels["magnet"])
+}
+
+func TestAddTorrentFile(t *testing.T) {
+	fake, serv := newFake(t)
+
+	conf := newConfig(serv.URL)
+	conf.Deluge.DownloadDir = "/downloads"
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+
+	// added under its file name, with label.
+	require.NoError(t, client.AddTorrentFile(t.Context(), "3.torrent", []byte("torrent 3")))
+	assert.Equal(t, []string{
+		"core.add_torrent_file",
+		"auth.login",
+		"web.connected",
+		"core.add_torrent_file",
+		"label.get_labels",
+		"label.add",
+		"label.set_torrent",
+	}, fake.methods())
+	assert.Equal(t, []byte("torrent 3"), fake.added["3.torrent"])
+	assert.Equal(t, map[string]any{"download_location": "/downloads"}, fake.reqs[3].Params[2])
+	assert.Equal(t, "autoget", fake.torrentLabels["added"])
+}
+
+// newMultiFileTorrent returns a torrent of show/ep1.mkv, show/Sample/sample.mkv
+// and show/notes.txt.
+func newMultiFileTorrent(t *testing.T) ([]byte, string) {
+	t.Helper()
+
+	info := metainfo.Info{Name: "show", PieceLength: 16 * 1024, Pieces: make([]byte, 20)}
+	for _, p := range [][]string{{"ep1.mkv"}, {"Sample", "sample.mkv"}, {"notes.txt"}} {
+		info.Files = append(info.Files, metainfo.FileInfo{Path: p, Length: 1})
+	}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+	mi := &metainfo.MetaInfo{InfoBytes: infoBytes}
+
+	data := &bytes.Buffer{}
+	require.NoError(t, mi.Write(data))
+	return data.Bytes(), mi.HashInfoBytes().HexString()
+}
+
+func TestAddTorrentFileSelection(t *testing.T) {
+	fake, serv := newFake(t)
+	fake.labels = []string{"autoget"}
+
+	conf := newConfig(serv.URL)
+	conf.Deluge.DownloadDir = "/downloads"
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+
+	data, _ := newMultiFileTorrent(t)
+	_, err = client.AddTorrent(t.Context(), &common.AddRequest{Torrent: data, Files: []int{0, 2}, Skip: []string{"*.txt"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"download_location": "/downloads",
+		"file_priorities":   []any{float64(1), float64(0), float64(0)},
+	}, fake.reqs[3].Params[2])
+
+	// skipped files are not copied.
+	fake.files["added"] = torrentFiles{
+		Files:          []torrentFile{{Path: "show/ep1.mkv"}, {Path: "show/Sample/sample.mkv"}, {Path: "show/notes.txt"}},
+		SavePath:       "/downloads",
+		FilePriorities: []int{1, 0, 0},
+	}
+	tr := &common.Torrent{Hash: "added"}
+	require.NoError(t, client.Files(t.Context(), tr))
+	assert.Equal(t, []string{"show/ep1.mkv"}, tr.Files)
+}
+
+func TestSetSpeedLimits(t *testing.T) {
+	fake, serv := newFake(t)
+
+	client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, client.SetSpeedLimits(t.Context(), &common.SpeedLimits{DownloadKB: 100}))
+	last := fake.reqs[len(fake.reqs)-1]
+	assert.Equal(t, "core.set_config", last.Method)
+	assert.Equal(t, []any{map[string]any{
+		"max_download_speed": float64(100),
+		"max_upload_speed":   float64(-1),
+	}}, last.Params)
+
+	assert.ErrorIs(t, client.SetSpeedLimits(t.Context(), &common.SpeedLimits{AltSpeed: true}), common.ErrNotSupported)
+}
@@ -0,0 +1,649 @@
+package embedded
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/autoget-project/autoget/backend/downloaders/common"
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/notify"
+	"github.com/autoget-project/autoget/backend/organizer"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+const (
+	stateFile   = "state.json"
+	torrentsDir = "torrents"
+)
+
+// torrentState is persisted in DataDir, piece completion is kept by the
+// engine itself.
+type torrentState struct {
+	Stopped bool `json:"stopped"`
+	// Uploaded in previous runs, engine stats start from 0 on each run.
+	Uploaded int64 `json:"uploaded"`
+	// Dir overrides DownloadDir.
+	Dir string `json:"dir,omitempty"`
+	// Magnet is kept until the info is fetched and saved.
+	Magnet string `json:"magnet,omitempty"`
+	// Unwanted are indexes of files not to download.
+	Unwanted []int `json:"unwanted,omitempty"`
+}
+
+// recheck is a running verification, it must end before its torrent is
+// dropped: the engine keeps its lock when verifying a closed torrent.
+type recheck struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Client runs a torrent engine in process.
+type Client struct {
+	*common.Downloader
+
+	cfg        *config.EmbeddedConfig
+	client     *torrent.Client
+	completion storage.PieceCompletion
+
+	uploadLimiter   *rate.Limiter
+	downloadLimiter *rate.Limiter
+
+	mu     sync.Mutex
+	states map[string]*torrentState
+	// rechecks running by hash.
+	rechecks map[string]*recheck
+
+	// last total read bytes for download speed.
+	lastRead   int64
+	lastReadAt time.Time
+}
+
+func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, organizerClient *organizer.Client, notifier notify.INotifier) (*Client, error) {
+	ec := cfg.Embedded
+	for _, dir := range []string{filepath.Join(ec.DataDir, torrentsDir), ec.DownloadDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	completion, err := storage.NewBoltPieceCompletion(ec.DataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	tc := torrent.NewDefaultClientConfig()
+	tc.Seed = true
+	tc.ListenPort = ec.ListenPort
+	tc.NoDHT = ec.NoDHT
+	tc.NoDefaultPortForwarding = ec.NoUPnP
+	tc.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   ec.DownloadDir,
+		PieceCompletion: completion,
+	})
+	// limiters are kept to change limits on bandwidth schedules, the burst
+	// is set as the engine overflows it for unlimited ones.
+	tc.UploadRateLimiter = rate.NewLimiter(toLimit(int64(ec.UploadRateLimitKB)), rateLimitBurst)
+	tc.DownloadRateLimiter = rate.NewLimiter(toLimit(int64(ec.DownloadRateLimitKB)), rateLimitBurst)
+
+	client, err := torrent.NewClient(tc)
+	if err != nil {
+		completion.Close()
+		return nil, err
+	}
+
+	c := &Client{
+		cfg:             ec,
+		client:          client,
+		completion:      completion,
+		uploadLimiter:   tc.UploadRateLimiter,
+		downloadLimiter: tc.DownloadRateLimiter,
+		states:          map[string]*torrentState{},
+		rechecks:        map[string]*recheck{},
+		lastReadAt:      time.Now(),
+	}
+	c.Downloader = common.New(name, c, common.Dirs{
+		TorrentsDir: ec.TorrentsDir,
+		DownloadDir: ec.DownloadDir,
+		FinishedDir: ec.FinishedDir,
+	}, cfg, db, organizerClient, notifier)
+
+	if err := c.resume(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Close stops the engine.
+func (c *Client) Close() {
+	c.mu.Lock()
+	hashes := slices.Collect(maps.Keys(c.rechecks))
+	c.mu.Unlock()
+	for _, hash := range hashes {
+		c.stopRecheck(hash)
+	}
+
+	c.client.Close()
+	c.completion.Close()
+}
+
+func (c *Client) torrentPath(hash string) string {
+	return filepath.Join(c.cfg.DataDir, torrentsDir, hash+".torrent")
+}
+
+// resume adds torrents of previous runs.
+func (c *Client) resume() error {
+	data, err := os.ReadFile(filepath.Join(c.cfg.DataDir, stateFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &c.states); err != nil {
+			return err
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(c.cfg.DataDir, torrentsDir, "*.torrent"))
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		mi, err := metainfo.LoadFromFile(p)
+		if err != nil {
+			return err
+		}
+		spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+		if err != nil {
+			return err
+		}
+		if err := c.add(spec); err != nil {
+			return err
+		}
+	}
+
+	for hash, st := range c.states {
+		if st.Magnet == "" {
+			continue
+		}
+		if _, ok := c.torrent(hash); ok {
+			continue
+		}
+		spec, err := torrent.TorrentSpecFromMagnetUri(st.Magnet)
+		if err != nil {
+			return err
+		}
+		if err := c.add(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add adds the torrent with its state, a state must exist for it.
+func (c *Client) add(spec *torrent.TorrentSpec) error {
+	hash := spec.InfoHash.HexString()
+
+	c.mu.Lock()
+	st, ok := c.states[hash]
+	if !ok {
+		st = &torrentState{}
+		c.states[hash] = st
+	}
+	stopped, dir, unwanted := st.Stopped, st.Dir, st.Unwanted
+	c.mu.Unlock()
+
+	if dir != "" {
+		spec.Storage = storage.NewFileOpts(storage.NewFileClientOpts{
+			ClientBaseDir:   dir,
+			PieceCompletion: c.completion,
+		})
+	}
+
+	t, _, err := c.client.AddTorrentSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	if stopped {
+		t.DisallowDataDownload()
+		t.DisallowDataUpload()
+	}
+	if t.Info() != nil {
+		if !stopped {
+			download(t, unwanted)
+		}
+		return nil
+	}
+
+	// magnets are saved once info is fetched, stopped ones too, and download
+	// unless stopped meanwhile, Start downloads them then.
+	go func() {
+		select {
+		case <-t.GotInfo():
+		case <-t.Closed():
+			return
+		}
+		c.mu.Lock()
+		stopped := st.Stopped
+		c.mu.Unlock()
+		if !stopped {
+			download(t, unwanted)
+		}
+		if err := c.saveMagnet(t); err != nil {
+			log.Error().Err(err).Str("hash", hash).Msg("failed to save torrent of magnet")
+		}
+	}()
+	return nil
+}
+
+// download downloads files of t but unwanted ones.
+func download(t *torrent.Torrent, unwanted []int) {
+	if len(unwanted) == 0 {
+		t.DownloadAll()
+		return
+	}
+	for i, f := range t.Files() {
+		if slices.Contains(unwanted, i) {
+			f.Cancel()
+		} else {
+			f.Download()
+		}
+	}
+}
+
+// saveMagnet saves the torrent file of a magnet, to resume without fetching
+// the info again.
+func (c *Client) saveMagnet(t *torrent.Torrent) error {
+	hash := t.InfoHash().HexString()
+	f, err := os.Create(c.torrentPath(hash))
+	if err != nil {
+		return err
+	}
+	mi := t.Metainfo()
+	if err := mi.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if st, ok := c.states[hash]; ok {
+		st.Magnet = ""
+	}
+	c.mu.Unlock()
+	return c.saveState()
+}
+
+// saveState persists states with uploaded of this run.
+func (c *Client) saveState() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	states := map[string]*torrentState{}
+	for hash, st := range c.states {
+		s := *st
+		if t, ok := c.torrent(hash); ok {
+			s.Uploaded += uploaded(t)
+		}
+		states[hash] = &s
+	}
+
+	data, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+	// write and rename, a partial state file loses all torrents.
+	path := filepath.Join(c.cfg.DataDir, stateFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// uploaded of t in this run.
+func uploaded(t *torrent.Torrent) int64 {
+	stats := t.Stats()
+	return stats.BytesWrittenData.Int64()
+}
+
+func (c *Client) torrent(hash string) (*torrent.Torrent, bool) {
+	var ih metainfo.Hash
+	if err := ih.FromHexString(hash); err != nil {
+		return nil, false
+	}
+	return c.client.Torrent(ih)
+}
+
+func (c *Client) Torrents(ctx context.Context) ([]*common.Torrent, error) {
+	ts := []*common.Torrent{}
+	for _, t := range c.client.Torrents() {
+		hash := t.InfoHash().HexString()
+
+		c.mu.Lock()
+		st := c.states[hash]
+		c.mu.Unlock()
+		if st == nil {
+			continue
+		}
+
+		ct := &common.Torrent{
+			Hash:     hash,
+			Name:     t.Name(),
+			Status:   common.StatusDownloading,
+			Uploaded: st.Uploaded + uploaded(t),
+			Dir:      c.cfg.DownloadDir,
+			Files:    []string{},
+			Peers:    t.Stats().ActivePeers,
+		}
+		if st.Dir != "" {
+			ct.Dir = st.Dir
+		}
+		// size and progress are of wanted files only.
+		completed := int64(0)
+		if t.Info() != nil {
+			for i, f := range t.Files() {
+				if slices.Contains(st.Unwanted, i) {
+					continue
+				}
+				ct.Size += f.Length()
+				completed += f.BytesCompleted()
+				ct.Files = append(ct.Files, filepath.FromSlash(f.Path()))
+			}
+			if ct.Size > 0 {
+				ct.Progress = float64(completed) / float64(ct.Size)
+			}
+		}
+
+		switch {
+		case st.Stopped:
+			ct.Status = common.StatusStopped
+		case t.Info() != nil && completed == ct.Size:
+			ct.Status = common.StatusSeeding
+		}
+		ts = append(ts, ct)
+	}
+
+	// keep uploaded across restarts.
+	if err := c.saveState(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// Files is a no-op, Torrents already returns files.
+func (c *Client) Files(ctx context.Context, t *common.Torrent) error {
+	return nil
+}
+
+func (c *Client) DownloadSpeed(ctx context.Context) (int64, error) {
+	stats := c.client.Stats()
+	read := stats.BytesReadData.Int64()
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elapsed := now.Sub(c.lastReadAt).Seconds()
+	speed := int64(0)
+	if elapsed > 0 {
+		speed = int64(float64(read-c.lastRead) / elapsed)
+	}
+	c.lastRead, c.lastReadAt = read, now
+	return speed, nil
+}
+
+func (c *Client) Stop(ctx context.Context, torrents []*common.Torrent) error {
+	for _, ct := range torrents {
+		t, ok := c.torrent(ct.Hash)
+		if !ok {
+			return common.ErrTorrentNotFound
+		}
+		t.DisallowDataDownload()
+		t.DisallowDataUpload()
+
+		c.mu.Lock()
+		c.states[ct.Hash].Stopped = true
+		c.mu.Unlock()
+	}
+	return c.saveState()
+}
+
+func (c *Client) Start(ctx context.Context, torrents []*common.Torrent) error {
+	for _, ct := range torrents {
+		t, ok := c.torrent(ct.Hash)
+		if !ok {
+			return common.ErrTorrentNotFound
+		}
+		t.AllowDataDownload()
+		t.AllowDataUpload()
+
+		c.mu.Lock()
+		st := c.states[ct.Hash]
+		st.Stopped = false
+		unwanted := st.Unwanted
+		c.mu.Unlock()
+
+		// magnets without info yet download once it is fetched.
+		if t.Info() != nil {
+			download(t, unwanted)
+		}
+	}
+	return c.saveState()
+}
+
+// Recheck verifies data in the background, it reads all pieces.
+func (c *Client) Recheck(ctx context.Context, torrents []*common.Torrent) error {
+	for _, ct := range torrents {
+		t, ok := c.torrent(ct.Hash)
+		if !ok {
+			return common.ErrTorrentNotFound
+		}
+		c.stopRecheck(ct.Hash)
+
+		verifyCtx, cancel := context.WithCancel(context.Background())
+		r := &recheck{cancel: cancel, done: make(chan struct{})}
+		c.mu.Lock()
+		c.rechecks[ct.Hash] = r
+		c.mu.Unlock()
+
+		go func() {
+			defer close(r.done)
+			err := t.VerifyDataContext(verifyCtx)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.Error().Err(err).Str("hash", ct.Hash).Msg("failed to verify torrent")
+			}
+
+			c.mu.Lock()
+			if c.rechecks[ct.Hash] == r {
+				delete(c.rechecks, ct.Hash)
+			}
+			c.mu.Unlock()
+		}()
+	}
+	return nil
+}
+
+// stopRecheck cancels the recheck of hash and waits for it to end.
+func (c *Client) stopRecheck(hash string) {
+	c.mu.Lock()
+	r := c.rechecks[hash]
+	c.mu.Unlock()
+	if r == nil {
+		return
+	}
+	r.cancel()
+	<-r.done
+}
+
+// Announce is not supported, the engine announces by itself.
+func (c *Client) Announce(ctx context.Context, torrents []*common.Torrent) error {
+	return common.ErrNotSupported
+}
+
+// rateLimitBurst is the default burst of the engine.
+const rateLimitBurst = 1 << 20
+
+// toLimit converts KB/s to a rate limit, 0 for unlimited.
+func toLimit(kb int64) rate.Limit {
+	if kb <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(kb * 1024)
+}
+
+// SetSpeedLimits changes rate limits of the engine, 0 goes back to the
+// configured limit.
+func (c *Client) SetSpeedLimits(ctx context.Context, limits *common.SpeedLimits) error {
+	if limits.AltSpeed {
+		return common.ErrNotSupported
+	}
+
+	upload, download := limits.UploadKB, limits.DownloadKB
+	if upload == 0 {
+		upload = int64(c.cfg.UploadRateLimitKB)
+	}
+	if download == 0 {
+		download = int64(c.cfg.DownloadRateLimitKB)
+	}
+	c.uploadLimiter.SetLimit(toLimit(upload))
+	c.downloadLimiter.SetLimit(toLimit(download))
+	return nil
+}
+
+// SetLocation moves data of torrents to dir, torrents are added again with
+// storage in dir.
+func (c *Client) SetLocation(ctx context.Context, torrents []*common.Torrent, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, ct := range torrents {
+		t, ok := c.torrent(ct.Hash)
+		if !ok {
+			return common.ErrTorrentNotFound
+		}
+		if t.Info() == nil {
+			return errors.New("torrent info is not fetched yet")
+		}
+		mi, err := metainfo.LoadFromFile(c.torrentPath(ct.Hash))
+		if err != nil {
+			return err
+		}
+		spec, err := torrent.TorrentSpecFromMetaInfoErr(mi)
+		if err != nil {
+			return err
+		}
+		name := t.Info().BestName()
+		c.stopRecheck(ct.Hash)
+
+		// stats of the added again torrent start from 0.
+		c.mu.Lock()
+		c.states[ct.Hash].Uploaded += uploaded(t)
+		t.Drop()
+		c.mu.Unlock()
+
+		// the torrent is added back at its old dir if the data failed to move.
+		moveErr := os.Rename(filepath.Join(ct.Dir, name), filepath.Join(dir, name))
+		if moveErr == nil || errors.Is(moveErr, os.ErrNotExist) {
+			moveErr = nil
+			c.mu.Lock()
+			c.states[ct.Hash].Dir = dir
+			c.mu.Unlock()
+		}
+
+		if err := c.add(spec); err != nil {
+			return errors.Join(moveErr, err)
+		}
+		if moveErr != nil {
+			return errors.Join(moveErr, c.saveState())
+		}
+	}
+	return c.saveState()
+}
+
+func (c *Client) Remove(ctx context.Context, torrents []*common.Torrent, deleteData bool) error {
+	for _, ct := range torrents {
+		c.stopRecheck(ct.Hash)
+		if t, ok := c.torrent(ct.Hash); ok {
+			t.Drop()
+		}
+
+		c.mu.Lock()
+		delete(c.states, ct.Hash)
+		c.mu.Unlock()
+
+		if err := os.Remove(c.torrentPath(ct.Hash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if deleteData {
+			common.RemoveData(ct)
+		}
+	}
+	return c.saveState()
+}
+
+// AddTorrentFile adds torrent files dropped in TorrentsDir.
+func (c *Client) AddTorrentFile(ctx context.Context, name string, data []byte) error {
+	_, err := c.AddTorrent(ctx, &common.AddRequest{Torrent: data})
+	return err
+}
+
+// AddTorrent adds the torrent or magnet, and keeps it in DataDir for next
+// runs. The engine has no labels or queue, so labels and priority are
+// ignored.
+func (c *Client) AddTorrent(ctx context.Context, req *common.AddRequest) (string, error) {
+	hash, err := req.Hash()
+	if err != nil {
+		return "", err
+	}
+	wanted, err := req.Wanted()
+	if err != nil {
+		return "", err
+	}
+
+	var spec *torrent.TorrentSpec
+	if len(req.Torrent) > 0 {
+		mi, err := req.MetaInfo()
+		if err != nil {
+			return "", err
+		}
+		if spec, err = torrent.TorrentSpecFromMetaInfoErr(mi); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(c.torrentPath(hash), req.Torrent, 0644); err != nil {
+			return "", err
+		}
+	} else {
+		if spec, err = torrent.TorrentSpecFromMagnetUri(req.Magnet); err != nil {
+			return "", err
+		}
+	}
+
+	c.mu.Lock()
+	if _, ok := c.states[hash]; !ok {
+		c.states[hash] = &torrentState{Stopped: req.Paused, Dir: req.Dir, Magnet: req.Magnet}
+		if wanted != nil {
+			c.states[hash].Unwanted = common.Unwanted(wanted)
+		}
+	}
+	c.mu.Unlock()
+
+	if err := c.add(spec); err != nil {
+		return "", err
+	}
+	return hash, c.saveState()
+}
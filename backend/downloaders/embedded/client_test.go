@@ -0,0 +1,395 @@
+package embedded
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/autoget-project/autoget/backend/downloaders/common"
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+// newSeeder seeds a torrent of dir/name from a local client, with no DHT,
+// trackers or port forwarding.
+func newSeeder(t *testing.T, dir, name string) (*torrent.Client, []byte) {
+	t.Helper()
+
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(t, info.BuildFromFilePath(filepath.Join(dir, name)))
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+	mi := &metainfo.MetaInfo{InfoBytes: infoBytes}
+
+	data := &bytes.Buffer{}
+	require.NoError(t, mi.Write(data))
+
+	tc := torrent.NewDefaultClientConfig()
+	tc.Seed = true
+	tc.NoDHT = true
+	tc.NoDefaultPortForwarding = true
+	tc.DisableTrackers = true
+	tc.ListenPort = 0
+	tc.DefaultStorage = storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	seeder, err := torrent.NewClient(tc)
+	require.NoError(t, err)
+	t.Cleanup(func() { seeder.Close() })
+
+	st, err := seeder.AddTorrent(mi)
+	require.NoError(t, err)
+	require.NoError(t, st.VerifyDataContext(t.Context()))
+	return seeder, data.Bytes()
+}
+
+func newConfig(t *testing.T) *config.DownloaderConfig {
+	tmpDir := t.TempDir()
+	return &config.DownloaderConfig{
+		Embedded: &config.EmbeddedConfig{
+			TorrentsDir: filepath.Join(tmpDir, "torrents"),
+			DownloadDir: filepath.Join(tmpDir, "download"),
+			FinishedDir: filepath.Join(tmpDir, "finished"),
+			DataDir:     filepath.Join(tmpDir, "data"),
+			NoDHT:       true,
+			NoUPnP:      true,
+		},
+	}
+}
+
+func newClient(t *testing.T, conf *config.DownloaderConfig) *Client {
+	t.Helper()
+
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+	t.Cleanup(client.Close)
+	return client
+}
+
+func hashOf(t *testing.T, data []byte) string {
+	mi, err := metainfo.Load(bytes.NewReader(data))
+	require.NoError(t, err)
+	return mi.HashInfoBytes().HexString()
+}
+
+func TestDownload(t *testing.T) {
+	seedDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(seedDir, "show", "sub"), 0755))
+	episode := bytes.Repeat([]byte("episode 1"), 10000)
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, "show", "ep1.mkv"), episode, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, "show", "sub", "ep1.srt"), []byte("subtitle 1"), 0644))
+	seeder, torrentFile := newSeeder(t, seedDir, "show")
+	hash := hashOf(t, torrentFile)
+
+	conf := newConfig(t)
+	client := newClient(t, conf)
+	require.NoError(t, client.AddTorrentFile(t.Context(), "show.torrent", torrentFile))
+
+	lt, ok := client.torrent(hash)
+	require.True(t, ok)
+	lt.AddClientPeer(seeder)
+
+	var got *common.Torrent
+	require.Eventually(t, func() bool {
+		torrents, err := client.Torrents(t.Context())
+		require.NoError(t, err)
+		require.Len(t, torrents, 1)
+		got = torrents[0]
+		return got.Status == common.StatusSeeding
+	}, 30*time.Second, 100*time.Millisecond)
+
+	assert.Equal(t, hash, got.Hash)
+	assert.Equal(t, "show", got.Name)
+	assert.Equal(t, float64(1), got.Progress)
+	assert.Equal(t, conf.Embedded.DownloadDir, got.Dir)
+	assert.ElementsMatch(t, []string{filepath.Join("show", "ep1.mkv"), filepath.Join("show", "sub", "ep1.srt")}, got.Files)
+
+	content, err := os.ReadFile(filepath.Join(conf.Embedded.DownloadDir, "show", "ep1.mkv"))
+	require.NoError(t, err)
+	assert.Equal(t, episode, content)
+}
+
+func TestResume(t *testing.T) {
+	seedDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, "file.bin"), []byte("content"), 0644))
+	_, torrentFile := newSeeder(t, seedDir, "file.bin")
+	hash := hashOf(t, torrentFile)
+
+	conf := newConfig(t)
+	conf.Embedded.UploadRateLimitKB = 100
+	conf.Embedded.DownloadRateLimitKB = 100
+
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, client.AddTorrentFile(t.Context(), "file.torrent", torrentFile))
+
+	torrents, err := client.Torrents(t.Context())
+	require.NoError(t, err)
+	require.Len(t, torrents, 1)
+	assert.Equal(t, hash, torrents[0].Hash)
+	assert.Equal(t, "file.bin", torrents[0].Name)
+	assert.Equal(t, []string{"file.bin"}, torrents[0].Files)
+	require.NoError(t, client.Stop(t.Context(), torrents))
+	client.Close()
+
+	// torrent and stopped state are kept for next run.
+	client = newClient(t, conf)
+	torrents, err = client.Torrents(t.Context())
+	require.NoError(t, err)
+	require.Len(t, torrents, 1)
+	assert.Equal(t, hash, torrents[0].Hash)
+	assert.Equal(t, common.StatusStopped, torrents[0].Status)
+
+	// removed torrent is gone for good.
+	require.NoError(t, client.Remove(t.Context(), torrents, false))
+	torrents, err = client.Torrents(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, torrents)
+	_, err = os.Stat(client.torrentPath(hash))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAddTorrent(t *testing.T) {
+	seedDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, "file.bin"), []byte("content"), 0644))
+	_, torrentFile := newSeeder(t, seedDir, "file.bin")
+	hash := hashOf(t, torrentFile)
+
+	conf := newConfig(t)
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+
+	tvDir := filepath.Join(t.TempDir(), "tv")
+	got, err := client.AddTorrent(t.Context(), &common.AddRequest{Torrent: torrentFile, Dir: tvDir, Paused: true})
+	require.NoError(t, err)
+	assert.Equal(t, hash, got)
+
+	// magnets without peers wait for info.
+	magnetHash := "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+	got, err = client.AddTorrent(t.Context(), &common.AddRequest{Magnet: "magnet:?xt=urn:btih:" + magnetHash})
+	require.NoError(t, err)
+	assert.Equal(t, magnetHash, got)
+
+	_, err = client.AddTorrent(t.Context(), &common.AddRequest{Torrent: []byte("broken")})
+	assert.Error(t, err)
+	client.Close()
+
+	// both are kept for next run.
+	client = newClient(t, conf)
+	torrents, err := client.Torrents(t.Context())
+	require.NoError(t, err)
+	require.Len(t, torrents, 2)
+
+	byHash := toTorrentsByHash(torrents)
+	require.Contains(t, byHash, hash)
+	assert.Equal(t, common.StatusStopped, byHash[hash].Status)
+	assert.Equal(t, tvDir, byHash[hash].Dir)
+	require.Contains(t, byHash, magnetHash)
+	assert.Equal(t, conf.Embedded.DownloadDir, byHash[magnetHash].Dir)
+}
+
+func TestAddPausedMagnet(t *testing.T) {
+	seedDir := t.TempDir()
+	content := bytes.Repeat([]byte("content"), 10000)
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, "file.bin"), content, 0644))
+	seeder, torrentFile := newSeeder(t, seedDir, "file.bin")
+	hash := hashOf(t, torrentFile)
+
+	conf := newConfig(t)
+	client := newClient(t, conf)
+	_, err := client.AddTorrent(t.Context(), &common.AddRequest{Magnet: "magnet:?xt=urn:btih:" + hash, Paused: true})
+	require.NoError(t, err)
+
+	lt, ok := client.torrent(hash)
+	require.True(t, ok)
+	lt.AddClientPeer(seeder)
+
+	// info is fetched and saved while paused, nothing is downloaded.
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(client.torrentPath(hash))
+		return err == nil
+	}, 30*time.Second, 100*time.Millisecond)
+	torrents, err := client.Torrents(t.Context())
+	require.NoError(t, err)
+	require.Len(t, torrents, 1)
+	assert.Equal(t, common.StatusStopped, torrents[0].Status)
+	assert.Equal(t, float64(0), torrents[0].Progress)
+
+	require.NoError(t, client.Start(t.Context(), torrents))
+	lt.AddClientPeer(seeder)
+	require.Eventually(t, func() bool {
+		torrents, err := client.Torrents(t.Context())
+		require.NoError(t, err)
+		return torrents[0].Status == common.StatusSeeding
+	}, 30*time.Second, 100*time.Millisecond)
+
+	got, err := os.ReadFile(filepath.Join(conf.Embedded.DownloadDir, "file.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	// the saved torrent lets it move.
+	tvDir := filepath.Join(t.TempDir(), "tv")
+	require.NoError(t, client.SetLocation(t.Context(), torrents, tvDir))
+	got, err = os.ReadFile(filepath.Join(tvDir, "file.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+}
+
+func toTorrentsByHash(torrents []*common.Torrent) map[string]*common.Torrent {
+	m := map[string]*common.Torrent{}
+	for _, t := range torrents {
+		m[t.Hash] = t
+	}
+	return m
+}
+
+func TestControl(t *testing.T) {
+	conf := newConfig(t)
+	require.NoError(t, os.MkdirAll(conf.Embedded.DownloadDir, 0755))
+	content := bytes.Repeat([]byte("content"), 10000)
+	require.NoError(t, os.WriteFile(filepath.Join(conf.Embedded.DownloadDir, "file.bin"), content, 0644))
+	_, torrentFile := newSeeder(t, conf.Embedded.DownloadDir, "file.bin")
+
+	client := newClient(t, conf)
+	_, err := client.AddTorrent(t.Context(), &common.AddRequest{Torrent: torrentFile})
+	require.NoError(t, err)
+
+	get := func() *common.Torrent {
+		torrents, err := client.Torrents(t.Context())
+		require.NoError(t, err)
+		require.Len(t, torrents, 1)
+		return torrents[0]
+	}
+	status := func() common.Status { return get().Status }
+	torrents := []*common.Torrent{get()}
+
+	require.NoError(t, client.Recheck(t.Context(), torrents))
+	require.Eventually(t, func() bool { return status() == common.StatusSeeding }, 10*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, client.Stop(t.Context(), torrents))
+	assert.Equal(t, common.StatusStopped, status())
+
+	require.NoError(t, client.Start(t.Context(), torrents))
+	assert.Equal(t, common.StatusSeeding, status())
+
+	assert.ErrorIs(t, client.Announce(t.Context(), torrents), common.ErrNotSupported)
+
+	// the torrent is kept at its dir if data fails to move.
+	takenDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(takenDir, "file.bin", "taken"), 0755))
+	assert.Error(t, client.SetLocation(t.Context(), torrents, takenDir))
+	assert.Equal(t, conf.Embedded.DownloadDir, get().Dir)
+
+	// data is moved and still complete.
+	tvDir := filepath.Join(t.TempDir(), "tv")
+	require.NoError(t, client.SetLocation(t.Context(), torrents, tvDir))
+	got, err := os.ReadFile(filepath.Join(tvDir, "file.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	assert.Equal(t, tvDir, get().Dir)
+	require.Eventually(t, func() bool { return status() == common.StatusSeeding }, 10*time.Second, 50*time.Millisecond)
+}
+
+func TestRemoveWhileRechecking(t *testing.T) {
+	conf := newConfig(t)
+	require.NoError(t, os.MkdirAll(conf.Embedded.DownloadDir, 0755))
+	// many pieces, so the recheck is still running.
+	content := bytes.Repeat([]byte("content"), 1<<20)
+	require.NoError(t, os.WriteFile(filepath.Join(conf.Embedded.DownloadDir, "file.bin"), content, 0644))
+	_, torrentFile := newSeeder(t, conf.Embedded.DownloadDir, "file.bin")
+
+	client := newClient(t, conf)
+	hash, err := client.AddTorrent(t.Context(), &common.AddRequest{Torrent: torrentFile})
+	require.NoError(t, err)
+	torrents := []*common.Torrent{{Hash: hash}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// dropped between pieces at some point.
+		for range 50 {
+			assert.NoError(t, client.Recheck(t.Context(), torrents))
+			time.Sleep(time.Millisecond)
+			assert.NoError(t, client.Remove(t.Context(), torrents, false))
+			// the engine is still usable.
+			_, err := client.AddTorrent(t.Context(), &common.AddRequest{Torrent: torrentFile})
+			assert.NoError(t, err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("engine locked up")
+	}
+}
+
+func TestAddTorrentFileSelection(t *testing.T) {
+	seedDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(seedDir, "show"), 0755))
+	// piece aligned, notes.txt has its own piece.
+	episode := bytes.Repeat([]byte("e"), 5*16*1024)
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, "show", "ep1.mkv"), episode, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(seedDir, "show", "notes.txt"), []byte("notes"), 0644))
+	seeder, torrentFile := newSeeder(t, seedDir, "show")
+	hash := hashOf(t, torrentFile)
+
+	conf := newConfig(t)
+	client := newClient(t, conf)
+
+	_, err := client.AddTorrent(t.Context(), &common.AddRequest{Torrent: torrentFile, Skip: []string{"*.txt"}})
+	require.NoError(t, err)
+
+	lt, ok := client.torrent(hash)
+	require.True(t, ok)
+	lt.AddClientPeer(seeder)
+
+	var got *common.Torrent
+	require.Eventually(t, func() bool {
+		torrents, err := client.Torrents(t.Context())
+		require.NoError(t, err)
+		require.Len(t, torrents, 1)
+		got = torrents[0]
+		return got.Status == common.StatusSeeding
+	}, 30*time.Second, 100*time.Millisecond)
+
+	assert.Equal(t, []string{filepath.Join("show", "ep1.mkv")}, got.Files)
+	assert.Equal(t, int64(len(episode)), got.Size)
+	assert.Equal(t, float64(1), got.Progress)
+
+	content, err := os.ReadFile(filepath.Join(conf.Embedded.DownloadDir, "show", "ep1.mkv"))
+	require.NoError(t, err)
+	assert.Equal(t, episode, content)
+	_, err = os.Stat(filepath.Join(conf.Embedded.DownloadDir, "show", "notes.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSetSpeedLimits(t *testing.T) {
+	conf := newConfig(t)
+	conf.Embedded.UploadRateLimitKB = 10
+	client := newClient(t, conf)
+
+	assert.Equal(t, rate.Limit(10*1024), client.uploadLimiter.Limit())
+	assert.Equal(t, rate.Inf, client.downloadLimiter.Limit())
+
+	require.NoError(t, client.SetSpeedLimits(t.Context(), &common.SpeedLimits{UploadKB: 50, DownloadKB: 100}))
+	assert.Equal(t, rate.Limit(50*1024), client.uploadLimiter.Limit())
+	assert.Equal(t, rate.Limit(100*1024), client.downloadLimiter.Limit())
+
+	// unlimited goes back to the configured limits.
+	require.NoError(t, client.SetSpeedLimits(t.Context(), &common.SpeedLimits{}))
+	assert.Equal(t, rate.Limit(10*1024), client.uploadLimiter.Limit())
+	assert.Equal(t, rate.Inf, client.downloadLimiter.Limit())
+
+	assert.ErrorIs(t, client.SetSpeedLimits(t.Context(), &common.SpeedLimits{AltSpeed: true}), common.ErrNotSupported)
+}
@@ -0,0 +1,488 @@
+package qbittorrent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/downloaders/common"
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/notify"
+	"github.com/autoget-project/autoget/backend/organizer"
+	"gorm.io/gorm"
+)
+
+// Client talks to qBittorrent Web API v2.
+type Client struct {
+	*common.Downloader
+
+	cfg     *config.QBittorrentConfig
+	baseURL string
+	client  *http.Client
+}
+
+func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, organizerClient *organizer.Client, notifier notify.INotifier) (*Client, error) {
+	u, err := url.Parse(cfg.QBittorrent.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	// session cookie from login is kept in jar.
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		cfg:     cfg.QBittorrent,
+		baseURL: strings.TrimSuffix(u.String(), "/"),
+		client:  &http.Client{Jar: jar},
+	}
+	c.Downloader = common.New(name, c, common.Dirs{
+		TorrentsDir: cfg.QBittorrent.TorrentsDir,
+		DownloadDir: cfg.QBittorrent.DownloadDir,
+		FinishedDir: cfg.QBittorrent.FinishedDir,
+	}, cfg, db, organizerClient, notifier)
+	return c, nil
+}
+
+func (c *Client) login(ctx context.Context) error {
+	form := url.Values{}
+	form.Set("username", c.cfg.Username)
+	form.Set("password", c.cfg.Password)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v2/auth/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// qBittorrent rejects requests with a foreign Referer.
+	req.Header.Set("Referer", c.baseURL)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "Ok." {
+		return fmt.Errorf("qbittorrent login failed: %d %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, path string, params url.Values) (*http.Request, error) {
+	var body io.Reader
+	u := c.baseURL + "/api/v2/" + path
+	if method == http.MethodGet {
+		if len(params) > 0 {
+			u += "?" + params.Encode()
+		}
+	} else {
+		body = strings.NewReader(params.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return req, nil
+}
+
+// call calls the API, logs in again when the session expired, and decodes
+// JSON response into out if it's not nil.
+func (c *Client) call(ctx context.Context, method string, path string, params url.Values, out any) error {
+	return c.do(ctx, path, func() (*http.Request, error) {
+		return c.newRequest(ctx, method, path, params)
+	}, out)
+}
+
+// do sends the request from newReq, which is called again for the retry
+// after login.
+func (c *Client) do(ctx context.Context, path string, newReq func() (*http.Request, error), out any) error {
+	send := func() (*http.Response, error) {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Referer", c.baseURL)
+		return c.client.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		resp.Body.Close()
+		if err := c.login(ctx); err != nil {
+			return err
+		}
+		resp, err = send()
+		if err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{path: path, code: resp.StatusCode}
+	}
+
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case *string:
+		// plain text response.
+		body, err := io.ReadAll(resp.Body)
+		*out = strings.TrimSpace(string(body))
+		return err
+	default:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+}
+
+type statusError struct {
+	path string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("qbittorrent %s returned %d", e.path, e.code)
+}
+
+type torrentInfo struct {
+	Hash     string  `json:"hash"`
+	Name     string  `json:"name"`
+	State    string  `json:"state"`
+	Progress float64 `json:"progress"`
+	Size     int64   `json:"size"`
+	Uploaded int64   `json:"uploaded"`
+	SavePath string  `json:"save_path"`
+	Category string  `json:"category"`
+	// Tracker is the current working tracker.
+	Tracker string `json:"tracker"`
+	// connected seeds and leechers.
+	NumSeeds  int `json:"num_seeds"`
+	NumLeechs int `json:"num_leechs"`
+}
+
+type torrentFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// Priority 0 is not downloaded.
+	Priority int `json:"priority"`
+}
+
+type transferInfo struct {
+	DownloadSpeed int64 `json:"dl_info_speed"`
+}
+
+func toStatus(state string) common.Status {
+	switch state {
+	case "downloading", "metaDL", "forcedMetaDL", "forcedDL", "stalledDL":
+		return common.StatusDownloading
+	case "uploading", "forcedUP", "stalledUP":
+		return common.StatusSeeding
+	// qBittorrent 5 renamed paused to stopped.
+	case "pausedUP", "pausedDL", "stoppedUP", "stoppedDL":
+		return common.StatusStopped
+	default:
+		return common.StatusOther
+	}
+}
+
+// localPath maps a path on qBittorrent side to local.
+func (c *Client) localPath(savePath string) string {
+	if c.cfg.SavePath == "" {
+		return savePath
+	}
+	rel, err := filepath.Rel(c.cfg.SavePath, savePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return savePath
+	}
+	return filepath.Join(c.cfg.DownloadDir, rel)
+}
+
+func (c *Client) Torrents(ctx context.Context) ([]*common.Torrent, error) {
+	params := url.Values{}
+	if c.cfg.Category != "" {
+		params.Set("category", c.cfg.Category)
+	}
+
+	infos := []torrentInfo{}
+	if err := c.call(ctx, http.MethodGet, "torrents/info", params, &infos); err != nil {
+		return nil, err
+	}
+
+	ts := []*common.Torrent{}
+	for _, i := range infos {
+		t := &common.Torrent{
+			Hash:     i.Hash,
+			Name:     i.Name,
+			Status:   toStatus(i.State),
+			Progress: i.Progress,
+			Size:     i.Size,
+			Uploaded: i.Uploaded,
+			Dir:      c.localPath(i.SavePath),
+			Peers:    i.NumSeeds + i.NumLeechs,
+		}
+		if i.Tracker != "" {
+			t.Trackers = []string{i.Tracker}
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+func (c *Client) Files(ctx context.Context, t *common.Torrent) error {
+	params := url.Values{}
+	params.Set("hash", t.Hash)
+
+	files := []torrentFile{}
+	if err := c.call(ctx, http.MethodGet, "torrents/files", params, &files); err != nil {
+		return err
+	}
+
+	t.Files = []string{}
+	for _, f := range files {
+		if f.Priority == 0 {
+			continue
+		}
+		t.Files = append(t.Files, f.Name)
+	}
+	return nil
+}
+
+func (c *Client) DownloadSpeed(ctx context.Context) (int64, error) {
+	info := &transferInfo{}
+	if err := c.call(ctx, http.MethodGet, "transfer/info", nil, info); err != nil {
+		return 0, err
+	}
+	return info.DownloadSpeed, nil
+}
+
+func toHashes(torrents []*common.Torrent) string {
+	hashes := []string{}
+	for _, t := range torrents {
+		hashes = append(hashes, t.Hash)
+	}
+	return strings.Join(hashes, "|")
+}
+
+func (c *Client) Stop(ctx context.Context, torrents []*common.Torrent) error {
+	// before qBittorrent 5, stop is called pause.
+	return c.torrentsAction(ctx, "torrents/stop", "torrents/pause", torrents, nil)
+}
+
+func (c *Client) Start(ctx context.Context, torrents []*common.Torrent) error {
+	// before qBittorrent 5, start is called resume.
+	return c.torrentsAction(ctx, "torrents/start", "torrents/resume", torrents, nil)
+}
+
+func (c *Client) Recheck(ctx context.Context, torrents []*common.Torrent) error {
+	return c.torrentsAction(ctx, "torrents/recheck", "", torrents, nil)
+}
+
+func (c *Client) Announce(ctx context.Context, torrents []*common.Torrent) error {
+	return c.torrentsAction(ctx, "torrents/reannounce", "", torrents, nil)
+}
+
+func (c *Client) SetLocation(ctx context.Context, torrents []*common.Torrent, dir string) error {
+	params := url.Values{}
+	params.Set("location", dir)
+	return c.torrentsAction(ctx, "torrents/setLocation", "", torrents, params)
+}
+
+// SetSpeedLimits sets global limits in bytes per second, 0 for unlimited,
+// and toggles alternative speed limits to match.
+func (c *Client) SetSpeedLimits(ctx context.Context, limits *common.SpeedLimits) error {
+	for _, l := range []struct {
+		path string
+		kb   int64
+	}{
+		{"transfer/setDownloadLimit", limits.DownloadKB},
+		{"transfer/setUploadLimit", limits.UploadKB},
+	} {
+		params := url.Values{}
+		params.Set("limit", fmt.Sprint(l.kb*1024))
+		if err := c.call(ctx, http.MethodPost, l.path, params, nil); err != nil {
+			return err
+		}
+	}
+
+	var mode int
+	if err := c.call(ctx, http.MethodGet, "transfer/speedLimitsMode", nil, &mode); err != nil {
+		return err
+	}
+	if (mode == 1) != limits.AltSpeed {
+		return c.call(ctx, http.MethodPost, "transfer/toggleSpeedLimitsMode", nil, nil)
+	}
+	return nil
+}
+
+// torrentsAction posts to path with hashes of torrents, and to oldPath if
+// path is not found on older qBittorrent.
+func (c *Client) torrentsAction(ctx context.Context, path, oldPath string, torrents []*common.Torrent, params url.Values) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("hashes", toHashes(torrents))
+
+	err := c.call(ctx, http.MethodPost, path, params, nil)
+	if se, ok := err.(*statusError); ok && se.code == http.StatusNotFound && oldPath != "" {
+		return c.call(ctx, http.MethodPost, oldPath, params, nil)
+	}
+	return err
+}
+
+func (c *Client) Remove(ctx context.Context, torrents []*common.Torrent, deleteData bool) error {
+	params := url.Values{}
+	params.Set("hashes", toHashes(torrents))
+	params.Set("deleteFiles", fmt.Sprint(deleteData))
+
+	return c.call(ctx, http.MethodPost, "torrents/delete", params, nil)
+}
+
+// qBittorrent adds torrents asynchronously, files of an added torrent are
+// polled this many times before selecting them.
+var (
+	filesAttempts = 20
+	filesInterval = 250 * time.Millisecond
+)
+
+// AddTorrent uploads the torrent with torrents/add, which doesn't return
+// the hash. Labels are set as tags. With file selection, the torrent is added
+// stopped and started once unwanted files are set to not download.
+func (c *Client) AddTorrent(ctx context.Context, req *common.AddRequest) (string, error) {
+	hash, err := req.Hash()
+	if err != nil {
+		return "", err
+	}
+	wanted, err := req.Wanted()
+	if err != nil {
+		return "", err
+	}
+	unwanted := common.Unwanted(wanted)
+	stopped := req.Paused || len(unwanted) > 0
+
+	fields := map[string]string{
+		"savepath": req.Dir,
+		"category": c.cfg.Category,
+		"tags":     strings.Join(req.Labels, ","),
+		// qBittorrent 5 renamed paused to stopped.
+		"paused":  fmt.Sprint(stopped),
+		"stopped": fmt.Sprint(stopped),
+	}
+	if req.Dir == "" && c.cfg.SavePath != "" {
+		fields["savepath"] = c.cfg.SavePath
+	}
+	if req.Priority > common.PriorityNormal {
+		fields["addToTopOfQueue"] = "true"
+	}
+	if req.Magnet != "" {
+		fields["urls"] = req.Magnet
+	}
+
+	newReq := func() (*http.Request, error) {
+		body := &bytes.Buffer{}
+		w := multipart.NewWriter(body)
+		for k, v := range fields {
+			if v == "" {
+				continue
+			}
+			if err := w.WriteField(k, v); err != nil {
+				return nil, err
+			}
+		}
+		if len(req.Torrent) > 0 {
+			part, err := w.CreateFormFile("torrents", hash+".torrent")
+			if err != nil {
+				return nil, err
+			}
+			if _, err := part.Write(req.Torrent); err != nil {
+				return nil, err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		r, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v2/torrents/add", body)
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Content-Type", w.FormDataContentType())
+		return r, nil
+	}
+
+	res := ""
+	if err := c.do(ctx, "torrents/add", newReq, &res); err != nil {
+		return "", err
+	}
+	if res == "Fails." {
+		return "", fmt.Errorf("qbittorrent failed to add torrent %s", hash)
+	}
+	if len(unwanted) == 0 {
+		return hash, nil
+	}
+
+	if err := c.skipFiles(ctx, hash, unwanted); err != nil {
+		// not left stopped and untracked.
+		if er := c.Remove(ctx, []*common.Torrent{{Hash: hash}}, true); er != nil {
+			return "", errors.Join(err, er)
+		}
+		return "", err
+	}
+
+	if !req.Paused {
+		if err := c.Start(ctx, []*common.Torrent{{Hash: hash}}); err != nil {
+			return "", err
+		}
+	}
+	return hash, nil
+}
+
+// skipFiles sets unwanted files of the torrent to not download, once
+// qBittorrent knows the torrent.
+func (c *Client) skipFiles(ctx context.Context, hash string, unwanted []int) error {
+	params := url.Values{}
+	params.Set("hash", hash)
+	for i := range filesAttempts {
+		files := []torrentFile{}
+		err := c.call(ctx, http.MethodGet, "torrents/files", params, &files)
+		if err == nil && len(files) > 0 {
+			break
+		}
+		if i == filesAttempts-1 {
+			return fmt.Errorf("qbittorrent didn't add torrent %s in time: %v", hash, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(filesInterval):
+		}
+	}
+
+	ids := []string{}
+	for _, i := range unwanted {
+		ids = append(ids, fmt.Sprint(i))
+	}
+	params.Set("id", strings.Join(ids, "|"))
+	params.Set("priority", "0")
+	return c.call(ctx, http.MethodPost, "torrents/filePrio", params, nil)
+}
@@ -0,0 +1,497 @@
+package qbittorrent
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/autoget-project/autoget/backend/downloaders/common"
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	Path   string
+	Params map[string]string
+}
+
+// fake qBittorrent Web API
+type fakeQBittorrent struct {
+	reqs []*request
+
+	loggedIn bool
+	// pauseOnly acts like qBittorrent before 5.0.
+	pauseOnly bool
+	addFails  bool
+	// filesPending answers torrents/files of so many requests with not
+	// found, like a torrent still being added.
+	filesPending int
+
+	torrents []torrentInfo
+	files    map[string][]torrentFile
+	speed    int64
+	altSpeed bool
+}
+
+func (f *fakeQBittorrent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	req := &request{Path: r.URL.Path, Params: map[string]string{}}
+	for k := range r.Form {
+		req.Params[k] = r.Form.Get(k)
+	}
+	// torrents/add uploads files, which are kept as params.
+	if err := r.ParseMultipartForm(1 << 20); err == nil {
+		for k := range r.MultipartForm.Value {
+			req.Params[k] = r.MultipartForm.Value[k][0]
+		}
+		for k, fhs := range r.MultipartForm.File {
+			file, _ := fhs[0].Open()
+			data, _ := io.ReadAll(file)
+			file.Close()
+			req.Params[k] = string(data)
+		}
+	}
+	f.reqs = append(f.reqs, req)
+
+	if r.URL.Path == "/api/v2/auth/login" {
+		if r.Form.Get("username") != "admin" || r.Form.Get("password") != "secret" {
+			w.Write([]byte("Fails."))
+			return
+		}
+		f.loggedIn = true
+		http.SetCookie(w, &http.Cookie{Name: "SID", Value: "session", Path: "/"})
+		w.Write([]byte("Ok."))
+		return
+	}
+
+	if c, err := r.Cookie("SID"); err != nil || c.Value != "session" || !f.loggedIn {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/api/v2/torrents/info":
+		ts := []torrentInfo{}
+		for _, t := range f.torrents {
+			if cat := r.Form.Get("category"); cat == "" || cat == t.Category {
+				ts = append(ts, t)
+			}
+		}
+		json.NewEncoder(w).Encode(ts)
+	case "/api/v2/torrents/files":
+		files, ok := f.files[r.Form.Get("hash")]
+		if !ok || f.filesPending > 0 {
+			f.filesPending--
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(files)
+	case "/api/v2/transfer/info":
+		json.NewEncoder(w).Encode(transferInfo{DownloadSpeed: f.speed})
+	case "/api/v2/torrents/stop", "/api/v2/torrents/start":
+		if f.pauseOnly {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case "/api/v2/torrents/add":
+		if f.addFails {
+			w.Write([]byte("Fails."))
+			return
+		}
+		w.Write([]byte("Ok."))
+	case "/api/v2/transfer/speedLimitsMode":
+		if f.altSpeed {
+			w.Write([]byte("1"))
+		} else {
+			w.Write([]byte("0"))
+		}
+	case "/api/v2/transfer/toggleSpeedLimitsMode":
+		f.altSpeed = !f.altSpeed
+	case "/api/v2/transfer/setDownloadLimit", "/api/v2/transfer/setUploadLimit":
+	case "/api/v2/torrents/pause", "/api/v2/torrents/resume", "/api/v2/torrents/delete",
+		"/api/v2/torrents/recheck", "/api/v2/torrents/reannounce", "/api/v2/torrents/setLocation",
+		"/api/v2/torrents/filePrio":
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeQBittorrent) paths() []string {
+	paths := []string{}
+	for _, r := range f.reqs {
+		paths = append(paths, r.Path)
+	}
+	return paths
+}
+
+func newFake(t *testing.T) (*fakeQBittorrent, *httptest.Server) {
+	t.Helper()
+
+	fake := &fakeQBittorrent{files: map[string][]torrentFile{}}
+	serv := httptest.NewServer(fake)
+	t.Cleanup(serv.Close)
+	return fake, serv
+}
+
+func newConfig(url string) *config.DownloaderConfig {
+	return &config.DownloaderConfig{
+		QBittorrent: &config.QBittorrentConfig{
+			URL:      url,
+			Username: "admin",
+			Password: "secret",
+			Category: "autoget",
+		},
+	}
+}
+
+func TestLogin(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		fake, serv := newFake(t)
+		fake.torrents = []torrentInfo{
+			{Hash: "1", Name: "Torrent 1", State: "downloading", Category: "autoget"},
+			{Hash: "2", Name: "Torrent 2", State: "uploading", Category: "other"},
+		}
+
+		client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+		require.NoError(t, err)
+
+		torrents, err := client.Torrents(t.Context())
+		require.NoError(t, err)
+		require.Len(t, torrents, 1)
+		assert.Equal(t, "1", torrents[0].Hash)
+
+		// session cookie is reused.
+		_, err = client.Torrents(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"/api/v2/torrents/info",
+			"/api/v2/auth/login",
+			"/api/v2/torrents/info",
+			"/api/v2/torrents/info",
+		}, fake.paths())
+		assert.Equal(t, "autoget", fake.reqs[0].Params["category"])
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		_, serv := newFake(t)
+		conf := newConfig(serv.URL)
+		conf.QBittorrent.Password = "wrong"
+
+		client, err := New("test", conf, nil, nil, nil)
+		require.NoError(t, err)
+
+		_, err = client.Torrents(t.Context())
+		assert.ErrorContains(t, err, "qbittorrent login failed")
+	})
+}
+
+func TestTorrents(t *testing.T) {
+	fake, serv := newFake(t)
+
+	conf := newConfig(serv.URL)
+	conf.QBittorrent.DownloadDir = "/data/download"
+	// qBittorrent sees download dir as /downloads
+	conf.QBittorrent.SavePath = "/downloads"
+
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+
+	fake.torrents = []torrentInfo{
+		{
+			Hash: "1", Name: "Torrent 1", State: "downloading", Progress: 0.5, Size: 1000,
+			SavePath: "/downloads", Category: "autoget", NumSeeds: 2, NumLeechs: 1,
+		},
+		{
+			Hash: "2", Name: "Torrent 2", State: "stalledUP", Progress: 1, Size: 2000, Uploaded: 500,
+			SavePath: "/downloads/tv", Category: "autoget", Tracker: "https://tracker.private.org/announce",
+		},
+		// out of save path, kept as is.
+		{Hash: "3", Name: "Torrent 3", State: "stoppedDL", SavePath: "/other", Category: "autoget"},
+		// other category.
+		{Hash: "4", Name: "Torrent 4", State: "uploading", Category: "other"},
+	}
+	fake.files["2"] = []torrentFile{{Name: "show/ep1.mkv", Priority: 1}, {Name: "show/sub/ep1.srt", Priority: 1}}
+	fake.speed = 1000 * 1000
+
+	torrents, err := client.Torrents(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []*common.Torrent{
+		{Hash: "1", Name: "Torrent 1", Status: common.StatusDownloading, Progress: 0.5, Size: 1000, Peers: 3, Dir: "/data/download"},
+		{
+			Hash: "2", Name: "Torrent 2", Status: common.StatusSeeding, Progress: 1, Size: 2000, Uploaded: 500,
+			Trackers: []string{"https://tracker.private.org/announce"}, Dir: "/data/download/tv",
+		},
+		{Hash: "3", Name: "Torrent 3", Status: common.StatusStopped, Dir: "/other"},
+	}, torrents)
+
+	require.NoError(t, client.Files(t.Context(), torrents[1]))
+	assert.Equal(t, []string{"show/ep1.mkv", "show/sub/ep1.srt"}, torrents[1].Files)
+
+	speed, err := client.DownloadSpeed(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000*1000), speed)
+
+	assert.Equal(t, []string{
+		"/api/v2/torrents/info",
+		"/api/v2/auth/login",
+		"/api/v2/torrents/info",
+		"/api/v2/torrents/files",
+		"/api/v2/transfer/info",
+	}, fake.paths())
+	assert.Equal(t, map[string]string{"hash": "2"}, fake.reqs[3].Params)
+}
+
+func newTorrentFile(t *testing.T) ([]byte, string) {
+	t.Helper()
+
+	info := metainfo.Info{Name: "file.bin", PieceLength: 16 * 1024, Length: 7, Pieces: make([]byte, 20)}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+	mi := &metainfo.MetaInfo{InfoBytes: infoBytes}
+
+	data := &bytes.Buffer{}
+	require.NoError(t, mi.Write(data))
+	return data.Bytes(), mi.HashInfoBytes().HexString()
+}
+
+func TestAddTorrent(t *testing.T) {
+	fake, serv := newFake(t)
+	conf := newConfig(serv.URL)
+	conf.QBittorrent.SavePath = "/qbt/downloads"
+
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+
+	data, hash := newTorrentFile(t)
+	got, err := client.AddTorrent(t.Context(), &common.AddRequest{
+		Torrent:  data,
+		Labels:   []string{"tv", "anime"},
+		Paused:   true,
+		Priority: common.PriorityHigh,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, hash, got)
+
+	// upload is sent again after login.
+	assert.Equal(t, []string{"/api/v2/torrents/add", "/api/v2/auth/login", "/api/v2/torrents/add"}, fake.paths())
+	assert.Equal(t, map[string]string{
+		"torrents":        string(data),
+		"savepath":        "/qbt/downloads",
+		"category":        "autoget",
+		"tags":            "tv,anime",
+		"paused":          "true",
+		"stopped":         "true",
+		"addToTopOfQueue": "true",
+	}, fake.reqs[2].Params)
+
+	fake.reqs = nil
+	magnet := "magnet:?xt=urn:btih:" + hash + "&dn=file.bin"
+	got, err = client.AddTorrent(t.Context(), &common.AddRequest{Magnet: magnet, Dir: "/qbt/other"})
+	require.NoError(t, err)
+	assert.Equal(t, hash, got)
+	assert.Equal(t, map[string]string{
+		"urls":     magnet,
+		"savepath": "/qbt/other",
+		"category": "autoget",
+		"paused":   "false",
+		"stopped":  "false",
+	}, fake.reqs[0].Params)
+
+	// qBittorrent replies Fails. to broken torrents.
+	fake.addFails = true
+	_, err = client.AddTorrent(t.Context(), &common.AddRequest{Torrent: data})
+	assert.EqualError(t, err, "qbittorrent failed to add torrent "+hash)
+}
+
+// newMultiFileTorrent returns a torrent of show/ep1.mkv, show/Sample/sample.mkv
+// and show/notes.txt.
+func newMultiFileTorrent(t *testing.T) ([]byte, string) {
+	t.Helper()
+
+	info := metainfo.Info{Name: "show", PieceLength: 16 * 1024, Pieces: make([]byte, 20)}
+	for _, p := range [][]string{{"ep1.mkv"}, {"Sample", "sample.mkv"}, {"notes.txt"}} {
+		info.Files = append(info.Files, metainfo.FileInfo{Path: p, Length: 1})
+	}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+	mi := &metainfo.MetaInfo{InfoBytes: infoBytes}
+
+	data := &bytes.Buffer{}
+	require.NoError(t, mi.Write(data))
+	return data.Bytes(), mi.HashInfoBytes().HexString()
+}
+
+func TestAddTorrentFileSelection(t *testing.T) {
+	fake, serv := newFake(t)
+
+	client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+	require.NoError(t, err)
+
+	filesInterval = time.Millisecond
+	t.Cleanup(func() { filesInterval = 250 * time.Millisecond })
+
+	data, hash := newMultiFileTorrent(t)
+	added := []torrentFile{{Name: "show/ep1.mkv", Priority: 1}, {Name: "show/Sample/sample.mkv", Priority: 1}, {Name: "show/notes.txt", Priority: 1}}
+	fake.files[hash] = added
+	// still being added by qBittorrent.
+	fake.filesPending = 1
+	_, err = client.AddTorrent(t.Context(), &common.AddRequest{Torrent: data, Skip: []string{"*.txt", "sample"}})
+	require.NoError(t, err)
+
+	// added stopped, started after unwanted files are skipped.
+	assert.Equal(t, []string{
+		"/api/v2/torrents/add", "/api/v2/auth/login", "/api/v2/torrents/add",
+		"/api/v2/torrents/files", "/api/v2/torrents/files",
+		"/api/v2/torrents/filePrio", "/api/v2/torrents/start",
+	}, fake.paths())
+	assert.Equal(t, "true", fake.reqs[2].Params["stopped"])
+	assert.Equal(t, map[string]string{"hash": hash, "id": "1|2", "priority": "0"}, fake.reqs[5].Params)
+
+	// paused torrents stay stopped.
+	fake.reqs = nil
+	_, err = client.AddTorrent(t.Context(), &common.AddRequest{Torrent: data, Files: []int{0}, Paused: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/api/v2/torrents/add", "/api/v2/torrents/files", "/api/v2/torrents/filePrio"}, fake.paths())
+
+	// removed if never added in time.
+	fake.reqs = nil
+	fake.filesPending = filesAttempts
+	_, err = client.AddTorrent(t.Context(), &common.AddRequest{Torrent: data, Files: []int{0}})
+	require.Error(t, err)
+	paths := fake.paths()
+	assert.Len(t, paths, 2+filesAttempts)
+	assert.Equal(t, "/api/v2/torrents/delete", paths[len(paths)-1])
+	fake.filesPending = 0
+
+	// skipped files are not copied.
+	fake.files[hash] = []torrentFile{
+		{Name: "show/ep1.mkv", Priority: 1},
+		{Name: "show/Sample/sample.mkv", Priority: 0},
+		{Name: "show/notes.txt", Priority: 0},
+	}
+	tr := &common.Torrent{Hash: hash}
+	require.NoError(t, client.Files(t.Context(), tr))
+	assert.Equal(t, []string{"show/ep1.mkv"}, tr.Files)
+}
+
+func TestControl(t *testing.T) {
+	torrents := []*common.Torrent{{Hash: "1"}, {Hash: "2"}}
+
+	tests := []struct {
+		name      string
+		pauseOnly bool
+		action    func(c *Client) error
+		paths     []string
+		params    map[string]string
+	}{
+		{
+			name:   "stop",
+			action: func(c *Client) error { return c.Stop(t.Context(), torrents) },
+			paths:  []string{"/api/v2/torrents/stop"},
+			params: map[string]string{"hashes": "1|2"},
+		},
+		{
+			name:      "stop qbittorrent 4",
+			pauseOnly: true,
+			action:    func(c *Client) error { return c.Stop(t.Context(), torrents) },
+			paths:     []string{"/api/v2/torrents/stop", "/api/v2/torrents/pause"},
+			params:    map[string]string{"hashes": "1|2"},
+		},
+		{
+			name:   "start",
+			action: func(c *Client) error { return c.Start(t.Context(), torrents) },
+			paths:  []string{"/api/v2/torrents/start"},
+			params: map[string]string{"hashes": "1|2"},
+		},
+		{
+			name:      "start qbittorrent 4",
+			pauseOnly: true,
+			action:    func(c *Client) error { return c.Start(t.Context(), torrents) },
+			paths:     []string{"/api/v2/torrents/start", "/api/v2/torrents/resume"},
+			params:    map[string]string{"hashes": "1|2"},
+		},
+		{
+			name:   "recheck",
+			action: func(c *Client) error { return c.Recheck(t.Context(), torrents) },
+			paths:  []string{"/api/v2/torrents/recheck"},
+			params: map[string]string{"hashes": "1|2"},
+		},
+		{
+			name:   "announce",
+			action: func(c *Client) error { return c.Announce(t.Context(), torrents) },
+			paths:  []string{"/api/v2/torrents/reannounce"},
+			params: map[string]string{"hashes": "1|2"},
+		},
+		{
+			name:   "set location",
+			action: func(c *Client) error { return c.SetLocation(t.Context(), torrents, "/downloads/tv") },
+			paths:  []string{"/api/v2/torrents/setLocation"},
+			params: map[string]string{"hashes": "1|2", "location": "/downloads/tv"},
+		},
+		{
+			name:   "remove",
+			action: func(c *Client) error { return c.Remove(t.Context(), torrents, false) },
+			paths:  []string{"/api/v2/torrents/delete"},
+			params: map[string]string{"hashes": "1|2", "deleteFiles": "false"},
+		},
+		{
+			name:   "remove with data",
+			action: func(c *Client) error { return c.Remove(t.Context(), torrents, true) },
+			paths:  []string{"/api/v2/torrents/delete"},
+			params: map[string]string{"hashes": "1|2", "deleteFiles": "true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, serv := newFake(t)
+			fake.pauseOnly = tt.pauseOnly
+
+			client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+			require.NoError(t, err)
+
+			require.NoError(t, tt.action(client))
+			// the first request logs in and is retried.
+			got := fake.paths()[2:]
+			assert.Equal(t, tt.paths, got)
+			assert.Equal(t, tt.params, fake.reqs[len(fake.reqs)-1].Params)
+		})
+	}
+}
+
+func TestSetSpeedLimits(t *testing.T) {
+	fake, serv := newFake(t)
+
+	client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, client.SetSpeedLimits(t.Context(), &common.SpeedLimits{UploadKB: 50, DownloadKB: 100}))
+	assert.Equal(t, []*request{
+		{Path: "/api/v2/transfer/setDownloadLimit", Params: map[string]string{"limit": "102400"}},
+		{Path: "/api/v2/transfer/setUploadLimit", Params: map[string]string{"limit": "51200"}},
+		{Path: "/api/v2/transfer/speedLimitsMode", Params: map[string]string{}},
+	}, fake.reqs[len(fake.reqs)-3:])
+	assert.False(t, fake.altSpeed)
+
+	fake.reqs = nil
+	require.NoError(t, client.SetSpeedLimits(t.Context(), &common.SpeedLimits{AltSpeed: true}))
+	assert.Equal(t, []string{
+		"/api/v2/transfer/setDownloadLimit",
+		"/api/v2/transfer/setUploadLimit",
+		"/api/v2/transfer/speedLimitsMode",
+		"/api/v2/transfer/toggleSpeedLimitsMode",
+	}, fake.paths())
+	assert.Equal(t, "0", fake.reqs[0].Params["limit"])
+	assert.True(t, fake.altSpeed)
+
+	// already in alt speed mode.
+	fake.reqs = nil
+	require.NoError(t, client.SetSpeedLimits(t.Context(), &common.SpeedLimits{AltSpeed: true}))
+	assert.NotContains(t, fake.paths(), "/api/v2/transfer/toggleSpeedLimitsMode")
+}
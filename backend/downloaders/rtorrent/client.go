@@ -0,0 +1,423 @@
+package rtorrent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/autoget-project/autoget/backend/downloaders/common"
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/internal/notify"
+	"github.com/autoget-project/autoget/backend/organizer"
+	"gorm.io/gorm"
+)
+
+var (
+	httpClient = http.DefaultClient
+
+	// fields of d.multicall2, in order of torrentFields.
+	multicallFields = []any{"", "main",
+		"d.hash=", "d.name=", "d.state=", "d.is_active=", "d.complete=",
+		"d.bytes_done=", "d.size_bytes=", "d.up.total=", "d.directory=",
+		"d.is_multi_file=", "d.custom1="}
+)
+
+// Client talks to rTorrent XML-RPC over SCGI or HTTP.
+type Client struct {
+	*common.Downloader
+
+	cfg *config.RTorrentConfig
+	u   *url.URL
+}
+
+func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, organizerClient *organizer.Client, notifier notify.INotifier) (*Client, error) {
+	u, err := url.Parse(cfg.RTorrent.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https", "scgi":
+	default:
+		return nil, fmt.Errorf("unsupported rtorrent URL scheme: %s", u.Scheme)
+	}
+
+	c := &Client{
+		cfg: cfg.RTorrent,
+		u:   u,
+	}
+	c.Downloader = common.New(name, c, common.Dirs{
+		TorrentsDir: cfg.RTorrent.TorrentsDir,
+		DownloadDir: cfg.RTorrent.DownloadDir,
+		FinishedDir: cfg.RTorrent.FinishedDir,
+	}, cfg, db, organizerClient, notifier)
+	return c, nil
+}
+
+func (c *Client) call(ctx context.Context, method string, params ...any) (any, error) {
+	body, err := encodeCall(method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp []byte
+	if c.u.Scheme == "scgi" {
+		resp, err = c.sendSCGI(ctx, body)
+	} else {
+		resp, err = c.sendHTTP(ctx, body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeResponse(resp)
+}
+
+func (c *Client) sendHTTP(ctx context.Context, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	if c.cfg.Username != "" {
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rtorrent returned %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// sendSCGI sends body over SCGI to host:port, or to the unix socket in path
+// when host is empty.
+func (c *Client) sendSCGI(ctx context.Context, body []byte) ([]byte, error) {
+	network, addr := "tcp", c.u.Host
+	if addr == "" {
+		network, addr = "unix", c.u.Path
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	headers := "CONTENT_LENGTH\x00" + strconv.Itoa(len(body)) + "\x00SCGI\x001\x00REQUEST_METHOD\x00POST\x00"
+	if _, err := fmt.Fprintf(conn, "%d:%s,", len(headers), headers); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(body); err != nil {
+		return nil, err
+	}
+
+	// response is CGI style headers and body.
+	r := textproto.NewReader(bufio.NewReader(conn))
+	h, err := r.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	if status := h.Get("Status"); status != "" && !strings.HasPrefix(status, "200") {
+		return nil, fmt.Errorf("rtorrent returned %s", status)
+	}
+	return io.ReadAll(r.R)
+}
+
+func toInt(v any) int64 {
+	n, _ := v.(int64)
+	return n
+}
+
+func toString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+// localPath maps a path on rTorrent side to local.
+func (c *Client) localPath(p string) string {
+	if c.cfg.SavePath == "" {
+		return p
+	}
+	rel, err := filepath.Rel(c.cfg.SavePath, p)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return p
+	}
+	return filepath.Join(c.cfg.DownloadDir, rel)
+}
+
+func toStatus(state, active, complete int64) common.Status {
+	if state == 0 || active == 0 {
+		return common.StatusStopped
+	}
+	if complete == 1 {
+		return common.StatusSeeding
+	}
+	return common.StatusDownloading
+}
+
+func (c *Client) Torrents(ctx context.Context) ([]*common.Torrent, error) {
+	res, err := c.call(ctx, "d.multicall2", multicallFields...)
+	if err != nil {
+		return nil, err
+	}
+	rows, _ := res.([]any)
+
+	ts := []*common.Torrent{}
+	for _, r := range rows {
+		f, _ := r.([]any)
+		if len(f) != len(multicallFields)-2 {
+			return nil, fmt.Errorf("unexpected d.multicall2 result: %v", r)
+		}
+		if c.cfg.Label != "" && toString(f[10]) != c.cfg.Label {
+			continue
+		}
+
+		t := &common.Torrent{
+			Hash:     strings.ToLower(toString(f[0])),
+			Name:     toString(f[1]),
+			Status:   toStatus(toInt(f[2]), toInt(f[3]), toInt(f[4])),
+			Size:     toInt(f[6]),
+			Uploaded: toInt(f[7]),
+			Dir:      c.localPath(toString(f[8])),
+			// not reported.
+			Peers: -1,
+		}
+		if t.Size > 0 {
+			t.Progress = float64(toInt(f[5])) / float64(t.Size)
+		}
+		// d.directory of multi file torrents is the torrent's own dir.
+		if toInt(f[9]) == 1 {
+			t.Dir = filepath.Dir(t.Dir)
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+func (c *Client) Files(ctx context.Context, t *common.Torrent) error {
+	multi, err := c.call(ctx, "d.is_multi_file", strings.ToUpper(t.Hash))
+	if err != nil {
+		return err
+	}
+	dir, err := c.call(ctx, "d.directory", strings.ToUpper(t.Hash))
+	if err != nil {
+		return err
+	}
+	res, err := c.call(ctx, "f.multicall", strings.ToUpper(t.Hash), "", "f.path=", "f.priority=")
+	if err != nil {
+		return err
+	}
+
+	// paths of multi file torrents are relative to the torrent's own dir.
+	prefix := ""
+	if toInt(multi) == 1 {
+		prefix = filepath.Base(toString(dir))
+	}
+
+	rows, _ := res.([]any)
+	t.Files = []string{}
+	for _, r := range rows {
+		f, _ := r.([]any)
+		if len(f) != 2 {
+			return fmt.Errorf("unexpected f.multicall result: %v", r)
+		}
+		// priority 0 is not downloaded.
+		if toInt(f[1]) == 0 {
+			continue
+		}
+		t.Files = append(t.Files, filepath.Join(prefix, toString(f[0])))
+	}
+	return nil
+}
+
+func (c *Client) DownloadSpeed(ctx context.Context) (int64, error) {
+	res, err := c.call(ctx, "throttle.global_down.rate")
+	if err != nil {
+		return 0, err
+	}
+	return toInt(res), nil
+}
+
+func (c *Client) Stop(ctx context.Context, torrents []*common.Torrent) error {
+	for _, t := range torrents {
+		if _, err := c.call(ctx, "d.stop", strings.ToUpper(t.Hash)); err != nil {
+			return err
+		}
+		if _, err := c.call(ctx, "d.close", strings.ToUpper(t.Hash)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start opens and starts torrents closed by Stop.
+func (c *Client) Start(ctx context.Context, torrents []*common.Torrent) error {
+	for _, t := range torrents {
+		if _, err := c.call(ctx, "d.open", strings.ToUpper(t.Hash)); err != nil {
+			return err
+		}
+		if _, err := c.call(ctx, "d.start", strings.ToUpper(t.Hash)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) Recheck(ctx context.Context, torrents []*common.Torrent) error {
+	for _, t := range torrents {
+		if _, err := c.call(ctx, "d.check_hash", strings.ToUpper(t.Hash)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) Announce(ctx context.Context, torrents []*common.Torrent) error {
+	for _, t := range torrents {
+		if _, err := c.call(ctx, "d.tracker_announce", strings.ToUpper(t.Hash)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetLocation is not supported, rTorrent only changes the directory of
+// closed torrents without moving data.
+func (c *Client) SetLocation(ctx context.Context, torrents []*common.Torrent, dir string) error {
+	return common.ErrNotSupported
+}
+
+// SetSpeedLimits sets global throttles in KiB/s, 0 for unlimited.
+func (c *Client) SetSpeedLimits(ctx context.Context, limits *common.SpeedLimits) error {
+	if limits.AltSpeed {
+		return common.ErrNotSupported
+	}
+	if _, err := c.call(ctx, "throttle.global_down.max_rate.set_kb", "", limits.DownloadKB); err != nil {
+		return err
+	}
+	_, err := c.call(ctx, "throttle.global_up.max_rate.set_kb", "", limits.UploadKB)
+	return err
+}
+
+// Remove erases torrents, rTorrent never deletes data so files are removed
+// here.
+func (c *Client) Remove(ctx context.Context, torrents []*common.Torrent, deleteData bool) error {
+	for _, t := range torrents {
+		if deleteData && t.Files == nil {
+			if err := c.Files(ctx, t); err != nil {
+				return err
+			}
+		}
+
+		if _, err := c.call(ctx, "d.erase", strings.ToUpper(t.Hash)); err != nil {
+			return err
+		}
+
+		if deleteData {
+			common.RemoveData(t)
+		}
+	}
+	return nil
+}
+
+// AddTorrentFile adds torrent files dropped in TorrentsDir.
+func (c *Client) AddTorrentFile(ctx context.Context, name string, data []byte) error {
+	return c.load(ctx, &common.AddRequest{Torrent: data})
+}
+
+// AddTorrent loads the torrent, with file selection it is loaded stopped and
+// started once unwanted files are set to priority off.
+func (c *Client) AddTorrent(ctx context.Context, req *common.AddRequest) (string, error) {
+	hash, err := req.Hash()
+	if err != nil {
+		return "", err
+	}
+	wanted, err := req.Wanted()
+	if err != nil {
+		return "", err
+	}
+	unwanted := common.Unwanted(wanted)
+	if len(unwanted) == 0 {
+		return hash, c.load(ctx, req)
+	}
+
+	stopped := *req
+	stopped.Paused = true
+	if err := c.load(ctx, &stopped); err != nil {
+		return "", err
+	}
+
+	target := strings.ToUpper(hash)
+	for _, i := range unwanted {
+		if _, err := c.call(ctx, "f.priority.set", fmt.Sprintf("%s:f%d", target, i), 0); err != nil {
+			return "", err
+		}
+	}
+	if _, err := c.call(ctx, "d.update_priorities", target); err != nil {
+		return "", err
+	}
+	if !req.Paused {
+		if _, err := c.call(ctx, "d.start", target); err != nil {
+			return "", err
+		}
+	}
+	return hash, nil
+}
+
+// load loads the torrent or magnet with load.raw or load.normal, started
+// unless paused, and sets directory, label and priority on load.
+func (c *Client) load(ctx context.Context, req *common.AddRequest) error {
+	dir := c.cfg.DownloadDir
+	if c.cfg.SavePath != "" {
+		dir = c.cfg.SavePath
+	}
+	if req.Dir != "" {
+		dir = req.Dir
+	}
+
+	var target any = req.Magnet
+	load, start := "load.normal", "load.start"
+	if len(req.Torrent) > 0 {
+		target = req.Torrent
+		load, start = "load.raw", "load.raw_start"
+	}
+	method := start
+	if req.Paused {
+		method = load
+	}
+
+	params := []any{"", target, "d.directory.set=" + dir}
+	label := c.cfg.Label
+	if label == "" && len(req.Labels) > 0 {
+		label = req.Labels[0]
+	}
+	if label != "" {
+		params = append(params, "d.custom1.set="+label)
+	}
+	if req.Priority != common.PriorityNormal {
+		// rTorrent priorities are 0 off, 1 low, 2 normal and 3 high.
+		params = append(params, fmt.Sprintf("d.priority.set=%d", 2+req.Priority))
+	}
+
+	_, err := c.call(ctx, method, params...)
+	return err
+}
@@ -0,0 +1,542 @@
+package rtorrent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/autoget-project/autoget/backend/downloaders/common"
+	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type call struct {
+	Method string
+	Params []any
+}
+
+type fakeTorrent struct {
+	Hash      string
+	Name      string
+	Started   bool
+	Complete  bool
+	BytesDone int64
+	Size      int64
+	Uploaded  int64
+	Directory string
+	Multi     bool
+	Label     string
+	Files     []string
+	// Unwanted file indexes, priority off.
+	Unwanted map[int]bool
+}
+
+func toFlag(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// fake rTorrent XML-RPC
+type fakeRTorrent struct {
+	calls []*call
+
+	torrents []*fakeTorrent
+	speed    int64
+}
+
+func (f *fakeRTorrent) torrent(hash any) *fakeTorrent {
+	for _, t := range f.torrents {
+		if t.Hash == hash {
+			return t
+		}
+	}
+	return nil
+}
+
+func (f *fakeRTorrent) handle(method string, params []any) (any, error) {
+	switch method {
+	case "d.multicall2":
+		rows := []any{}
+		for _, t := range f.torrents {
+			rows = append(rows, []any{
+				t.Hash, t.Name, toFlag(t.Started), toFlag(t.Started), toFlag(t.Complete),
+				t.BytesDone, t.Size, t.Uploaded, t.Directory, toFlag(t.Multi), t.Label,
+			})
+		}
+		return rows, nil
+	case "throttle.global_down.rate":
+		return f.speed, nil
+	case "throttle.global_down.max_rate.set_kb", "throttle.global_up.max_rate.set_kb":
+		return int64(0), nil
+	case "load.raw_start", "load.raw", "load.start", "load.normal":
+		return int64(0), nil
+	case "f.priority.set":
+		// target is HASH:fN
+		var hash string
+		var i int
+		fmt.Sscanf(strings.Replace(params[0].(string), ":f", " ", 1), "%s %d", &hash, &i)
+		t := f.torrent(hash)
+		if t == nil {
+			return nil, &fault{Code: -501, Message: "Could not find info-hash."}
+		}
+		if t.Unwanted == nil {
+			t.Unwanted = map[int]bool{}
+		}
+		t.Unwanted[i] = params[1] == int64(0)
+		return int64(0), nil
+	}
+
+	t := f.torrent(params[0])
+	if t == nil {
+		return nil, &fault{Code: -501, Message: "Could not find info-hash."}
+	}
+
+	switch method {
+	case "d.is_multi_file":
+		return toFlag(t.Multi), nil
+	case "d.directory":
+		return t.Directory, nil
+	case "f.multicall":
+		rows := []any{}
+		for i, p := range t.Files {
+			rows = append(rows, []any{p, toFlag(!t.Unwanted[i])})
+		}
+		return rows, nil
+	case "d.stop", "d.close", "d.erase", "d.open", "d.start", "d.check_hash", "d.tracker_announce", "d.update_priorities":
+		return int64(0), nil
+	}
+	return nil, &fault{Code: -506, Message: "Method '" + method + "' not defined"}
+}
+
+func (f *fakeRTorrent) serve(body []byte) []byte {
+	mc := &methodCall{}
+	if err := xml.Unmarshal(body, mc); err != nil {
+		panic(err)
+	}
+
+	c := &call{Method: mc.MethodName}
+	for _, p := range mc.Params {
+		v, err := p.Value.toAny()
+		if err != nil {
+			panic(err)
+		}
+		c.Params = append(c.Params, v)
+	}
+	f.calls = append(f.calls, c)
+
+	b := &bytes.Buffer{}
+	b.WriteString("<?xml version=\"1.0\"?><methodResponse>")
+	res, err := f.handle(c.Method, c.Params)
+	if ft, ok := err.(*fault); ok {
+		b.WriteString("<fault>")
+		encodeValue(b, map[string]any{"faultCode": ft.Code, "faultString": ft.Message})
+		b.WriteString("</fault>")
+	} else {
+		b.WriteString("<params><param>")
+		if err := encodeValue(b, res); err != nil {
+			panic(err)
+		}
+		b.WriteString("</param></params>")
+	}
+	b.WriteString("</methodResponse>")
+	return b.Bytes()
+}
+
+func (f *fakeRTorrent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	w.Write(f.serve(body))
+}
+
+// serveSCGI serves one request per connection like rTorrent.
+func (f *fakeRTorrent) serveSCGI(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	n, _ := r.ReadString(':')
+	size, _ := strconv.Atoi(strings.TrimSuffix(n, ":"))
+	netstring := make([]byte, size+1) // with trailing ","
+	io.ReadFull(r, netstring)
+
+	headers := strings.Split(string(netstring[:size]), "\x00")
+	length := 0
+	for i := 0; i+1 < len(headers); i += 2 {
+		if headers[i] == "CONTENT_LENGTH" {
+			length, _ = strconv.Atoi(headers[i+1])
+		}
+	}
+	body := make([]byte, length)
+	io.ReadFull(r, body)
+
+	resp := f.serve(body)
+	fmt.Fprintf(conn, "Status: 200 OK\r\nContent-Type: text/xml\r\nContent-Length: %d\r\n\r\n", len(resp))
+	conn.Write(resp)
+}
+
+func (f *fakeRTorrent) methods() []string {
+	methods := []string{}
+	for _, c := range f.calls {
+		methods = append(methods, c.Method)
+	}
+	return methods
+}
+
+func newFake(t *testing.T) (*fakeRTorrent, *httptest.Server) {
+	t.Helper()
+
+	fake := &fakeRTorrent{}
+	serv := httptest.NewServer(fake)
+	t.Cleanup(serv.Close)
+	return fake, serv
+}
+
+func newConfig(url string) *config.DownloaderConfig {
+	return &config.DownloaderConfig{
+		RTorrent: &config.RTorrentConfig{
+			URL:      url + "/RPC2",
+			Username: "admin",
+			Password: "secret",
+			Label:    "autoget",
+		},
+	}
+}
+
+func TestXMLRPC(t *testing.T) {
+	body, err := encodeCall("load.raw_start", []any{"", []byte("data"), "d.custom1.set=a&b", int64(1), true, []any{"x"}})
+	require.NoError(t, err)
+
+	mc := &methodCall{}
+	require.NoError(t, xml.Unmarshal(body, mc))
+	assert.Equal(t, "load.raw_start", mc.MethodName)
+
+	got := []any{}
+	for _, p := range mc.Params {
+		v, err := p.Value.toAny()
+		require.NoError(t, err)
+		got = append(got, v)
+	}
+	assert.Equal(t, []any{"", []byte("data"), "d.custom1.set=a&b", int64(1), true, []any{"x"}}, got)
+
+	t.Run("untyped string", func(t *testing.T) {
+		v, err := decodeResponse([]byte(`<methodResponse><params><param><value>abc</value></param></params></methodResponse>`))
+		require.NoError(t, err)
+		assert.Equal(t, "abc", v)
+	})
+
+	t.Run("fault", func(t *testing.T) {
+		_, err := decodeResponse([]byte(`<methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><i4>-501</i4></value></member>
+<member><name>faultString</name><value><string>Could not find info-hash.</string></value></member>
+</struct></value></fault></methodResponse>`))
+		assert.EqualError(t, err, "rtorrent fault -501: Could not find info-hash.")
+	})
+}
+
+func TestTorrents(t *testing.T) {
+	torrents := []*fakeTorrent{
+		{Hash: "AA", Name: "Torrent 1", Started: true, BytesDone: 500, Size: 1000, Directory: "/downloads", Label: "autoget"},
+		{Hash: "BB", Name: "Torrent 2", Started: true, Complete: true, Size: 1000, Uploaded: 20, Directory: "/downloads/Torrent 2", Multi: true, Label: "autoget"},
+		{Hash: "CC", Name: "Torrent 3", Label: "other"},
+	}
+
+	check := func(t *testing.T, client *Client) {
+		ts, err := client.Torrents(t.Context())
+		require.NoError(t, err)
+		require.Len(t, ts, 2)
+
+		assert.Equal(t, "aa", ts[0].Hash)
+		assert.Equal(t, 0.5, ts[0].Progress)
+		assert.Equal(t, "/downloads", ts[0].Dir)
+
+		assert.Equal(t, "bb", ts[1].Hash)
+		assert.Equal(t, int64(20), ts[1].Uploaded)
+		assert.Equal(t, "/downloads", ts[1].Dir)
+	}
+
+	t.Run("http", func(t *testing.T) {
+		fake, serv := newFake(t)
+		fake.torrents = torrents
+
+		client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+		require.NoError(t, err)
+		check(t, client)
+	})
+
+	t.Run("scgi", func(t *testing.T) {
+		fake := &fakeRTorrent{torrents: torrents}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { l.Close() })
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				fake.serveSCGI(conn)
+			}
+		}()
+
+		conf := newConfig("")
+		conf.RTorrent.URL = "scgi://" + l.Addr().String()
+		client, err := New("test", conf, nil, nil, nil)
+		require.NoError(t, err)
+		check(t, client)
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		_, serv := newFake(t)
+		conf := newConfig(serv.URL)
+		conf.RTorrent.Password = "wrong"
+
+		client, err := New("test", conf, nil, nil, nil)
+		require.NoError(t, err)
+
+		_, err = client.Torrents(t.Context())
+		assert.EqualError(t, err, "rtorrent returned 401")
+	})
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		conf := newConfig("")
+		conf.RTorrent.URL = "ftp://rtorrent"
+		_, err := New("test", conf, nil, nil, nil)
+		assert.EqualError(t, err, "unsupported rtorrent URL scheme: ftp")
+	})
+}
+
+func TestFiles(t *testing.T) {
+	fake, serv := newFake(t)
+
+	conf := newConfig(serv.URL)
+	conf.RTorrent.DownloadDir = "/data/download"
+	// rTorrent sees download dir as /downloads
+	conf.RTorrent.SavePath = "/downloads"
+
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+
+	fake.torrents = []*fakeTorrent{
+		{Hash: "BB", Name: "show", Started: true, Complete: true, BytesDone: 2000, Size: 2000, Directory: "/downloads/show", Multi: true, Label: "autoget",
+			Files: []string{"ep1.mkv", "sub/ep1.srt"}},
+	}
+	fake.speed = 1000 * 1000
+
+	ts, err := client.Torrents(t.Context())
+	require.NoError(t, err)
+	require.Len(t, ts, 1)
+	// the dir holding the torrent's own dir, mapped to local.
+	assert.Equal(t, "/data/download", ts[0].Dir)
+
+	// paths are relative to the dir.
+	require.NoError(t, client.Files(t.Context(), ts[0]))
+	assert.Equal(t, []string{"show/ep1.mkv", "show/sub/ep1.srt"}, ts[0].Files)
+
+	speed, err := client.DownloadSpeed(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000*1000), speed)
+
+	assert.Equal(t, []string{
+		"d.multicall2",
+		"d.is_multi_file",
+		"d.directory",
+		"f.multicall",
+		"throttle.global_down.rate",
+	}, fake.methods())
+}
+
+func TestAddTorrentFile(t *testing.T) {
+	fake, serv := newFake(t)
+
+	conf := newConfig(serv.URL)
+	conf.RTorrent.SavePath = "/downloads"
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, client.AddTorrentFile(t.Context(), "3.torrent", []byte("torrent 3")))
+	assert.Equal(t, []string{"load.raw_start"}, fake.methods())
+	assert.Equal(t, []any{"", []byte("torrent 3"), "d.directory.set=/downloads", "d.custom1.set=autoget"}, fake.calls[0].Params)
+}
+
+func TestRemove(t *testing.T) {
+	fake, serv := newFake(t)
+
+	client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+	require.NoError(t, err)
+
+	downloadDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(downloadDir, "show3"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(downloadDir, "show3", "ep1.mkv"), []byte("episode 1"), 0644))
+	fake.torrents = []*fakeTorrent{
+		{Hash: "AA", Complete: true, Label: "autoget"},
+		{Hash: "CC", Complete: true, Directory: filepath.Join(downloadDir, "show3"), Multi: true, Label: "autoget", Files: []string{"ep1.mkv"}},
+	}
+
+	require.NoError(t, client.Remove(t.Context(), []*common.Torrent{{Hash: "aa"}}, false))
+	assert.Equal(t, []string{"d.erase"}, fake.methods())
+	assert.Equal(t, []any{"AA"}, fake.calls[0].Params)
+
+	// files are listed first, data is removed by AutoGet.
+	fake.calls = nil
+	require.NoError(t, client.Remove(t.Context(), []*common.Torrent{{Hash: "cc", Dir: downloadDir}}, true))
+	assert.Equal(t, []string{"d.is_multi_file", "d.directory", "f.multicall", "d.erase"}, fake.methods())
+	assert.Equal(t, []any{"CC"}, fake.calls[3].Params)
+	_, err = os.Stat(filepath.Join(downloadDir, "show3"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAddTorrentFileSelection(t *testing.T) {
+	fake, serv := newFake(t)
+
+	conf := newConfig(serv.URL)
+	conf.RTorrent.DownloadDir = "/downloads"
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+
+	info := metainfo.Info{Name: "show", PieceLength: 16 * 1024, Pieces: make([]byte, 20)}
+	for _, p := range [][]string{{"ep1.mkv"}, {"Sample", "sample.mkv"}, {"notes.txt"}} {
+		info.Files = append(info.Files, metainfo.FileInfo{Path: p, Length: 1})
+	}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+	mi := &metainfo.MetaInfo{InfoBytes: infoBytes}
+	data := &bytes.Buffer{}
+	require.NoError(t, mi.Write(data))
+	hash := mi.HashInfoBytes().HexString()
+	target := strings.ToUpper(hash)
+
+	// the fake doesn't parse torrents, it knows the torrent already.
+	fake.torrents = []*fakeTorrent{{
+		Hash:      target,
+		Directory: "/downloads/show",
+		Multi:     true,
+		Label:     "autoget",
+		Files:     []string{"ep1.mkv", "Sample/sample.mkv", "notes.txt"},
+	}}
+
+	_, err = client.AddTorrent(t.Context(), &common.AddRequest{Torrent: data.Bytes(), Skip: []string{"*.txt", "sample"}})
+	require.NoError(t, err)
+
+	// loaded stopped, started after unwanted files are off.
+	assert.Equal(t, []string{"load.raw", "f.priority.set", "f.priority.set", "d.update_priorities", "d.start"}, fake.methods())
+	assert.Equal(t, []any{target + ":f1", int64(0)}, fake.calls[1].Params)
+	assert.Equal(t, []any{target + ":f2", int64(0)}, fake.calls[2].Params)
+
+	// skipped files are not copied.
+	tr := &common.Torrent{Hash: hash}
+	require.NoError(t, client.Files(t.Context(), tr))
+	assert.Equal(t, []string{filepath.Join("show", "ep1.mkv")}, tr.Files)
+}
+
+func TestControl(t *testing.T) {
+	fake, serv := newFake(t)
+
+	client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+	require.NoError(t, err)
+
+	fake.torrents = []*fakeTorrent{{Hash: "AA", Started: true, Complete: true, BytesDone: 10, Size: 10, Label: "autoget"}}
+	torrents := []*common.Torrent{{Hash: "aa"}}
+
+	tests := []struct {
+		name    string
+		action  func() error
+		methods []string
+	}{
+		{
+			name:    "stop",
+			action:  func() error { return client.Stop(t.Context(), torrents) },
+			methods: []string{"d.stop", "d.close"},
+		},
+		{
+			name:    "start",
+			action:  func() error { return client.Start(t.Context(), torrents) },
+			methods: []string{"d.open", "d.start"},
+		},
+		{
+			name:    "recheck",
+			action:  func() error { return client.Recheck(t.Context(), torrents) },
+			methods: []string{"d.check_hash"},
+		},
+		{
+			name:    "announce",
+			action:  func() error { return client.Announce(t.Context(), torrents) },
+			methods: []string{"d.tracker_announce"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.calls = nil
+
+			require.NoError(t, tt.action())
+			assert.Equal(t, tt.methods, fake.methods())
+			// rTorrent hashes are upper case.
+			for _, c := range fake.calls {
+				assert.Equal(t, []any{"AA"}, c.Params)
+			}
+		})
+	}
+
+	assert.ErrorIs(t, client.SetLocation(t.Context(), torrents, "/downloads/tv"), common.ErrNotSupported)
+}
+
+func TestAddTorrent(t *testing.T) {
+	fake, serv := newFake(t)
+
+	conf := newConfig(serv.URL)
+	conf.RTorrent.DownloadDir = "/downloads"
+	client, err := New("test", conf, nil, nil, nil)
+	require.NoError(t, err)
+
+	hash := "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+	magnet := "magnet:?xt=urn:btih:" + strings.ToUpper(hash)
+	got, err := client.AddTorrent(t.Context(), &common.AddRequest{
+		Magnet:   magnet,
+		Dir:      "/downloads/tv",
+		Labels:   []string{"tv"},
+		Paused:   true,
+		Priority: common.PriorityHigh,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, hash, got)
+
+	// without configured label, the first requested label is used.
+	conf.RTorrent.Label = ""
+	_, err = client.AddTorrent(t.Context(), &common.AddRequest{Magnet: magnet, Labels: []string{"tv"}, Priority: common.PriorityLow})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"load.normal", "load.start"}, fake.methods())
+	assert.Equal(t, []any{"", magnet, "d.directory.set=/downloads/tv", "d.custom1.set=autoget", "d.priority.set=3"}, fake.calls[0].Params)
+	assert.Equal(t, []any{"", magnet, "d.directory.set=/downloads", "d.custom1.set=tv", "d.priority.set=1"}, fake.calls[1].Params)
+}
+
+func TestSetSpeedLimits(t *testing.T) {
+	fake, serv := newFake(t)
+
+	client, err := New("test", newConfig(serv.URL), nil, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, client.SetSpeedLimits(t.Context(), &common.SpeedLimits{DownloadKB: 100}))
+	assert.Equal(t, []string{"throttle.global_down.max_rate.set_kb", "throttle.global_up.max_rate.set_kb"}, fake.methods())
+	assert.Equal(t, []any{"", int64(100)}, fake.calls[0].Params)
+	assert.Equal(t, []any{"", int64(0)}, fake.calls[1].Params)
+
+	assert.ErrorIs(t, client.SetSpeedLimits(t.Context(), &common.SpeedLimits{AltSpeed: true}), common.ErrNotSupported)
+}
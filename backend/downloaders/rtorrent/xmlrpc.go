@@ -0,0 +1,200 @@
+package rtorrent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Minimal XML-RPC codec for what rTorrent speaks.
+
+type value struct {
+	String  *string     `xml:"string"`
+	Int     *string     `xml:"int"`
+	I4      *string     `xml:"i4"`
+	I8      *string     `xml:"i8"`
+	Boolean *string     `xml:"boolean"`
+	Double  *string     `xml:"double"`
+	Base64  *string     `xml:"base64"`
+	Array   *arrayValue `xml:"array"`
+	Struct  *struct {
+		Members []member `xml:"member"`
+	} `xml:"struct"`
+	// Text is a value without type, which is a string.
+	Text string `xml:",chardata"`
+}
+
+type arrayValue struct {
+	Values []value `xml:"data>value"`
+}
+
+type member struct {
+	Name  string `xml:"name"`
+	Value value  `xml:"value"`
+}
+
+type param struct {
+	Value value `xml:"value"`
+}
+
+type methodCall struct {
+	MethodName string  `xml:"methodName"`
+	Params     []param `xml:"params>param"`
+}
+
+type methodResponse struct {
+	Params []param `xml:"params>param"`
+	Fault  *param  `xml:"fault"`
+}
+
+type fault struct {
+	Code    int64
+	Message string
+}
+
+func (f *fault) Error() string {
+	return fmt.Sprintf("rtorrent fault %d: %s", f.Code, f.Message)
+}
+
+func (v *value) toAny() (any, error) {
+	toInt := func(s string) (any, error) {
+		return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	}
+
+	switch {
+	case v.String != nil:
+		return *v.String, nil
+	case v.Int != nil:
+		return toInt(*v.Int)
+	case v.I4 != nil:
+		return toInt(*v.I4)
+	case v.I8 != nil:
+		return toInt(*v.I8)
+	case v.Boolean != nil:
+		return strings.TrimSpace(*v.Boolean) == "1", nil
+	case v.Double != nil:
+		return strconv.ParseFloat(strings.TrimSpace(*v.Double), 64)
+	case v.Base64 != nil:
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(*v.Base64))
+	case v.Array != nil:
+		arr := []any{}
+		for _, e := range v.Array.Values {
+			a, err := e.toAny()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, a)
+		}
+		return arr, nil
+	case v.Struct != nil:
+		m := map[string]any{}
+		for _, e := range v.Struct.Members {
+			a, err := e.Value.toAny()
+			if err != nil {
+				return nil, err
+			}
+			m[e.Name] = a
+		}
+		return m, nil
+	default:
+		return v.Text, nil
+	}
+}
+
+func encodeValue(b *bytes.Buffer, v any) error {
+	b.WriteString("<value>")
+	switch v := v.(type) {
+	case string:
+		b.WriteString("<string>")
+		xml.EscapeText(b, []byte(v))
+		b.WriteString("</string>")
+	case int:
+		fmt.Fprintf(b, "<i8>%d</i8>", v)
+	case int64:
+		fmt.Fprintf(b, "<i8>%d</i8>", v)
+	case bool:
+		if v {
+			b.WriteString("<boolean>1</boolean>")
+		} else {
+			b.WriteString("<boolean>0</boolean>")
+		}
+	case []byte:
+		b.WriteString("<base64>")
+		b.WriteString(base64.StdEncoding.EncodeToString(v))
+		b.WriteString("</base64>")
+	case []string:
+		b.WriteString("<array><data>")
+		for _, e := range v {
+			encodeValue(b, e)
+		}
+		b.WriteString("</data></array>")
+	case []any:
+		b.WriteString("<array><data>")
+		for _, e := range v {
+			if err := encodeValue(b, e); err != nil {
+				return err
+			}
+		}
+		b.WriteString("</data></array>")
+	case map[string]any:
+		b.WriteString("<struct>")
+		for k, e := range v {
+			b.WriteString("<member><name>")
+			xml.EscapeText(b, []byte(k))
+			b.WriteString("</name>")
+			if err := encodeValue(b, e); err != nil {
+				return err
+			}
+			b.WriteString("</member>")
+		}
+		b.WriteString("</struct>")
+	default:
+		return fmt.Errorf("unsupported xml-rpc type %T", v)
+	}
+	b.WriteString("</value>")
+	return nil
+}
+
+func encodeCall(method string, params []any) ([]byte, error) {
+	b := &bytes.Buffer{}
+	b.WriteString(xml.Header)
+	b.WriteString("<methodCall><methodName>")
+	xml.EscapeText(b, []byte(method))
+	b.WriteString("</methodName><params>")
+	for _, p := range params {
+		b.WriteString("<param>")
+		if err := encodeValue(b, p); err != nil {
+			return nil, err
+		}
+		b.WriteString("</param>")
+	}
+	b.WriteString("</params></methodCall>")
+	return b.Bytes(), nil
+}
+
+func decodeResponse(data []byte) (any, error) {
+	resp := &methodResponse{}
+	if err := xml.Unmarshal(data, resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Fault != nil {
+		v, err := resp.Fault.Value.toAny()
+		if err != nil {
+			return nil, err
+		}
+		m, _ := v.(map[string]any)
+		f := &fault{}
+		f.Code, _ = m["faultCode"].(int64)
+		f.Message, _ = m["faultString"].(string)
+		return nil, f
+	}
+
+	if len(resp.Params) == 0 {
+		return nil, nil
+	}
+	return resp.Params[0].Value.toAny()
+}
@@ -2,27 +2,127 @@ package downloaders
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/autoget-project/autoget/backend/downloaders/aria2"
+	"github.com/autoget-project/autoget/backend/downloaders/common"
 	"github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/downloaders/deluge"
+	"github.com/autoget-project/autoget/backend/downloaders/embedded"
+	"github.com/autoget-project/autoget/backend/downloaders/qbittorrent"
+	"github.com/autoget-project/autoget/backend/downloaders/rtorrent"
 	"github.com/autoget-project/autoget/backend/downloaders/transmission"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/events"
+	"github.com/autoget-project/autoget/backend/internal/notify"
 	"github.com/autoget-project/autoget/backend/organizer"
 	"github.com/robfig/cron/v3"
 	"gorm.io/gorm"
 )
 
+// AddRequest adds a torrent file or a magnet to a downloader.
+type AddRequest = common.AddRequest
+
+// SpeedLimits are global limits of a downloader in KB/s, 0 for unlimited.
+type SpeedLimits = common.SpeedLimits
+
+type BandwidthStatus = common.BandwidthStatus
+
+// DiskStatus is disk usage of download and finished dirs of a downloader.
+type DiskStatus = common.DiskStatus
+
+type DiskUsage = common.DiskUsage
+
+// Reconciliation lists torrents not tracked and downloads gone from a
+// downloader.
+type Reconciliation = common.Reconciliation
+
+type UntrackedTorrent = common.UntrackedTorrent
+
+type MissingDownload = common.MissingDownload
+
+// PostProcessStatus lists finished downloads waiting for or in
+// post-processing, with why they wait.
+type PostProcessStatus = common.PostProcessStatus
+
+type PostProcessItem = common.PostProcessItem
+
+// QueueStatus lists downloads held until a slot of max active downloads is
+// free.
+type QueueStatus = common.QueueStatus
+
+type QueuedDownload = common.QueuedDownload
+
+var (
+	ErrTorrentNotFound    = common.ErrTorrentNotFound
+	ErrNotSupported       = common.ErrNotSupported
+	ErrInvalidSpeedLimits = common.ErrInvalidSpeedLimits
+	ErrHitAndRun          = common.ErrHitAndRun
+	ErrLowDiskSpace       = common.ErrLowDiskSpace
+	ErrAlreadyTracked     = common.ErrAlreadyTracked
+	ErrNotMissing         = common.ErrNotMissing
+	ErrNoTorrentFile      = common.ErrNoTorrentFile
+	ErrNotQueued          = common.ErrNotQueued
+)
+
 type IDownloader interface {
+	// Add adds the torrent and returns its info hash.
+	Add(req *AddRequest) (string, error)
 	RegisterCronjobs(cron *cron.Cron)
 	RegisterDailySeedingChecker(cron *cron.Cron)
 	ProgressChecker()
 	TorrentsDir() string
 	DownloadDir() string
-	DeleteTorrent(hash string) error
+	// DeleteTorrent returns ErrHitAndRun for protected torrents unless force.
+	DeleteTorrent(hash string, force bool) error
+	Pause(hash string) error
+	Resume(hash string) error
+	Verify(hash string) error
+	Reannounce(hash string) error
+	// Move moves data to dir, as the downloader sees it.
+	Move(hash, dir string) error
+	// BandwidthStatus returns current speed limits by schedules or override.
+	BandwidthStatus() *BandwidthStatus
+	// OverrideSpeedLimits sets limits over schedules for duration.
+	OverrideSpeedLimits(limits *SpeedLimits, duration time.Duration) error
+	ClearSpeedLimitsOverride() error
+	DiskStatus() *DiskStatus
+	// CheckDiskSpace returns ErrLowDiskSpace if a download of size bytes
+	// doesn't fit over the free space watermark.
+	CheckDiskSpace(size int64) error
+	Reconcile() (*Reconciliation, error)
+	// Adopt tracks an untracked torrent, s has optional resource info.
+	Adopt(hash string, s *db.DownloadStatus) error
+	MarkMissing(id string) error
+	// ReAdd adds a missing download again from its stored .torrent.
+	ReAdd(id string) error
+	PostProcessStatus() (*PostProcessStatus, error)
+	// Queue adds the torrent, or holds it while max active downloads are
+	// downloading, track saves it before another one is counted.
+	Queue(req *AddRequest, track func(hash string, queued bool) error) (hash string, queued bool, err error)
+	QueueStatus() (*QueueStatus, error)
+	// ReorderQueue puts ids first in the queue, in their order.
+	ReorderQueue(ids []string) error
+	SetQueuePriority(id string, priority int) error
+	// SetEvents publishes download events to bus.
+	SetEvents(bus *events.Bus)
 }
 
-func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, organizerClient *organizer.Client) (IDownloader, error) {
-	if cfg.Transmission == nil {
+func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, organizerClient *organizer.Client, notifier notify.INotifier) (IDownloader, error) {
+	switch {
+	case cfg.Transmission != nil:
+		return transmission.New(name, cfg, db, organizerClient, notifier)
+	case cfg.QBittorrent != nil:
+		return qbittorrent.New(name, cfg, db, organizerClient, notifier)
+	case cfg.Deluge != nil:
+		return deluge.New(name, cfg, db, organizerClient, notifier)
+	case cfg.Aria2 != nil:
+		return aria2.New(name, cfg, db, organizerClient, notifier)
+	case cfg.RTorrent != nil:
+		return rtorrent.New(name, cfg, db, organizerClient, notifier)
+	case cfg.Embedded != nil:
+		return embedded.New(name, cfg, db, organizerClient, notifier)
+	default:
 		return nil, fmt.Errorf("Unknown downloader %s", name)
 	}
-
-	return transmission.New(name, cfg, db, organizerClient)
 }
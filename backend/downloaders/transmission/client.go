@@ -2,38 +2,30 @@ package transmission
 
 import (
 	"context"
-	"errors"
-	"io"
+	"encoding/base64"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
-	"time"
+	"strings"
 
+	"github.com/autoget-project/autoget/backend/downloaders/common"
 	"github.com/autoget-project/autoget/backend/downloaders/config"
-	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/notify"
 	"github.com/autoget-project/autoget/backend/organizer"
 	"github.com/hekmon/transmissionrpc/v3"
-	"github.com/robfig/cron/v3"
-	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 )
 
 var (
-	logger = log.With().Str("component", "transmission").Logger()
-
 	httpClient = http.DefaultClient
 )
 
 type Client struct {
-	client          *transmissionrpc.Client
-	name            string
-	db              *gorm.DB
-	organizerClient *organizer.Client
-	cfg             *config.DownloaderConfig
+	*common.Downloader
+
+	client *transmissionrpc.Client
 }
 
-func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, organizerClient *organizer.Client) (*Client, error) {
+func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, organizerClient *organizer.Client, notifier notify.INotifier) (*Client, error) {
 	u, err := url.Parse(cfg.Transmission.URL)
 	if err != nil {
 		return nil, err
@@ -50,342 +42,176 @@ func New(name string, cfg *config.DownloaderConfig, db *gorm.DB, organizerClient
 		return nil, err
 	}
 
-	return &Client{
-		client:          client,
-		name:            name,
-		db:              db,
-		organizerClient: organizerClient,
-		cfg:             cfg,
-	}, nil
-}
-
-func (c *Client) RegisterCronjobs(cron *cron.Cron) {
-	c.RegisterDailySeedingChecker(cron)
-
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			c.ProgressChecker()
-		}
-	}()
-}
-
-func toTorrentsByHash(torrents []transmissionrpc.Torrent) map[string]*transmissionrpc.Torrent {
-	torrentsByHash := make(map[string]*transmissionrpc.Torrent)
-	for _, t := range torrents {
-		torrentsByHash[*t.HashString] = &t
+	c := &Client{
+		client: client,
 	}
-	return torrentsByHash
+	c.Downloader = common.New(name, c, common.Dirs{
+		TorrentsDir: cfg.Transmission.TorrentsDir,
+		DownloadDir: cfg.Transmission.DownloadDir,
+		FinishedDir: cfg.Transmission.FinishedDir,
+	}, cfg, db, organizerClient, notifier)
+	return c, nil
 }
 
-func (c *Client) ProgressChecker() {
-	torrents, err := c.client.TorrentGetAll(context.Background())
-	if err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to get all torrents")
-		return
-	}
-
-	torrentsByHash := toTorrentsByHash(torrents)
-
-	c.updateDownloadProgress(torrentsByHash)
-
-	// check if transmission is actively downloading.
-	stats, err := c.client.SessionStats(context.Background())
-	if err != nil {
-		logger.Err(err).Str("name", c.name).Msg("failed to get session stats")
+func toStatus(s transmissionrpc.TorrentStatus) common.Status {
+	switch s {
+	case transmissionrpc.TorrentStatusDownload:
+		return common.StatusDownloading
+	case transmissionrpc.TorrentStatusSeed:
+		return common.StatusSeeding
+	case transmissionrpc.TorrentStatusStopped:
+		return common.StatusStopped
+	default:
+		return common.StatusOther
 	}
-
-	// if downloadSpeed > 2M/s, consider transimission is still busy
-	if stats.DownloadSpeed > 2*1000*1000 {
-		return
-	}
-
-	// start copys
-	c.copyFinishedDownloads(torrentsByHash)
-
-	// create organizer plan
-	c.createOrganizerPlan()
 }
 
-func (c *Client) updateDownloadProgress(torrentsByHash map[string]*transmissionrpc.Torrent) {
-	statuses, err := db.GetUnfinishedDownloadStatusByDownloader(c.db, c.name)
+func (c *Client) Torrents(ctx context.Context) ([]*common.Torrent, error) {
+	torrents, err := c.client.TorrentGetAll(ctx)
 	if err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to get download status")
-		return
+		return nil, err
 	}
 
-	for _, s := range statuses {
-		t, ok := torrentsByHash[s.ID]
-		if !ok {
-			continue
+	ts := []*common.Torrent{}
+	for _, t := range torrents {
+		ct := &common.Torrent{
+			ID:     *t.ID,
+			Hash:   *t.HashString,
+			Status: toStatus(*t.Status),
+			Peers:  -1,
 		}
-
-		s.DownloadProgress = uint16(*t.PercentDone * 1000)
-		s.Size = uint64(t.TotalSize.Byte())
-		if *t.Status == transmissionrpc.TorrentStatusSeed {
-			s.State = db.DownloadSeeding
+		if t.Name != nil {
+			ct.Name = *t.Name
 		}
-		db.SaveDownloadStatus(c.db, &s)
-	}
-}
-
-func (c *Client) copyFinishedDownloads(torrentsByHash map[string]*transmissionrpc.Torrent) {
-	statuses, err := db.GetFinishedUnmoveedDownloadStatusByDownloader(c.db, c.name)
-	if err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to get seeding download status")
-		return
-	}
-
-	for _, s := range statuses {
-		t, ok := torrentsByHash[s.ID]
-		if !ok {
-			continue
+		if t.PercentDone != nil {
+			ct.Progress = *t.PercentDone
 		}
-
-		if c.copyTorrentFiles(t, &s) {
-			s.MoveState = db.Moved
-			db.SaveDownloadStatus(c.db, &s)
+		if t.TotalSize != nil {
+			ct.Size = int64(t.TotalSize.Byte())
 		}
-	}
-}
-
-func (c *Client) copyTorrentFiles(t *transmissionrpc.Torrent, s *db.DownloadStatus) bool {
-	files := []string{}
-	for _, f := range t.Files {
-		from := filepath.Join(*t.DownloadDir, f.Name)
-		target := filepath.Join(c.cfg.Transmission.FinishedDir, s.ID, f.Name)
-
-		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-			logger.Error().Err(err).Str("name", c.name).Msg("failed to create parent directory for copied file")
-			return false
+		if t.UploadedEver != nil {
+			ct.Uploaded = *t.UploadedEver
 		}
-
-		fromFile, err := os.Open(from)
-		if err != nil {
-			logger.Error().Err(err).Str("name", c.name).Msg("failed to open file")
-			return false
+		if t.DownloadDir != nil {
+			ct.Dir = *t.DownloadDir
 		}
-		defer fromFile.Close()
-
-		targetFile, err := os.Create(target)
-		if err != nil {
-			logger.Error().Err(err).Str("name", c.name).Msg("failed to create file")
-			return false
+		if t.PeersConnected != nil {
+			ct.Peers = int(*t.PeersConnected)
 		}
-		defer targetFile.Close()
-
-		_, err = io.Copy(targetFile, fromFile)
-		if err != nil {
-			logger.Error().Err(err).Str("name", c.name).Msg("failed to copy file")
-			return false
+		for _, tr := range t.Trackers {
+			ct.Trackers = append(ct.Trackers, tr.Announce)
 		}
-
-		files = append(files, f.Name)
-	}
-	// add files based on path from transmission.
-	s.FileList = files
-	return true
-}
-
-func (c *Client) createOrganizerPlan() {
-	statuses, err := db.GetMovedAndOrganizeStateDownloadStatusByDownloader(c.db, c.name, db.Unplaned)
-	if err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to get moved & unplaned download status")
-		return
-	}
-
-	for _, st := range statuses {
-		resp, err := c.organizerClient.Plan(&organizer.PlanRequest{
-			Dir:      st.ID,
-			Files:    st.FileList,
-			Metadata: st.Metadata,
-		})
-		if err != nil {
-			logger.Error().Err(err).Str("name", c.name).Msg("failed to create organizer plan")
-			st.OrganizeState = db.CreatePlanFailed
-			db.SaveDownloadStatus(c.db, &st)
-			continue
+		for i, f := range t.Files {
+			// skip files not selected to download.
+			if i < len(t.Wanted) && !t.Wanted[i] {
+				continue
+			}
+			ct.Files = append(ct.Files, f.Name)
 		}
-		st.OrganizePlans = resp
-		st.OrganizeState = db.Planed
-		db.SaveDownloadStatus(c.db, &st)
+		ts = append(ts, ct)
 	}
+	return ts, nil
 }
 
-func (c *Client) RegisterDailySeedingChecker(cron *cron.Cron) {
-	if c.cfg.SeedingPolicy == nil {
-		logger.Info().Str("name", c.name).Msg("seeding policy is not configured")
-		return
-	}
-
-	jobID, err := cron.AddFunc("0 8 * * *", func() {
-		c.checkDailySeeding()
-	})
-	if err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to add cron job")
-		return
-	}
-	logger.Info().Str("name", c.name).Int64("jobID", int64(jobID)).Msg("added cron job")
+// Files is a no-op, torrent-get already returns files.
+func (c *Client) Files(ctx context.Context, t *common.Torrent) error {
+	return nil
 }
 
-func (c *Client) checkDailySeeding() {
-	logger.Info().Str("name", c.name).Msg("checking daily seeding")
-
-	torrents, err := c.client.TorrentGetAll(context.Background())
+func (c *Client) DownloadSpeed(ctx context.Context) (int64, error) {
+	stats, err := c.client.SessionStats(ctx)
 	if err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to get all torrents")
-		return
+		return 0, err
 	}
-
-	torrentsByHash := toTorrentsByHash(torrents)
-
-	c.stopTorrents(torrents)
-	c.removeTorrents(torrentsByHash)
+	return stats.DownloadSpeed, nil
 }
 
-func (c *Client) stopTorrents(torrents []transmissionrpc.Torrent) {
-	stopIDs := []string{}
-	stopTorIDs := []int64{}
-
+func toIDs(torrents []*common.Torrent) []int64 {
+	ids := []int64{}
 	for _, t := range torrents {
-		// only check seeding torrents
-		if *t.Status != transmissionrpc.TorrentStatusSeed {
-			continue
-		}
-
-		hash := (*t.HashString)
-		uploaded := *t.UploadedEver
-
-		ss, err := db.GetDownloadStatus(c.db, hash)
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			ss.ID = hash
-			ss.Downloader = c.name
-			ss.State = db.DownloadSeeding
-			ss.UploadHistories = make(map[string]int64)
-			ss.ResTitle = *t.Name
-			ss.AddToday(uploaded)
-			db.SaveDownloadStatus(c.db, ss)
-
-			continue
-		}
-		if ss.UploadHistories == nil {
-			ss.UploadHistories = make(map[string]int64)
-		}
-		ss.CleanupHistory()
-		ss.AddToday(uploaded)
-
-		db.SaveDownloadStatus(c.db, ss)
-
-		before, ok := ss.GetXDayBefore(int(c.cfg.SeedingPolicy.IntervalInDays))
-		if !ok {
-			continue
-		}
-
-		if (uploaded - before) > c.cfg.SeedingPolicy.UploadAtLeastInMB*1024*1024 {
-			continue
-		}
-
-		// stop this torrent
-		stopTorIDs = append(stopTorIDs, *t.ID)
-		stopIDs = append(stopIDs, hash)
+		ids = append(ids, t.ID)
 	}
+	return ids
+}
 
-	// nothing to stop
-	if len(stopTorIDs) == 0 {
-		return
-	}
+func (c *Client) Stop(ctx context.Context, torrents []*common.Torrent) error {
+	return c.client.TorrentStopIDs(ctx, toIDs(torrents))
+}
 
-	// stop torrents
-	if err := c.client.TorrentStopIDs(context.Background(), stopTorIDs); err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to stop torrents")
-		return
-	}
+func (c *Client) Start(ctx context.Context, torrents []*common.Torrent) error {
+	return c.client.TorrentStartIDs(ctx, toIDs(torrents))
+}
 
-	// update state in db
-	if err := db.UpdateDownloadStateForStatuses(c.db, stopIDs, db.DownloadStopped); err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to update download status")
-		return
-	}
+func (c *Client) Recheck(ctx context.Context, torrents []*common.Torrent) error {
+	return c.client.TorrentVerifyIDs(ctx, toIDs(torrents))
 }
 
-func (c *Client) removeTorrents(torrentsByHash map[string]*transmissionrpc.Torrent) {
-	statuses, err := db.GetStoppedMovedDownloadStatusByDownloader(c.db, c.name)
-	if err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to get stopped download status")
-		return
-	}
+func (c *Client) Announce(ctx context.Context, torrents []*common.Torrent) error {
+	return c.client.TorrentReannounceIDs(ctx, toIDs(torrents))
+}
 
-	deleteStatusIDs := []string{}
-	deleteTorIDs := []int64{}
-	for _, s := range statuses {
-		t, ok := torrentsByHash[s.ID]
-		if !ok {
-			continue
+func (c *Client) SetLocation(ctx context.Context, torrents []*common.Torrent, dir string) error {
+	for _, t := range torrents {
+		if err := c.client.TorrentSetLocation(ctx, t.ID, dir, true); err != nil {
+			return err
 		}
-
-		deleteTorIDs = append(deleteTorIDs, *t.ID)
-		deleteStatusIDs = append(deleteStatusIDs, s.ID)
 	}
+	return nil
+}
 
-	// nothing to delete
-	if len(deleteTorIDs) == 0 {
-		return
+func (c *Client) SetSpeedLimits(ctx context.Context, limits *common.SpeedLimits) error {
+	payload := transmissionrpc.SessionArguments{
+		AltSpeedEnabled:       &limits.AltSpeed,
+		SpeedLimitDownEnabled: new(bool),
+		SpeedLimitUpEnabled:   new(bool),
 	}
-
-	// delete torrents
-	if err := c.client.TorrentRemove(context.Background(), transmissionrpc.TorrentRemovePayload{IDs: deleteTorIDs, DeleteLocalData: true}); err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to delete torrents")
-		return
+	if limits.DownloadKB > 0 {
+		*payload.SpeedLimitDownEnabled = true
+		payload.SpeedLimitDown = &limits.DownloadKB
 	}
-
-	if err := db.UpdateDownloadStateForStatuses(c.db, deleteStatusIDs, db.DownloadDeleted); err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to update download status")
+	if limits.UploadKB > 0 {
+		*payload.SpeedLimitUpEnabled = true
+		payload.SpeedLimitUp = &limits.UploadKB
 	}
+	return c.client.SessionArgumentsSet(ctx, payload)
 }
 
-func (c *Client) TorrentsDir() string {
-	return c.cfg.Transmission.TorrentsDir
+func (c *Client) Remove(ctx context.Context, torrents []*common.Torrent, deleteData bool) error {
+	return c.client.TorrentRemove(ctx, transmissionrpc.TorrentRemovePayload{
+		IDs:             toIDs(torrents),
+		DeleteLocalData: deleteData,
+	})
 }
 
-func (c *Client) DeleteTorrent(hash string) error {
-	torrents, err := c.client.TorrentGetAll(context.Background())
-	if err != nil {
-		logger.Error().Err(err).Str("name", c.name).Msg("failed to get all torrents")
-		return err
+func (c *Client) AddTorrent(ctx context.Context, req *common.AddRequest) (string, error) {
+	priority := int64(req.Priority)
+	payload := transmissionrpc.TorrentAddPayload{
+		Paused:            &req.Paused,
+		BandwidthPriority: &priority,
 	}
-
-	// Find the torrent by hash
-	var torrentID int64
-	for _, t := range torrents {
-		if *t.HashString == hash {
-			torrentID = *t.ID
-			break
-		}
+	if len(req.Torrent) > 0 {
+		metaInfo := base64.StdEncoding.EncodeToString(req.Torrent)
+		payload.MetaInfo = &metaInfo
+	} else {
+		payload.Filename = &req.Magnet
 	}
-
-	if torrentID == 0 {
-		return errors.New("torrent not found")
+	if req.Dir != "" {
+		payload.DownloadDir = &req.Dir
 	}
-
-	// Delete the torrent from Transmission
-	if err := c.client.TorrentRemove(context.Background(), transmissionrpc.TorrentRemovePayload{
-		IDs:             []int64{torrentID},
-		DeleteLocalData: true,
-	}); err != nil {
-		logger.Error().Err(err).Str("name", c.name).Str("hash", hash).Msg("failed to delete torrent")
-		return err
+	if len(req.Labels) > 0 {
+		payload.Labels = req.Labels
 	}
-
-	// Update the download status in database
-	if err := db.UpdateDownloadStateForStatuses(c.db, []string{hash}, db.DownloadDeleted); err != nil {
-		logger.Error().Err(err).Str("name", c.name).Str("hash", hash).Msg("failed to update download status")
-		return err
+	wanted, err := req.Wanted()
+	if err != nil {
+		return "", err
+	}
+	for _, i := range common.Unwanted(wanted) {
+		payload.FilesUnwanted = append(payload.FilesUnwanted, int64(i))
 	}
 
-	logger.Info().Str("name", c.name).Str("hash", hash).Msg("successfully deleted torrent")
-	return nil
-}
-
-func (c *Client) DownloadDir() string {
-	return c.cfg.Transmission.DownloadDir
+	t, err := c.client.TorrentAdd(ctx, payload)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(*t.HashString), nil
 }
@@ -1,6 +1,8 @@
 package transmission
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -10,6 +12,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/autoget-project/autoget/backend/downloaders/common"
 	"github.com/autoget-project/autoget/backend/downloaders/config"
 	"github.com/autoget-project/autoget/backend/internal/db"
 	"github.com/autoget-project/autoget/backend/organizer"
@@ -17,6 +22,7 @@ import (
 	"github.com/hekmon/transmissionrpc/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 type requestPayload struct {
@@ -99,7 +105,7 @@ func TestCheckDailySeeding(t *testing.T) {
 		},
 	}
 
-	client, err := New("test", conf, d, nil)
+	client, err := New("test", conf, d, nil, nil)
 	require.NoError(t, err)
 
 	today := time.Now().Format("2006-01-02")
@@ -161,7 +167,7 @@ func TestCheckDailySeeding(t *testing.T) {
 				newTorrent(2, "2", transmissionrpc.TorrentStatusSeed, 1025*1024),
 				newTorrent(3, "3", transmissionrpc.TorrentStatusSeed, 1000*1024),
 				newTorrent(4, "4", transmissionrpc.TorrentStatusStopped, 1000*1024),
-				// r5 is brand new, insert to db
+				// r5 is untracked, left to reconciliation
 				newTorrent(5, "5", transmissionrpc.TorrentStatusSeed, 1000*1024),
 			},
 		},
@@ -169,7 +175,7 @@ func TestCheckDailySeeding(t *testing.T) {
 		&struct{}{},
 	}
 
-	client.checkDailySeeding()
+	client.CheckDailySeeding()
 
 	assert.Len(t, fake.reqs, 3)
 	assert.Equal(t, "torrent-get", fake.reqs[0].Method)
@@ -217,12 +223,9 @@ func TestCheckDailySeeding(t *testing.T) {
 	}
 
 	{
-		// r5 should be inserted
-		r := &db.DownloadStatus{}
-		require.NoError(t, d.First(r, "id = ?", "5").Error)
-		assert.Equal(t, map[string]int64{
-			today: 1000 * 1024,
-		}, r.UploadHistories)
+		// r5 should not be inserted
+		err := d.First(&db.DownloadStatus{}, "id = ?", "5").Error
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
 	}
 }
 
@@ -304,7 +307,7 @@ func TestProgressChecker(t *testing.T) {
 	organizerClient, err := organizer.NewClient(organizerServ.URL, nil)
 	require.NoError(t, err)
 
-	client, err := New("test", conf, d, organizerClient)
+	client, err := New("test", conf, d, organizerClient, nil)
 	require.NoError(t, err)
 
 	// r1 is downloading
@@ -375,6 +378,7 @@ func TestProgressChecker(t *testing.T) {
 	}
 
 	client.ProgressChecker()
+	client.WaitTransfers()
 
 	assert.Len(t, fake.reqs, 2)
 	assert.Equal(t, "torrent-get", fake.reqs[0].Method)
@@ -424,7 +428,7 @@ func TestProgressChecker(t *testing.T) {
 	}
 }
 
-func TestCreateOrganizerPlan(t *testing.T) {
+func TestCreatePlans(t *testing.T) {
 	d, err := db.SqliteForTest()
 	require.NoError(t, err)
 
@@ -452,12 +456,27 @@ func TestCreateOrganizerPlan(t *testing.T) {
 	organizerClient, err := organizer.NewClient(organizerServ.URL, nil)
 	require.NoError(t, err)
 
+	fake := &fakeTransmission{}
+	serv := httptest.NewServer(http.HandlerFunc(fake.ServeHTTP))
+
+	httpClient = &http.Client{}
+	t.Cleanup(func() {
+		httpClient = http.DefaultClient
+		serv.Close()
+	})
+
 	conf := &config.DownloaderConfig{
-		Transmission: &config.TransmissionConfig{},
+		Transmission: &config.TransmissionConfig{URL: serv.URL},
 	}
-	client, err := New("test", conf, d, organizerClient)
+	client, err := New("test", conf, d, organizerClient, nil)
 	require.NoError(t, err)
 
+	// plans are created by the progress check, downloads are already moved.
+	check := func(client *Client) {
+		fake.resp = []any{&torrentGetResults{}, &transmissionrpc.SessionStats{}}
+		client.ProgressChecker()
+	}
+
 	t.Run("successful plan creation", func(t *testing.T) {
 		// Create a download status that needs planning
 		status := &db.DownloadStatus{
@@ -471,7 +490,7 @@ func TestCreateOrganizerPlan(t *testing.T) {
 		}
 		require.NoError(t, d.Create(status).Error)
 
-		client.createOrganizerPlan()
+		check(client)
 
 		// Verify the plan was created
 		updated := &db.DownloadStatus{}
@@ -501,7 +520,7 @@ func TestCreateOrganizerPlan(t *testing.T) {
 		failingClient, err := organizer.NewClient(failingServ.URL, nil)
 		require.NoError(t, err)
 
-		clientWithFailingOrganizer, err := New("test", conf, d, failingClient)
+		clientWithFailingOrganizer, err := New("test", conf, d, failingClient, nil)
 		require.NoError(t, err)
 
 		// Create a download status that needs planning
@@ -516,7 +535,7 @@ func TestCreateOrganizerPlan(t *testing.T) {
 		}
 		require.NoError(t, d.Create(status).Error)
 
-		clientWithFailingOrganizer.createOrganizerPlan()
+		check(clientWithFailingOrganizer)
 
 		// Verify the status changed to error
 		updated := &db.DownloadStatus{}
@@ -538,7 +557,7 @@ func TestCreateOrganizerPlan(t *testing.T) {
 		}
 		require.NoError(t, d.Create(status).Error)
 
-		client.createOrganizerPlan()
+		check(client)
 
 		// Verify no new requests were made to organizer service
 		updated := &db.DownloadStatus{}
@@ -546,3 +565,324 @@ func TestCreateOrganizerPlan(t *testing.T) {
 		assert.Equal(t, db.Planed, updated.OrganizeState)
 	})
 }
+
+func TestAddTorrent(t *testing.T) {
+	fake := &fakeTransmission{}
+	serv := httptest.NewServer(http.HandlerFunc(fake.ServeHTTP))
+
+	httpClient = &http.Client{}
+	t.Cleanup(func() {
+		httpClient = http.DefaultClient
+		serv.Close()
+	})
+
+	d, err := db.SqliteForTest()
+	require.NoError(t, err)
+
+	client, err := New("test", &config.DownloaderConfig{
+		Transmission: &config.TransmissionConfig{URL: serv.URL},
+	}, d, nil, nil)
+	require.NoError(t, err)
+
+	fake.resp = []any{
+		map[string]any{"torrent-added": map[string]any{"hashString": "ABCDEF", "id": 1, "name": "Torrent 1"}},
+		map[string]any{"torrent-duplicate": map[string]any{"hashString": "abcdef", "id": 1, "name": "Torrent 1"}},
+	}
+
+	hash, err := client.Add(&common.AddRequest{
+		Torrent:  []byte("torrent"),
+		Dir:      "/downloads/tv",
+		Labels:   []string{"tv"},
+		Paused:   true,
+		Priority: common.PriorityLow,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef", hash)
+
+	hash, err = client.Add(&common.AddRequest{Magnet: "magnet:?xt=urn:btih:abcdef"})
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef", hash)
+
+	require.Len(t, fake.reqs, 2)
+	assert.Equal(t, "torrent-add", fake.reqs[0].Method)
+	assert.Equal(t, map[string]any{
+		"metainfo":          base64.StdEncoding.EncodeToString([]byte("torrent")),
+		"download-dir":      "/downloads/tv",
+		"labels":            []any{"tv"},
+		"paused":            true,
+		"bandwidthPriority": float64(-1),
+	}, fake.reqs[0].Arguments)
+	assert.Equal(t, map[string]any{
+		"filename":          "magnet:?xt=urn:btih:abcdef",
+		"paused":            false,
+		"bandwidthPriority": float64(0),
+	}, fake.reqs[1].Arguments)
+}
+
+func TestControl(t *testing.T) {
+	fake := &fakeTransmission{}
+	serv := httptest.NewServer(http.HandlerFunc(fake.ServeHTTP))
+
+	httpClient = &http.Client{}
+	t.Cleanup(func() {
+		httpClient = http.DefaultClient
+		serv.Close()
+	})
+
+	client, err := New("test", &config.DownloaderConfig{
+		Transmission: &config.TransmissionConfig{URL: serv.URL},
+	}, nil, nil, nil)
+	require.NoError(t, err)
+
+	torrents := []*common.Torrent{{ID: 1, Hash: "1"}}
+	tests := []struct {
+		name      string
+		action    func() error
+		method    string
+		arguments any
+	}{
+		{
+			name:      "stop",
+			action:    func() error { return client.Stop(t.Context(), torrents) },
+			method:    "torrent-stop",
+			arguments: map[string]any{"ids": []any{float64(1)}},
+		},
+		{
+			name:      "start",
+			action:    func() error { return client.Start(t.Context(), torrents) },
+			method:    "torrent-start",
+			arguments: map[string]any{"ids": []any{float64(1)}},
+		},
+		{
+			name:      "recheck",
+			action:    func() error { return client.Recheck(t.Context(), torrents) },
+			method:    "torrent-verify",
+			arguments: map[string]any{"ids": []any{float64(1)}},
+		},
+		{
+			name:      "announce",
+			action:    func() error { return client.Announce(t.Context(), torrents) },
+			method:    "torrent-reannounce",
+			arguments: map[string]any{"ids": []any{float64(1)}},
+		},
+		{
+			name:      "set location",
+			action:    func() error { return client.SetLocation(t.Context(), torrents, "/downloads/tv") },
+			method:    "torrent-set-location",
+			arguments: map[string]any{"ids": []any{float64(1)}, "location": "/downloads/tv", "move": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.reqs = nil
+			fake.resp = []any{nil}
+
+			require.NoError(t, tt.action())
+			require.Len(t, fake.reqs, 1)
+			assert.Equal(t, tt.method, fake.reqs[0].Method)
+			assert.Equal(t, tt.arguments, fake.reqs[0].Arguments)
+		})
+	}
+}
+
+func TestSetSpeedLimits(t *testing.T) {
+	fake := &fakeTransmission{}
+	serv := httptest.NewServer(http.HandlerFunc(fake.ServeHTTP))
+
+	httpClient = &http.Client{}
+	t.Cleanup(func() {
+		httpClient = http.DefaultClient
+		serv.Close()
+	})
+
+	client, err := New("test", &config.DownloaderConfig{
+		Transmission: &config.TransmissionConfig{URL: serv.URL},
+	}, nil, nil, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		limits    *common.SpeedLimits
+		arguments map[string]any
+	}{
+		{
+			name:   "limited",
+			limits: &common.SpeedLimits{UploadKB: 50, DownloadKB: 100},
+			arguments: map[string]any{
+				"alt-speed-enabled":        false,
+				"speed-limit-down-enabled": true,
+				"speed-limit-down":         float64(100),
+				"speed-limit-up-enabled":   true,
+				"speed-limit-up":           float64(50),
+			},
+		},
+		{
+			name:   "unlimited",
+			limits: &common.SpeedLimits{},
+			arguments: map[string]any{
+				"alt-speed-enabled":        false,
+				"speed-limit-down-enabled": false,
+				"speed-limit-up-enabled":   false,
+			},
+		},
+		{
+			name:   "alt speed",
+			limits: &common.SpeedLimits{AltSpeed: true},
+			arguments: map[string]any{
+				"alt-speed-enabled":        true,
+				"speed-limit-down-enabled": false,
+				"speed-limit-up-enabled":   false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.reqs = nil
+			fake.resp = []any{nil}
+
+			require.NoError(t, client.SetSpeedLimits(t.Context(), tt.limits))
+			require.Len(t, fake.reqs, 1)
+			assert.Equal(t, "session-set", fake.reqs[0].Method)
+			assert.Equal(t, tt.arguments, fake.reqs[0].Arguments)
+		})
+	}
+}
+
+// newMultiFileTorrent returns a torrent of show/ep1.mkv, show/ep1.nfo,
+// show/Sample/sample.mkv and show/notes.txt.
+func newMultiFileTorrent(t *testing.T) []byte {
+	t.Helper()
+
+	info := metainfo.Info{Name: "show", PieceLength: 16 * 1024, Pieces: make([]byte, 20)}
+	for _, p := range [][]string{{"ep1.mkv"}, {"ep1.nfo"}, {"Sample", "sample.mkv"}, {"notes.txt"}} {
+		info.Files = append(info.Files, metainfo.FileInfo{Path: p, Length: 1})
+	}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(t, err)
+	mi := &metainfo.MetaInfo{InfoBytes: infoBytes}
+
+	data := &bytes.Buffer{}
+	require.NoError(t, mi.Write(data))
+	return data.Bytes()
+}
+
+func TestAddTorrentFileSelection(t *testing.T) {
+	data := newMultiFileTorrent(t)
+
+	tests := []struct {
+		name     string
+		req      *common.AddRequest
+		unwanted []any
+		wantErr  string
+	}{
+		{
+			name:     "skip patterns",
+			req:      &common.AddRequest{Torrent: data, Skip: []string{"*.TXT", "sample"}},
+			unwanted: []any{float64(2), float64(3)},
+		},
+		{
+			name:     "files and skip",
+			req:      &common.AddRequest{Torrent: data, Files: []int{0, 1, 2}, Skip: []string{"*.nfo"}},
+			unwanted: []any{float64(1), float64(3)},
+		},
+		{
+			name:    "magnet",
+			req:     &common.AddRequest{Magnet: "magnet:?xt=urn:btih:abcdef", Files: []int{0}},
+			wantErr: "file selection needs a torrent file",
+		},
+		{
+			name:    "out of range",
+			req:     &common.AddRequest{Torrent: data, Files: []int{4}},
+			wantErr: "file index 4 out of range",
+		},
+		{
+			name:    "nothing selected",
+			req:     &common.AddRequest{Torrent: data, Skip: []string{"*"}},
+			wantErr: "no file is selected",
+		},
+		{
+			name:    "bad pattern",
+			req:     &common.AddRequest{Torrent: data, Skip: []string{"["}},
+			wantErr: `invalid skip pattern "[": syntax error in pattern`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeTransmission{}
+			serv := httptest.NewServer(http.HandlerFunc(fake.ServeHTTP))
+
+			httpClient = &http.Client{}
+			t.Cleanup(func() {
+				httpClient = http.DefaultClient
+				serv.Close()
+			})
+
+			d, err := db.SqliteForTest()
+			require.NoError(t, err)
+
+			client, err := New("test", &config.DownloaderConfig{
+				Transmission: &config.TransmissionConfig{URL: serv.URL},
+			}, d, nil, nil)
+			require.NoError(t, err)
+
+			fake.resp = []any{
+				map[string]any{"torrent-added": map[string]any{"hashString": "abcdef", "id": 1, "name": "show"}},
+			}
+			_, err = client.Add(tt.req)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Empty(t, fake.reqs)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, fake.reqs, 1)
+			assert.Equal(t, tt.unwanted, fake.reqs[0].Arguments.(map[string]any)["files-unwanted"])
+		})
+	}
+}
+
+func TestTorrents(t *testing.T) {
+	fake := &fakeTransmission{}
+	serv := httptest.NewServer(http.HandlerFunc(fake.ServeHTTP))
+
+	httpClient = &http.Client{}
+	t.Cleanup(func() {
+		httpClient = http.DefaultClient
+		serv.Close()
+	})
+
+	client, err := New("test", &config.DownloaderConfig{
+		Transmission: &config.TransmissionConfig{URL: serv.URL},
+	}, nil, nil, nil)
+	require.NoError(t, err)
+
+	tr := newTorrentWithProgress(1, "1", transmissionrpc.TorrentStatusSeed, 1, "/downloads", []transmissionrpc.TorrentFile{
+		{Name: "show/ep1.mkv"},
+		{Name: "show/notes.txt"},
+	})
+	// files not wanted are skipped.
+	tr.Wanted = []bool{true, false}
+	peers := int64(3)
+	tr.PeersConnected = &peers
+	tr.Trackers = []transmissionrpc.Tracker{{Announce: "https://tracker.private.org/announce"}}
+	fake.resp = []any{&torrentGetResults{Torrents: []transmissionrpc.Torrent{
+		tr,
+		// no peers reported.
+		newTorrentWithProgress(2, "2", transmissionrpc.TorrentStatusStopped, 0.5, "/downloads", nil),
+	}}}
+
+	torrents, err := client.Torrents(t.Context())
+	require.NoError(t, err)
+	// sizes are 8000 through the fake.
+	assert.Equal(t, []*common.Torrent{
+		{
+			ID: 1, Hash: "1", Name: "Torrent 1", Status: common.StatusSeeding, Progress: 1, Size: 8000,
+			Trackers: []string{"https://tracker.private.org/announce"}, Peers: 3,
+			Dir: "/downloads", Files: []string{"show/ep1.mkv"},
+		},
+		{ID: 2, Hash: "2", Name: "Torrent 2", Status: common.StatusStopped, Progress: 0.5, Size: 8000, Peers: -1, Dir: "/downloads"},
+	}, torrents)
+}
@@ -69,11 +69,9 @@ type MTeam struct {
 
 	prefetched *prefetcheddata.Data
 	standards  map[string]string
-
-	torrentsDir string
 }
 
-func NewMTeam(config *Config, mType MTeamType, torrentsDir string, db *gorm.DB, notify notify.INotifier) *MTeam {
+func NewMTeam(config *Config, mType MTeamType, db *gorm.DB, notify notify.INotifier) *MTeam {
 	if config.APIKey == "" {
 		return nil
 	}
@@ -89,7 +87,6 @@ func NewMTeam(config *Config, mType MTeamType, torrentsDir string, db *gorm.DB,
 		config:           config,
 		db:               db,
 		standards:        map[string]string{},
-		torrentsDir:      torrentsDir,
 		notify:           notify,
 	}
 
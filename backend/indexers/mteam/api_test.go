@@ -1,6 +1,7 @@
 package mteam
 
 import (
+	"bytes"
 	"os"
 	"testing"
 
@@ -24,7 +25,7 @@ func TestCategories(t *testing.T) {
 
 	m := NewMTeam(&Config{
 		APIKey: apiKey,
-	}, MTeamTypeNormal, "", nil, nil)
+	}, MTeamTypeNormal, nil, nil)
 	require.NotNil(t, m)
 
 	got, err := m.Categories()
@@ -39,7 +40,7 @@ func TestList(t *testing.T) {
 
 	m := NewMTeam(&Config{
 		APIKey: apiKey,
-	}, MTeamTypeNormal, "", nil, nil)
+	}, MTeamTypeNormal, nil, nil)
 	require.NotNil(t, m)
 
 	tests := []struct {
@@ -146,7 +147,7 @@ func TestDetail(t *testing.T) {
 
 	m := NewMTeam(&Config{
 		APIKey: apiKey,
-	}, MTeamTypeNormal, "", nil, nil)
+	}, MTeamTypeNormal, nil, nil)
 	require.NotNil(t, m)
 
 	res, err := m.Detail("913855", true)
@@ -159,22 +160,19 @@ func TestDownload(t *testing.T) {
 		t.Skip("MTEAM_API_KEY not set")
 	}
 
-	dir := t.TempDir()
 	d, err := db.SqliteForTest()
 	require.NoError(t, err)
 	m := NewMTeam(&Config{
 		APIKey: apiKey,
-	}, MTeamTypeNormal, dir, d, nil)
+	}, MTeamTypeNormal, d, nil)
 	require.NotNil(t, m)
 
 	res, err := m.Download("913855")
 	require.Nil(t, err)
 
-	assert.NotEmpty(t, res.TorrentFilePath)
-	assert.FileExists(t, res.TorrentFilePath)
 	assert.NotEmpty(t, res.TorrentHash)
 
-	mi, er := metainfo.LoadFromFile(res.TorrentFilePath)
+	mi, er := metainfo.Load(bytes.NewReader(res.TorrentData))
 	require.NoError(t, er)
 	info, er := mi.UnmarshalInfo()
 	require.NoError(t, er)
@@ -2,7 +2,6 @@ package mteam
 
 import (
 	"net/http"
-	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -36,9 +35,7 @@ func (m *MTeam) Download(id string) (*indexers.DownloadResult, *errors.HTTPStatu
 		return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, resp.Message)
 	}
 
-	destFilePath := filepath.Join(m.torrentsDir, name+"."+id+".torrent")
-
-	me, _, err := helpers.DownloadTorrentFileFromURL(http.DefaultClient, resp.Data, destFilePath, m.db)
+	me, data, err := helpers.FetchTorrentFile(http.DefaultClient, resp.Data, m.db)
 	if err != nil {
 		// Check if this is a duplicate download error
 		if strings.Contains(err.Error(), "duplicate download:") {
@@ -48,7 +45,7 @@ func (m *MTeam) Download(id string) (*indexers.DownloadResult, *errors.HTTPStatu
 	}
 
 	return &indexers.DownloadResult{
-		TorrentFilePath: destFilePath,
-		TorrentHash:     me.HashInfoBytes().HexString(),
+		TorrentHash: me.HashInfoBytes().HexString(),
+		TorrentData: data,
 	}, nil
 }
@@ -9,7 +9,7 @@ import (
 	"github.com/robfig/cron/v3"
 )
 
-func (m *MTeam) RegisterRSSCronjob(cron *cron.Cron) {
+func (m *MTeam) RegisterRSSCronjob(cron *cron.Cron, downloader indexers.ResourceDownloader) {
 	if m.config.RSS == "" {
 		return
 	}
@@ -21,7 +21,7 @@ func (m *MTeam) RegisterRSSCronjob(cron *cron.Cron) {
 			return
 		}
 
-		rsshelper.SearchRSS(m, m.db, m.notify, items)
+		rsshelper.SearchRSS(m, m.db, m.notify, downloader, items)
 	})
 }
 
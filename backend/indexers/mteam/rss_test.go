@@ -23,7 +23,7 @@ func TestParseRSSItem(t *testing.T) {
 
 	m := NewMTeam(&Config{
 		APIKey: "api-key",
-	}, MTeamTypeNormal, "", nil, nil)
+	}, MTeamTypeNormal, nil, nil)
 
 	got := m.ParseRSSItem(feed.Items[0])
 
@@ -53,10 +53,9 @@ func (c *Config) getProxyURL() string {
 type Client struct {
 	indexers.IndexerBasicInfo
 
-	config      *Config
-	torrentsDir string
-	db          *gorm.DB
-	notify      notify.INotifier
+	config *Config
+	db     *gorm.DB
+	notify notify.INotifier
 
 	httpClient *http.Client
 
@@ -73,11 +72,10 @@ func (c *Client) getBaseURL() string {
 	return c.config.BaseURL
 }
 
-func NewClient(config *Config, torrentsDir string, db *gorm.DB, notify notify.INotifier) *Client {
+func NewClient(config *Config, db *gorm.DB, notify notify.INotifier) *Client {
 	c := &Client{
 		IndexerBasicInfo:       *indexers.NewIndexerBasicInfo("nyaa", config.Downloader, false),
 		config:                 config,
-		torrentsDir:            torrentsDir,
 		db:                     db,
 		notify:                 notify,
 		httpClient:             http.DefaultClient,
@@ -409,7 +407,7 @@ func parseFileList(s *goquery.Selection, currentPath string, fileList *[]indexer
 	})
 }
 
-// Download the torrent file to given dir or return the magnet link.
+// Download fetches the torrent file.
 func (c *Client) Download(id string) (*indexers.DownloadResult, *errors.HTTPStatusError) {
 	fileName := fmt.Sprintf("%s.torrent", id)
 
@@ -418,7 +416,7 @@ func (c *Client) Download(id string) (*indexers.DownloadResult, *errors.HTTPStat
 		return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, fmt.Sprintf("failed to join path: %v", err))
 	}
 
-	meta, _, err := helpers.DownloadTorrentFileFromURL(c.httpClient, url, filepath.Join(c.torrentsDir, fileName), c.db)
+	meta, data, err := helpers.FetchTorrentFile(c.httpClient, url, c.db)
 	if err != nil {
 		// Check if this is a duplicate download error
 		if strings.Contains(err.Error(), "duplicate download:") {
@@ -428,8 +426,8 @@ func (c *Client) Download(id string) (*indexers.DownloadResult, *errors.HTTPStat
 	}
 
 	return &indexers.DownloadResult{
-		TorrentFilePath: filepath.Join(c.torrentsDir, fileName),
-		TorrentHash:     meta.HashInfoBytes().HexString(),
+		TorrentHash: meta.HashInfoBytes().HexString(),
+		TorrentData: data,
 	}, nil
 }
 
@@ -6,6 +6,8 @@ import (
 
 	"github.com/autoget-project/autoget/backend/indexers"
 	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/errors"
+	"github.com/autoget-project/autoget/backend/internal/notify"
 	"github.com/mmcdole/gofeed"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -13,7 +15,7 @@ import (
 )
 
 func TestCategories(t *testing.T) {
-	n := NewClient(&Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&Config{UseProxy: true}, nil, nil)
 	got, err := n.Categories()
 	require.Nil(t, err)
 	assert.NotEmpty(t, got)
@@ -21,7 +23,7 @@ func TestCategories(t *testing.T) {
 }
 
 func TestDetail(t *testing.T) {
-	n := NewClient(&Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&Config{UseProxy: true}, nil, nil)
 	got, err := n.Detail("1980585", true)
 	require.Nil(t, err)
 
@@ -39,7 +41,7 @@ func TestDetail(t *testing.T) {
 }
 
 func TestDetailWithComplexFileLists(t *testing.T) {
-	n := NewClient(&Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&Config{UseProxy: true}, nil, nil)
 	got, err := n.Detail("1980395", true)
 	require.Nil(t, err)
 
@@ -104,7 +106,7 @@ func TestHumanSizeToBytes(t *testing.T) {
 }
 
 func TestList(t *testing.T) {
-	n := NewClient(&Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&Config{UseProxy: true}, nil, nil)
 
 	tests := []struct {
 		name     string
@@ -152,19 +154,17 @@ func TestList(t *testing.T) {
 }
 
 func TestDownload(t *testing.T) {
-	dir := t.TempDir()
 	d, err := db.SqliteForTest()
 	require.NoError(t, err)
-	n := NewClient(&Config{UseProxy: true}, dir, d, nil)
+	n := NewClient(&Config{UseProxy: true}, d, nil)
 	got, err := n.Download("1980585")
 	require.Nil(t, err)
-	assert.NotEmpty(t, got.TorrentFilePath)
-	assert.FileExists(t, got.TorrentFilePath)
+	assert.NotEmpty(t, got.TorrentData)
 	assert.Equal(t, "5344c9d0e58483e4587e1de7e449abacbe92eff2", got.TorrentHash)
 }
 
 func TestPullRSS(t *testing.T) {
-	n := NewClient(&Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&Config{UseProxy: true}, nil, nil)
 	items, err := n.pullRSS()
 	require.NoError(t, err)
 	assert.NotEmpty(t, items)
@@ -179,6 +179,7 @@ func TestPullRSS(t *testing.T) {
 
 type fakeNotifier struct {
 	message string
+	matches []*notify.RSSMatch
 }
 
 func (f *fakeNotifier) SendMessage(message string) error {
@@ -191,17 +192,30 @@ func (f *fakeNotifier) SendMarkdownMessage(message string) error {
 	return nil
 }
 
+func (f *fakeNotifier) SendRSSMatch(match *notify.RSSMatch) error {
+	f.matches = append(f.matches, match)
+	return nil
+}
+
 var (
 	//go:embed test_data/rss.xml
 	rssResp string
 )
 
+type fakeDownloader struct {
+	downloads []string
+}
+
+func (f *fakeDownloader) Download(indexerName string, resourceID string) *errors.HTTPStatusError {
+	f.downloads = append(f.downloads, indexerName+"/"+resourceID)
+	return nil
+}
+
 func TestSearchRSS(t *testing.T) {
-	dir := t.TempDir()
 	d, err := db.SqliteForTest()
 	require.NoError(t, err)
 	notifier := &fakeNotifier{}
-	n := NewClient(&Config{UseProxy: true}, dir, d, notifier)
+	n := NewClient(&Config{UseProxy: true}, d, notifier)
 
 	search1 := &db.RSSSearch{
 		Indexer: "nyaa",
@@ -227,11 +241,16 @@ func TestSearchRSS(t *testing.T) {
 		items = append(items, n.ParseRSSItem(item))
 	}
 
-	n.SearchRSS(items)
+	downloader := &fakeDownloader{}
+	n.SearchRSS(downloader, items)
+
+	assert.Equal(t, []string{"nyaa/1981792"}, downloader.downloads)
 
 	assert.Contains(t, notifier.message, "# nyaa RSS")
 	assert.Contains(t, notifier.message, "## Download Started\n\n- Match Search 1")
-	assert.Contains(t, notifier.message, "## Download Pending to Start\n\n- Match Search 2")
+	require.Len(t, notifier.matches, 1)
+	assert.Equal(t, search2.ID, notifier.matches[0].SearchID)
+	assert.Equal(t, "Match Search 2", notifier.matches[0].Title)
 
 	search1After := &db.RSSSearch{}
 	search1After.ID = search1.ID
@@ -10,7 +10,7 @@ import (
 	"github.com/robfig/cron/v3"
 )
 
-func (c *Client) RegisterRSSCronjob(cron *cron.Cron) {
+func (c *Client) RegisterRSSCronjob(cron *cron.Cron, downloader indexers.ResourceDownloader) {
 	cron.AddFunc("@every 5m", func() {
 		items, err := c.pullRSS()
 		if err != nil {
@@ -18,7 +18,7 @@ func (c *Client) RegisterRSSCronjob(cron *cron.Cron) {
 			return
 		}
 
-		c.SearchRSS(items)
+		c.SearchRSS(downloader, items)
 	})
 }
 
@@ -75,6 +75,6 @@ func getResourceIDFromRSSGUID(guid string) string {
 	return parts[len(parts)-1]
 }
 
-func (c *Client) SearchRSS(items []*indexers.RSSItem) {
-	rsshelper.SearchRSS(c, c.db, c.notify, items)
+func (c *Client) SearchRSS(downloader indexers.ResourceDownloader, items []*indexers.RSSItem) {
+	rsshelper.SearchRSS(c, c.db, c.notify, downloader, items)
 }
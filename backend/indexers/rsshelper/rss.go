@@ -3,8 +3,10 @@ package rsshelper
 import (
 	"bytes"
 	_ "embed"
+	"fmt"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/autoget-project/autoget/backend/indexers"
 	"github.com/autoget-project/autoget/backend/internal/db"
@@ -27,16 +29,16 @@ func init() {
 }
 
 type RSSResultTemplateData struct {
-	Indexer                string
-	DownloadStarted        []string
-	DownloadPendingToStart []string
+	Indexer         string
+	DownloadStarted []string
+	DownloadFailed  []string
 }
 
-func RenderRSSResult(indexer string, downloadStarted []string, downloadPendingToStart []string) (string, error) {
+func RenderRSSResult(indexer string, downloadStarted []string, downloadFailed []string) (string, error) {
 	data := RSSResultTemplateData{
-		Indexer:                indexer,
-		DownloadStarted:        downloadStarted,
-		DownloadPendingToStart: downloadPendingToStart,
+		Indexer:         indexer,
+		DownloadStarted: downloadStarted,
+		DownloadFailed:  downloadFailed,
 	}
 
 	var buf bytes.Buffer
@@ -51,60 +53,126 @@ var (
 	logger = log.With().Str("module", "rsshelper").Logger()
 )
 
-func SearchRSS(index indexers.IIndexer, d *gorm.DB, notify notify.INotifier, items []*indexers.RSSItem) {
+// Match checks if item is a new match of an active search.
+func Match(search *db.RSSSearch, item *indexers.RSSItem, now time.Time) bool {
+	if !search.Active(now) || search.Matched(item.ResID) {
+		return false
+	}
+	return MatchText(search, item.Title)
+}
+
+// MatchText checks if title contains the text of the search.
+func MatchText(search *db.RSSSearch, title string) bool {
+	return strings.Contains(strings.ToLower(title), strings.ToLower(search.Text))
+}
+
+func SearchRSS(index indexers.IIndexer, d *gorm.DB, notifier notify.INotifier, downloader indexers.ResourceDownloader, items []*indexers.RSSItem) {
+	saveItems(index.Name(), d, items)
+
 	searchs, err := db.GetSearchsByIndexer(d, index.Name())
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to get searchs from database")
 		return
 	}
 
+	searchItems(index, d, notifier, downloader, searchs, items)
+}
+
+// SearchHistory matches a new search against RSS items seen since.
+func SearchHistory(index indexers.IIndexer, d *gorm.DB, notifier notify.INotifier, downloader indexers.ResourceDownloader, search *db.RSSSearch, since time.Time) error {
+	stored, err := db.GetRSSItemsSince(d, index.Name(), since)
+	if err != nil {
+		return err
+	}
+
+	items := []*indexers.RSSItem{}
+	for _, i := range stored {
+		items = append(items, &indexers.RSSItem{
+			ResID:     i.ResID,
+			Title:     i.Title,
+			Catergory: i.Category,
+			URL:       i.URL,
+		})
+	}
+
+	searchItems(index, d, notifier, downloader, []*db.RSSSearch{search}, items)
+	return nil
+}
+
+func saveItems(indexer string, d *gorm.DB, items []*indexers.RSSItem) {
+	now := time.Now()
+	stored := []*db.RSSItem{}
+	for _, item := range items {
+		stored = append(stored, &db.RSSItem{
+			Indexer:     indexer,
+			ResID:       item.ResID,
+			Title:       item.Title,
+			Category:    item.Catergory,
+			URL:         item.URL,
+			FirstSeenAt: now,
+		})
+	}
+
+	if err := db.AddRSSItems(d, stored); err != nil {
+		logger.Error().Err(err).Msg("Failed to save RSS items")
+	}
+}
+
+func searchItems(index indexers.IIndexer, d *gorm.DB, notifier notify.INotifier, downloader indexers.ResourceDownloader, searchs []*db.RSSSearch, items []*indexers.RSSItem) {
 	downloadStarted := []string{}
-	downloadPendingToStart := []string{}
+	downloadFailed := []string{}
 
+	now := time.Now()
 	for _, item := range items {
 		for _, search := range searchs {
-			if search.ResID != "" {
+			if !Match(search, item, now) {
+				continue
+			}
+
+			search.RecordMatch(item.ResID, item.Title, item.Catergory, item.URL, now)
+			if err := db.UpdateSearch(d, search); err != nil {
+				logger.Error().Err(err).Msg("Failed to update search")
 				continue
 			}
-			if strings.Contains(strings.ToLower(item.Title), search.Text) {
-				search.Title = item.Title
-				search.URL = item.URL
-				search.ResID = item.ResID
-				search.Catergory = item.Catergory
-
-				err = db.UpdateSearch(d, search)
-				if err != nil {
-					logger.Error().Err(err).Msg("Failed to update search")
+
+			if search.Action == "download" {
+				if err := downloader.Download(index.Name(), search.ResID); err != nil {
+					logger.Error().Err(err).Str("resource", search.ResID).Msg("Failed to download torrent")
+					downloadFailed = append(downloadFailed, fmt.Sprintf("%s: %s", search.Title, err.Message))
 					continue
 				}
 
-				if search.Action == "download" {
-					_, err := index.Download(search.ResID)
-					if err != nil {
-						logger.Error().Err(err).Msg("Failed to download torrent")
-						continue
-					}
-
+				if search.Exhausted() {
 					if err := db.DeleteSearch(d, search.ID); err != nil {
 						logger.Error().Err(err).Msg("Failed to delete search")
 						continue
 					}
+				}
 
-					downloadStarted = append(downloadStarted, search.Title)
-				} else if search.Action == "notification" {
-					downloadPendingToStart = append(downloadPendingToStart, search.Title)
+				downloadStarted = append(downloadStarted, search.Title)
+			} else if search.Action == "notification" {
+				if err := notifier.SendRSSMatch(&notify.RSSMatch{
+					SearchID:   search.ID,
+					SearchText: search.Text,
+					Indexer:    index.Name(),
+					ResID:      search.ResID,
+					Title:      search.Title,
+					Category:   search.Catergory,
+					URL:        search.URL,
+				}); err != nil {
+					logger.Error().Err(err).Msg("Failed to send RSS match notification")
 				}
 			}
 		}
 	}
 
-	if len(downloadStarted) > 0 || len(downloadPendingToStart) > 0 {
-		msg, err := RenderRSSResult(index.Name(), downloadStarted, downloadPendingToStart)
+	if len(downloadStarted) > 0 || len(downloadFailed) > 0 {
+		msg, err := RenderRSSResult(index.Name(), downloadStarted, downloadFailed)
 		if err != nil {
 			logger.Error().Err(err).Msg("Failed to render RSS result")
 			return
 		}
-		if err := notify.SendMarkdownMessage(msg); err != nil {
+		if err := notifier.SendMarkdownMessage(msg); err != nil {
 			logger.Error().Err(err).Msg("Failed to send RSS notification")
 		}
 	}
@@ -3,36 +3,34 @@ package rsshelper
 import (
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestRenderRSSResult(t *testing.T) {
 	tests := []struct {
-		name                   string
-		indexer                string
-		downloadStarted        []string
-		downloadPendingToStart []string
-		expectedSubstrings     []string
-		notExpectedSubstrings  []string
+		name                  string
+		indexer               string
+		downloadStarted       []string
+		downloadFailed        []string
+		expectedSubstrings    []string
+		notExpectedSubstrings []string
 	}{
 		{
-			name:    "Both lists populated",
+			name:    "DownloadStarted populated",
 			indexer: "TestIndexer",
 			downloadStarted: []string{
 				"Item A",
 				"Item B",
 			},
-			downloadPendingToStart: []string{
-				"Item C",
-				"Item D",
-			},
 			expectedSubstrings: []string{
 				"# TestIndexer RSS",
 				"## Download Started",
 				"- Item A",
 				"- Item B",
-				"## Download Pending to Start",
-				"- Item C",
-				"- Item D",
 			},
 			notExpectedSubstrings: []string{},
 		},
@@ -40,56 +38,32 @@ func TestRenderRSSResult(t *testing.T) {
 			name:            "DownloadStarted empty",
 			indexer:         "TestIndexer",
 			downloadStarted: []string{},
-			downloadPendingToStart: []string{
-				"Item C",
-				"Item D",
-			},
 			expectedSubstrings: []string{
 				"# TestIndexer RSS",
-				"## Download Pending to Start",
-				"- Item C",
-				"- Item D",
 			},
 			notExpectedSubstrings: []string{
 				"## Download Started",
+				"## Download Failed",
 			},
 		},
 		{
-			name:    "DownloadPendingToStart empty",
-			indexer: "TestIndexer",
-			downloadStarted: []string{
-				"Item A",
-				"Item B",
-			},
-			downloadPendingToStart: []string{},
-			expectedSubstrings: []string{
-				"# TestIndexer RSS",
-				"## Download Started",
-				"- Item A",
-				"- Item B",
-			},
-			notExpectedSubstrings: []string{
-				"## Download Pending to Start",
-			},
-		},
-		{
-			name:                   "Both lists empty",
-			indexer:                "TestIndexer",
-			downloadStarted:        []string{},
-			downloadPendingToStart: []string{},
+			name:            "DownloadFailed populated",
+			indexer:         "TestIndexer",
+			downloadStarted: []string{},
+			downloadFailed:  []string{"Item C: duplicate download"},
 			expectedSubstrings: []string{
-				"# TestIndexer RSS",
+				"## Download Failed",
+				"- Item C: duplicate download",
 			},
 			notExpectedSubstrings: []string{
 				"## Download Started",
-				"## Download Pending to Start",
 			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := RenderRSSResult(tt.indexer, tt.downloadStarted, tt.downloadPendingToStart)
+			result, err := RenderRSSResult(tt.indexer, tt.downloadStarted, tt.downloadFailed)
 			if err != nil {
 				t.Fatalf("RenderRSSResult returned an error: %v", err)
 			}
@@ -108,3 +82,28 @@ func TestRenderRSSResult(t *testing.T) {
 		})
 	}
 }
+
+func TestMatch(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		search *db.RSSSearch
+		want   bool
+	}{
+		{name: "match", search: &db.RSSSearch{Text: "some"}, want: true},
+		{name: "text not match", search: &db.RSSSearch{Text: "other"}, want: false},
+		{name: "already matched", search: &db.RSSSearch{Text: "some", MaxMatches: 2, MatchCount: 1, MatchedResIDs: []string{"1"}}, want: false},
+		{name: "ignored", search: &db.RSSSearch{Text: "some", IgnoredResIDs: []string{"1"}}, want: false},
+		{name: "expired", search: &db.RSSSearch{Text: "some", ExpiresAt: &past}, want: false},
+		{name: "disabled", search: &db.RSSSearch{Text: "some", Disabled: true}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Match(tt.search, &indexers.RSSItem{ResID: "1", Title: "Some Title"}, now)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package rsshelper
+
+import (
+	"bytes"
+	_ "embed"
+	"text/template"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/notify"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultStaleAfterDays       = 30
+	defaultHistoryRetentionDays = 30
+)
+
+type SubscriptionConfig struct {
+	// StaleAfterDays is how long a search goes without match before it
+	// shows up in the weekly reminder.
+	StaleAfterDays int `yaml:"stale_after_days"`
+
+	// HistoryRetentionDays is how long pulled RSS items are kept.
+	HistoryRetentionDays int `yaml:"history_retention_days"`
+}
+
+func (c *SubscriptionConfig) staleAfterDays() int {
+	if c == nil || c.StaleAfterDays <= 0 {
+		return defaultStaleAfterDays
+	}
+	return c.StaleAfterDays
+}
+
+func (c *SubscriptionConfig) HistoryRetention() time.Duration {
+	days := defaultHistoryRetentionDays
+	if c != nil && c.HistoryRetentionDays > 0 {
+		days = c.HistoryRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+//go:embed subscriptions.md
+var staleTemplateContent string
+
+var staleTemplate *template.Template
+
+func init() {
+	var err error
+	staleTemplate, err = template.New("stale").Parse(staleTemplateContent)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to parse stale subscriptions template")
+	}
+}
+
+type staleTemplateData struct {
+	Days     int
+	Searches []*db.RSSSearch
+}
+
+func RenderStaleSearches(days int, searchs []*db.RSSSearch) (string, error) {
+	var buf bytes.Buffer
+	err := staleTemplate.Execute(&buf, staleTemplateData{Days: days, Searches: searchs})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// RegisterSubscriptionCronjobs disables expired searches hourly, reminds
+// stale searches weekly and cleans up RSS item history daily.
+func RegisterSubscriptionCronjobs(cron *cron.Cron, d *gorm.DB, notifier notify.INotifier, cfg *SubscriptionConfig) {
+	if _, err := cron.AddFunc("0 * * * *", func() {
+		DisableExpiredSearches(d, time.Now())
+	}); err != nil {
+		logger.Error().Err(err).Msg("Failed to add expired searches cron job")
+	}
+
+	if _, err := cron.AddFunc("0 9 * * 1", func() {
+		RemindStaleSearches(d, notifier, cfg.staleAfterDays(), time.Now())
+	}); err != nil {
+		logger.Error().Err(err).Msg("Failed to add stale searches cron job")
+	}
+
+	if _, err := cron.AddFunc("30 4 * * *", func() {
+		CleanupHistory(d, time.Now().Add(-cfg.HistoryRetention()))
+	}); err != nil {
+		logger.Error().Err(err).Msg("Failed to add RSS history cleanup cron job")
+	}
+}
+
+func CleanupHistory(d *gorm.DB, before time.Time) {
+	count, err := db.DeleteRSSItemsBefore(d, before)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to cleanup RSS items")
+		return
+	}
+	logger.Info().Int64("count", count).Msg("Cleaned up RSS items")
+}
+
+func DisableExpiredSearches(d *gorm.DB, now time.Time) {
+	count, err := db.DisableExpiredSearches(d, now)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to disable expired searches")
+		return
+	}
+	if count > 0 {
+		logger.Info().Int64("count", count).Msg("Disabled expired searches")
+	}
+}
+
+func RemindStaleSearches(d *gorm.DB, notifier notify.INotifier, days int, now time.Time) {
+	searchs, err := db.GetStaleSearches(d, now.AddDate(0, 0, -days))
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to get stale searches")
+		return
+	}
+
+	stale := []*db.RSSSearch{}
+	for _, s := range searchs {
+		// exhausted searches already got what they wanted.
+		if s.Active(now) {
+			stale = append(stale, s)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	msg, err := RenderStaleSearches(days, stale)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to render stale searches")
+		return
+	}
+	if err := notifier.SendMarkdownMessage(msg); err != nil {
+		logger.Error().Err(err).Msg("Failed to send stale searches reminder")
+	}
+}
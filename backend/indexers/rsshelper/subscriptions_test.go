@@ -0,0 +1,59 @@
+package rsshelper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type fakeNotifier struct {
+	markdowns []string
+}
+
+func (f *fakeNotifier) SendMessage(message string) error {
+	return nil
+}
+
+func (f *fakeNotifier) SendMarkdownMessage(message string) error {
+	f.markdowns = append(f.markdowns, message)
+	return nil
+}
+
+func (f *fakeNotifier) SendRSSMatch(match *notify.RSSMatch) error {
+	return nil
+}
+
+func TestRemindStaleSearches(t *testing.T) {
+	d, err := db.SqliteForTest()
+	require.NoError(t, err)
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -40)
+	searchs := []*db.RSSSearch{
+		{Indexer: "nyaa", Text: "stale", Action: "notification", Model: gorm.Model{CreatedAt: old}},
+		{Indexer: "nyaa", Text: "fresh", Action: "notification"},
+		{Indexer: "nyaa", Text: "exhausted", Action: "notification", Model: gorm.Model{CreatedAt: old}, MatchCount: 1, LastMatchedAt: &old},
+	}
+	for _, s := range searchs {
+		require.NoError(t, d.Create(s).Error)
+	}
+
+	notifier := &fakeNotifier{}
+	RemindStaleSearches(d, notifier, 30, now)
+
+	require.Len(t, notifier.markdowns, 1)
+	assert.Contains(t, notifier.markdowns[0], "last 30 days")
+	assert.Contains(t, notifier.markdowns[0], "- [nyaa] stale (notification)")
+	assert.NotContains(t, notifier.markdowns[0], "fresh")
+	assert.NotContains(t, notifier.markdowns[0], "exhausted")
+
+	// nothing stale, no reminder.
+	notifier = &fakeNotifier{}
+	RemindStaleSearches(d, notifier, 60, now)
+	assert.Empty(t, notifier.markdowns)
+}
@@ -18,27 +18,37 @@ type IIndexer interface {
 	// Detail of a resource.
 	Detail(id string, fileList bool) (*ResourceDetail, *errors.HTTPStatusError)
 
-	// Download the torrent file to given dir or return the magnet link.
+	// Download fetches the torrent file of a resource, adding it to the
+	// downloader is up to the caller.
 	Download(id string) (*DownloadResult, *errors.HTTPStatusError)
 
-	// RegisterRSSCronjob
-	RegisterRSSCronjob(cron *cron.Cron)
+	// RegisterRSSCronjob, matched resources are downloaded with downloader.
+	RegisterRSSCronjob(cron *cron.Cron, downloader ResourceDownloader)
 
 	// DownloaderName
 	DownloaderName() string
+
+	// Private tells if the indexer is a private tracker, its torrents are
+	// protected from hit-and-run.
+	Private() bool
+}
+
+// ResourceDownloader downloads resources of indexers into their downloader.
+type ResourceDownloader interface {
+	Download(indexerName string, resourceID string) *errors.HTTPStatusError
 }
 
 type IndexerBasicInfo struct {
 	Name_           string
 	DownloaderName_ string
-	Private         bool
+	Private_        bool
 }
 
 func NewIndexerBasicInfo(name string, downloaderName string, private bool) *IndexerBasicInfo {
 	return &IndexerBasicInfo{
 		Name_:           name,
 		DownloaderName_: downloaderName,
-		Private:         private,
+		Private_:        private,
 	}
 }
 
@@ -50,6 +60,10 @@ func (info *IndexerBasicInfo) DownloaderName() string {
 	return info.DownloaderName_
 }
 
+func (info *IndexerBasicInfo) Private() bool {
+	return info.Private_
+}
+
 type Category struct {
 	ID            string     `json:"id"`
 	Name          string     `json:"name"`
@@ -129,8 +143,9 @@ type ResourceDetail struct {
 }
 
 type DownloadResult struct {
-	TorrentFilePath string
-	TorrentHash     string
+	TorrentHash string
+	// TorrentData is the content of the torrent file.
+	TorrentData []byte
 }
 
 type ListRequest struct {
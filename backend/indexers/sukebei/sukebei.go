@@ -15,9 +15,9 @@ type Client struct {
 	nyaa.Client
 }
 
-func NewClient(config *nyaa.Config, torrentsDir string, db *gorm.DB, notify notify.INotifier) *Client {
+func NewClient(config *nyaa.Config, db *gorm.DB, notify notify.INotifier) *Client {
 	c := &Client{}
-	c.Client = *nyaa.NewClient(config, torrentsDir, db, notify)
+	c.Client = *nyaa.NewClient(config, db, notify)
 	c.Name_ = "sukebei"
 	c.Client.DefaultBaseURL = defaultBaseURL
 	c.Client.CategoriesMap = prefetcheddata.Categories
@@ -7,6 +7,8 @@ import (
 	"github.com/autoget-project/autoget/backend/indexers"
 	"github.com/autoget-project/autoget/backend/indexers/nyaa"
 	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/errors"
+	"github.com/autoget-project/autoget/backend/internal/notify"
 	"github.com/mmcdole/gofeed"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -14,7 +16,7 @@ import (
 )
 
 func TestCategories(t *testing.T) {
-	n := NewClient(&nyaa.Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&nyaa.Config{UseProxy: true}, nil, nil)
 	got, err := n.Categories()
 	require.Nil(t, err)
 	assert.NotEmpty(t, got)
@@ -22,7 +24,7 @@ func TestCategories(t *testing.T) {
 }
 
 func TestList(t *testing.T) {
-	n := NewClient(&nyaa.Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&nyaa.Config{UseProxy: true}, nil, nil)
 
 	tests := []struct {
 		name     string
@@ -70,19 +72,17 @@ func TestList(t *testing.T) {
 }
 
 func TestDownload(t *testing.T) {
-	dir := t.TempDir()
 	d, err := db.SqliteForTest()
 	require.NoError(t, err)
-	n := NewClient(&nyaa.Config{UseProxy: true}, dir, d, nil)
+	n := NewClient(&nyaa.Config{UseProxy: true}, d, nil)
 	got, err := n.Download("4322631")
 	require.Nil(t, err)
-	assert.NotEmpty(t, got.TorrentFilePath)
-	assert.FileExists(t, got.TorrentFilePath)
+	assert.NotEmpty(t, got.TorrentData)
 	assert.Equal(t, "540b136f03c15c003823d7b9869a0008f44b5d29", got.TorrentHash)
 }
 
 func TestDetail(t *testing.T) {
-	n := NewClient(&nyaa.Config{UseProxy: true}, "", nil, nil)
+	n := NewClient(&nyaa.Config{UseProxy: true}, nil, nil)
 	got, err := n.Detail("4322631", true)
 	require.Nil(t, err)
 
@@ -97,6 +97,7 @@ func TestDetail(t *testing.T) {
 
 type fakeNotifier struct {
 	message string
+	matches []*notify.RSSMatch
 }
 
 func (f *fakeNotifier) SendMessage(message string) error {
@@ -109,17 +110,30 @@ func (f *fakeNotifier) SendMarkdownMessage(message string) error {
 	return nil
 }
 
+func (f *fakeNotifier) SendRSSMatch(match *notify.RSSMatch) error {
+	f.matches = append(f.matches, match)
+	return nil
+}
+
 var (
 	//go:embed test_data/rss.xml
 	rssResp string
 )
 
+type fakeDownloader struct {
+	downloads []string
+}
+
+func (f *fakeDownloader) Download(indexerName string, resourceID string) *errors.HTTPStatusError {
+	f.downloads = append(f.downloads, indexerName+"/"+resourceID)
+	return nil
+}
+
 func TestSearchRSS(t *testing.T) {
-	dir := t.TempDir()
 	d, err := db.SqliteForTest()
 	require.NoError(t, err)
 	notifier := &fakeNotifier{}
-	n := NewClient(&nyaa.Config{UseProxy: true}, dir, d, notifier)
+	n := NewClient(&nyaa.Config{UseProxy: true}, d, notifier)
 
 	search1 := &db.RSSSearch{
 		Indexer: "sukebei",
@@ -145,11 +159,16 @@ func TestSearchRSS(t *testing.T) {
 		items = append(items, n.ParseRSSItem(item))
 	}
 
-	n.SearchRSS(items)
+	downloader := &fakeDownloader{}
+	n.SearchRSS(downloader, items)
+
+	assert.Equal(t, []string{"sukebei/4326219"}, downloader.downloads)
 
 	assert.Contains(t, notifier.message, "# sukebei RSS")
 	assert.Contains(t, notifier.message, "## Download Started\n\n- Match Search 1")
-	assert.Contains(t, notifier.message, "## Download Pending to Start\n\n- Match Search 2")
+	require.Len(t, notifier.matches, 1)
+	assert.Equal(t, search2.ID, notifier.matches[0].SearchID)
+	assert.Equal(t, "Match Search 2", notifier.matches[0].Title)
 
 	search1After := &db.RSSSearch{}
 	search1After.ID = search1.ID
@@ -2,20 +2,35 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"slices"
 
 	dlconfig "github.com/autoget-project/autoget/backend/downloaders/config"
 	"github.com/autoget-project/autoget/backend/indexers/mteam"
 	"github.com/autoget-project/autoget/backend/indexers/nyaa"
+	"github.com/autoget-project/autoget/backend/indexers/rsshelper"
 	"github.com/autoget-project/autoget/backend/internal/notify/telegram"
 	"github.com/goccy/go-yaml"
 )
 
+const (
+	FeedCompleted = "completed"
+	FeedOrganized = "organized"
+	FeedMatches   = "matches"
+	FeedPending   = "pending"
+)
+
+var feedNames = []string{FeedCompleted, FeedOrganized, FeedMatches, FeedPending}
+
 type Config struct {
 	Port             string `yaml:"port"`
 	ProxyURL         string `yaml:"proxy_url"`
 	PgDSN            string `yaml:"pg_dsn"`
 	OrganizerService string `yaml:"organizer_service"`
+	// BaseURL is the URL AutoGet is reached at, for absolute links in feeds.
+	// Scheme and host of requests are used if empty.
+	BaseURL string `yaml:"base_url"`
 
 	Telegram *telegram.Config `yaml:"telegram"`
 
@@ -23,6 +38,12 @@ type Config struct {
 	Nyaa    *nyaa.Config  `yaml:"nyaa"`
 	Sukebei *nyaa.Config  `yaml:"sukebei"`
 
+	Subscriptions *rsshelper.SubscriptionConfig `yaml:"subscriptions"`
+
+	// Feeds maps feed name to the token required to read it, feeds not
+	// listed are not published.
+	Feeds map[string]string `yaml:"feeds"`
+
 	Downloaders map[string]*dlconfig.DownloaderConfig `yaml:"downloaders"`
 }
 
@@ -102,6 +123,21 @@ func (c *Config) validate() error {
 		}
 	}
 
+	if c.BaseURL != "" {
+		if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid base_url: %s", c.BaseURL)
+		}
+	}
+
+	for name, token := range c.Feeds {
+		if !slices.Contains(feedNames, name) {
+			return fmt.Errorf("unknown feed: %s", name)
+		}
+		if token == "" {
+			return fmt.Errorf("token of feed %s is required", name)
+		}
+	}
+
 	for name, downloader := range c.Downloaders {
 		if err := downloader.Validate(); err != nil {
 			return fmt.Errorf("invalid downloader config for %s: %v", name, err)
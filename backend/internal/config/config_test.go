@@ -416,7 +416,7 @@ func TestConfig_validate(t *testing.T) {
 			wantErr: "unknown sukebei downloader: unknown_downloader",
 		},
 		{
-			name: "Invalid downloader config (missing transmission config)",
+			name: "Invalid downloader config (missing backend config)",
 			config: &Config{
 				PgDSN:            "dsn",
 				OrganizerService: "http://organizer.svc",
@@ -425,10 +425,10 @@ func TestConfig_validate(t *testing.T) {
 					ChatID: "test_chat_id",
 				},
 				Downloaders: map[string]*dlconfig.DownloaderConfig{
-					"invalid_downloader": {}, // Missing Transmission config
+					"invalid_downloader": {}, // Missing backend config
 				},
 			},
-			wantErr: "invalid downloader config for invalid_downloader: transmission config is required",
+			wantErr: "invalid downloader config for invalid_downloader: downloader backend config is required",
 		},
 		{
 			name: "Invalid downloader config (invalid transmission URL)",
@@ -451,6 +451,537 @@ func TestConfig_validate(t *testing.T) {
 			},
 			wantErr: "invalid downloader config for invalid_downloader: transmission RPC URL is required",
 		},
+		{
+			name: "Unknown feed",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Feeds: map[string]string{"unknown": "token"},
+			},
+			wantErr: "unknown feed: unknown",
+		},
+		{
+			name: "Feed missing token",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Feeds: map[string]string{FeedCompleted: ""},
+			},
+			wantErr: "token of feed completed is required",
+		},
+		{
+			name: "Invalid base URL",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				BaseURL:          "autoget.example.com",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+			},
+			wantErr: "invalid base_url: autoget.example.com",
+		},
+		{
+			name: "Invalid downloader config (multiple backends)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Transmission: &dlconfig.TransmissionConfig{
+							URL:         "http://localhost:9091",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						QBittorrent: &dlconfig.QBittorrentConfig{
+							URL:         "http://localhost:8080",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: only one downloader backend can be configured",
+		},
+		{
+			name: "Invalid downloader config (invalid qbittorrent URL)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						QBittorrent: &dlconfig.QBittorrentConfig{
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: qbittorrent Web API URL is required",
+		},
+		{
+			name: "Invalid downloader config (invalid deluge URL)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: deluge Web UI URL is required",
+		},
+		{
+			name: "Invalid downloader config (invalid aria2 URL)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Aria2: &dlconfig.Aria2Config{
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: aria2 RPC URL is required",
+		},
+		{
+			name: "Invalid downloader config (invalid rtorrent URL)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						RTorrent: &dlconfig.RTorrentConfig{
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: rtorrent XML-RPC URL is required",
+		},
+		{
+			name: "Invalid downloader config (embedded without data dir)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Embedded: &dlconfig.EmbeddedConfig{
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: data directory is required",
+		},
+		{
+			name: "Invalid downloader config (embedded negative rate limit)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Embedded: &dlconfig.EmbeddedConfig{
+							DataDir:           "/tmp/data",
+							TorrentsDir:       "/tmp/torrents",
+							DownloadDir:       "/tmp/downloads",
+							FinishedDir:       "/tmp/finished",
+							UploadRateLimitKB: -1,
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: rate limits can not be negative",
+		},
+		{
+			name: "Invalid downloader config (seeding policy without rule)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						SeedingPolicies: []dlconfig.SeedingPolicy{
+							{Indexer: "mteam", Action: dlconfig.SeedingActionRemove},
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: seeding policy needs a ratio, seed time or idle-upload rule",
+		},
+		{
+			name: "Invalid downloader config (seeding policy invalid action)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						SeedingPolicies: []dlconfig.SeedingPolicy{
+							{Tracker: "tracker.example.org", MinRatio: 1, Action: "delete"},
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: invalid seeding action \"delete\"",
+		},
+		{
+			name: "Invalid downloader config (seeding policy max under min seed time)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						SeedingPolicies: []dlconfig.SeedingPolicy{
+							{MinSeedHours: 72, MaxSeedHours: 24},
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: max seed hours should not be less than min seed hours",
+		},
+		{
+			name: "Invalid downloader config (hit-and-run without seed hours)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						HitAndRun: &dlconfig.HitAndRun{MinRatio: 1},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: hit-and-run min seed hours is required",
+		},
+		{
+			name: "Invalid downloader config (disk space without min free)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						DiskSpace: &dlconfig.DiskSpace{},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: disk space min free MB is required",
+		},
+		{
+			name: "Invalid downloader config (transfer mode)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						TransferMode: "move",
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: invalid transfer mode \"move\"",
+		},
+		{
+			name: "Invalid downloader config (negative transfer workers)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						PostProcessing: &dlconfig.PostProcessing{TransferWorkers: -1},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: transfer workers can not be negative",
+		},
+		{
+			name: "Invalid downloader config (post-processing window invalid)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						PostProcessing: &dlconfig.PostProcessing{
+							Windows: []dlconfig.TimeWindow{{Start: "01:00", End: "01:00"}},
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: time window 01:00-01:00 is empty",
+		},
+		{
+			name: "Invalid downloader config (negative max active downloads)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						MaxActiveDownloads: -1,
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: max active downloads can not be negative",
+		},
+		{
+			name: "Invalid downloader config (stalled grab without remove)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						Stalled: &dlconfig.Stalled{AfterHours: 24, Replace: dlconfig.ReplaceGrab},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: stalled replace grab requires remove",
+		},
+		{
+			name: "Invalid downloader config (stalled after hours)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						Stalled: &dlconfig.Stalled{Replace: dlconfig.ReplaceOffer},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: stalled after hours must be positive",
+		},
+		{
+			name: "Invalid downloader config (bandwidth schedule invalid time)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						BandwidthSchedules: []dlconfig.BandwidthSchedule{
+							{Start: "9am", End: "18:00"},
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: invalid time \"9am\", want HH:MM",
+		},
+		{
+			name: "Invalid downloader config (bandwidth schedule invalid day)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						BandwidthSchedules: []dlconfig.BandwidthSchedule{
+							{Days: []string{"someday"}, Start: "09:00", End: "18:00"},
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: invalid day \"someday\" in bandwidth schedule",
+		},
+		{
+			name: "Invalid downloader config (alt speed on deluge)",
+			config: &Config{
+				PgDSN:            "dsn",
+				OrganizerService: "http://organizer.svc",
+				Telegram: &telegram.Config{
+					Token:  "test_token",
+					ChatID: "test_chat_id",
+				},
+				Downloaders: map[string]*dlconfig.DownloaderConfig{
+					"invalid_downloader": {
+						Deluge: &dlconfig.DelugeConfig{
+							URL:         "http://localhost:8112",
+							TorrentsDir: "/tmp/torrents",
+							DownloadDir: "/tmp/downloads",
+							FinishedDir: "/tmp/finished",
+						},
+						BandwidthSchedules: []dlconfig.BandwidthSchedule{
+							{Start: "09:00", End: "18:00", AltSpeed: true},
+						},
+					},
+				},
+			},
+			wantErr: "invalid downloader config for invalid_downloader: alt speed is only supported by transmission and qbittorrent",
+		},
 	}
 
 	for _, tt := range tests {
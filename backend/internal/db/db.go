@@ -52,6 +52,13 @@ func SqliteForTest() (*gorm.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	// each connection of :memory: is a new empty database, background
+	// transfers must see the same one.
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
 	if err := migrate(db); err != nil {
 		return nil, err
 	}
@@ -62,5 +69,7 @@ func migrate(db *gorm.DB) error {
 	return db.AutoMigrate(
 		&DownloadStatus{},
 		&RSSSearch{},
+		&RSSItem{},
+		&TorrentFile{},
 	)
 }
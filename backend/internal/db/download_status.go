@@ -18,8 +18,26 @@ const (
 	DownloadSeeding
 	DownloadStopped
 	DownloadDeleted
+	// DownloadPaused is a download paused by the user, done downloading if
+	// CompletedAt is set.
+	DownloadPaused
+	// DownloadMissing is a download gone from the downloader, marked by
+	// reconciliation.
+	DownloadMissing
+	// DownloadQueued is a download held by AutoGet until a slot of max
+	// active downloads is free, not added to the downloader yet.
+	DownloadQueued
 )
 
+// trackedStates are downloads expected in the downloader.
+var trackedStates = []DownloadState{DownloadStarted, DownloadSeeding, DownloadStopped, DownloadPaused}
+
+// finishedStates are downloads done downloading.
+var finishedStates = []DownloadState{DownloadSeeding, DownloadStopped, DownloadDeleted}
+
+// unfinishedStates are downloads not done downloading yet.
+var unfinishedStates = []DownloadState{DownloadStarted, DownloadPaused}
+
 type MoveState uint16
 
 const (
@@ -53,6 +71,13 @@ type DownloadStatus struct {
 
 	UploadHistories map[string]int64 `gorm:"serializer:json"`
 	Size            uint64
+	// CompletedAt is when seeding started, for seed time of seeding policies.
+	CompletedAt *time.Time
+	// Private downloads are from private indexers, SeedTime is tracked for
+	// hit-and-run protection.
+	Private           bool
+	SeedTime          time.Duration
+	HitAndRunNotified bool
 
 	ResIndexer string
 	ResTitle   string
@@ -62,10 +87,46 @@ type DownloadStatus struct {
 	Metadata   map[string]interface{} `gorm:"serializer:json"`
 
 	MoveState MoveState `gorm:"index:idx_downloader_state_movestate;index:idx_downloader_movestate_organizestate"`
+	// MoveProgress of files transferred to the finished dir, in x/1000.
+	MoveProgress uint16
+	// TransferAttempts are failed transfers to the finished dir, the last
+	// one failed at TransferFailedAt with TransferError.
+	TransferAttempts int
+	TransferError    string
+	TransferFailedAt *time.Time
 
 	OrganizeState OrganizeState `gorm:"index:idx_downloader_movestate_organizestate"`
 
 	OrganizePlans *organizer.PlanResponse `gorm:"serializer:json"`
+
+	// AddOptions of a queued download, to add it once released. Queued
+	// downloads are released by QueuePriority, higher first, then
+	// QueuePosition.
+	AddOptions    *AddOptions `gorm:"serializer:json"`
+	QueuePriority int
+	QueuePosition int64
+
+	// ProgressAt and PeersAt are when the download last made progress and
+	// last had peers, StalledAt is when it was found stalled.
+	ProgressAt *time.Time
+	PeersAt    *time.Time
+	StalledAt  *time.Time
+	// ReplaceSearched is set once an alternative release of a stalled
+	// download was searched, Replacement is the grabbed "indexer/id".
+	ReplaceSearched bool
+	Replacement     string
+}
+
+// AddOptions are options adding a queued download, its .torrent is a
+// TorrentFile.
+type AddOptions struct {
+	Magnet   string   `json:"magnet,omitempty"`
+	Dir      string   `json:"dir,omitempty"`
+	Labels   []string `json:"labels,omitempty"`
+	Paused   bool     `json:"paused,omitempty"`
+	Priority int      `json:"priority,omitempty"`
+	Files    []int    `json:"files,omitempty"`
+	Skip     []string `json:"skip,omitempty"`
 }
 
 func (s *DownloadStatus) AddToday(b int64) {
@@ -98,7 +159,40 @@ func GetDownloadStatusByID(db *gorm.DB, id string) (*DownloadStatus, error) {
 
 func GetUnfinishedDownloadStatusByDownloader(db *gorm.DB, downloader string) ([]DownloadStatus, error) {
 	var ss []DownloadStatus
-	err := db.Where("downloader = ?", downloader).Where("state = ?", DownloadStarted).Find(&ss).Error
+	err := db.Where("downloader = ?", downloader).Where("state IN ?", unfinishedStates).Find(&ss).Error
+	return ss, err
+}
+
+// GetTrackedDownloadStatusByDownloader returns downloads expected in the
+// downloader.
+func GetTrackedDownloadStatusByDownloader(db *gorm.DB, downloader string) ([]DownloadStatus, error) {
+	var ss []DownloadStatus
+	err := db.Where("downloader = ?", downloader).Where("state IN ?", trackedStates).Find(&ss).Error
+	return ss, err
+}
+
+// GetQueuedDownloadStatusByDownloader returns queued downloads in release
+// order.
+func GetQueuedDownloadStatusByDownloader(db *gorm.DB, downloader string) ([]DownloadStatus, error) {
+	var ss []DownloadStatus
+	err := db.Where("downloader = ?", downloader).Where("state = ?", DownloadQueued).
+		Order("queue_priority DESC").Order("queue_position").Order("created_at").Find(&ss).Error
+	return ss, err
+}
+
+// CountActiveDownloads counts started downloads of the downloader, paused
+// ones are not active.
+func CountActiveDownloads(db *gorm.DB, downloader string) (int64, error) {
+	var n int64
+	err := db.Model(&DownloadStatus{}).Where("downloader = ?", downloader).Where("state = ?", DownloadStarted).Count(&n).Error
+	return n, err
+}
+
+// GetStalledUnsearchedDownloadStatusByDownloader returns stalled downloads
+// not searched for a replacement yet.
+func GetStalledUnsearchedDownloadStatusByDownloader(db *gorm.DB, downloader string) ([]DownloadStatus, error) {
+	var ss []DownloadStatus
+	err := db.Where("downloader = ?", downloader).Where("stalled_at IS NOT NULL").Where("replace_searched = ?", false).Find(&ss).Error
 	return ss, err
 }
 
@@ -108,9 +202,12 @@ func GetDownloadStatusByDownloaderAndState(db *gorm.DB, downloader string, state
 	return ss, err
 }
 
+// GetFinishedUnmoveedDownloadStatusByDownloader returns downloads done
+// downloading not transferred yet, paused ones included.
 func GetFinishedUnmoveedDownloadStatusByDownloader(db *gorm.DB, downloader string) ([]DownloadStatus, error) {
 	var ss []DownloadStatus
-	err := db.Where("downloader = ?", downloader).Where("state >= ?", DownloadSeeding).Where("move_state = ?", UnMoved).Find(&ss).Error
+	done := db.Where("state IN ?", finishedStates).Or("state = ? AND completed_at IS NOT NULL", DownloadPaused)
+	err := db.Where("downloader = ?", downloader).Where(done).Where("move_state = ?", UnMoved).Find(&ss).Error
 	return ss, err
 }
 
@@ -120,6 +217,14 @@ func GetStoppedMovedDownloadStatusByDownloader(db *gorm.DB, downloader string) (
 	return ss, err
 }
 
+// GetPrivateCompletedDownloadStatusByDownloader returns completed downloads
+// of private indexers not deleted, for hit-and-run protection.
+func GetPrivateCompletedDownloadStatusByDownloader(db *gorm.DB, downloader string) ([]DownloadStatus, error) {
+	var ss []DownloadStatus
+	err := db.Where("downloader = ?", downloader).Where("private = ?", true).Where("completed_at IS NOT NULL").Where("state != ?", DownloadDeleted).Find(&ss).Error
+	return ss, err
+}
+
 func GetMovedAndOrganizeStateDownloadStatusByDownloader(db *gorm.DB, downloader string, organizeState OrganizeState) ([]DownloadStatus, error) {
 	var ss []DownloadStatus
 	err := db.Where("downloader = ?", downloader).Where("state != ?", DownloadDeleted).Where("move_state = ?", Moved).Where("organize_state = ?", organizeState).Find(&ss).Error
@@ -132,6 +237,32 @@ func GetDownloadStatus(db *gorm.DB, hash string) (*DownloadStatus, error) {
 	return s, err
 }
 
+// FindDownloadStatusByIDPrefix finds download statuses whose hash starts with
+// prefix, at most limit of them.
+func FindDownloadStatusByIDPrefix(db *gorm.DB, prefix string, limit int) ([]DownloadStatus, error) {
+	var ss []DownloadStatus
+	err := db.Where("id LIKE ?", prefix+"%").Limit(limit).Find(&ss).Error
+	return ss, err
+}
+
+// GetRecentCompletedDownloadStatuses returns the latest completed downloads
+// of all downloaders, by completion time. Seeding updates other columns of
+// completed downloads.
+func GetRecentCompletedDownloadStatuses(db *gorm.DB, limit int) ([]DownloadStatus, error) {
+	var ss []DownloadStatus
+	err := db.Where("state IN ?", finishedStates).
+		Order("completed_at IS NULL").Order("completed_at DESC").Order("updated_at DESC").Limit(limit).Find(&ss).Error
+	return ss, err
+}
+
+// GetRecentOrganizedDownloadStatuses returns the latest organized downloads
+// of all downloaders.
+func GetRecentOrganizedDownloadStatuses(db *gorm.DB, limit int) ([]DownloadStatus, error) {
+	var ss []DownloadStatus
+	err := db.Where("organize_state = ?", Organized).Order("updated_at DESC").Limit(limit).Find(&ss).Error
+	return ss, err
+}
+
 func SaveDownloadStatus(db *gorm.DB, s *DownloadStatus) error {
 	return db.Save(s).Error
 }
@@ -144,6 +275,61 @@ func UpdateDownloadStateForStatuses(db *gorm.DB, ids []string, state DownloadSta
 	return db.Model(&DownloadStatus{}).Where("id IN ?", ids).Update("state", state).Error
 }
 
+// UpdateDownloadStateFrom updates state of the status, only if it is in one of
+// from states.
+func UpdateDownloadStateFrom(db *gorm.DB, id string, from []DownloadState, state DownloadState) error {
+	return db.Model(&DownloadStatus{}).Where("id = ?", id).Where("state IN ?", from).Update("state", state).Error
+}
+
+// UpdateMoveProgress saves only the move progress, the status is saved by
+// other checks meanwhile.
+func UpdateMoveProgress(db *gorm.DB, id string, progress uint16) error {
+	return db.Model(&DownloadStatus{}).Where("id = ?", id).Update("move_progress", progress).Error
+}
+
+// SetMoved marks files of the status transferred to the finished dir.
+func SetMoved(db *gorm.DB, id string, files []string) error {
+	return db.Model(&DownloadStatus{ID: id}).
+		Select("move_state", "move_progress", "file_list", "transfer_attempts", "transfer_error", "transfer_failed_at").
+		Updates(&DownloadStatus{MoveState: Moved, MoveProgress: 1000, FileList: files}).Error
+}
+
+// SetTransferFailed counts a failed transfer of the status to the finished
+// dir.
+func SetTransferFailed(db *gorm.DB, id string, msg string, at time.Time) error {
+	return db.Model(&DownloadStatus{}).Where("id = ?", id).Updates(map[string]any{
+		"transfer_attempts":  gorm.Expr("transfer_attempts + 1"),
+		"transfer_error":     msg,
+		"transfer_failed_at": at,
+	}).Error
+}
+
+// UpdateSeedTime saves only hit-and-run tracking of the status, transfer
+// workers update the status meanwhile.
+func UpdateSeedTime(db *gorm.DB, s *DownloadStatus) error {
+	return db.Model(&DownloadStatus{ID: s.ID}).Select("seed_time", "hit_and_run_notified").
+		Updates(&DownloadStatus{SeedTime: s.SeedTime, HitAndRunNotified: s.HitAndRunNotified}).Error
+}
+
+// UpdateUploadHistories saves only upload histories and completion time of
+// the status.
+func UpdateUploadHistories(db *gorm.DB, s *DownloadStatus) error {
+	return db.Model(&DownloadStatus{ID: s.ID}).Select("upload_histories", "completed_at").
+		Updates(&DownloadStatus{UploadHistories: s.UploadHistories, CompletedAt: s.CompletedAt}).Error
+}
+
+// SetStalled saves when the download was found stalled.
+func SetStalled(db *gorm.DB, id string, at time.Time) error {
+	return db.Model(&DownloadStatus{}).Where("id = ?", id).Update("stalled_at", at).Error
+}
+
+// SetReplaceSearched marks the stalled download searched for a replacement,
+// replacement is the grabbed "indexer/id" if any.
+func SetReplaceSearched(db *gorm.DB, id string, replacement string) error {
+	return db.Model(&DownloadStatus{}).Where("id = ?", id).Select("replace_searched", "replacement").
+		Updates(&DownloadStatus{ReplaceSearched: true, Replacement: replacement}).Error
+}
+
 type DownloaderStateCounts struct {
 	CountOfDownloading int64 `json:"count_of_downloading"`
 	CountOfPlanned     int64 `json:"count_of_planned"`
@@ -153,8 +339,8 @@ type DownloaderStateCounts struct {
 func GetDownloaderStateCounts(db *gorm.DB, downloader string) (*DownloaderStateCounts, error) {
 	counts := &DownloaderStateCounts{}
 
-	// Count downloading (DownloadStarted AND not moved to organized states yet)
-	err := db.Model(&DownloadStatus{}).Where("downloader = ?", downloader).Where("state = ?", DownloadStarted).Where("move_state != ?", Moved).Count(&counts.CountOfDownloading).Error
+	// Count downloading (DownloadStarted or DownloadPaused AND not moved to organized states yet)
+	err := db.Model(&DownloadStatus{}).Where("downloader = ?", downloader).Where("state IN ?", unfinishedStates).Where("move_state != ?", Moved).Count(&counts.CountOfDownloading).Error
 	if err != nil {
 		return nil, err
 	}
@@ -281,3 +281,226 @@ func TestGetAllDownloadersStateCounts(t *testing.T) {
 	require.NoError(t, err)
 	assert.Len(t, emptyResult, 0)
 }
+
+func TestFindDownloadStatusByIDPrefix(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	require.NoError(t, db.Create(&DownloadStatus{ID: "abc123"}).Error)
+	require.NoError(t, db.Create(&DownloadStatus{ID: "abc456"}).Error)
+	require.NoError(t, db.Create(&DownloadStatus{ID: "def789"}).Error)
+
+	got, err := FindDownloadStatusByIDPrefix(db, "abc", 5)
+	require.NoError(t, err)
+	assert.Len(t, got, 2)
+
+	got, err = FindDownloadStatusByIDPrefix(db, "def", 5)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "def789", got[0].ID)
+
+	got, err = FindDownloadStatusByIDPrefix(db, "abc", 1)
+	require.NoError(t, err)
+	assert.Len(t, got, 1)
+
+	got, err = FindDownloadStatusByIDPrefix(db, "xyz", 5)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestPausedDownloadStatus(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	require.NoError(t, db.Create(&DownloadStatus{ID: "started", Downloader: "d", State: DownloadStarted}).Error)
+	require.NoError(t, db.Create(&DownloadStatus{ID: "paused", Downloader: "d", State: DownloadPaused}).Error)
+	require.NoError(t, db.Create(&DownloadStatus{ID: "seeding", Downloader: "d", State: DownloadSeeding}).Error)
+
+	ids := func(ss []DownloadStatus) []string {
+		got := []string{}
+		for _, s := range ss {
+			got = append(got, s.ID)
+		}
+		return got
+	}
+
+	// paused downloads are unfinished.
+	got, err := GetUnfinishedDownloadStatusByDownloader(db, "d")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"started", "paused"}, ids(got))
+
+	got, err = GetFinishedUnmoveedDownloadStatusByDownloader(db, "d")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"seeding"}, ids(got))
+
+	got, err = GetRecentCompletedDownloadStatuses(db, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"seeding"}, ids(got))
+
+	counts, err := GetDownloaderStateCounts(db, "d")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), counts.CountOfDownloading)
+}
+
+func TestTrackedDownloadStatus(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	for _, s := range []*DownloadStatus{
+		{ID: "started", Downloader: "d", State: DownloadStarted},
+		{ID: "paused", Downloader: "d", State: DownloadPaused},
+		{ID: "seeding", Downloader: "d", State: DownloadSeeding},
+		{ID: "stopped", Downloader: "d", State: DownloadStopped},
+		{ID: "deleted", Downloader: "d", State: DownloadDeleted},
+		{ID: "missing", Downloader: "d", State: DownloadMissing},
+		{ID: "queued", Downloader: "d", State: DownloadQueued},
+		{ID: "other", Downloader: "other", State: DownloadSeeding},
+	} {
+		require.NoError(t, db.Create(s).Error)
+	}
+
+	got, err := GetTrackedDownloadStatusByDownloader(db, "d")
+	require.NoError(t, err)
+	ids := []string{}
+	for _, s := range got {
+		ids = append(ids, s.ID)
+	}
+	assert.ElementsMatch(t, []string{"started", "paused", "seeding", "stopped"}, ids)
+}
+
+func TestQueuedDownloadStatus(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	for _, s := range []*DownloadStatus{
+		{ID: "started", Downloader: "d", State: DownloadStarted},
+		{ID: "paused", Downloader: "d", State: DownloadPaused},
+		{ID: "second", Downloader: "d", State: DownloadQueued, QueuePosition: 2},
+		{ID: "first", Downloader: "d", State: DownloadQueued, QueuePosition: 1, AddOptions: &AddOptions{Labels: []string{"tv"}}},
+		{ID: "high", Downloader: "d", State: DownloadQueued, QueuePosition: 3, QueuePriority: 1},
+		{ID: "other", Downloader: "other", State: DownloadQueued},
+	} {
+		require.NoError(t, db.Create(s).Error)
+	}
+
+	got, err := GetQueuedDownloadStatusByDownloader(db, "d")
+	require.NoError(t, err)
+	ids := []string{}
+	for _, s := range got {
+		ids = append(ids, s.ID)
+	}
+	assert.Equal(t, []string{"high", "first", "second"}, ids)
+	assert.Equal(t, &AddOptions{Labels: []string{"tv"}}, got[1].AddOptions)
+
+	n, err := CountActiveDownloads(db, "d")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestStalledUnsearchedDownloadStatus(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	now := time.Now()
+	for _, s := range []*DownloadStatus{
+		{ID: "active", Downloader: "d", State: DownloadStarted},
+		{ID: "stalled", Downloader: "d", State: DownloadStarted, StalledAt: &now},
+		{ID: "removed", Downloader: "d", State: DownloadDeleted, StalledAt: &now},
+		{ID: "searched", Downloader: "d", State: DownloadDeleted, StalledAt: &now, ReplaceSearched: true},
+		{ID: "other", Downloader: "other", State: DownloadStarted, StalledAt: &now},
+	} {
+		require.NoError(t, db.Create(s).Error)
+	}
+
+	got, err := GetStalledUnsearchedDownloadStatusByDownloader(db, "d")
+	require.NoError(t, err)
+	ids := []string{}
+	for _, s := range got {
+		ids = append(ids, s.ID)
+	}
+	assert.ElementsMatch(t, []string{"stalled", "removed"}, ids)
+
+	// only replacement columns are written.
+	require.NoError(t, db.Model(&DownloadStatus{}).Where("id = ?", "removed").Update("move_state", Moved).Error)
+	require.NoError(t, SetReplaceSearched(db, "removed", "nyaa/1"))
+	r, err := GetDownloadStatus(db, "removed")
+	require.NoError(t, err)
+	assert.True(t, r.ReplaceSearched)
+	assert.Equal(t, "nyaa/1", r.Replacement)
+	assert.Equal(t, Moved, r.MoveState)
+	assert.Equal(t, DownloadDeleted, r.State)
+}
+
+func TestSeedingColumnUpdates(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&DownloadStatus{ID: "1", State: DownloadSeeding, HitAndRunNotified: true}).Error)
+
+	// loaded before the transfer finished.
+	stale, err := GetDownloadStatus(db, "1")
+	require.NoError(t, err)
+	require.NoError(t, SetMoved(db, "1", []string{"a.mkv"}))
+
+	stale.SeedTime = time.Hour
+	stale.HitAndRunNotified = false
+	require.NoError(t, UpdateSeedTime(db, stale))
+	now := time.Now()
+	stale.UploadHistories = map[string]int64{"2024-01-01": 10}
+	stale.CompletedAt = &now
+	require.NoError(t, UpdateUploadHistories(db, stale))
+
+	r, err := GetDownloadStatus(db, "1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, r.SeedTime)
+	assert.False(t, r.HitAndRunNotified)
+	assert.Equal(t, map[string]int64{"2024-01-01": 10}, r.UploadHistories)
+	assert.NotNil(t, r.CompletedAt)
+	assert.Equal(t, Moved, r.MoveState)
+	assert.Equal(t, uint16(1000), r.MoveProgress)
+	assert.Equal(t, []string{"a.mkv"}, r.FileList)
+}
+
+func TestSetTransferFailed(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&DownloadStatus{ID: "1", State: DownloadSeeding}).Error)
+
+	at := time.Now()
+	require.NoError(t, SetTransferFailed(db, "1", "disk full", at))
+	require.NoError(t, SetTransferFailed(db, "1", "permission denied", at))
+	r, err := GetDownloadStatus(db, "1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, r.TransferAttempts)
+	assert.Equal(t, "permission denied", r.TransferError)
+	require.NotNil(t, r.TransferFailedAt)
+
+	// cleared once moved.
+	require.NoError(t, SetMoved(db, "1", []string{"a.mkv"}))
+	r, err = GetDownloadStatus(db, "1")
+	require.NoError(t, err)
+	assert.Zero(t, r.TransferAttempts)
+	assert.Empty(t, r.TransferError)
+	assert.Nil(t, r.TransferFailedAt)
+	assert.Equal(t, Moved, r.MoveState)
+}
+
+func TestGetRecentCompletedDownloadStatuses(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	older := time.Now().Add(-2 * time.Hour)
+	newer := time.Now().Add(-time.Hour)
+	require.NoError(t, db.Create(&DownloadStatus{ID: "newer", State: DownloadSeeding, CompletedAt: &newer}).Error)
+	require.NoError(t, db.Create(&DownloadStatus{ID: "unknown", State: DownloadStopped}).Error)
+	require.NoError(t, db.Create(&DownloadStatus{ID: "older", State: DownloadSeeding, CompletedAt: &older}).Error)
+	// seeding updates the older one last.
+	require.NoError(t, UpdateSeedTime(db, &DownloadStatus{ID: "older", SeedTime: time.Hour}))
+
+	got, err := GetRecentCompletedDownloadStatuses(db, 10)
+	require.NoError(t, err)
+	ids := []string{}
+	for _, s := range got {
+		ids = append(ids, s.ID)
+	}
+	assert.Equal(t, []string{"newer", "older", "unknown"}, ids)
+}
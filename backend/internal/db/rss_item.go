@@ -0,0 +1,65 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RSSItem is an item pulled from the RSS feed of an indexer.
+type RSSItem struct {
+	Indexer     string    `gorm:"primaryKey" json:"indexer"`
+	ResID       string    `gorm:"primaryKey" json:"res_id"`
+	Title       string    `json:"title"`
+	Category    string    `json:"category"`
+	URL         string    `json:"url"`
+	FirstSeenAt time.Time `gorm:"index" json:"first_seen_at"`
+}
+
+func (i *RSSItem) TableName() string {
+	return "rss_items"
+}
+
+// AddRSSItems stores items, the ones seen before are kept as is.
+func AddRSSItems(db *gorm.DB, items []*RSSItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(items).Error
+}
+
+// ListRSSItems lists items latest first, optionally filtered by indexer and
+// keyword in title. page starts from 1.
+func ListRSSItems(db *gorm.DB, indexer string, keyword string, page int, pageSize int) ([]RSSItem, int64, error) {
+	query := db.Model(&RSSItem{})
+	if indexer != "" {
+		query = query.Where("indexer = ?", indexer)
+	}
+	if keyword != "" {
+		query = query.Where("LOWER(title) LIKE ?", "%"+strings.ToLower(keyword)+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var items []RSSItem
+	err := query.Order("first_seen_at DESC, res_id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&items).Error
+	return items, total, err
+}
+
+// GetRSSItemsSince returns items of the indexer first seen after since,
+// latest first.
+func GetRSSItemsSince(db *gorm.DB, indexer string, since time.Time) ([]RSSItem, error) {
+	var items []RSSItem
+	err := db.Where("indexer = ? AND first_seen_at > ?", indexer, since).Order("first_seen_at DESC, res_id DESC").Find(&items).Error
+	return items, err
+}
+
+func DeleteRSSItemsBefore(db *gorm.DB, before time.Time) (int64, error) {
+	result := db.Where("first_seen_at < ?", before).Delete(&RSSItem{})
+	return result.RowsAffected, result.Error
+}
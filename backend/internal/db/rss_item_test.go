@@ -0,0 +1,95 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddRSSItems(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	firstSeen := time.Now().Add(-time.Hour)
+	require.NoError(t, AddRSSItems(db, []*RSSItem{
+		{Indexer: "nyaa", ResID: "1", Title: "Title 1", FirstSeenAt: firstSeen},
+	}))
+	require.NoError(t, AddRSSItems(db, []*RSSItem{
+		{Indexer: "nyaa", ResID: "1", Title: "Title 1", FirstSeenAt: time.Now()},
+		{Indexer: "nyaa", ResID: "2", Title: "Title 2", FirstSeenAt: time.Now()},
+		{Indexer: "sukebei", ResID: "1", Title: "Other Title", FirstSeenAt: time.Now()},
+	}))
+	require.NoError(t, AddRSSItems(db, nil))
+
+	var count int64
+	require.NoError(t, db.Model(&RSSItem{}).Count(&count).Error)
+	assert.Equal(t, int64(3), count)
+
+	item := &RSSItem{}
+	require.NoError(t, db.First(item, "indexer = ? AND res_id = ?", "nyaa", "1").Error)
+	assert.True(t, firstSeen.Equal(item.FirstSeenAt))
+}
+
+func TestListRSSItems(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, AddRSSItems(db, []*RSSItem{
+		{Indexer: "nyaa", ResID: "1", Title: "Frieren 01", FirstSeenAt: now.Add(-3 * time.Hour)},
+		{Indexer: "nyaa", ResID: "2", Title: "Frieren 02", FirstSeenAt: now.Add(-2 * time.Hour)},
+		{Indexer: "nyaa", ResID: "3", Title: "Other 01", FirstSeenAt: now.Add(-time.Hour)},
+		{Indexer: "sukebei", ResID: "4", Title: "Frieren Other", FirstSeenAt: now},
+	}))
+
+	tests := []struct {
+		name      string
+		indexer   string
+		keyword   string
+		page      int
+		pageSize  int
+		wantIDs   []string
+		wantTotal int64
+	}{
+		{name: "all", page: 1, pageSize: 10, wantIDs: []string{"4", "3", "2", "1"}, wantTotal: 4},
+		{name: "by indexer", indexer: "nyaa", page: 1, pageSize: 10, wantIDs: []string{"3", "2", "1"}, wantTotal: 3},
+		{name: "by keyword", indexer: "nyaa", keyword: "FRIEREN", page: 1, pageSize: 10, wantIDs: []string{"2", "1"}, wantTotal: 2},
+		{name: "second page", page: 2, pageSize: 3, wantIDs: []string{"1"}, wantTotal: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, total, err := ListRSSItems(db, tt.indexer, tt.keyword, tt.page, tt.pageSize)
+			require.NoError(t, err)
+			ids := []string{}
+			for _, i := range items {
+				ids = append(ids, i.ResID)
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+			assert.Equal(t, tt.wantTotal, total)
+		})
+	}
+}
+
+func TestGetRSSItemsSinceAndDeleteBefore(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, AddRSSItems(db, []*RSSItem{
+		{Indexer: "nyaa", ResID: "old", FirstSeenAt: now.AddDate(0, 0, -40)},
+		{Indexer: "nyaa", ResID: "new", FirstSeenAt: now.Add(-time.Hour)},
+		{Indexer: "sukebei", ResID: "other", FirstSeenAt: now.Add(-time.Hour)},
+	}))
+
+	items, err := GetRSSItemsSince(db, "nyaa", now.AddDate(0, 0, -30))
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "new", items[0].ResID)
+
+	count, err := DeleteRSSItemsBefore(db, now.AddDate(0, 0, -30))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
@@ -1,7 +1,9 @@
 package db
 
 import (
+	"slices"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -17,12 +19,64 @@ type RSSSearch struct {
 	Title     string `gorm:"title"`
 	Catergory string `gorm:"category"`
 	URL       string `gorm:"url"`
+
+	// ResIDs the user ignored, they won't match this search again.
+	IgnoredResIDs []string `gorm:"serializer:json"`
+
+	// ExpiresAt is optional, expired searches are disabled.
+	ExpiresAt *time.Time
+	// MaxMatches is how many items the search matches before it stops,
+	// 0 means 1.
+	MaxMatches    uint
+	MatchCount    uint
+	MatchedResIDs []string `gorm:"serializer:json"`
+	LastMatchedAt *time.Time
+	Disabled      bool
 }
 
 func (s *RSSSearch) TableName() string {
 	return "rss_search"
 }
 
+// matches returns how many items the search matched. Searches created before
+// match counting only have the ResID of their single match.
+func (s *RSSSearch) matches() uint {
+	if s.MatchCount == 0 && s.ResID != "" {
+		return 1
+	}
+	return s.MatchCount
+}
+
+// Exhausted checks if the search reached MaxMatches.
+func (s *RSSSearch) Exhausted() bool {
+	return s.matches() >= max(s.MaxMatches, 1)
+}
+
+func (s *RSSSearch) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !s.ExpiresAt.After(now)
+}
+
+// Active checks if the search still looks for new items.
+func (s *RSSSearch) Active(now time.Time) bool {
+	return !s.Disabled && !s.Expired(now) && !s.Exhausted()
+}
+
+// Matched checks if resID was matched or ignored before.
+func (s *RSSSearch) Matched(resID string) bool {
+	return s.ResID == resID || slices.Contains(s.MatchedResIDs, resID) || slices.Contains(s.IgnoredResIDs, resID)
+}
+
+// RecordMatch stores item as the latest match of the search.
+func (s *RSSSearch) RecordMatch(resID, title, category, url string, now time.Time) {
+	s.MatchCount = s.matches() + 1
+	s.MatchedResIDs = append(s.MatchedResIDs, resID)
+	s.LastMatchedAt = &now
+	s.ResID = resID
+	s.Title = title
+	s.Catergory = category
+	s.URL = url
+}
+
 func GetSearchsByIndexer(db *gorm.DB, indexer string) ([]*RSSSearch, error) {
 	var searchs []*RSSSearch
 	err := db.Where("indexer = ?", indexer).Find(&searchs).Error
@@ -32,6 +86,12 @@ func GetSearchsByIndexer(db *gorm.DB, indexer string) ([]*RSSSearch, error) {
 	return searchs, nil
 }
 
+func GetSearch(db *gorm.DB, id uint) (*RSSSearch, error) {
+	search := &RSSSearch{}
+	err := db.First(search, id).Error
+	return search, err
+}
+
 func AddSearch(db *gorm.DB, search *RSSSearch) error {
 	search.Text = strings.ToLower(search.Text)
 	return db.Create(search).Error
@@ -44,3 +104,80 @@ func UpdateSearch(db *gorm.DB, search *RSSSearch) error {
 func DeleteSearch(db *gorm.DB, id uint) error {
 	return db.Delete(&RSSSearch{}, id).Error
 }
+
+// IgnoreSearchMatch forgets the match resID of the search, the latest match
+// if empty, and keeps watching for other items.
+func IgnoreSearchMatch(db *gorm.DB, id uint, resID string) error {
+	search, err := GetSearch(db, id)
+	if err != nil {
+		return err
+	}
+	if resID == "" {
+		resID = search.ResID
+	}
+	if resID == "" || slices.Contains(search.IgnoredResIDs, resID) {
+		return nil
+	}
+
+	search.IgnoredResIDs = append(search.IgnoredResIDs, resID)
+	// ignored match doesn't count toward MaxMatches. Searches created before
+	// match counting only have the ResID of their single match.
+	if i := slices.Index(search.MatchedResIDs, resID); i >= 0 || resID == search.ResID {
+		if count := search.matches(); count > 0 {
+			search.MatchCount = count - 1
+		}
+		if i >= 0 {
+			search.MatchedResIDs = slices.Delete(search.MatchedResIDs, i, i+1)
+		}
+	}
+	if resID == search.ResID {
+		search.ResID = ""
+		search.Title = ""
+		search.Catergory = ""
+		search.URL = ""
+	}
+	return UpdateSearch(db, search)
+}
+
+// DisableExpiredSearches disables searches expired before now.
+func DisableExpiredSearches(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Model(&RSSSearch{}).
+		Where("disabled = ? AND expires_at IS NOT NULL AND expires_at <= ?", false, now).
+		Update("disabled", true)
+	return result.RowsAffected, result.Error
+}
+
+// GetStaleSearches returns enabled searches with no match since before.
+func GetStaleSearches(db *gorm.DB, before time.Time) ([]*RSSSearch, error) {
+	var searchs []*RSSSearch
+	err := db.Where("disabled = ?", false).
+		Where("(last_matched_at IS NULL AND created_at < ?) OR last_matched_at < ?", before, before).
+		Order("indexer, id").
+		Find(&searchs).Error
+	if err != nil {
+		return nil, err
+	}
+	return searchs, nil
+}
+
+// GetRecentMatchedSearches returns the latest matched searches, including
+// the ones deleted after download.
+func GetRecentMatchedSearches(db *gorm.DB, limit int) ([]*RSSSearch, error) {
+	var searchs []*RSSSearch
+	err := db.Unscoped().Where("res_id != ?", "").Order("updated_at DESC").Limit(limit).Find(&searchs).Error
+	if err != nil {
+		return nil, err
+	}
+	return searchs, nil
+}
+
+// GetPendingMatchedSearches returns notification-only searches whose match
+// waits for the user to decide.
+func GetPendingMatchedSearches(db *gorm.DB, limit int) ([]*RSSSearch, error) {
+	var searchs []*RSSSearch
+	err := db.Where("action = ? AND res_id != ?", "notification", "").Order("updated_at DESC").Limit(limit).Find(&searchs).Error
+	if err != nil {
+		return nil, err
+	}
+	return searchs, nil
+}
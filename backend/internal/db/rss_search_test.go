@@ -2,6 +2,7 @@ package db
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -79,3 +80,179 @@ func TestDeleteSearch(t *testing.T) {
 	err = DeleteSearch(db, 999) // Assuming 999 is a non-existent ID
 	assert.NoError(t, err)
 }
+
+func TestIgnoreSearchMatch(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	search := &RSSSearch{
+		Indexer:   "indexer",
+		Text:      "text",
+		Action:    "notification",
+		ResID:     "123",
+		Title:     "Some Title",
+		Catergory: "Some Category",
+		URL:       "http://test.com/123",
+	}
+	require.NoError(t, db.Create(search).Error)
+
+	require.NoError(t, IgnoreSearchMatch(db, search.ID, ""))
+
+	got, err := GetSearch(db, search.ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.ResID)
+	assert.Empty(t, got.Title)
+	assert.Empty(t, got.Catergory)
+	assert.Empty(t, got.URL)
+	assert.Equal(t, []string{"123"}, got.IgnoredResIDs)
+	assert.True(t, got.Active(time.Now()))
+
+	// search not found
+	assert.ErrorIs(t, IgnoreSearchMatch(db, 999, ""), gorm.ErrRecordNotFound)
+}
+
+func TestIgnoreOlderSearchMatch(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	now := time.Now()
+	search := &RSSSearch{Indexer: "indexer", Text: "text", Action: "notification", MaxMatches: 3}
+	search.RecordMatch("1", "Title 1", "Category", "http://test.com/1", now)
+	search.RecordMatch("2", "Title 2", "Category", "http://test.com/2", now)
+	require.NoError(t, db.Create(search).Error)
+
+	require.NoError(t, IgnoreSearchMatch(db, search.ID, "1"))
+	// ignored once.
+	require.NoError(t, IgnoreSearchMatch(db, search.ID, "1"))
+
+	got, err := GetSearch(db, search.ID)
+	require.NoError(t, err)
+	// the latest match is kept.
+	assert.Equal(t, "2", got.ResID)
+	assert.Equal(t, "Title 2", got.Title)
+	assert.Equal(t, uint(1), got.MatchCount)
+	assert.Equal(t, []string{"2"}, got.MatchedResIDs)
+	assert.Equal(t, []string{"1"}, got.IgnoredResIDs)
+}
+
+func TestRSSSearchActive(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		search RSSSearch
+		want   bool
+	}{
+		{name: "new", search: RSSSearch{}, want: true},
+		{name: "disabled", search: RSSSearch{Disabled: true}, want: false},
+		{name: "expired", search: RSSSearch{ExpiresAt: &past}, want: false},
+		{name: "not expired", search: RSSSearch{ExpiresAt: &future}, want: true},
+		{name: "matched once", search: RSSSearch{MatchCount: 1}, want: false},
+		{name: "legacy matched", search: RSSSearch{ResID: "123"}, want: false},
+		{name: "below max matches", search: RSSSearch{MaxMatches: 3, MatchCount: 2}, want: true},
+		{name: "reached max matches", search: RSSSearch{MaxMatches: 3, MatchCount: 3}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.search.Active(now))
+		})
+	}
+}
+
+func TestRSSSearchRecordMatch(t *testing.T) {
+	now := time.Now()
+	search := &RSSSearch{MaxMatches: 2}
+
+	search.RecordMatch("1", "Title 1", "Category", "http://test.com/1", now)
+	assert.False(t, search.Exhausted())
+	assert.True(t, search.Matched("1"))
+	assert.False(t, search.Matched("2"))
+
+	search.RecordMatch("2", "Title 2", "Category", "http://test.com/2", now)
+	assert.True(t, search.Exhausted())
+	assert.Equal(t, uint(2), search.MatchCount)
+	assert.Equal(t, []string{"1", "2"}, search.MatchedResIDs)
+	assert.Equal(t, "2", search.ResID)
+	assert.Equal(t, "Title 2", search.Title)
+	assert.Equal(t, &now, search.LastMatchedAt)
+}
+
+func TestDisableExpiredSearches(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	expired := &RSSSearch{Indexer: "indexer", Text: "expired", ExpiresAt: &past}
+	notExpired := &RSSSearch{Indexer: "indexer", Text: "not expired", ExpiresAt: &future}
+	noExpiry := &RSSSearch{Indexer: "indexer", Text: "no expiry"}
+	require.NoError(t, db.Create(expired).Error)
+	require.NoError(t, db.Create(notExpired).Error)
+	require.NoError(t, db.Create(noExpiry).Error)
+
+	count, err := DisableExpiredSearches(db, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	for _, s := range []*RSSSearch{expired, notExpired, noExpiry} {
+		got, err := GetSearch(db, s.ID)
+		require.NoError(t, err)
+		assert.Equal(t, s == expired, got.Disabled, s.Text)
+	}
+}
+
+func TestGetStaleSearches(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	now := time.Now()
+	before := now.Add(-30 * 24 * time.Hour)
+	old := before.Add(-time.Hour)
+	recent := before.Add(time.Hour)
+
+	searchs := []*RSSSearch{
+		{Indexer: "indexer", Text: "old never matched", Model: gorm.Model{CreatedAt: old}},
+		{Indexer: "indexer", Text: "new never matched", Model: gorm.Model{CreatedAt: recent}},
+		{Indexer: "indexer", Text: "matched long ago", Model: gorm.Model{CreatedAt: old}, LastMatchedAt: &old},
+		{Indexer: "indexer", Text: "matched recently", Model: gorm.Model{CreatedAt: old}, LastMatchedAt: &recent},
+		{Indexer: "indexer", Text: "disabled", Model: gorm.Model{CreatedAt: old}, Disabled: true},
+	}
+	for _, s := range searchs {
+		require.NoError(t, db.Create(s).Error)
+	}
+
+	got, err := GetStaleSearches(db, before)
+	require.NoError(t, err)
+	texts := []string{}
+	for _, s := range got {
+		texts = append(texts, s.Text)
+	}
+	assert.Equal(t, []string{"old never matched", "matched long ago"}, texts)
+}
+
+func TestGetMatchedSearches(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	notMatched := &RSSSearch{Indexer: "indexer", Text: "not matched", Action: "notification"}
+	pending := &RSSSearch{Indexer: "indexer", Text: "pending", Action: "notification", ResID: "1"}
+	downloaded := &RSSSearch{Indexer: "indexer", Text: "downloaded", Action: "download", ResID: "2"}
+	for _, s := range []*RSSSearch{notMatched, pending, downloaded} {
+		require.NoError(t, db.Create(s).Error)
+	}
+	require.NoError(t, DeleteSearch(db, downloaded.ID))
+
+	matched, err := GetRecentMatchedSearches(db, 10)
+	require.NoError(t, err)
+	assert.Len(t, matched, 2)
+
+	pendings, err := GetPendingMatchedSearches(db, 10)
+	require.NoError(t, err)
+	require.Len(t, pendings, 1)
+	assert.Equal(t, "pending", pendings[0].Text)
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TorrentFile keeps the .torrent of a download, to add it again if it is gone
+// from the downloader.
+type TorrentFile struct {
+	ID        string `gorm:"primarykey"` // hash
+	CreatedAt time.Time
+	Data      []byte
+}
+
+func (f *TorrentFile) TableName() string {
+	return "torrent_files"
+}
+
+func SaveTorrentFile(db *gorm.DB, id string, data []byte) error {
+	return db.Save(&TorrentFile{ID: id, Data: data}).Error
+}
+
+func GetTorrentFile(db *gorm.DB, id string) ([]byte, error) {
+	f := &TorrentFile{}
+	if err := db.First(f, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return f.Data, nil
+}
+
+// TorrentFileIDs returns which of ids have a stored .torrent.
+func TorrentFileIDs(db *gorm.DB, ids []string) (map[string]bool, error) {
+	var found []string
+	if err := db.Model(&TorrentFile{}).Where("id IN ?", ids).Pluck("id", &found).Error; err != nil {
+		return nil, err
+	}
+	m := map[string]bool{}
+	for _, id := range found {
+		m[id] = true
+	}
+	return m, nil
+}
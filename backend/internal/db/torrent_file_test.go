@@ -0,0 +1,29 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestTorrentFile(t *testing.T) {
+	db, err := SqliteForTest()
+	require.NoError(t, err)
+
+	require.NoError(t, SaveTorrentFile(db, "1", []byte("torrent 1")))
+	// replaced when added again.
+	require.NoError(t, SaveTorrentFile(db, "1", []byte("torrent 1 again")))
+
+	data, err := GetTorrentFile(db, "1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("torrent 1 again"), data)
+
+	_, err = GetTorrentFile(db, "2")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	ids, err := TorrentFileIDs(db, []string{"1", "2"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"1": true}, ids)
+}
@@ -0,0 +1,94 @@
+// Package events is an in-process bus of download events, streamed to the
+// frontend.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Types of events.
+const (
+	DownloadAdded     = "added"
+	DownloadProgress  = "progress"
+	DownloadCompleted = "completed"
+	DownloadMoved     = "moved"
+	DownloadPlanned   = "planned"
+	DownloadOrganized = "organized"
+	DownloadFailed    = "failed"
+	DownloadDeleted   = "deleted"
+	DownloadStalled   = "stalled"
+)
+
+// subscriberBuffer is events kept for a slow subscriber, newer ones are
+// dropped for it.
+const subscriberBuffer = 64
+
+type Event struct {
+	Type       string `json:"type"`
+	Downloader string `json:"downloader,omitempty"`
+	// ID is the download status ID, the torrent hash.
+	ID    string `json:"id,omitempty"`
+	Title string `json:"title,omitempty"`
+	// Progress in x/1000, for progress events.
+	Progress uint16    `json:"progress,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Bus fans out events to subscribers. A nil Bus drops events.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	ch         chan Event
+	downloader string
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[*subscriber]struct{}{}}
+}
+
+// Publish sends e to subscribers without blocking.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		if s.downloader != "" && s.downloader != e.Downloader {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns events of downloader, all if empty, until cancel is
+// called.
+func (b *Bus) Subscribe(downloader string) (<-chan Event, func()) {
+	s := &subscriber{ch: make(chan Event, subscriberBuffer), downloader: downloader}
+
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, s)
+			b.mu.Unlock()
+			close(s.ch)
+		})
+	}
+}
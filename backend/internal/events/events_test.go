@@ -0,0 +1,43 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+
+	all, cancelAll := b.Subscribe("")
+	defer cancelAll()
+	tr, cancelTr := b.Subscribe("transmission")
+
+	b.Publish(Event{Type: DownloadAdded, Downloader: "transmission", ID: "1"})
+	b.Publish(Event{Type: DownloadAdded, Downloader: "qbittorrent", ID: "2"})
+
+	e := <-all
+	assert.Equal(t, "1", e.ID)
+	assert.False(t, e.Time.IsZero())
+	assert.Equal(t, "2", (<-all).ID)
+	assert.Equal(t, "1", (<-tr).ID)
+	assert.Empty(t, tr)
+
+	// cancelled subscribers are closed and get nothing.
+	cancelTr()
+	cancelTr()
+	b.Publish(Event{Type: DownloadDeleted, Downloader: "transmission", ID: "1"})
+	_, ok := <-tr
+	assert.False(t, ok)
+	assert.Equal(t, DownloadDeleted, (<-all).Type)
+
+	// slow subscribers drop events instead of blocking.
+	for range subscriberBuffer + 1 {
+		b.Publish(Event{Type: DownloadProgress})
+	}
+	require.Len(t, all, subscriberBuffer)
+
+	var nilBus *Bus
+	nilBus.Publish(Event{Type: DownloadAdded})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/events"
+	"github.com/gin-gonic/gin"
+)
+
+// keepaliveInterval keeps idle event streams open through proxies.
+var keepaliveInterval = 30 * time.Second
+
+func (s *Service) publish(typ string, downloadStatus *db.DownloadStatus, errMsg string) {
+	s.bus.Publish(events.Event{
+		Type:       typ,
+		Downloader: downloadStatus.Downloader,
+		ID:         downloadStatus.ID,
+		Title:      downloadStatus.ResTitle,
+		Error:      errMsg,
+	})
+}
+
+// streamEvents streams download events as Server-Sent Events, optionally
+// only of the downloader in query.
+func (s *Service) streamEvents(c *gin.Context) {
+	if s.bus == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Events not available"})
+		return
+	}
+
+	downloader := c.Query("downloader")
+	if downloader != "" {
+		if _, ok := s.downloaders[downloader]; !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Downloader not found"})
+			return
+		}
+	}
+
+	ch, cancel := s.bus.Subscribe(downloader)
+	defer cancel()
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	// sends headers, the client is subscribed once it has them.
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case e := <-ch:
+			c.SSEvent(e.Type, e)
+		case <-keepalive.C:
+			io.WriteString(w, ": keepalive\n\n")
+		}
+		return true
+	})
+}
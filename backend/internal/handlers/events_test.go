@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/autoget-project/autoget/backend/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_streamEvents(t *testing.T) {
+	serv, router, _, _ := testSetup(t)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"/events?downloader=mock", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	serv.bus.Publish(events.Event{Type: events.DownloadProgress, Downloader: "other", ID: "bb"})
+	serv.bus.Publish(events.Event{Type: events.DownloadProgress, Downloader: "mock", ID: "aa", Progress: 500})
+
+	r := bufio.NewReader(resp.Body)
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "event:progress\n", line)
+	line, err = r.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(line, "data:"))
+
+	var e events.Event
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &e))
+	assert.Equal(t, "aa", e.ID)
+	assert.Equal(t, "mock", e.Downloader)
+	assert.Equal(t, uint16(500), e.Progress)
+}
+
+func TestService_streamEventsUnknownDownloader(t *testing.T) {
+	_, router, _, _ := testSetup(t)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/events?downloader=nonexistent", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
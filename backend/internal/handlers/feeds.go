@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/internal/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+const maxFeedEntries = 50
+
+type feedEntry struct {
+	ID      string
+	Title   string
+	Summary string
+	Link    string
+	Updated time.Time
+}
+
+type feed struct {
+	ID      string
+	Title   string
+	Link    string
+	Entries []feedEntry
+}
+
+var feedTitles = map[string]string{
+	config.FeedCompleted: "AutoGet completed downloads",
+	config.FeedOrganized: "AutoGet organized downloads",
+	config.FeedMatches:   "AutoGet subscription matches",
+	config.FeedPending:   "AutoGet pending notifications",
+}
+
+// feed serves the named feed as Atom, or RSS 2.0 with ?format=rss.
+// The token of the feed is passed by ?token= since feed readers rarely support
+// headers.
+func (s *Service) feed(c *gin.Context) {
+	name := c.Param("feed")
+	token, ok := s.config.Feeds[name]
+	if !ok {
+		c.JSON(404, gin.H{"error": "Feed not found"})
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.Query("token")), []byte(token)) != 1 {
+		c.JSON(401, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	entries, err := s.feedEntries(name)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	f := &feed{
+		ID:      "urn:autoget:feed:" + name,
+		Title:   feedTitles[name],
+		Link:    s.feedLink(c),
+		Entries: entries,
+	}
+
+	switch c.DefaultQuery("format", "atom") {
+	case "atom":
+		c.XML(200, toAtom(f))
+	case "rss":
+		c.XML(200, toRSS(f))
+	default:
+		c.JSON(400, gin.H{"error": "Invalid format"})
+	}
+}
+
+// feedLink is the absolute URL of the feed without token, under the
+// configured base URL, or the scheme and host the request came with.
+func (s *Service) feedLink(c *gin.Context) string {
+	if s.config.BaseURL != "" {
+		return strings.TrimSuffix(s.config.BaseURL, "/") + c.Request.URL.Path
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := c.Request.Host
+	if h := c.GetHeader("X-Forwarded-Host"); h != "" {
+		host = h
+	}
+	return (&url.URL{Scheme: scheme, Host: host, Path: c.Request.URL.Path}).String()
+}
+
+func (s *Service) feedEntries(name string) ([]feedEntry, error) {
+	switch name {
+	case config.FeedCompleted, config.FeedOrganized:
+		var statuses []db.DownloadStatus
+		var err error
+		if name == config.FeedCompleted {
+			statuses, err = db.GetRecentCompletedDownloadStatuses(s.db, maxFeedEntries)
+		} else {
+			statuses, err = db.GetRecentOrganizedDownloadStatuses(s.db, maxFeedEntries)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entries := []feedEntry{}
+		for _, st := range statuses {
+			entries = append(entries, downloadFeedEntry(name, &st))
+		}
+		return entries, nil
+	case config.FeedMatches, config.FeedPending:
+		var searchs []*db.RSSSearch
+		var err error
+		if name == config.FeedMatches {
+			searchs, err = db.GetRecentMatchedSearches(s.db, maxFeedEntries)
+		} else {
+			searchs, err = db.GetPendingMatchedSearches(s.db, maxFeedEntries)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entries := []feedEntry{}
+		for _, search := range searchs {
+			entries = append(entries, feedEntry{
+				ID:      fmt.Sprintf("urn:autoget:%s:%d:%s", name, search.ID, search.ResID),
+				Title:   search.Title,
+				Summary: fmt.Sprintf("[%s] %s matched \"%s\" (%s)", search.Indexer, search.Catergory, search.Text, search.Action),
+				Link:    search.URL,
+				Updated: search.UpdatedAt,
+			})
+		}
+		return entries, nil
+	}
+	return nil, fmt.Errorf("unknown feed: %s", name)
+}
+
+func downloadFeedEntry(name string, st *db.DownloadStatus) feedEntry {
+	summary := &strings.Builder{}
+	fmt.Fprintf(summary, "[%s] %s, %s, downloaded by %s", st.ResIndexer, st.Category, helpers.HumanSize(st.Size), st.Downloader)
+	if name == config.FeedOrganized && st.OrganizePlans != nil {
+		for _, a := range st.OrganizePlans.Plan {
+			if a.Target != "" {
+				fmt.Fprintf(summary, "\n%s -> %s", a.File, a.Target)
+			}
+		}
+	}
+
+	updated := st.UpdatedAt
+	if name == config.FeedCompleted && st.CompletedAt != nil {
+		updated = *st.CompletedAt
+	}
+	return feedEntry{
+		ID:      fmt.Sprintf("urn:autoget:%s:%s", name, st.ID),
+		Title:   st.ResTitle,
+		Summary: summary.String(),
+		Updated: updated,
+	}
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string    `xml:"id"`
+	Title   string    `xml:"title"`
+	Updated string    `xml:"updated"`
+	Summary string    `xml:"summary"`
+	Link    *atomLink `xml:"link,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func toAtom(f *feed) *atomFeed {
+	updated := time.Unix(0, 0)
+	entries := []atomEntry{}
+	for _, e := range f.Entries {
+		if e.Updated.After(updated) {
+			updated = e.Updated
+		}
+		entry := atomEntry{
+			ID:      e.ID,
+			Title:   e.Title,
+			Updated: e.Updated.UTC().Format(time.RFC3339),
+			Summary: e.Summary,
+		}
+		if e.Link != "" {
+			entry.Link = &atomLink{Href: e.Link}
+		}
+		entries = append(entries, entry)
+	}
+
+	return &atomFeed{
+		ID:      f.ID,
+		Title:   f.Title,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Link:    atomLink{Href: f.Link},
+		Entries: entries,
+	}
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	GUID        rssGUID `xml:"guid"`
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	Description string  `xml:"description"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+func toRSS(f *feed) *rssFeed {
+	items := []rssItem{}
+	for _, e := range f.Entries {
+		items = append(items, rssItem{
+			GUID:        rssGUID{Value: e.ID},
+			Title:       e.Title,
+			Link:        e.Link,
+			Description: e.Summary,
+			PubDate:     e.Updated.UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	return &rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.Link,
+			Description: f.Title,
+			Items:       items,
+		},
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/autoget-project/autoget/backend/internal/config"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/organizer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func feedSetup(t *testing.T) (*Service, http.Handler) {
+	t.Helper()
+
+	serv, router, _, testDB := testSetup(t)
+	serv.config = &config.Config{
+		Feeds: map[string]string{
+			config.FeedCompleted: "completed-token",
+			config.FeedOrganized: "organized-token",
+			config.FeedMatches:   "matches-token",
+			config.FeedPending:   "pending-token",
+		},
+	}
+
+	statuses := []*db.DownloadStatus{
+		{ID: "downloading", Downloader: "mock", State: db.DownloadStarted, ResTitle: "Downloading"},
+		{ID: "seeding", Downloader: "mock", State: db.DownloadSeeding, ResTitle: "Seeding", ResIndexer: "mock", Size: 2048},
+		{
+			ID: "organized", Downloader: "mock", State: db.DownloadStopped, ResTitle: "Organized",
+			MoveState: db.Moved, OrganizeState: db.Organized,
+			OrganizePlans: &organizer.PlanResponse{Plan: []organizer.PlanAction{{File: "a.mkv", Action: "move", Target: "/movies/a.mkv"}}},
+		},
+	}
+	for _, s := range statuses {
+		require.NoError(t, testDB.Create(s).Error)
+	}
+
+	searchs := []*db.RSSSearch{
+		{Indexer: "mock", Text: "pending", Action: "notification", ResID: "1", Title: "Pending Title", URL: "http://test.com/1"},
+		{Indexer: "mock", Text: "downloaded", Action: "download", ResID: "2", Title: "Downloaded Title"},
+		{Indexer: "mock", Text: "not matched", Action: "notification"},
+	}
+	for _, s := range searchs {
+		require.NoError(t, testDB.Create(s).Error)
+	}
+	require.NoError(t, db.DeleteSearch(testDB, searchs[1].ID))
+
+	return serv, router
+}
+
+func TestFeed(t *testing.T) {
+	tests := []struct {
+		feed       string
+		token      string
+		wantTitles []string
+	}{
+		{feed: config.FeedCompleted, token: "completed-token", wantTitles: []string{"Seeding", "Organized"}},
+		{feed: config.FeedOrganized, token: "organized-token", wantTitles: []string{"Organized"}},
+		{feed: config.FeedMatches, token: "matches-token", wantTitles: []string{"Pending Title", "Downloaded Title"}},
+		{feed: config.FeedPending, token: "pending-token", wantTitles: []string{"Pending Title"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.feed, func(t *testing.T) {
+			_, router := feedSetup(t)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/feeds/"+tt.feed+"?token="+tt.token, nil)
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var f atomFeed
+			require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &f))
+			assert.Equal(t, "urn:autoget:feed:"+tt.feed, f.ID)
+			titles := []string{}
+			for _, e := range f.Entries {
+				titles = append(titles, e.Title)
+			}
+			assert.ElementsMatch(t, tt.wantTitles, titles)
+		})
+	}
+}
+
+func TestFeed_Content(t *testing.T) {
+	_, router := feedSetup(t)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/feeds/organized?token=organized-token", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var atom atomFeed
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &atom))
+	require.Len(t, atom.Entries, 1)
+	assert.Equal(t, "urn:autoget:organized:organized", atom.Entries[0].ID)
+	assert.Contains(t, atom.Entries[0].Summary, "a.mkv -> /movies/a.mkv")
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/feeds/pending?token=pending-token&format=rss", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var rss rssFeed
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &rss))
+	assert.Equal(t, "2.0", rss.Version)
+	require.Len(t, rss.Channel.Items, 1)
+	assert.Equal(t, "Pending Title", rss.Channel.Items[0].Title)
+	assert.Equal(t, "http://test.com/1", rss.Channel.Items[0].Link)
+	assert.Contains(t, rss.Channel.Items[0].Description, `matched "pending"`)
+}
+
+func TestFeed_Link(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		header  map[string]string
+		want    string
+	}{
+		{
+			name: "request host",
+			want: "http://example.com/feeds/completed",
+		},
+		{
+			name:   "behind proxy",
+			header: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "autoget.example.org"},
+			want:   "https://autoget.example.org/feeds/completed",
+		},
+		{
+			name:    "base url",
+			baseURL: "https://autoget.example.org/autoget/",
+			header:  map[string]string{"X-Forwarded-Host": "ignored.example.org"},
+			want:    "https://autoget.example.org/autoget/feeds/completed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv, router := feedSetup(t)
+			serv.config.BaseURL = tt.baseURL
+
+			for _, format := range []string{"atom", "rss"} {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("GET", "/feeds/completed?token=completed-token&format="+format, nil)
+				for k, v := range tt.header {
+					req.Header.Set(k, v)
+				}
+				router.ServeHTTP(w, req)
+				require.Equal(t, http.StatusOK, w.Code)
+
+				// the token is not part of the link.
+				if format == "atom" {
+					var atom atomFeed
+					require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &atom))
+					assert.Equal(t, tt.want, atom.Link.Href)
+				} else {
+					var rss rssFeed
+					require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &rss))
+					assert.Equal(t, tt.want, rss.Channel.Link)
+				}
+			}
+		})
+	}
+}
+
+func TestFeed_Error(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		expectedCode int
+		expectedMsg  string
+	}{
+		{
+			name:         "unknown feed",
+			url:          "/feeds/unknown?token=x",
+			expectedCode: http.StatusNotFound,
+			expectedMsg:  "Feed not found",
+		},
+		{
+			name:         "missing token",
+			url:          "/feeds/completed",
+			expectedCode: http.StatusUnauthorized,
+			expectedMsg:  "Invalid token",
+		},
+		{
+			name:         "token of other feed",
+			url:          "/feeds/completed?token=pending-token",
+			expectedCode: http.StatusUnauthorized,
+			expectedMsg:  "Invalid token",
+		},
+		{
+			name:         "invalid format",
+			url:          "/feeds/completed?token=completed-token&format=json",
+			expectedCode: http.StatusBadRequest,
+			expectedMsg:  "Invalid format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, router := feedSetup(t)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			var resp map[string]string
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expectedMsg, resp["error"])
+		})
+	}
+}
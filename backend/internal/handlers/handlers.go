@@ -5,16 +5,25 @@ import (
 	"net/url"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/autoget-project/autoget/backend/downloaders"
 	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/indexers/rsshelper"
 	"github.com/autoget-project/autoget/backend/internal/config"
 	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/errors"
+	"github.com/autoget-project/autoget/backend/internal/events"
+	"github.com/autoget-project/autoget/backend/internal/notify"
 	"github.com/autoget-project/autoget/backend/organizer"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+var (
+	errIndexerNotFound = errors.NewHTTPStatusError(http.StatusNotFound, "Indexer not found")
+)
+
 type Service struct {
 	config *config.Config
 	db     *gorm.DB
@@ -22,15 +31,19 @@ type Service struct {
 	indexers        map[string]indexers.IIndexer
 	downloaders     map[string]downloaders.IDownloader
 	organizerClient *organizer.Client
+	notifier        notify.INotifier
+	bus             *events.Bus
 }
 
-func NewService(config *config.Config, db *gorm.DB, indexers map[string]indexers.IIndexer, downloaders map[string]downloaders.IDownloader, organizerClient *organizer.Client) *Service {
+func NewService(config *config.Config, db *gorm.DB, indexers map[string]indexers.IIndexer, downloaders map[string]downloaders.IDownloader, organizerClient *organizer.Client, notifier notify.INotifier, bus *events.Bus) *Service {
 	s := &Service{
 		config:          config,
 		db:              db,
 		indexers:        indexers,
 		downloaders:     downloaders,
 		organizerClient: organizerClient,
+		notifier:        notifier,
+		bus:             bus,
 	}
 
 	return s
@@ -46,10 +59,29 @@ func (s *Service) SetupRouter(router *gin.RouterGroup) {
 
 	router.GET("/downloaders", s.listDownloaders)
 	router.GET("/downloaders/:downloader", s.getDownloaderStatuses)
+	router.GET("/downloaders/:downloader/speed", s.getSpeedLimits)
+	router.PUT("/downloaders/:downloader/speed", s.overrideSpeedLimits)
+	router.DELETE("/downloaders/:downloader/speed", s.clearSpeedLimitsOverride)
+	router.GET("/downloaders/:downloader/disk", s.getDiskStatus)
+	router.GET("/downloaders/:downloader/postprocessing", s.getPostProcessStatus)
+	router.GET("/downloaders/:downloader/queue", s.getQueue)
+	router.POST("/downloaders/:downloader/queue/reorder", s.reorderQueue)
+	router.POST("/downloaders/:downloader/queue/:id/priority", s.setQueuePriority)
+	router.GET("/downloaders/:downloader/reconcile", s.reconcile)
+	router.POST("/downloaders/:downloader/reconcile/:action", s.reconcileAction)
 	router.POST("/download/:id/organize", s.organizeDownload)
 	router.DELETE("/download/:id", s.deleteDownload)
+	for _, action := range downloadActions {
+		router.POST("/download/:id/"+action, s.downloadAction(action))
+	}
+
+	router.POST("/searches/test", s.testSearch)
+	router.GET("/rss/items", s.listRSSItems)
+
+	router.GET("/feeds/:feed", s.feed)
 
 	router.GET("/image", s.image)
+	router.GET("/events", s.streamEvents)
 }
 
 func (s *Service) listIndexers(c *gin.Context) {
@@ -89,8 +121,7 @@ type ListRequest struct {
 
 func (s *Service) indexerListResources(c *gin.Context) {
 	indexerName := c.Param("indexer")
-	indexer, ok := s.indexers[indexerName]
-	if !ok {
+	if _, ok := s.indexers[indexerName]; !ok {
 		c.JSON(404, gin.H{"error": "Indexer not found"})
 		return
 	}
@@ -110,7 +141,7 @@ func (s *Service) indexerListResources(c *gin.Context) {
 		Standards: req.Standards,
 	}
 
-	listResult, err := indexer.List(lreq)
+	listResult, err := s.ListResources(indexerName, lreq)
 	if err != nil {
 		c.JSON(err.Code, gin.H{"error": err.Message})
 		return
@@ -119,6 +150,16 @@ func (s *Service) indexerListResources(c *gin.Context) {
 	c.JSON(200, listResult)
 }
 
+// ListResources lists resources of the indexer.
+func (s *Service) ListResources(indexerName string, req *indexers.ListRequest) (*indexers.ListResult, *errors.HTTPStatusError) {
+	indexer, ok := s.indexers[indexerName]
+	if !ok {
+		return nil, errIndexerNotFound
+	}
+
+	return indexer.List(req)
+}
+
 func (s *Service) indexerResourceDetail(c *gin.Context) {
 	indexerName := c.Param("indexer")
 	indexer, ok := s.indexers[indexerName]
@@ -137,26 +178,78 @@ func (s *Service) indexerResourceDetail(c *gin.Context) {
 	c.JSON(200, detail)
 }
 
+// DownloadRequest are optional options of the torrent added to downloader.
+type DownloadRequest struct {
+	Dir           string   `form:"dir"`
+	Labels        []string `form:"labels"`
+	Paused        bool     `form:"paused"`
+	Priority      int      `form:"priority"`
+	QueuePriority int      `form:"queue_priority"`
+	Files         []int    `form:"files"`
+	Skip          []string `form:"skip"`
+}
+
 func (s *Service) indexerDownload(c *gin.Context) {
 	indexerName := c.Param("indexer")
-	indexer, ok := s.indexers[indexerName]
-	if !ok {
-		c.JSON(404, gin.H{"error": "Indexer not found"})
+	resourceID := c.Param("resource")
+
+	req := &DownloadRequest{}
+	if err := c.ShouldBindQuery(req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
 		return
 	}
 
-	resourceID := c.Param("resource")
+	if err := s.download(indexerName, resourceID, &downloaders.AddRequest{
+		Dir:           req.Dir,
+		Labels:        req.Labels,
+		Paused:        req.Paused,
+		Priority:      req.Priority,
+		QueuePriority: req.QueuePriority,
+		Files:         req.Files,
+		Skip:          req.Skip,
+	}); err != nil {
+		c.JSON(err.Code, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(200, gin.H{"status": "started"})
+}
+
+// Download downloads the resource from the indexer and starts tracking its
+// download status.
+func (s *Service) Download(indexerName string, resourceID string) *errors.HTTPStatusError {
+	return s.download(indexerName, resourceID, &downloaders.AddRequest{})
+}
+
+// download fetches the torrent of the resource and adds it to the indexer's
+// downloader with options in req.
+func (s *Service) download(indexerName string, resourceID string, req *downloaders.AddRequest) *errors.HTTPStatusError {
+	indexer, ok := s.indexers[indexerName]
+	if !ok {
+		return errIndexerNotFound
+	}
+	downloader, ok := s.downloaders[indexer.DownloaderName()]
+	if !ok {
+		return errors.NewHTTPStatusError(http.StatusInternalServerError, "Downloader not found")
+	}
 
 	detail, err := indexer.Detail(resourceID, true)
 	if err != nil {
-		c.JSON(err.Code, gin.H{"error": err.Message})
-		return
+		return err
+	}
+
+	if er := downloader.CheckDiskSpace(int64(detail.Size)); er != nil {
+		return errors.NewHTTPStatusError(http.StatusInsufficientStorage, er.Error())
 	}
 
 	res, err := indexer.Download(resourceID)
 	if err != nil {
-		c.JSON(err.Code, gin.H{"error": err.Message})
-		return
+		return err
+	}
+
+	req.Torrent = res.TorrentData
+	if err := req.Validate(); err != nil {
+		return errors.NewHTTPStatusError(http.StatusBadRequest, err.Error())
 	}
 
 	files := []string{}
@@ -165,27 +258,67 @@ func (s *Service) indexerDownload(c *gin.Context) {
 	}
 
 	downloadStatus := &db.DownloadStatus{
-		ID:         res.TorrentHash,
 		Downloader: indexer.DownloaderName(),
 		State:      db.DownloadStarted,
 		ResTitle:   detail.Title,
 		ResTitle2:  detail.Title2,
 		ResIndexer: indexerName,
+		Private:    indexer.Private(),
 		Category:   detail.Category,
 		FileList:   files,
 		Metadata:   detail.Metadata,
 	}
-	if err := s.db.Create(downloadStatus).Error; err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+	if req.Paused {
+		downloadStatus.State = db.DownloadPaused
+	}
+	var trackErr error
+	// held by AutoGet while max active downloads are downloading, tracked
+	// before another download is counted.
+	_, _, er := downloader.Queue(req, func(hash string, queued bool) error {
+		downloadStatus.ID = hash
+		if queued {
+			req.MarkQueued(downloadStatus)
+		}
+		trackErr = s.track(downloadStatus, res.TorrentData)
+		return trackErr
+	})
+	if trackErr != nil {
+		return errors.NewHTTPStatusError(http.StatusInternalServerError, trackErr.Error())
+	}
+	if er == downloaders.ErrAlreadyTracked {
+		return errors.NewHTTPStatusError(http.StatusConflict, er.Error())
 	}
+	if er != nil {
+		return errors.NewHTTPStatusError(http.StatusBadGateway, "downloader failed to add torrent: "+er.Error())
+	}
+	s.bus.Publish(events.Event{Type: events.DownloadAdded, Downloader: downloadStatus.Downloader, ID: downloadStatus.ID, Title: detail.Title})
 
-	c.JSON(200, gin.H{"status": "started"})
+	return nil
+}
+
+// track saves the download status with its .torrent, kept to add the torrent
+// again if it is gone from the downloader.
+func (s *Service) track(st *db.DownloadStatus, torrent []byte) error {
+	if err := s.db.Create(st).Error; err != nil {
+		return err
+	}
+	if err := db.SaveTorrentFile(s.db, st.ID, torrent); err != nil {
+		db.RemoveDownloadStatus(s.db, st.ID)
+		return err
+	}
+	return nil
 }
 
 type indexerRegisterSearchReq struct {
 	Text   string `json:"text" binding:"required"`
 	Action string `json:"action" binding:"required"`
+
+	// optional, the search is disabled after it.
+	ExpiresAt *time.Time `json:"expires_at"`
+	// optional, how many items the search matches before it stops.
+	MaxMatches uint `json:"max_matches"`
+	// optional, also match RSS items seen before.
+	MatchHistory bool `json:"match_history"`
 }
 
 func (s *Service) indexerRegisterSearch(c *gin.Context) {
@@ -201,20 +334,47 @@ func (s *Service) indexerRegisterSearch(c *gin.Context) {
 		return
 	}
 
-	if req.Action != indexers.ActionDownload &&
-		req.Action != indexers.ActionNotification {
-		c.JSON(400, gin.H{"error": "Invalid action"})
+	search := &db.RSSSearch{
+		Indexer:    indexerName,
+		Text:       req.Text,
+		Action:     req.Action,
+		ExpiresAt:  req.ExpiresAt,
+		MaxMatches: req.MaxMatches,
+	}
+	if err := s.RegisterSearch(search); err != nil {
+		c.JSON(err.Code, gin.H{"error": err.Message})
 		return
 	}
 
-	if err := db.AddSearch(s.db, &db.RSSSearch{
-		Indexer: indexerName,
-		Text:    req.Text,
-		Action:  req.Action,
-	}); err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+	if req.MatchHistory {
+		since := time.Now().Add(-s.config.Subscriptions.HistoryRetention())
+		if err := rsshelper.SearchHistory(s.indexers[indexerName], s.db, s.notifier, s, search, since); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+	}
+}
+
+// RegisterSearch subscribes to RSS items of the indexer matching search.Text.
+func (s *Service) RegisterSearch(search *db.RSSSearch) *errors.HTTPStatusError {
+	if _, ok := s.indexers[search.Indexer]; !ok {
+		return errIndexerNotFound
+	}
+
+	if search.Action != indexers.ActionDownload &&
+		search.Action != indexers.ActionNotification {
+		return errors.NewHTTPStatusError(http.StatusBadRequest, "Invalid action")
+	}
+
+	if search.ExpiresAt != nil && search.ExpiresAt.Before(time.Now()) {
+		return errors.NewHTTPStatusError(http.StatusBadRequest, "expires_at is in the past")
 	}
+
+	if err := db.AddSearch(s.db, search); err != nil {
+		return errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
+	}
+
+	return nil
 }
 
 type DownloaderInfoResponse struct {
@@ -222,6 +382,8 @@ type DownloaderInfoResponse struct {
 	CountOfDownloading int64  `json:"count_of_downloading"`
 	CountOfPlanned     int64  `json:"count_of_planned"`
 	CountOfFailed      int64  `json:"count_of_failed"`
+
+	Disk *downloaders.DiskStatus `json:"disk"`
 }
 
 func (s *Service) listDownloaders(c *gin.Context) {
@@ -251,6 +413,7 @@ func (s *Service) listDownloaders(c *gin.Context) {
 			CountOfDownloading: countOfDownloading,
 			CountOfPlanned:     countOfPlanned,
 			CountOfFailed:      countOfFailed,
+			Disk:               s.downloaders[name].DiskStatus(),
 		})
 	}
 
@@ -279,22 +442,54 @@ func (s *Service) getDownloaderStatuses(c *gin.Context) {
 
 	state := c.Query("state")
 	if state == "" {
-		c.JSON(400, gin.H{"error": "State parameter is required. Valid states: downloading, seeding, stopped, planned, failed"})
+		c.JSON(400, gin.H{"error": "State parameter is required. Valid states: downloading, queued, seeding, stopped, paused, planned, failed"})
 		return
 	}
 
+	statuses, er := s.DownloadStatuses(downloaderName, state)
+	if er != nil {
+		c.JSON(er.Code, gin.H{"error": er.Message})
+		return
+	}
+
+	// Get state counts for this downloader
+	stateCounts, err := db.GetDownloaderStateCounts(s.db, downloaderName)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := DownloaderStatusResponse{
+		State:     *stateCounts,
+		Resources: statuses,
+	}
+
+	c.JSON(200, response)
+}
+
+// DownloadStatuses returns download statuses of the downloader in the given
+// state, latest first.
+func (s *Service) DownloadStatuses(downloaderName string, state string) ([]db.DownloadStatus, *errors.HTTPStatusError) {
+	if _, ok := s.downloaders[downloaderName]; !ok {
+		return nil, errors.NewHTTPStatusError(http.StatusNotFound, "Downloader not found")
+	}
+
 	var statuses []db.DownloadStatus
 	var err error
 
 	switch state {
 	case "downloading":
 		statuses, err = db.GetUnfinishedDownloadStatusByDownloader(s.db, downloaderName)
+	case "queued":
+		statuses, err = db.GetQueuedDownloadStatusByDownloader(s.db, downloaderName)
 	case "seeding":
 		// For seeding, we want downloads that are in seeding state
 		statuses, err = db.GetDownloadStatusByDownloaderAndState(s.db, downloaderName, db.DownloadSeeding)
 	case "stopped":
 		// For stopped, we want downloads that are stopped
 		statuses, err = db.GetDownloadStatusByDownloaderAndState(s.db, downloaderName, db.DownloadStopped)
+	case "paused":
+		statuses, err = db.GetDownloadStatusByDownloaderAndState(s.db, downloaderName, db.DownloadPaused)
 	case "planned":
 		// For planned, we want downloads that are moved and have been planned for organization
 		statuses, err = db.GetMovedAndOrganizeStateDownloadStatusByDownloader(s.db, downloaderName, db.Planed)
@@ -305,46 +500,129 @@ func (s *Service) getDownloaderStatuses(c *gin.Context) {
 
 		createFailedStatuses, err = db.GetMovedAndOrganizeStateDownloadStatusByDownloader(s.db, downloaderName, db.CreatePlanFailed)
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
+			return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
 		}
 
 		executeFailedStatuses, err = db.GetMovedAndOrganizeStateDownloadStatusByDownloader(s.db, downloaderName, db.ExecutePlanFailed)
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
+			return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
 		}
 
 		// Combine both lists
 		statuses = append(createFailedStatuses, executeFailedStatuses...)
 	default:
-		c.JSON(400, gin.H{"error": "Invalid state. Valid states: downloading, seeding, stopped, planned, failed"})
-		return
+		return nil, errors.NewHTTPStatusError(http.StatusBadRequest, "Invalid state. Valid states: downloading, queued, seeding, stopped, paused, planned, failed")
 	}
 
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
+	}
+
+	// sort statuses by create date, latest , ..., earliest
+	slices.SortFunc(statuses, func(a, b db.DownloadStatus) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	return statuses, nil
+}
+
+func (s *Service) getSpeedLimits(c *gin.Context) {
+	downloader, ok := s.downloaders[c.Param("downloader")]
+	if !ok {
+		c.JSON(404, gin.H{"error": "Downloader not found"})
 		return
 	}
+	c.JSON(200, downloader.BandwidthStatus())
+}
 
-	// Get state counts for this downloader
-	stateCounts, err := db.GetDownloaderStateCounts(s.db, downloaderName)
+// SpeedOverrideRequest overrides speed limits of a downloader for Duration,
+// e.g. "2h".
+type SpeedOverrideRequest struct {
+	downloaders.SpeedLimits
+	Duration string `json:"duration"`
+}
+
+func (s *Service) overrideSpeedLimits(c *gin.Context) {
+	req := &SpeedOverrideRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, er := s.OverrideSpeedLimits(c.Param("downloader"), req)
+	if er != nil {
+		c.JSON(er.Code, gin.H{"error": er.Message})
+		return
+	}
+	c.JSON(200, status)
+}
+
+// OverrideSpeedLimits sets limits of the downloader over its bandwidth
+// schedules until the duration passes.
+func (s *Service) OverrideSpeedLimits(downloaderName string, req *SpeedOverrideRequest) (*downloaders.BandwidthStatus, *errors.HTTPStatusError) {
+	downloader, ok := s.downloaders[downloaderName]
+	if !ok {
+		return nil, errors.NewHTTPStatusError(http.StatusNotFound, "Downloader not found")
+	}
+
+	duration, err := time.ParseDuration(req.Duration)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		return nil, errors.NewHTTPStatusError(http.StatusBadRequest, "Invalid duration: "+err.Error())
+	}
+
+	if err := downloader.OverrideSpeedLimits(&req.SpeedLimits, duration); err != nil {
+		return nil, speedLimitsError(downloaderName, err)
+	}
+	return downloader.BandwidthStatus(), nil
+}
+
+func (s *Service) clearSpeedLimitsOverride(c *gin.Context) {
+	downloader, ok := s.downloaders[c.Param("downloader")]
+	if !ok {
+		c.JSON(404, gin.H{"error": "Downloader not found"})
 		return
 	}
 
-	// sort statuses by create date, latest , ..., earliest
-	slices.SortFunc(statuses, func(a, b db.DownloadStatus) int {
-		return b.CreatedAt.Compare(a.CreatedAt)
-	})
+	if err := downloader.ClearSpeedLimitsOverride(); err != nil {
+		er := speedLimitsError(c.Param("downloader"), err)
+		c.JSON(er.Code, gin.H{"error": er.Message})
+		return
+	}
+	c.JSON(200, downloader.BandwidthStatus())
+}
 
-	response := DownloaderStatusResponse{
-		State:     *stateCounts,
-		Resources: statuses,
+func speedLimitsError(downloaderName string, err error) *errors.HTTPStatusError {
+	switch {
+	case err == downloaders.ErrInvalidSpeedLimits:
+		return errors.NewHTTPStatusError(http.StatusBadRequest, err.Error())
+	case err == downloaders.ErrNotSupported:
+		return errors.NewHTTPStatusError(http.StatusNotImplemented, downloaderName+": alt speed is not supported")
+	default:
+		return errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
 	}
+}
 
-	c.JSON(200, response)
+func (s *Service) getDiskStatus(c *gin.Context) {
+	downloader, ok := s.downloaders[c.Param("downloader")]
+	if !ok {
+		c.JSON(404, gin.H{"error": "Downloader not found"})
+		return
+	}
+	c.JSON(200, downloader.DiskStatus())
+}
+
+func (s *Service) getPostProcessStatus(c *gin.Context) {
+	downloader, ok := s.downloaders[c.Param("downloader")]
+	if !ok {
+		c.JSON(404, gin.H{"error": "Downloader not found"})
+		return
+	}
+	status, err := downloader.PostProcessStatus()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, status)
 }
 
 func (s *Service) image(c *gin.Context) {
@@ -416,11 +694,29 @@ func (s *Service) organizeDownload(c *gin.Context) {
 }
 
 func (s *Service) handleAcceptPlan(c *gin.Context, downloadStatus *db.DownloadStatus) {
-	if downloadStatus.OrganizePlans == nil {
-		c.JSON(400, gin.H{"error": "No organize plan available"})
+	failedResp, err := s.AcceptPlan(downloadStatus)
+	if err != nil {
+		c.JSON(err.Code, gin.H{"error": err.Message})
 		return
 	}
 
+	if failedResp == nil {
+		c.JSON(200, gin.H{"status": "organization completed successfully"})
+	} else {
+		c.JSON(200, gin.H{
+			"status": "organization partially completed",
+			"failed": failedResp,
+		})
+	}
+}
+
+// AcceptPlan executes the organize plan of the download. The returned
+// response lists the failed moves if the plan only partially succeeded.
+func (s *Service) AcceptPlan(downloadStatus *db.DownloadStatus) (*organizer.ExecuteResponse, *errors.HTTPStatusError) {
+	if downloadStatus.OrganizePlans == nil {
+		return nil, errors.NewHTTPStatusError(http.StatusBadRequest, "No organize plan available")
+	}
+
 	// Execute the plan
 	executeReq := &organizer.ExecuteRequest{
 		Dir:  downloadStatus.ID,
@@ -429,8 +725,7 @@ func (s *Service) handleAcceptPlan(c *gin.Context, downloadStatus *db.DownloadSt
 
 	success, failedResp, err := s.organizerClient.Execute(executeReq)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+		return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
 	}
 
 	// Update the organize plan action based on execution result
@@ -442,18 +737,15 @@ func (s *Service) handleAcceptPlan(c *gin.Context, downloadStatus *db.DownloadSt
 
 	// Update the download status
 	if err := db.SaveDownloadStatus(s.db, downloadStatus); err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+		return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
 	}
 
 	if success {
-		c.JSON(200, gin.H{"status": "organization completed successfully"})
-	} else {
-		c.JSON(200, gin.H{
-			"status": "organization partially completed",
-			"failed": failedResp,
-		})
+		s.publish(events.DownloadOrganized, downloadStatus, "")
+		return nil, nil
 	}
+	s.publish(events.DownloadFailed, downloadStatus, "execute plan failed")
+	return failedResp, nil
 }
 
 func (s *Service) handleManualOrganized(c *gin.Context, downloadStatus *db.DownloadStatus) {
@@ -465,6 +757,7 @@ func (s *Service) handleManualOrganized(c *gin.Context, downloadStatus *db.Downl
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
+	s.publish(events.DownloadOrganized, downloadStatus, "")
 
 	c.JSON(200, gin.H{"status": "marked as manually organized"})
 }
@@ -473,6 +766,21 @@ func (s *Service) handleRePlan(c *gin.Context, downloadStatus *db.DownloadStatus
 	// Get user_hint from query parameter (optional)
 	userHint := c.Query("user_hint")
 
+	resp, err := s.RePlan(downloadStatus, userHint)
+	if err != nil {
+		c.JSON(err.Code, gin.H{"error": err.Message})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"status": "re_plan completed successfully",
+		"plan":   resp,
+	})
+}
+
+// RePlan asks the organizer for a new plan of the download, userHint is
+// optional.
+func (s *Service) RePlan(downloadStatus *db.DownloadStatus, userHint string) (*organizer.PlanResponse, *errors.HTTPStatusError) {
 	var resp *organizer.PlanResponse
 	var err error
 
@@ -497,11 +805,10 @@ func (s *Service) handleRePlan(c *gin.Context, downloadStatus *db.DownloadStatus
 		// Update the state to CreatePlanFailed when re-planning fails
 		downloadStatus.OrganizeState = db.CreatePlanFailed
 		if saveErr := db.SaveDownloadStatus(s.db, downloadStatus); saveErr != nil {
-			c.JSON(500, gin.H{"error": saveErr.Error()})
-			return
+			return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, saveErr.Error())
 		}
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+		s.publish(events.DownloadFailed, downloadStatus, "create plan: "+err.Error())
+		return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
 	}
 
 	// Update the organize plan and state
@@ -510,14 +817,11 @@ func (s *Service) handleRePlan(c *gin.Context, downloadStatus *db.DownloadStatus
 
 	// Update the download status
 	if err := db.SaveDownloadStatus(s.db, downloadStatus); err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+		return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
 	}
+	s.publish(events.DownloadPlanned, downloadStatus, "")
 
-	c.JSON(200, gin.H{
-		"status": "re_plan completed successfully",
-		"plan":   resp,
-	})
+	return resp, nil
 }
 
 func (s *Service) deleteDownload(c *gin.Context) {
@@ -541,11 +845,75 @@ func (s *Service) deleteDownload(c *gin.Context) {
 		return
 	}
 
-	// Delete the torrent
-	if err := downloader.DeleteTorrent(downloadID); err != nil {
+	// Delete the torrent, force deletes torrents protected from hit-and-run
+	force := c.Query("force") == "true"
+	if err := downloader.DeleteTorrent(downloadID, force); err != nil {
+		if err == downloaders.ErrHitAndRun {
+			c.JSON(409, gin.H{"error": err.Error() + ", use force=true to delete anyway"})
+			return
+		}
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(200, gin.H{"status": "deleted"})
 }
+
+// downloadActions are control actions on a download, see DownloadAction.
+var downloadActions = []string{"pause", "resume", "verify", "reannounce", "move"}
+
+func (s *Service) downloadAction(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := s.DownloadAction(c.Param("id"), action, c.Query("dir")); err != nil {
+			c.JSON(err.Code, gin.H{"error": err.Message})
+			return
+		}
+		c.JSON(200, gin.H{"status": action})
+	}
+}
+
+// DownloadAction pauses, resumes, verifies, reannounces or moves to dir the
+// torrent of the download.
+func (s *Service) DownloadAction(downloadID, action, dir string) *errors.HTTPStatusError {
+	downloadStatus, err := db.GetDownloadStatusByID(s.db, downloadID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return errors.NewHTTPStatusError(http.StatusNotFound, "Download not found")
+		}
+		return errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
+	}
+
+	downloader, ok := s.downloaders[downloadStatus.Downloader]
+	if !ok {
+		return errors.NewHTTPStatusError(http.StatusNotFound, "Downloader not found")
+	}
+
+	switch action {
+	case "pause":
+		err = downloader.Pause(downloadID)
+	case "resume":
+		err = downloader.Resume(downloadID)
+	case "verify":
+		err = downloader.Verify(downloadID)
+	case "reannounce":
+		err = downloader.Reannounce(downloadID)
+	case "move":
+		if dir == "" {
+			return errors.NewHTTPStatusError(http.StatusBadRequest, "missing dir query")
+		}
+		err = downloader.Move(downloadID, dir)
+	default:
+		return errors.NewHTTPStatusError(http.StatusBadRequest, "Invalid action. Valid actions: "+strings.Join(downloadActions, ", "))
+	}
+
+	switch {
+	case err == nil:
+		return nil
+	case err == downloaders.ErrTorrentNotFound:
+		return errors.NewHTTPStatusError(http.StatusNotFound, "Torrent not found in downloader")
+	case err == downloaders.ErrNotSupported:
+		return errors.NewHTTPStatusError(http.StatusNotImplemented, downloadStatus.Downloader+": "+action+" is not supported")
+	default:
+		return errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
+	}
+}
@@ -1,16 +1,24 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
 	"github.com/autoget-project/autoget/backend/downloaders"
 	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/internal/config"
 	"github.com/autoget-project/autoget/backend/internal/db"
 	"github.com/autoget-project/autoget/backend/internal/errors"
+	"github.com/autoget-project/autoget/backend/internal/events"
+	"github.com/autoget-project/autoget/backend/internal/notify"
 	"github.com/autoget-project/autoget/backend/organizer"
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron/v3"
@@ -21,6 +29,7 @@ import (
 
 type indexerMock struct {
 	mockName           string
+	mockPrivate        bool
 	mockCategories     []indexers.Category
 	mockCategoriesErr  *errors.HTTPStatusError
 	mockListResult     *indexers.ListResult
@@ -51,15 +60,67 @@ func (i *indexerMock) Download(id string) (*indexers.DownloadResult, *errors.HTT
 	return i.mockDownloadResult, i.mockDownloadErr
 }
 
-func (i *indexerMock) RegisterRSSCronjob(cron *cron.Cron) {}
+func (i *indexerMock) RegisterRSSCronjob(cron *cron.Cron, downloader indexers.ResourceDownloader) {}
 
 func (i *indexerMock) DownloaderName() string {
-	return "mock-downloader"
+	return "mock"
+}
+
+func (i *indexerMock) Private() bool {
+	return i.mockPrivate
 }
 
 type downloadersMock struct {
 	mockTorrentsDir string
 	mockDownloadDir string
+	mockAddHash     string
+	mockAddErr      error
+	mockActionErr   error
+	mockSpeedErr    error
+	mockDeleteErr   error
+	mockDiskErr     error
+	mockQueued      bool
+	mockQueueErr    error
+
+	added   []*downloaders.AddRequest
+	adopted []*db.DownloadStatus
+	actions []string
+	speed   downloaders.BandwidthStatus
+}
+
+func (d *downloadersMock) Add(req *downloaders.AddRequest) (string, error) {
+	d.added = append(d.added, req)
+	return d.mockAddHash, d.mockAddErr
+}
+
+func (d *downloadersMock) Queue(req *downloaders.AddRequest, track func(hash string, queued bool) error) (string, bool, error) {
+	d.added = append(d.added, req)
+	if d.mockAddErr != nil {
+		return "", false, d.mockAddErr
+	}
+	return d.mockAddHash, d.mockQueued, track(d.mockAddHash, d.mockQueued)
+}
+
+func (d *downloadersMock) QueueStatus() (*downloaders.QueueStatus, error) {
+	return &downloaders.QueueStatus{
+		MaxActive: 2,
+		Active:    2,
+		Items:     []downloaders.QueuedDownload{{ID: "aa", Title: "Show", Priority: 1}},
+	}, nil
+}
+
+func (d *downloadersMock) ReorderQueue(ids []string) error {
+	if d.mockQueueErr != nil {
+		return d.mockQueueErr
+	}
+	return d.action("reorder " + strings.Join(ids, ","))
+}
+
+func (d *downloadersMock) SetQueuePriority(id string, priority int) error {
+	if d.mockQueueErr != nil {
+		return d.mockQueueErr
+	}
+	return d.action(fmt.Sprintf("priority %s %d", id, priority))
 }
 
 func (d *downloadersMock) TorrentsDir() string {
@@ -73,7 +134,104 @@ func (d *downloadersMock) DownloadDir() string {
 func (d *downloadersMock) RegisterCronjobs(cron *cron.Cron)            {}
 func (d *downloadersMock) RegisterDailySeedingChecker(cron *cron.Cron) {}
 func (d *downloadersMock) ProgressChecker()                            {}
-func (d *downloadersMock) DeleteTorrent(hash string) error             { return nil }
+func (d *downloadersMock) DeleteTorrent(hash string, force bool) error {
+	if d.mockDeleteErr != nil && !force {
+		return d.mockDeleteErr
+	}
+	return nil
+}
+
+func (d *downloadersMock) action(action string) error {
+	d.actions = append(d.actions, action)
+	return d.mockActionErr
+}
+
+func (d *downloadersMock) Pause(hash string) error      { return d.action("pause " + hash) }
+func (d *downloadersMock) Resume(hash string) error     { return d.action("resume " + hash) }
+func (d *downloadersMock) Verify(hash string) error     { return d.action("verify " + hash) }
+func (d *downloadersMock) Reannounce(hash string) error { return d.action("reannounce " + hash) }
+func (d *downloadersMock) Move(hash, dir string) error  { return d.action("move " + hash + " " + dir) }
+
+func (d *downloadersMock) BandwidthStatus() *downloaders.BandwidthStatus {
+	status := d.speed
+	return &status
+}
+
+func (d *downloadersMock) OverrideSpeedLimits(limits *downloaders.SpeedLimits, duration time.Duration) error {
+	if d.mockSpeedErr != nil {
+		return d.mockSpeedErr
+	}
+	until := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Add(duration)
+	d.speed = downloaders.BandwidthStatus{Limits: *limits, Source: "override", Until: &until}
+	return nil
+}
+
+func (d *downloadersMock) ClearSpeedLimitsOverride() error {
+	if d.mockSpeedErr != nil {
+		return d.mockSpeedErr
+	}
+	d.speed = downloaders.BandwidthStatus{Source: "default"}
+	return nil
+}
+
+func (d *downloadersMock) DiskStatus() *downloaders.DiskStatus {
+	return &downloaders.DiskStatus{
+		Dirs:         []downloaders.DiskUsage{{Dir: "download", Path: d.mockDownloadDir, Total: 1000, Free: 100}},
+		MinFreeMB:    1,
+		IntakePaused: d.mockDiskErr != nil,
+	}
+}
+
+func (d *downloadersMock) PostProcessStatus() (*downloaders.PostProcessStatus, error) {
+	return &downloaders.PostProcessStatus{
+		TransferWorkers: 2,
+		Items:           []downloaders.PostProcessItem{{ID: "aa", Title: "Show", Stage: "transfer", State: "waiting", Reason: "busy"}},
+	}, nil
+}
+
+func (d *downloadersMock) CheckDiskSpace(size int64) error {
+	return d.mockDiskErr
+}
+
+func (d *downloadersMock) Reconcile() (*downloaders.Reconciliation, error) {
+	return &downloaders.Reconciliation{
+		Untracked: []downloaders.UntrackedTorrent{{Hash: "aa", Name: "Show"}},
+		Missing:   []downloaders.MissingDownload{{ID: "bb", Title: "Movie", CanReAdd: true}},
+	}, nil
+}
+
+func (d *downloadersMock) Adopt(hash string, s *db.DownloadStatus) error {
+	if err := d.action("adopt " + hash); err != nil {
+		return err
+	}
+	d.adopted = append(d.adopted, s)
+	return nil
+}
+
+func (d *downloadersMock) MarkMissing(id string) error { return d.action("missing " + id) }
+func (d *downloadersMock) ReAdd(id string) error       { return d.action("readd " + id) }
+func (d *downloadersMock) SetEvents(bus *events.Bus)   {}
+
+type fakeNotifier struct {
+	messages  []string
+	markdowns []string
+	matches   []*notify.RSSMatch
+}
+
+func (f *fakeNotifier) SendMessage(message string) error {
+	f.messages = append(f.messages, message)
+	return nil
+}
+
+func (f *fakeNotifier) SendMarkdownMessage(message string) error {
+	f.markdowns = append(f.markdowns, message)
+	return nil
+}
+
+func (f *fakeNotifier) SendRSSMatch(match *notify.RSSMatch) error {
+	f.matches = append(f.matches, match)
+	return nil
+}
 
 func testSetup(t *testing.T) (*Service, *gin.Engine, *indexerMock, *gorm.DB) {
 	t.Helper()
@@ -87,7 +245,8 @@ func testSetup(t *testing.T) (*Service, *gin.Engine, *indexerMock, *gorm.DB) {
 	}
 
 	serv := &Service{
-		db: testDB,
+		config: &config.Config{},
+		db:     testDB,
 		indexers: map[string]indexers.IIndexer{
 			"mock": m,
 		},
@@ -97,6 +256,8 @@ func testSetup(t *testing.T) (*Service, *gin.Engine, *indexerMock, *gorm.DB) {
 				mockDownloadDir: "/downloads",
 			},
 		},
+		notifier: &fakeNotifier{},
+		bus:      events.NewBus(),
 	}
 
 	router := gin.Default()
@@ -398,6 +559,54 @@ func TestService_indexerRegisterSearch(t *testing.T) {
 		assert.Equal(t, "notification", searches[0].Action)
 	})
 
+	t.Run("success - expires and max matches", func(t *testing.T) {
+		_, router, _, testDB := testSetup(t)
+
+		expiresAt := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+		w := httptest.NewRecorder()
+		reqBody := `{"text": "bounded", "action": "notification", "expires_at": "` + expiresAt.Format(time.RFC3339) + `", "max_matches": 3}`
+		req := httptest.NewRequest("GET", "/indexers/mock/registerSearch", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var searches []db.RSSSearch
+		require.NoError(t, testDB.Find(&searches).Error)
+		require.Len(t, searches, 1)
+		require.NotNil(t, searches[0].ExpiresAt)
+		assert.True(t, expiresAt.Equal(*searches[0].ExpiresAt))
+		assert.Equal(t, uint(3), searches[0].MaxMatches)
+	})
+
+	t.Run("success - match history", func(t *testing.T) {
+		serv, router, _, testDB := testSetup(t)
+
+		require.NoError(t, db.AddRSSItems(testDB, []*db.RSSItem{
+			{Indexer: "mock", ResID: "1", Title: "Frieren 01", FirstSeenAt: time.Now().Add(-time.Hour)},
+			{Indexer: "mock", ResID: "2", Title: "Frieren 02", FirstSeenAt: time.Now().AddDate(0, 0, -40)},
+			{Indexer: "mock", ResID: "3", Title: "Other 01", FirstSeenAt: time.Now().Add(-time.Hour)},
+		}))
+
+		w := httptest.NewRecorder()
+		reqBody := `{"text": "frieren", "action": "notification", "max_matches": 5, "match_history": true}`
+		req := httptest.NewRequest("GET", "/indexers/mock/registerSearch", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// item 2 is older than the history retention.
+		notifier := serv.notifier.(*fakeNotifier)
+		require.Len(t, notifier.matches, 1)
+		assert.Equal(t, "1", notifier.matches[0].ResID)
+
+		var searches []db.RSSSearch
+		require.NoError(t, testDB.Find(&searches).Error)
+		require.Len(t, searches, 1)
+		assert.Equal(t, uint(1), searches[0].MatchCount)
+	})
+
 	t.Run("error - indexer not found", func(t *testing.T) {
 		_, router, _, _ := testSetup(t)
 
@@ -472,6 +681,193 @@ func TestService_indexerRegisterSearch(t *testing.T) {
 		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
 		assert.Equal(t, "Invalid action", resp["error"])
 	})
+
+	t.Run("error - expires in the past", func(t *testing.T) {
+		_, router, _, _ := testSetup(t)
+
+		w := httptest.NewRecorder()
+		reqBody := `{"text": "test", "action": "download", "expires_at": "2020-01-01T00:00:00Z"}`
+		req := httptest.NewRequest("GET", "/indexers/mock/registerSearch", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var resp map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "expires_at is in the past", resp["error"])
+	})
+}
+
+func TestService_indexerDownload(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		serv, router, m, testDB := testSetup(t)
+
+		m.mockDetailResult = &indexers.ResourceDetail{
+			ListResourceItem: indexers.ListResourceItem{ID: "res-1", Title: "Resource 1"},
+		}
+		m.mockDownloadResult = &indexers.DownloadResult{TorrentHash: "hash-1", TorrentData: []byte("torrent")}
+		downloader := serv.downloaders["mock"].(*downloadersMock)
+		downloader.mockAddHash = "hash-1"
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/indexers/mock/resources/res-1/download?dir=/data/tv&labels=tv&labels=anime&paused=true&priority=1", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, downloader.added, 1)
+		assert.Equal(t, &downloaders.AddRequest{
+			Torrent:  []byte("torrent"),
+			Dir:      "/data/tv",
+			Labels:   []string{"tv", "anime"},
+			Paused:   true,
+			Priority: 1,
+		}, downloader.added[0])
+
+		status, err := db.GetDownloadStatusByID(testDB, "hash-1")
+		require.NoError(t, err)
+		// paused takes no slot.
+		assert.Equal(t, db.DownloadPaused, status.State)
+
+		data, err := db.GetTorrentFile(testDB, "hash-1")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("torrent"), data)
+	})
+
+	t.Run("file selection", func(t *testing.T) {
+		serv, router, m, _ := testSetup(t)
+
+		info := metainfo.Info{Name: "show", PieceLength: 16 * 1024, Pieces: make([]byte, 20)}
+		for _, p := range [][]string{{"ep1.mkv"}, {"notes.txt"}} {
+			info.Files = append(info.Files, metainfo.FileInfo{Path: p, Length: 1})
+		}
+		infoBytes, err := bencode.Marshal(info)
+		require.NoError(t, err)
+		data := &bytes.Buffer{}
+		require.NoError(t, (&metainfo.MetaInfo{InfoBytes: infoBytes}).Write(data))
+
+		m.mockDetailResult = &indexers.ResourceDetail{
+			ListResourceItem: indexers.ListResourceItem{ID: "res-1", Title: "Resource 1"},
+		}
+		m.mockDownloadResult = &indexers.DownloadResult{TorrentHash: "hash-1", TorrentData: data.Bytes()}
+		downloader := serv.downloaders["mock"].(*downloadersMock)
+		downloader.mockAddHash = "hash-1"
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/indexers/mock/resources/res-1/download?files=0&skip=*.nfo", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		require.Len(t, downloader.added, 1)
+		assert.Equal(t, []int{0}, downloader.added[0].Files)
+		assert.Equal(t, []string{"*.nfo"}, downloader.added[0].Skip)
+
+		// unknown file
+		w = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/indexers/mock/resources/res-1/download?files=2", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "file index 2 out of range")
+		assert.Len(t, downloader.added, 1)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			query        string
+			mockErr      *errors.HTTPStatusError
+			addErr       error
+			diskErr      error
+			expectedCode int
+			expectedMsg  string
+		}{
+			{
+				name:         "indexer returns error",
+				mockErr:      errors.NewHTTPStatusError(http.StatusConflict, "duplicate download"),
+				expectedCode: http.StatusConflict,
+				expectedMsg:  "duplicate download",
+			},
+			{
+				name:         "invalid priority",
+				query:        "?priority=5",
+				expectedCode: http.StatusBadRequest,
+				expectedMsg:  "priority must be -1, 0 or 1",
+			},
+			{
+				name:         "downloader returns error",
+				addErr:       fmt.Errorf("invalid or corrupt torrent file"),
+				expectedCode: http.StatusBadGateway,
+				expectedMsg:  "downloader failed to add torrent: invalid or corrupt torrent file",
+			},
+			{
+				name:         "low disk space",
+				diskErr:      fmt.Errorf("%w: /downloads has 10 MB free, needs 110 MB", downloaders.ErrLowDiskSpace),
+				expectedCode: http.StatusInsufficientStorage,
+				expectedMsg:  "not enough free disk space: /downloads has 10 MB free, needs 110 MB",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				serv, router, m, testDB := testSetup(t)
+
+				m.mockDetailResult = &indexers.ResourceDetail{}
+				m.mockDownloadResult = &indexers.DownloadResult{TorrentHash: "hash-1", TorrentData: []byte("torrent")}
+				m.mockDownloadErr = tt.mockErr
+				serv.downloaders["mock"].(*downloadersMock).mockAddErr = tt.addErr
+				serv.downloaders["mock"].(*downloadersMock).mockDiskErr = tt.diskErr
+
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("GET", "/indexers/mock/resources/res-1/download"+tt.query, nil)
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.expectedCode, w.Code)
+				var resp map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedMsg, resp["error"])
+
+				// nothing is tracked.
+				_, err := db.GetDownloadStatusByID(testDB, "hash-1")
+				assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+			})
+		}
+	})
+
+	t.Run("tracking failure", func(t *testing.T) {
+		serv, router, m, testDB := testSetup(t)
+
+		m.mockDetailResult = &indexers.ResourceDetail{}
+		m.mockDownloadResult = &indexers.DownloadResult{TorrentHash: "hash-1", TorrentData: []byte("torrent")}
+		downloader := serv.downloaders["mock"].(*downloadersMock)
+		downloader.mockAddHash = "hash-1"
+		require.NoError(t, testDB.Migrator().DropTable(&db.DownloadStatus{}))
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/indexers/mock/resources/res-1/download", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		_, err := db.GetTorrentFile(testDB, "hash-1")
+		assert.Error(t, err)
+	})
+
+	t.Run("already tracked", func(t *testing.T) {
+		serv, router, m, testDB := testSetup(t)
+
+		m.mockDetailResult = &indexers.ResourceDetail{}
+		m.mockDownloadResult = &indexers.DownloadResult{TorrentHash: "hash-1", TorrentData: []byte("torrent")}
+		downloader := serv.downloaders["mock"].(*downloadersMock)
+		downloader.mockAddHash = "hash-1"
+		downloader.mockAddErr = downloaders.ErrAlreadyTracked
+		require.NoError(t, testDB.Create(&db.DownloadStatus{ID: "hash-1", Downloader: "mock", State: db.DownloadStarted}).Error)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/indexers/mock/resources/res-1/download", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		status, err := db.GetDownloadStatusByID(testDB, "hash-1")
+		require.NoError(t, err)
+		assert.Equal(t, db.DownloadStarted, status.State)
+	})
 }
 
 func TestListDownloaders(t *testing.T) {
@@ -491,6 +887,9 @@ func TestListDownloaders(t *testing.T) {
 	assert.Equal(t, int64(0), downloaders[0].CountOfDownloading)
 	assert.Equal(t, int64(0), downloaders[0].CountOfPlanned)
 	assert.Equal(t, int64(0), downloaders[0].CountOfFailed)
+	require.NotNil(t, downloaders[0].Disk)
+	assert.Equal(t, uint64(100), downloaders[0].Disk.Dirs[0].Free)
+	assert.False(t, downloaders[0].Disk.IntakePaused)
 }
 
 func TestGetDownloaderStatuses(t *testing.T) {
@@ -513,7 +912,7 @@ func TestGetDownloaderStatuses(t *testing.T) {
 
 		var response map[string]string
 		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
-		assert.Equal(t, "State parameter is required. Valid states: downloading, seeding, stopped, planned, failed", response["error"])
+		assert.Equal(t, "State parameter is required. Valid states: downloading, queued, seeding, stopped, paused, planned, failed", response["error"])
 	})
 
 	t.Run("valid downloader with state filter", func(t *testing.T) {
@@ -557,7 +956,7 @@ func TestGetDownloaderStatuses(t *testing.T) {
 
 		var response map[string]string
 		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
-		assert.Equal(t, "Invalid state. Valid states: downloading, seeding, stopped, planned, failed", response["error"])
+		assert.Equal(t, "Invalid state. Valid states: downloading, queued, seeding, stopped, paused, planned, failed", response["error"])
 	})
 }
 
@@ -600,6 +999,203 @@ func TestService_organizeDownload_InvalidAction(t *testing.T) {
 	assert.Contains(t, response["error"], "Invalid action")
 }
 
+func TestService_downloadAction(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		actionErr error
+		wantCode  int
+		wantError string
+		want      []string
+	}{
+		{name: "pause", url: "/download/test-hash/pause", wantCode: http.StatusOK, want: []string{"pause test-hash"}},
+		{name: "resume", url: "/download/test-hash/resume", wantCode: http.StatusOK, want: []string{"resume test-hash"}},
+		{name: "verify", url: "/download/test-hash/verify", wantCode: http.StatusOK, want: []string{"verify test-hash"}},
+		{name: "reannounce", url: "/download/test-hash/reannounce", wantCode: http.StatusOK, want: []string{"reannounce test-hash"}},
+		{name: "move", url: "/download/test-hash/move?dir=/downloads/tv", wantCode: http.StatusOK, want: []string{"move test-hash /downloads/tv"}},
+		{name: "move without dir", url: "/download/test-hash/move", wantCode: http.StatusBadRequest, wantError: "missing dir query"},
+		{name: "download not found", url: "/download/nonexistent/pause", wantCode: http.StatusNotFound, wantError: "Download not found"},
+		{
+			name:      "torrent not found",
+			url:       "/download/test-hash/pause",
+			actionErr: downloaders.ErrTorrentNotFound,
+			wantCode:  http.StatusNotFound,
+			wantError: "Torrent not found in downloader",
+			want:      []string{"pause test-hash"},
+		},
+		{
+			name:      "not supported",
+			url:       "/download/test-hash/reannounce",
+			actionErr: downloaders.ErrNotSupported,
+			wantCode:  http.StatusNotImplemented,
+			wantError: "mock: reannounce is not supported",
+			want:      []string{"reannounce test-hash"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv, router, _, testDB := testSetup(t)
+			mock := serv.downloaders["mock"].(*downloadersMock)
+			mock.mockActionErr = tt.actionErr
+			require.NoError(t, testDB.Create(&db.DownloadStatus{ID: "test-hash", Downloader: "mock"}).Error)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.want, mock.actions)
+			if tt.wantError != "" {
+				var response map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.wantError, response["error"])
+			}
+		})
+	}
+}
+
+func TestService_deleteDownload(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		deleteErr error
+		wantCode  int
+		wantError string
+	}{
+		{name: "deleted", url: "/download/test-hash", wantCode: http.StatusOK},
+		{
+			name:      "hit-and-run",
+			url:       "/download/test-hash",
+			deleteErr: downloaders.ErrHitAndRun,
+			wantCode:  http.StatusConflict,
+			wantError: downloaders.ErrHitAndRun.Error() + ", use force=true to delete anyway",
+		},
+		{name: "force", url: "/download/test-hash?force=true", deleteErr: downloaders.ErrHitAndRun, wantCode: http.StatusOK},
+		{name: "download not found", url: "/download/nonexistent", wantCode: http.StatusNotFound, wantError: "Download not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv, router, _, testDB := testSetup(t)
+			serv.downloaders["mock"].(*downloadersMock).mockDeleteErr = tt.deleteErr
+			require.NoError(t, testDB.Create(&db.DownloadStatus{ID: "test-hash", Downloader: "mock"}).Error)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("DELETE", tt.url, nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantError != "" {
+				var response map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.wantError, response["error"])
+			}
+		})
+	}
+}
+
+func TestService_speedLimits(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		body      string
+		speedErr  error
+		wantCode  int
+		wantError string
+		want      downloaders.BandwidthStatus
+		wantUntil string
+	}{
+		{
+			name:     "get",
+			method:   "GET",
+			url:      "/downloaders/mock/speed",
+			wantCode: http.StatusOK,
+			want:     downloaders.BandwidthStatus{Limits: downloaders.SpeedLimits{DownloadKB: 100}, Source: "schedule"},
+		},
+		{
+			name:      "override",
+			method:    "PUT",
+			url:       "/downloaders/mock/speed",
+			body:      `{"upload_kb": 0, "download_kb": 0, "duration": "2h"}`,
+			wantCode:  http.StatusOK,
+			want:      downloaders.BandwidthStatus{Source: "override"},
+			wantUntil: "2025-01-01T02:00:00Z",
+		},
+		{
+			name:      "invalid duration",
+			method:    "PUT",
+			url:       "/downloaders/mock/speed",
+			body:      `{"download_kb": 100, "duration": "soon"}`,
+			wantCode:  http.StatusBadRequest,
+			wantError: `Invalid duration: time: invalid duration "soon"`,
+		},
+		{
+			name:      "invalid limits",
+			method:    "PUT",
+			url:       "/downloaders/mock/speed",
+			body:      `{"download_kb": -1, "duration": "1h"}`,
+			speedErr:  downloaders.ErrInvalidSpeedLimits,
+			wantCode:  http.StatusBadRequest,
+			wantError: downloaders.ErrInvalidSpeedLimits.Error(),
+		},
+		{
+			name:      "alt speed not supported",
+			method:    "PUT",
+			url:       "/downloaders/mock/speed",
+			body:      `{"alt_speed": true, "duration": "1h"}`,
+			speedErr:  downloaders.ErrNotSupported,
+			wantCode:  http.StatusNotImplemented,
+			wantError: "mock: alt speed is not supported",
+		},
+		{
+			name:     "clear",
+			method:   "DELETE",
+			url:      "/downloaders/mock/speed",
+			wantCode: http.StatusOK,
+			want:     downloaders.BandwidthStatus{Source: "default"},
+		},
+		{
+			name:      "downloader not found",
+			method:    "GET",
+			url:       "/downloaders/nonexistent/speed",
+			wantCode:  http.StatusNotFound,
+			wantError: "Downloader not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv, router, _, _ := testSetup(t)
+			mock := serv.downloaders["mock"].(*downloadersMock)
+			mock.mockSpeedErr = tt.speedErr
+			mock.speed = downloaders.BandwidthStatus{Limits: downloaders.SpeedLimits{DownloadKB: 100}, Source: "schedule"}
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantError != "" {
+				var response map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.wantError, response["error"])
+				return
+			}
+
+			var got downloaders.BandwidthStatus
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			if tt.wantUntil != "" {
+				require.NotNil(t, got.Until)
+				assert.Equal(t, tt.wantUntil, got.Until.UTC().Format(time.RFC3339))
+				got.Until = nil
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
 func TestService_handleManualOrganized_Success(t *testing.T) {
 	_, router, _, testDB := testSetup(t)
 
@@ -1060,3 +1656,166 @@ func TestService_handleRePlan_EmptyUserHint_UsesRegularPlan(t *testing.T) {
 	assert.Equal(t, db.Planed, updatedStatus.OrganizeState)
 	assert.NotNil(t, updatedStatus.OrganizePlans)
 }
+
+func TestService_DownloadRSSMatch(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		serv, _, m, testDB := testSetup(t)
+		m.mockPrivate = true
+
+		m.mockDetailResult = &indexers.ResourceDetail{
+			ListResourceItem: indexers.ListResourceItem{
+				ID:       "res-1",
+				Title:    "Resource 1",
+				Category: "Movie",
+			},
+			Files: []indexers.File{{Name: "movie.mkv", Size: 100}},
+		}
+		m.mockDownloadResult = &indexers.DownloadResult{TorrentHash: "hash-1", TorrentData: []byte("torrent")}
+		serv.downloaders["mock"].(*downloadersMock).mockAddHash = "hash-1"
+
+		search := &db.RSSSearch{Indexer: "mock", Text: "resource", Action: indexers.ActionNotification, ResID: "res-1"}
+		require.NoError(t, db.AddSearch(testDB, search))
+
+		require.NoError(t, serv.DownloadRSSMatch(search.ID, ""))
+
+		status, err := db.GetDownloadStatusByID(testDB, "hash-1")
+		require.NoError(t, err)
+		assert.Equal(t, "mock", status.Downloader)
+		assert.Equal(t, db.DownloadStarted, status.State)
+		assert.Equal(t, "Resource 1", status.ResTitle)
+		assert.Equal(t, "mock", status.ResIndexer)
+		assert.True(t, status.Private)
+		assert.Equal(t, []string{"movie.mkv"}, status.FileList)
+
+		_, err = db.GetSearch(testDB, search.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("success - keeps search below max matches", func(t *testing.T) {
+		serv, _, m, testDB := testSetup(t)
+
+		m.mockDetailResult = &indexers.ResourceDetail{
+			ListResourceItem: indexers.ListResourceItem{ID: "res-1", Title: "Resource 1"},
+		}
+		m.mockDownloadResult = &indexers.DownloadResult{TorrentHash: "hash-1", TorrentData: []byte("torrent")}
+		serv.downloaders["mock"].(*downloadersMock).mockAddHash = "hash-1"
+
+		search := &db.RSSSearch{Indexer: "mock", Text: "resource", Action: indexers.ActionNotification, ResID: "res-1", MaxMatches: 3, MatchCount: 1}
+		require.NoError(t, db.AddSearch(testDB, search))
+
+		require.NoError(t, serv.DownloadRSSMatch(search.ID, ""))
+
+		_, err := db.GetSearch(testDB, search.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			search      *db.RSSSearch
+			mockErr     *errors.HTTPStatusError
+			expectedMsg string
+		}{
+			{
+				name:        "search not found",
+				expectedMsg: "record not found",
+			},
+			{
+				name:        "indexer not found",
+				search:      &db.RSSSearch{Indexer: "nonexistent", Text: "resource", ResID: "res-1"},
+				expectedMsg: "Indexer not found",
+			},
+			{
+				name:        "indexer returns error",
+				search:      &db.RSSSearch{Indexer: "mock", Text: "resource", ResID: "res-1"},
+				mockErr:     errors.NewHTTPStatusError(http.StatusInternalServerError, "mock detail error"),
+				expectedMsg: "mock detail error",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				serv, _, m, testDB := testSetup(t)
+				m.mockDetailErr = tt.mockErr
+
+				id := uint(999)
+				if tt.search != nil {
+					require.NoError(t, db.AddSearch(testDB, tt.search))
+					id = tt.search.ID
+				}
+
+				err := serv.DownloadRSSMatch(id, "")
+				require.Error(t, err)
+				assert.Equal(t, tt.expectedMsg, err.Error())
+			})
+		}
+	})
+}
+
+func TestService_IgnoreRSSMatch(t *testing.T) {
+	serv, _, _, testDB := testSetup(t)
+
+	search := &db.RSSSearch{Indexer: "mock", Text: "resource", Action: indexers.ActionNotification, ResID: "res-1"}
+	require.NoError(t, db.AddSearch(testDB, search))
+
+	require.NoError(t, serv.IgnoreRSSMatch(search.ID, ""))
+
+	got, err := db.GetSearch(testDB, search.ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.ResID)
+	assert.Equal(t, []string{"res-1"}, got.IgnoredResIDs)
+}
+
+func TestService_FindDownloadStatus(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		serv, _, _, testDB := testSetup(t)
+		require.NoError(t, testDB.Create(&db.DownloadStatus{ID: "abc123"}).Error)
+
+		got, err := serv.FindDownloadStatus("abc")
+		require.Nil(t, err)
+		assert.Equal(t, "abc123", got.ID)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			prefix       string
+			expectedCode int
+		}{
+			{name: "not found", prefix: "xyz", expectedCode: http.StatusNotFound},
+			{name: "ambiguous", prefix: "abc", expectedCode: http.StatusBadRequest},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				serv, _, _, testDB := testSetup(t)
+				require.NoError(t, testDB.Create(&db.DownloadStatus{ID: "abc123"}).Error)
+				require.NoError(t, testDB.Create(&db.DownloadStatus{ID: "abc456"}).Error)
+
+				_, err := serv.FindDownloadStatus(tt.prefix)
+				require.NotNil(t, err)
+				assert.Equal(t, tt.expectedCode, err.Code)
+			})
+		}
+	})
+}
+
+func TestService_getPostProcessStatus(t *testing.T) {
+	_, router, _, _ := testSetup(t)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/downloaders/mock/postprocessing", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status downloaders.PostProcessStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, 2, status.TransferWorkers)
+	require.Len(t, status.Items, 1)
+	assert.Equal(t, "busy", status.Items[0].Reason)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/downloaders/nonexistent/postprocessing", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"github.com/autoget-project/autoget/backend/downloaders"
+	"github.com/gin-gonic/gin"
+)
+
+// ReorderQueueRequest lists queued downloads to put first, in order.
+type ReorderQueueRequest struct {
+	IDs []string `json:"ids" binding:"required"`
+}
+
+// QueuePriorityRequest sets the priority of a queued download, higher is
+// released first.
+type QueuePriorityRequest struct {
+	Priority *int `json:"priority" binding:"required"`
+}
+
+func (s *Service) getQueue(c *gin.Context) {
+	downloader, ok := s.downloaders[c.Param("downloader")]
+	if !ok {
+		c.JSON(404, gin.H{"error": "Downloader not found"})
+		return
+	}
+	status, err := downloader.QueueStatus()
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(200, status)
+}
+
+func (s *Service) reorderQueue(c *gin.Context) {
+	downloader, ok := s.downloaders[c.Param("downloader")]
+	if !ok {
+		c.JSON(404, gin.H{"error": "Downloader not found"})
+		return
+	}
+	req := &ReorderQueueRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := downloader.ReorderQueue(req.IDs); err != nil {
+		queueError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"status": "reordered"})
+}
+
+func (s *Service) setQueuePriority(c *gin.Context) {
+	downloader, ok := s.downloaders[c.Param("downloader")]
+	if !ok {
+		c.JSON(404, gin.H{"error": "Downloader not found"})
+		return
+	}
+	req := &QueuePriorityRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := downloader.SetQueuePriority(c.Param("id"), *req.Priority); err != nil {
+		queueError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{"status": "priority set"})
+}
+
+func queueError(c *gin.Context, err error) {
+	if err == downloaders.ErrNotQueued {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(500, gin.H{"error": err.Error()})
+}
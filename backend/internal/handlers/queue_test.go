@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/autoget-project/autoget/backend/downloaders"
+	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_indexerDownloadQueued(t *testing.T) {
+	serv, router, m, testDB := testSetup(t)
+
+	m.mockDetailResult = &indexers.ResourceDetail{
+		ListResourceItem: indexers.ListResourceItem{ID: "res-1", Title: "Resource 1"},
+	}
+	m.mockDownloadResult = &indexers.DownloadResult{TorrentHash: "hash-1", TorrentData: []byte("torrent")}
+	downloader := serv.downloaders["mock"].(*downloadersMock)
+	downloader.mockAddHash = "hash-1"
+	downloader.mockQueued = true
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/indexers/mock/resources/res-1/download?labels=tv&priority=1&queue_priority=2", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	status, err := db.GetDownloadStatusByID(testDB, "hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, db.DownloadQueued, status.State)
+	assert.Equal(t, 2, status.QueuePriority)
+	assert.Positive(t, status.QueuePosition)
+	assert.Equal(t, &db.AddOptions{Labels: []string{"tv"}, Priority: 1}, status.AddOptions)
+
+	// kept to add it once released.
+	data, err := db.GetTorrentFile(testDB, "hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("torrent"), data)
+}
+
+func TestService_getQueue(t *testing.T) {
+	_, router, _, _ := testSetup(t)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/downloaders/mock/queue", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var status downloaders.QueueStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, 2, status.MaxActive)
+	assert.Equal(t, []downloaders.QueuedDownload{{ID: "aa", Title: "Show", Priority: 1}}, status.Items)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/downloaders/nonexistent/queue", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestService_queueActions(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		queueErr   error
+		wantCode   int
+		wantAction string
+	}{
+		{
+			name:       "reorder",
+			path:       "/downloaders/mock/queue/reorder",
+			body:       `{"ids": ["bb", "aa"]}`,
+			wantCode:   http.StatusOK,
+			wantAction: "reorder bb,aa",
+		},
+		{
+			name:     "reorder without ids",
+			path:     "/downloaders/mock/queue/reorder",
+			body:     `{}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "reorder not queued",
+			path:     "/downloaders/mock/queue/reorder",
+			body:     `{"ids": ["cc"]}`,
+			queueErr: downloaders.ErrNotQueued,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:       "priority",
+			path:       "/downloaders/mock/queue/aa/priority",
+			body:       `{"priority": 0}`,
+			wantCode:   http.StatusOK,
+			wantAction: "priority aa 0",
+		},
+		{
+			name:     "priority missing",
+			path:     "/downloaders/mock/queue/aa/priority",
+			body:     `{}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "priority not queued",
+			path:     "/downloaders/mock/queue/aa/priority",
+			body:     `{"priority": 1}`,
+			queueErr: downloaders.ErrNotQueued,
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "unknown downloader",
+			path:     "/downloaders/nonexistent/queue/reorder",
+			body:     `{"ids": ["aa"]}`,
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv, router, _, _ := testSetup(t)
+			downloader := serv.downloaders["mock"].(*downloadersMock)
+			downloader.mockQueueErr = tt.queueErr
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code, w.Body.String())
+			if tt.wantAction != "" {
+				assert.Equal(t, []string{tt.wantAction}, downloader.actions)
+			} else {
+				assert.Empty(t, downloader.actions)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/autoget-project/autoget/backend/downloaders"
+	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var reconcileActions = []string{"adopt", "missing", "readd"}
+
+// ReconcileRequest picks the orphan of a reconcile action by ID, the hash of
+// an untracked torrent or the ID of a missing download.
+type ReconcileRequest struct {
+	ID string `json:"id" binding:"required"`
+
+	// Optional for adopt: the resource is looked up on Indexer by
+	// ResourceID, or by Title, which is also the title without Indexer.
+	Indexer    string `json:"indexer"`
+	ResourceID string `json:"resource_id"`
+	Title      string `json:"title"`
+}
+
+func (s *Service) reconcile(c *gin.Context) {
+	r, er := s.Reconcile(c.Param("downloader"))
+	if er != nil {
+		c.JSON(er.Code, gin.H{"error": er.Message})
+		return
+	}
+	c.JSON(200, r)
+}
+
+// Reconcile reports torrents of the downloader not tracked, and tracked
+// downloads gone from it.
+func (s *Service) Reconcile(downloaderName string) (*downloaders.Reconciliation, *errors.HTTPStatusError) {
+	downloader, ok := s.downloaders[downloaderName]
+	if !ok {
+		return nil, errors.NewHTTPStatusError(http.StatusNotFound, "Downloader not found")
+	}
+
+	r, err := downloader.Reconcile()
+	if err != nil {
+		return nil, errors.NewHTTPStatusError(http.StatusBadGateway, "failed to reconcile: "+err.Error())
+	}
+	return r, nil
+}
+
+func (s *Service) reconcileAction(c *gin.Context) {
+	req := &ReconcileRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	action := c.Param("action")
+	if er := s.ReconcileAction(c.Param("downloader"), action, req); er != nil {
+		c.JSON(er.Code, gin.H{"error": er.Message})
+		return
+	}
+	c.JSON(200, gin.H{"status": action})
+}
+
+// ReconcileAction adopts an untracked torrent, or marks a missing download as
+// missing or adds it again.
+func (s *Service) ReconcileAction(downloaderName, action string, req *ReconcileRequest) *errors.HTTPStatusError {
+	downloader, ok := s.downloaders[downloaderName]
+	if !ok {
+		return errors.NewHTTPStatusError(http.StatusNotFound, "Downloader not found")
+	}
+
+	var err error
+	switch action {
+	case "adopt":
+		status, er := s.lookupResource(req)
+		if er != nil {
+			return er
+		}
+		err = downloader.Adopt(req.ID, status)
+	case "missing":
+		err = downloader.MarkMissing(req.ID)
+	case "readd":
+		err = downloader.ReAdd(req.ID)
+	default:
+		return errors.NewHTTPStatusError(http.StatusBadRequest, "Invalid action. Valid actions: "+strings.Join(reconcileActions, ", "))
+	}
+
+	switch {
+	case err == nil:
+		return nil
+	case err == downloaders.ErrTorrentNotFound:
+		return errors.NewHTTPStatusError(http.StatusNotFound, "Torrent not found in downloader")
+	case err == gorm.ErrRecordNotFound:
+		return errors.NewHTTPStatusError(http.StatusNotFound, "Download not found")
+	case err == downloaders.ErrAlreadyTracked, err == downloaders.ErrNotMissing, err == downloaders.ErrNoTorrentFile:
+		return errors.NewHTTPStatusError(http.StatusConflict, err.Error())
+	default:
+		return errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
+	}
+}
+
+// lookupResource fills resource info of an adopted torrent from the indexer.
+func (s *Service) lookupResource(req *ReconcileRequest) (*db.DownloadStatus, *errors.HTTPStatusError) {
+	status := &db.DownloadStatus{ResTitle: req.Title}
+	if req.Indexer == "" {
+		return status, nil
+	}
+	indexer, ok := s.indexers[req.Indexer]
+	if !ok {
+		return nil, errIndexerNotFound
+	}
+	status.ResIndexer = req.Indexer
+	status.Private = indexer.Private()
+
+	resourceID := req.ResourceID
+	if resourceID == "" && req.Title != "" {
+		result, err := indexer.List(&indexers.ListRequest{Keyword: req.Title})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range result.Resources {
+			if strings.EqualFold(item.Title, req.Title) {
+				resourceID = item.ID
+				break
+			}
+		}
+		if resourceID == "" {
+			return nil, errors.NewHTTPStatusError(http.StatusNotFound, "No resource titled \""+req.Title+"\" in "+req.Indexer)
+		}
+	}
+	if resourceID == "" {
+		return status, nil
+	}
+
+	detail, err := indexer.Detail(resourceID, true)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, file := range detail.Files {
+		files = append(files, file.Name)
+	}
+	status.ResTitle = detail.Title
+	status.ResTitle2 = detail.Title2
+	status.Category = detail.Category
+	status.FileList = files
+	status.Metadata = detail.Metadata
+	return status, nil
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/autoget-project/autoget/backend/downloaders"
+	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_reconcile(t *testing.T) {
+	_, router, _, _ := testSetup(t)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/downloaders/mock/reconcile", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var r downloaders.Reconciliation
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &r))
+	assert.Equal(t, []downloaders.UntrackedTorrent{{Hash: "aa", Name: "Show"}}, r.Untracked)
+	assert.Equal(t, []downloaders.MissingDownload{{ID: "bb", Title: "Movie", CanReAdd: true}}, r.Missing)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/downloaders/nonexistent/reconcile", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestService_reconcileAction(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		body       string
+		list       []indexers.ListResourceItem
+		actionErr  error
+		wantCode   int
+		wantError  string
+		wantAction string
+		wantTitle  string
+		wantIndex  string
+	}{
+		{
+			name:       "adopt with title",
+			action:     "adopt",
+			body:       `{"id": "aa", "title": "My Show"}`,
+			wantCode:   http.StatusOK,
+			wantAction: "adopt aa",
+			wantTitle:  "My Show",
+		},
+		{
+			name:       "adopt with resource",
+			action:     "adopt",
+			body:       `{"id": "aa", "indexer": "mock", "resource_id": "res-1"}`,
+			wantCode:   http.StatusOK,
+			wantAction: "adopt aa",
+			wantTitle:  "Resource 1",
+			wantIndex:  "mock",
+		},
+		{
+			name:       "adopt by title lookup",
+			action:     "adopt",
+			body:       `{"id": "aa", "indexer": "mock", "title": "resource 1"}`,
+			list:       []indexers.ListResourceItem{{ID: "res-2", Title: "Resource 1 Extra"}, {ID: "res-1", Title: "Resource 1"}},
+			wantCode:   http.StatusOK,
+			wantAction: "adopt aa",
+			wantTitle:  "Resource 1",
+			wantIndex:  "mock",
+		},
+		{
+			name:      "title not found",
+			action:    "adopt",
+			body:      `{"id": "aa", "indexer": "mock", "title": "Other"}`,
+			list:      []indexers.ListResourceItem{{ID: "res-1", Title: "Resource 1"}},
+			wantCode:  http.StatusNotFound,
+			wantError: `No resource titled "Other" in mock`,
+		},
+		{
+			name:      "unknown indexer",
+			action:    "adopt",
+			body:      `{"id": "aa", "indexer": "other"}`,
+			wantCode:  http.StatusNotFound,
+			wantError: "Indexer not found",
+		},
+		{
+			name:      "already tracked",
+			action:    "adopt",
+			body:      `{"id": "aa"}`,
+			actionErr: downloaders.ErrAlreadyTracked,
+			wantCode:  http.StatusConflict,
+			wantError: downloaders.ErrAlreadyTracked.Error(),
+		},
+		{
+			name:       "mark missing",
+			action:     "missing",
+			body:       `{"id": "bb"}`,
+			wantCode:   http.StatusOK,
+			wantAction: "missing bb",
+		},
+		{
+			name:      "still in downloader",
+			action:    "missing",
+			body:      `{"id": "bb"}`,
+			actionErr: downloaders.ErrNotMissing,
+			wantCode:  http.StatusConflict,
+			wantError: downloaders.ErrNotMissing.Error(),
+		},
+		{
+			name:       "add again",
+			action:     "readd",
+			body:       `{"id": "bb"}`,
+			wantCode:   http.StatusOK,
+			wantAction: "readd bb",
+		},
+		{
+			name:      "no torrent file",
+			action:    "readd",
+			body:      `{"id": "bb"}`,
+			actionErr: downloaders.ErrNoTorrentFile,
+			wantCode:  http.StatusConflict,
+			wantError: downloaders.ErrNoTorrentFile.Error(),
+		},
+		{
+			name:      "invalid action",
+			action:    "forget",
+			body:      `{"id": "bb"}`,
+			wantCode:  http.StatusBadRequest,
+			wantError: "Invalid action. Valid actions: adopt, missing, readd",
+		},
+		{
+			name:     "missing id",
+			action:   "missing",
+			body:     `{}`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv, router, m, _ := testSetup(t)
+			m.mockListResult = &indexers.ListResult{Resources: tt.list}
+			m.mockDetailResult = &indexers.ResourceDetail{
+				ListResourceItem: indexers.ListResourceItem{ID: "res-1", Title: "Resource 1"},
+			}
+			downloader := serv.downloaders["mock"].(*downloadersMock)
+			downloader.mockActionErr = tt.actionErr
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/downloaders/mock/reconcile/"+tt.action, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantError != "" {
+				var response map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.wantError, response["error"])
+			}
+			if tt.wantAction != "" {
+				assert.Equal(t, []string{tt.wantAction}, downloader.actions)
+			}
+			if tt.wantTitle != "" {
+				require.Len(t, downloader.adopted, 1)
+				assert.Equal(t, tt.wantTitle, downloader.adopted[0].ResTitle)
+				assert.Equal(t, tt.wantIndex, downloader.adopted[0].ResIndexer)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/indexers/rsshelper"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// how many latest RSS items a search rule is tested against.
+	maxRecentRSSItems = 500
+
+	matchSourceRSS  = "rss"
+	matchSourceLive = "live"
+
+	// actionSkip is for matches after the search reaches max matches.
+	actionSkip = "skip"
+)
+
+type testSearchReq struct {
+	Indexer    string `json:"indexer" binding:"required"`
+	Text       string `json:"text" binding:"required"`
+	Action     string `json:"action" binding:"required"`
+	MaxMatches uint   `json:"max_matches"`
+
+	// Live also searches the indexer with text.
+	Live bool `json:"live"`
+}
+
+type testSearchMatch struct {
+	Source   string `json:"source"`
+	ResID    string `json:"res_id"`
+	Title    string `json:"title"`
+	Category string `json:"category"`
+	URL      string `json:"url,omitempty"`
+	Action   string `json:"action"`
+}
+
+type testSearchResp struct {
+	Matches []testSearchMatch `json:"matches"`
+}
+
+// testSearch evaluates a search rule without saving it or downloading
+// anything.
+func (s *Service) testSearch(c *gin.Context) {
+	req := &testSearchReq{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	indexer, ok := s.indexers[req.Indexer]
+	if !ok {
+		c.JSON(404, gin.H{"error": "Indexer not found"})
+		return
+	}
+
+	if req.Action != indexers.ActionDownload &&
+		req.Action != indexers.ActionNotification {
+		c.JSON(400, gin.H{"error": "Invalid action"})
+		return
+	}
+
+	search := &db.RSSSearch{
+		Indexer:    req.Indexer,
+		Text:       req.Text,
+		Action:     req.Action,
+		MaxMatches: req.MaxMatches,
+	}
+
+	resp := &testSearchResp{Matches: []testSearchMatch{}}
+	seen := map[string]bool{}
+	add := func(source string, resID, title, category, url string) {
+		if seen[resID] || !rsshelper.MatchText(search, title) {
+			return
+		}
+		seen[resID] = true
+
+		action := search.Action
+		if search.Exhausted() {
+			action = actionSkip
+		} else {
+			search.MatchCount++
+		}
+
+		resp.Matches = append(resp.Matches, testSearchMatch{
+			Source:   source,
+			ResID:    resID,
+			Title:    title,
+			Category: category,
+			URL:      url,
+			Action:   action,
+		})
+	}
+
+	items, _, err := db.ListRSSItems(s.db, req.Indexer, "", 1, maxRecentRSSItems)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+	for _, item := range items {
+		add(matchSourceRSS, item.ResID, item.Title, item.Category, item.URL)
+	}
+
+	if req.Live {
+		result, er := indexer.List(&indexers.ListRequest{Keyword: req.Text})
+		if er != nil {
+			c.JSON(er.Code, gin.H{"error": er.Message})
+			return
+		}
+		for _, r := range result.Resources {
+			add(matchSourceLive, r.ID, r.Title, r.Category, "")
+		}
+	}
+
+	c.JSON(200, resp)
+}
+
+type listRSSItemsReq struct {
+	Indexer  string `form:"indexer"`
+	Keyword  string `form:"keyword"`
+	Page     uint32 `form:"page"`
+	PageSize uint32 `form:"pageSize"`
+}
+
+type listRSSItemsResp struct {
+	Pagination indexers.Pagination `json:"pagination"`
+	Items      []db.RSSItem        `json:"items"`
+}
+
+// listRSSItems browses RSS items pulled from indexers, latest first.
+func (s *Service) listRSSItems(c *gin.Context) {
+	req := &listRSSItemsReq{}
+	if err := c.ShouldBindQuery(req); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.PageSize == 0 {
+		req.PageSize = 50
+	}
+
+	items, total, err := db.ListRSSItems(s.db, req.Indexer, req.Keyword, int(req.Page), int(req.PageSize))
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, &listRSSItemsResp{
+		Pagination: indexers.Pagination{
+			Page:       req.Page,
+			TotalPages: uint32((total + int64(req.PageSize) - 1) / int64(req.PageSize)),
+			PageSize:   req.PageSize,
+			Total:      uint32(total),
+		},
+		Items: items,
+	})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/indexers/rsshelper"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_testSearch(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		_, router, m, testDB := testSetup(t)
+
+		// no search registered, SearchRSS only stores the items.
+		rsshelper.SearchRSS(m, testDB, nil, nil, []*indexers.RSSItem{
+			{ResID: "1", Title: "Frieren 01 1080p", Catergory: "Anime", URL: "http://test.com/1"},
+			{ResID: "2", Title: "Frieren 02 720p", Catergory: "Anime", URL: "http://test.com/2"},
+			{ResID: "3", Title: "Other 01 1080p", Catergory: "Anime", URL: "http://test.com/3"},
+		})
+		m.mockListResult = &indexers.ListResult{
+			Resources: []indexers.ListResourceItem{
+				{ID: "1", Title: "Frieren 01 1080p", Category: "Anime"},
+				{ID: "4", Title: "Frieren 03 1080p", Category: "Anime"},
+			},
+		}
+
+		w := httptest.NewRecorder()
+		reqBody := `{"indexer": "mock", "text": "FRIEREN", "action": "download", "max_matches": 2, "live": true}`
+		req := httptest.NewRequest("POST", "/searches/test", strings.NewReader(reqBody))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp testSearchResp
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, []testSearchMatch{
+			{Source: "rss", ResID: "2", Title: "Frieren 02 720p", Category: "Anime", URL: "http://test.com/2", Action: "download"},
+			{Source: "rss", ResID: "1", Title: "Frieren 01 1080p", Category: "Anime", URL: "http://test.com/1", Action: "download"},
+			{Source: "live", ResID: "4", Title: "Frieren 03 1080p", Category: "Anime", Action: "skip"},
+		}, resp.Matches)
+
+		// nothing is written.
+		var searchCount, statusCount int64
+		require.NoError(t, testDB.Model(&db.RSSSearch{}).Count(&searchCount).Error)
+		require.NoError(t, testDB.Model(&db.DownloadStatus{}).Count(&statusCount).Error)
+		assert.Zero(t, searchCount)
+		assert.Zero(t, statusCount)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			reqBody      string
+			mockErr      *errors.HTTPStatusError
+			expectedCode int
+			expectedMsg  string
+		}{
+			{
+				name:         "missing text",
+				reqBody:      `{"indexer": "mock", "action": "download"}`,
+				expectedCode: http.StatusBadRequest,
+				expectedMsg:  "Key: 'testSearchReq.Text' Error:Field validation for 'Text' failed on the 'required' tag",
+			},
+			{
+				name:         "indexer not found",
+				reqBody:      `{"indexer": "nonexistent", "text": "test", "action": "download"}`,
+				expectedCode: http.StatusNotFound,
+				expectedMsg:  "Indexer not found",
+			},
+			{
+				name:         "invalid action",
+				reqBody:      `{"indexer": "mock", "text": "test", "action": "invalid"}`,
+				expectedCode: http.StatusBadRequest,
+				expectedMsg:  "Invalid action",
+			},
+			{
+				name:         "live search error",
+				reqBody:      `{"indexer": "mock", "text": "test", "action": "download", "live": true}`,
+				mockErr:      errors.NewHTTPStatusError(http.StatusInternalServerError, "mock list error"),
+				expectedCode: http.StatusInternalServerError,
+				expectedMsg:  "mock list error",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, router, m, _ := testSetup(t)
+				m.mockListErr = tt.mockErr
+
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest("POST", "/searches/test", strings.NewReader(tt.reqBody))
+				req.Header.Set("Content-Type", "application/json")
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.expectedCode, w.Code)
+				var resp map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Contains(t, resp["error"], tt.expectedMsg)
+			})
+		}
+	})
+}
+
+func TestService_listRSSItems(t *testing.T) {
+	_, router, _, testDB := testSetup(t)
+
+	now := time.Now()
+	require.NoError(t, db.AddRSSItems(testDB, []*db.RSSItem{
+		{Indexer: "mock", ResID: "1", Title: "Frieren 01", FirstSeenAt: now.Add(-2 * time.Hour)},
+		{Indexer: "mock", ResID: "2", Title: "Frieren 02", FirstSeenAt: now.Add(-time.Hour)},
+		{Indexer: "other", ResID: "3", Title: "Frieren 03", FirstSeenAt: now},
+	}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/rss/items?indexer=mock&keyword=frieren&page=1&pageSize=1", nil)
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp listRSSItemsResp
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, indexers.Pagination{Page: 1, TotalPages: 2, PageSize: 1, Total: 2}, resp.Pagination)
+	require.Len(t, resp.Items, 1)
+	assert.Equal(t, "2", resp.Items[0].ResID)
+	assert.Equal(t, "Frieren 02", resp.Items[0].Title)
+
+	// invalid page
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/rss/items?page=abc", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	dlconfig "github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// maxReplacementOffers is alternatives offered for a stalled download.
+const maxReplacementOffers = 3
+
+var (
+	stalledLogger = log.With().Str("module", "stalled").Logger()
+
+	// releaseTagRegex matches release group, resolution and hash tags of a
+	// title, e.g. [SubsPlease] or (1080p).
+	releaseTagRegex = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)|【[^】]*】`)
+	videoExtRegex   = regexp.MustCompile(`(?i)\.(mkv|mp4|avi|ts|m2ts|wmv)$`)
+)
+
+// RegisterStalledReplacer searches alternatives of stalled downloads every
+// 10 minutes.
+func (s *Service) RegisterStalledReplacer(cron *cron.Cron) {
+	jobID, err := cron.AddFunc("*/10 * * * *", func() {
+		s.ReplaceStalled()
+	})
+	if err != nil {
+		stalledLogger.Error().Err(err).Msg("failed to add cron job")
+		return
+	}
+	stalledLogger.Info().Int64("jobID", int64(jobID)).Msg("added cron job")
+}
+
+// ReplaceStalled searches alternative releases of stalled downloads of
+// downloaders replacing them, then offers them or grabs the best one.
+func (s *Service) ReplaceStalled() {
+	for name, cfg := range s.config.Downloaders {
+		if cfg.Stalled == nil || cfg.Stalled.Replace == "" {
+			continue
+		}
+		statuses, err := db.GetStalledUnsearchedDownloadStatusByDownloader(s.db, name)
+		if err != nil {
+			stalledLogger.Error().Err(err).Str("downloader", name).Msg("failed to get stalled downloads")
+			continue
+		}
+		for _, st := range statuses {
+			replacement := s.replaceStalled(&st, cfg.Stalled)
+			// searching is slow, the row is updated by progress checks
+			// meanwhile.
+			if err := db.SetReplaceSearched(s.db, st.ID, replacement); err != nil {
+				stalledLogger.Error().Err(err).Str("hash", st.ID).Msg("failed to save stalled download")
+			}
+		}
+	}
+}
+
+// replacement is an alternative release of a stalled download.
+type replacement struct {
+	Indexer string
+	indexers.ListResourceItem
+}
+
+// replaceStalled offers or grabs alternatives of st, it returns the grabbed
+// "indexer/id" if any.
+func (s *Service) replaceStalled(st *db.DownloadStatus, cfg *dlconfig.Stalled) string {
+	candidates := s.searchReplacements(st, cfg)
+	if len(candidates) == 0 {
+		s.notifyStalled(fmt.Sprintf("🔍 No alternative release of stalled %s found.", st.ResTitle))
+		return ""
+	}
+
+	// the stalled download is kept if it couldn't be removed.
+	if cfg.Replace == dlconfig.ReplaceGrab && st.State == db.DownloadDeleted {
+		best := candidates[0]
+		if err := s.Download(best.Indexer, best.ID); err != nil {
+			stalledLogger.Error().Err(err).Str("hash", st.ID).Str("resource", best.ID).Msg("failed to grab replacement")
+		} else {
+			s.notifyStalled(fmt.Sprintf("🔁 Replaced stalled %s with %s from %s, %d seeders.", st.ResTitle, best.Title, best.Indexer, best.Seeders))
+			return best.Indexer + "/" + best.ID
+		}
+	}
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "🔍 Alternative releases of stalled %s:\n\n", st.ResTitle)
+	for _, c := range candidates[:min(len(candidates), maxReplacementOffers)] {
+		fmt.Fprintf(sb, "%s\n%d seeders\n/get %s %s\n\n", c.Title, c.Seeders, c.Indexer, c.ID)
+	}
+	s.notifyStalled(strings.TrimSpace(sb.String()))
+	return ""
+}
+
+// searchReplacements lists releases of the same title with seeders, most
+// seeded first.
+func (s *Service) searchReplacements(st *db.DownloadStatus, cfg *dlconfig.Stalled) []replacement {
+	keyword := replacementKeyword(st)
+	if keyword == "" {
+		return nil
+	}
+
+	names := cfg.Indexers
+	if len(names) == 0 {
+		names = []string{st.ResIndexer}
+	}
+
+	candidates := []replacement{}
+	for _, name := range names {
+		indexer, ok := s.indexers[name]
+		if !ok {
+			stalledLogger.Warn().Str("indexer", name).Msg("unknown indexer to search replacements")
+			continue
+		}
+		result, err := indexer.List(&indexers.ListRequest{Keyword: keyword})
+		if err != nil {
+			stalledLogger.Error().Err(err).Str("indexer", name).Msg("failed to search replacements")
+			continue
+		}
+		for _, item := range result.Resources {
+			if item.Seeders == 0 || (name == st.ResIndexer && item.Title == st.ResTitle) {
+				continue
+			}
+			if !strings.Contains(strings.ToLower(item.Title), strings.ToLower(keyword)) {
+				continue
+			}
+			candidates = append(candidates, replacement{Indexer: name, ListResourceItem: item})
+		}
+	}
+
+	slices.SortStableFunc(candidates, func(a, b replacement) int {
+		return int(b.Seeders) - int(a.Seeders)
+	})
+	return candidates
+}
+
+// replacementKeyword is the title of the download without release tags,
+// from its metadata if any.
+func replacementKeyword(st *db.DownloadStatus) string {
+	title := st.ResTitle
+	if t, ok := st.Metadata["title"].(string); ok && t != "" {
+		title = t
+	}
+	title = videoExtRegex.ReplaceAllString(title, "")
+	title = releaseTagRegex.ReplaceAllString(title, " ")
+	return strings.Join(strings.Fields(title), " ")
+}
+
+func (s *Service) notifyStalled(msg string) {
+	if s.notifier == nil {
+		return
+	}
+	if err := s.notifier.SendMessage(msg); err != nil {
+		stalledLogger.Error().Err(err).Msg("failed to send stalled notification")
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	dlconfig "github.com/autoget-project/autoget/backend/downloaders/config"
+	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplacementKeyword(t *testing.T) {
+	tests := []struct {
+		name   string
+		status *db.DownloadStatus
+		want   string
+	}{
+		{
+			name:   "release tags",
+			status: &db.DownloadStatus{ResTitle: "[SubsPlease] Show - 05 (1080p) [ABCD1234].mkv"},
+			want:   "Show - 05",
+		},
+		{
+			name:   "metadata title",
+			status: &db.DownloadStatus{ResTitle: "Movie 2024 1080p", Metadata: map[string]interface{}{"title": "【Group】Movie 2024"}},
+			want:   "Movie 2024",
+		},
+		{
+			name:   "only tags",
+			status: &db.DownloadStatus{ResTitle: "[Group]"},
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, replacementKeyword(tt.status))
+		})
+	}
+}
+
+func TestService_ReplaceStalled(t *testing.T) {
+	list := &indexers.ListResult{Resources: []indexers.ListResourceItem{
+		// the stalled release.
+		{ID: "res-1", Title: "[SubsPlease] Show - 05 (1080p)", Seeders: 9},
+		{ID: "res-2", Title: "[Erai-raws] Show - 05 [720p]", Seeders: 3},
+		{ID: "res-3", Title: "[Group] Show - 05 [1080p]", Seeders: 12},
+		// dead.
+		{ID: "res-4", Title: "[Old] Show - 05", Seeders: 0},
+		// another title.
+		{ID: "res-5", Title: "[Group] Show - 06 [1080p]", Seeders: 20},
+	}}
+
+	setup := func(t *testing.T, stalled *dlconfig.Stalled, state db.DownloadState) (*Service, *indexerMock, *fakeNotifier) {
+		serv, _, m, testDB := testSetup(t)
+		serv.config.Downloaders = map[string]*dlconfig.DownloaderConfig{"mock": {Stalled: stalled}}
+		m.mockListResult = list
+
+		now := time.Now()
+		require.NoError(t, testDB.Create(&db.DownloadStatus{
+			ID:         "stalled",
+			Downloader: "mock",
+			State:      state,
+			ResIndexer: "mock",
+			ResTitle:   "[SubsPlease] Show - 05 (1080p)",
+			StalledAt:  &now,
+		}).Error)
+		return serv, m, serv.notifier.(*fakeNotifier)
+	}
+
+	t.Run("offer", func(t *testing.T) {
+		serv, _, notifier := setup(t, &dlconfig.Stalled{AfterHours: 24, Replace: dlconfig.ReplaceOffer}, db.DownloadStarted)
+
+		serv.ReplaceStalled()
+
+		require.Len(t, notifier.messages, 1)
+		assert.Equal(t, "🔍 Alternative releases of stalled [SubsPlease] Show - 05 (1080p):\n\n"+
+			"[Group] Show - 05 [1080p]\n12 seeders\n/get mock res-3\n\n"+
+			"[Erai-raws] Show - 05 [720p]\n3 seeders\n/get mock res-2", notifier.messages[0])
+
+		r, err := db.GetDownloadStatus(serv.db, "stalled")
+		require.NoError(t, err)
+		assert.True(t, r.ReplaceSearched)
+		assert.Empty(t, r.Replacement)
+
+		// searched once.
+		serv.ReplaceStalled()
+		assert.Len(t, notifier.messages, 1)
+	})
+
+	t.Run("grab", func(t *testing.T) {
+		serv, m, notifier := setup(t, &dlconfig.Stalled{AfterHours: 24, Remove: true, Replace: dlconfig.ReplaceGrab}, db.DownloadDeleted)
+		m.mockDetailResult = &indexers.ResourceDetail{
+			ListResourceItem: indexers.ListResourceItem{ID: "res-3", Title: "[Group] Show - 05 [1080p]"},
+		}
+		m.mockDownloadResult = &indexers.DownloadResult{TorrentHash: "hash-3", TorrentData: []byte("torrent")}
+		serv.downloaders["mock"].(*downloadersMock).mockAddHash = "hash-3"
+
+		serv.ReplaceStalled()
+
+		require.Len(t, notifier.messages, 1)
+		assert.Equal(t, "🔁 Replaced stalled [SubsPlease] Show - 05 (1080p) with [Group] Show - 05 [1080p] from mock, 12 seeders.", notifier.messages[0])
+
+		r, err := db.GetDownloadStatus(serv.db, "stalled")
+		require.NoError(t, err)
+		assert.True(t, r.ReplaceSearched)
+		assert.Equal(t, "mock/res-3", r.Replacement)
+
+		r, err = db.GetDownloadStatus(serv.db, "hash-3")
+		require.NoError(t, err)
+		assert.Equal(t, db.DownloadStarted, r.State)
+	})
+
+	t.Run("grab offers if not removed", func(t *testing.T) {
+		serv, _, notifier := setup(t, &dlconfig.Stalled{AfterHours: 24, Remove: true, Replace: dlconfig.ReplaceGrab}, db.DownloadStarted)
+
+		serv.ReplaceStalled()
+
+		require.Len(t, notifier.messages, 1)
+		assert.Contains(t, notifier.messages[0], "/get mock res-3")
+		assert.Empty(t, serv.downloaders["mock"].(*downloadersMock).added)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		serv, m, notifier := setup(t, &dlconfig.Stalled{AfterHours: 24, Replace: dlconfig.ReplaceOffer}, db.DownloadStarted)
+		m.mockListResult = &indexers.ListResult{}
+
+		serv.ReplaceStalled()
+
+		assert.Equal(t, []string{"🔍 No alternative release of stalled [SubsPlease] Show - 05 (1080p) found."}, notifier.messages)
+	})
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/errors"
+	"github.com/autoget-project/autoget/backend/internal/notify/telegram"
+)
+
+var _ telegram.Backend = (*Service)(nil)
+
+// DownloadRSSMatch downloads resID matched by the search, its latest match if
+// empty.
+func (s *Service) DownloadRSSMatch(searchID uint, resID string) error {
+	search, err := db.GetSearch(s.db, searchID)
+	if err != nil {
+		return err
+	}
+	if resID == "" {
+		resID = search.ResID
+	}
+
+	if er := s.Download(search.Indexer, resID); er != nil {
+		return er
+	}
+
+	if !search.Exhausted() {
+		return nil
+	}
+	return db.DeleteSearch(s.db, searchID)
+}
+
+func (s *Service) RSSMatchDetail(searchID uint, resID string) (*indexers.ResourceDetail, error) {
+	search, err := db.GetSearch(s.db, searchID)
+	if err != nil {
+		return nil, err
+	}
+	if resID == "" {
+		resID = search.ResID
+	}
+
+	indexer, ok := s.indexers[search.Indexer]
+	if !ok {
+		return nil, errIndexerNotFound
+	}
+
+	detail, er := indexer.Detail(resID, true)
+	if er != nil {
+		return nil, er
+	}
+	return detail, nil
+}
+
+func (s *Service) IgnoreRSSMatch(searchID uint, resID string) error {
+	return db.IgnoreSearchMatch(s.db, searchID, resID)
+}
+
+func (s *Service) Unsubscribe(searchID uint) error {
+	return db.DeleteSearch(s.db, searchID)
+}
+
+func (s *Service) DownloaderNames() []string {
+	names := []string{}
+	for name := range s.downloaders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (s *Service) FindDownloadStatus(hashPrefix string) (*db.DownloadStatus, *errors.HTTPStatusError) {
+	statuses, err := db.FindDownloadStatusByIDPrefix(s.db, hashPrefix, 2)
+	if err != nil {
+		return nil, errors.NewHTTPStatusError(http.StatusInternalServerError, err.Error())
+	}
+
+	switch len(statuses) {
+	case 0:
+		return nil, errors.NewHTTPStatusError(http.StatusNotFound, "Download not found")
+	case 1:
+		return &statuses[0], nil
+	default:
+		return nil, errors.NewHTTPStatusError(http.StatusBadRequest, "Hash prefix matches multiple downloads")
+	}
+}
@@ -5,16 +5,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/autoget-project/autoget/backend/internal/db"
 	"gorm.io/gorm"
 )
 
-// DownloadTorrentFileFromURL downloads a file from a given URL and saves it to a specified local path,
+// FetchTorrentFile downloads a torrent file from a given URL and returns its content,
 // while checking for duplicates using the provided database connection.
-func DownloadTorrentFileFromURL(httpClient *http.Client, url string, dest string, dbClient *gorm.DB) (*metainfo.MetaInfo, *metainfo.Info, error) {
+func FetchTorrentFile(httpClient *http.Client, url string, dbClient *gorm.DB) (*metainfo.MetaInfo, []byte, error) {
 	// Get the data
 	resp, err := httpClient.Get(url)
 	if err != nil {
@@ -37,8 +36,7 @@ func DownloadTorrentFileFromURL(httpClient *http.Client, url string, dest string
 		return nil, nil, fmt.Errorf("failed to load metainfo: %w", err)
 	}
 
-	info, err := m.UnmarshalInfo()
-	if err != nil {
+	if _, err := m.UnmarshalInfo(); err != nil {
 		return nil, nil, fmt.Errorf("failed to unmarshal info: %w", err)
 	}
 
@@ -56,18 +54,5 @@ func DownloadTorrentFileFromURL(httpClient *http.Client, url string, dest string
 	}
 	// err == gorm.ErrRecordNotFound means no duplicate found, which is what we want
 
-	// Create the destination file
-	out, err := os.Create(dest)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create file: %w", err)
-	}
-	defer out.Close()
-
-	// Write the response body to the file
-	_, err = io.Copy(out, bytes.NewReader(buffer.Bytes()))
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to copy response body to file: %w", err)
-	}
-
-	return m, &info, nil
+	return m, buffer.Bytes(), nil
 }
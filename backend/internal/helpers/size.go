@@ -0,0 +1,17 @@
+package helpers
+
+import "fmt"
+
+// HumanSize formats b bytes in binary units, e.g. 1.50 GiB.
+func HumanSize(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.2f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -4,4 +4,19 @@ type INotifier interface {
 	SendMessage(message string) error
 
 	SendMarkdownMessage(message string) error
+
+	// SendRSSMatch sends a single match of a notification-only search so the
+	// user can decide what to do with it.
+	SendRSSMatch(match *RSSMatch) error
+}
+
+// RSSMatch is a RSS item matched by a notification-only search.
+type RSSMatch struct {
+	SearchID   uint
+	SearchText string
+	Indexer    string
+	ResID      string
+	Title      string
+	Category   string
+	URL        string
 }
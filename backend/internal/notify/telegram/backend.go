@@ -0,0 +1,52 @@
+package telegram
+
+import (
+	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/errors"
+	"github.com/autoget-project/autoget/backend/organizer"
+)
+
+// Backend is the service logic the bot calls into, shared with the HTTP
+// handlers. Searches are referred by their database ID since telegram limits
+// callback data to 64 bytes. Matches are referred by resID, an empty resID is
+// the latest match of the search.
+type Backend interface {
+	// DownloadRSSMatch downloads the resource matched by the search, the same
+	// way the download API does, and removes the search once exhausted.
+	DownloadRSSMatch(searchID uint, resID string) error
+
+	// RSSMatchDetail returns detail of the resource matched by the search.
+	RSSMatchDetail(searchID uint, resID string) (*indexers.ResourceDetail, error)
+
+	// IgnoreRSSMatch drops the match and keeps the search watching.
+	IgnoreRSSMatch(searchID uint, resID string) error
+
+	// Unsubscribe removes the search.
+	Unsubscribe(searchID uint) error
+
+	// ListResources lists resources of the indexer.
+	ListResources(indexer string, req *indexers.ListRequest) (*indexers.ListResult, *errors.HTTPStatusError)
+
+	// Download downloads the resource from the indexer.
+	Download(indexer string, resID string) *errors.HTTPStatusError
+
+	// DownloaderNames returns names of all downloaders, sorted.
+	DownloaderNames() []string
+
+	// DownloadStatuses returns download statuses of the downloader in the
+	// given state, see the downloader statuses API for valid states.
+	DownloadStatuses(downloader string, state string) ([]db.DownloadStatus, *errors.HTTPStatusError)
+
+	// FindDownloadStatus finds the download by hash or an unique prefix of it.
+	FindDownloadStatus(hashPrefix string) (*db.DownloadStatus, *errors.HTTPStatusError)
+
+	// AcceptPlan executes the organize plan of the download.
+	AcceptPlan(downloadStatus *db.DownloadStatus) (*organizer.ExecuteResponse, *errors.HTTPStatusError)
+
+	// RePlan asks the organizer for a new plan of the download.
+	RePlan(downloadStatus *db.DownloadStatus, userHint string) (*organizer.PlanResponse, *errors.HTTPStatusError)
+
+	// RegisterSearch subscribes to RSS items of the indexer matching search.Text.
+	RegisterSearch(search *db.RSSSearch) *errors.HTTPStatusError
+}
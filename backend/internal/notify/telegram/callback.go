@@ -0,0 +1,188 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/internal/helpers"
+	"github.com/autoget-project/autoget/backend/internal/notify"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	callbackPrefix = "rss:"
+
+	actionDownload    = "dl"
+	actionDetail      = "detail"
+	actionIgnore      = "ignore"
+	actionUnsubscribe = "unsub"
+
+	maxDetailFiles = 10
+
+	// maxCallbackData is the limit of telegram on callback data.
+	maxCallbackData = 64
+)
+
+func renderRSSMatch(match *notify.RSSMatch) string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "[%s] New match for \"%s\"\n\n", match.Indexer, match.SearchText)
+	fmt.Fprintf(sb, "%s\n", match.Title)
+	if match.Category != "" {
+		fmt.Fprintf(sb, "Category: %s\n", match.Category)
+	}
+	if match.URL != "" {
+		fmt.Fprintf(sb, "%s\n", match.URL)
+	}
+	return sb.String()
+}
+
+// callbackData refers to the match resID of the search, so buttons of an
+// older message act on its own match. resID is left out if it doesn't fit,
+// the latest match is used then.
+func callbackData(action string, searchID uint, resID string) string {
+	data := fmt.Sprintf("%s%s:%d", callbackPrefix, action, searchID)
+	if resID != "" && len(data)+1+len(resID) <= maxCallbackData {
+		data += ":" + resID
+	}
+	return data
+}
+
+// parseCallbackData returns action, search ID and resID, empty in messages
+// sent before matches were referred.
+func parseCallbackData(data string) (string, uint, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(data, callbackPrefix), ":", 3)
+	if len(parts) < 2 {
+		return "", 0, "", fmt.Errorf("invalid callback data: %s", data)
+	}
+
+	searchID, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("invalid search id in callback data: %s", data)
+	}
+
+	resID := ""
+	if len(parts) == 3 {
+		resID = parts[2]
+	}
+	return parts[0], uint(searchID), resID, nil
+}
+
+func rssMatchKeyboard(searchID uint, resID string) *models.InlineKeyboardMarkup {
+	return &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{
+			{
+				{Text: "Download", CallbackData: callbackData(actionDownload, searchID, resID)},
+				{Text: "Details", CallbackData: callbackData(actionDetail, searchID, resID)},
+			},
+			{
+				{Text: "Ignore", CallbackData: callbackData(actionIgnore, searchID, resID)},
+				{Text: "Unsubscribe", CallbackData: callbackData(actionUnsubscribe, searchID, resID)},
+			},
+		},
+	}
+}
+
+func (n *Notifier) handleCallback(ctx context.Context, b *bot.Bot, update *models.Update) {
+	q := update.CallbackQuery
+	msg := q.Message.Message
+	if msg == nil || !n.isAllowed(msg.Chat.ID, q.From.ID) {
+		n.answerCallback(ctx, b, q.ID, "Not allowed")
+		return
+	}
+
+	action, searchID, resID, err := parseCallbackData(q.Data)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to parse callback data")
+		n.answerCallback(ctx, b, q.ID, err.Error())
+		return
+	}
+
+	status := ""
+	switch action {
+	case actionDownload:
+		err = n.backend.DownloadRSSMatch(searchID, resID)
+		status = "Download started"
+	case actionDetail:
+		var detail *indexers.ResourceDetail
+		detail, err = n.backend.RSSMatchDetail(searchID, resID)
+		if err == nil {
+			// keep the buttons, user may still want to download it.
+			n.answerCallback(ctx, b, q.ID, "")
+			_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: msg.Chat.ID,
+				Text:   renderDetail(detail),
+				ReplyParameters: &models.ReplyParameters{
+					MessageID: msg.ID,
+				},
+			})
+			if err != nil {
+				logger.Error().Err(err).Msg("failed to send resource detail")
+			}
+			return
+		}
+	case actionIgnore:
+		err = n.backend.IgnoreRSSMatch(searchID, resID)
+		status = "Ignored"
+	case actionUnsubscribe:
+		err = n.backend.Unsubscribe(searchID)
+		status = "Unsubscribed"
+	default:
+		err = fmt.Errorf("unknown action: %s", action)
+	}
+
+	if err != nil {
+		logger.Error().Err(err).Str("action", action).Uint("searchID", searchID).Str("resID", resID).Msg("failed to handle callback")
+		n.answerCallback(ctx, b, q.ID, "Failed: "+err.Error())
+		return
+	}
+
+	n.answerCallback(ctx, b, q.ID, status)
+
+	// editing the text without reply markup also removes the buttons.
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    msg.Chat.ID,
+		MessageID: msg.ID,
+		Text:      msg.Text + "\n" + status,
+	}); err != nil {
+		logger.Error().Err(err).Msg("failed to edit message")
+	}
+}
+
+func (n *Notifier) answerCallback(ctx context.Context, b *bot.Bot, id string, text string) {
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: id,
+		Text:            text,
+	}); err != nil {
+		logger.Error().Err(err).Msg("failed to answer callback query")
+	}
+}
+
+func renderDetail(detail *indexers.ResourceDetail) string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%s\n", detail.Title)
+	if detail.Title2 != "" {
+		fmt.Fprintf(sb, "%s\n", detail.Title2)
+	}
+	sb.WriteString("\n")
+	if detail.Category != "" {
+		fmt.Fprintf(sb, "Category: %s\n", detail.Category)
+	}
+	fmt.Fprintf(sb, "Size: %s\n", helpers.HumanSize(detail.Size))
+	fmt.Fprintf(sb, "Seeders: %d, Leechers: %d\n", detail.Seeders, detail.Leechers)
+
+	if len(detail.Files) > 0 {
+		fmt.Fprintf(sb, "\nFiles (%d):\n", len(detail.Files))
+		for i, f := range detail.Files {
+			if i == maxDetailFiles {
+				fmt.Fprintf(sb, "- ... and %d more\n", len(detail.Files)-maxDetailFiles)
+				break
+			}
+			fmt.Fprintf(sb, "- %s (%s)\n", f.Name, helpers.HumanSize(f.Size))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,291 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/helpers"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	maxSearchResults = 10
+	maxPlanActions   = 5
+	shortHashLen     = 8
+
+	// telegram rejects messages longer than 4096 characters.
+	maxMessageLen = 4000
+)
+
+const usage = `/search <indexer> <text> - search resources
+/get <indexer> <id> - download a resource
+/status - list downloading resources
+/plans - list organize plans waiting for review
+/accept <hash> - execute the organize plan
+/replan <hash> [hint] - ask organizer for a new plan
+/subscribe <indexer> <download|notification> <text> - subscribe RSS`
+
+type commandHandler func(ctx context.Context, args string) string
+
+func (n *Notifier) registerCommands() {
+	commands := map[string]commandHandler{
+		"start":     n.cmdHelp,
+		"help":      n.cmdHelp,
+		"search":    n.cmdSearch,
+		"get":       n.cmdGet,
+		"status":    n.cmdStatus,
+		"plans":     n.cmdPlans,
+		"accept":    n.cmdAccept,
+		"replan":    n.cmdRePlan,
+		"subscribe": n.cmdSubscribe,
+	}
+
+	for name, h := range commands {
+		n.bot.RegisterHandler(bot.HandlerTypeMessageText, name, bot.MatchTypeCommandStartOnly, n.command(h))
+	}
+}
+
+// command wraps a command handler with access control and sends its reply.
+func (n *Notifier) command(h commandHandler) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		msg := update.Message
+		userID := int64(0)
+		if msg.From != nil {
+			userID = msg.From.ID
+		}
+		if !n.isAllowed(msg.Chat.ID, userID) {
+			logger.Warn().Int64("chatID", msg.Chat.ID).Int64("userID", userID).Msg("unauthorized command")
+			return
+		}
+
+		_, args, _ := strings.Cut(msg.Text, " ")
+		reply := h(ctx, strings.TrimSpace(args))
+		reply = truncate(reply, maxMessageLen)
+
+		if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: msg.Chat.ID,
+			Text:   reply,
+			ReplyParameters: &models.ReplyParameters{
+				MessageID: msg.ID,
+			},
+		}); err != nil {
+			logger.Error().Err(err).Msg("failed to reply command")
+		}
+	}
+}
+
+// truncate cuts s longer than n bytes on a rune boundary, marked by "...".
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "\n..."
+}
+
+// splitArgs splits args into at most n parts, the last part keeps the rest.
+func splitArgs(args string, n int) []string {
+	parts := []string{}
+	for len(parts) < n-1 {
+		args = strings.TrimSpace(args)
+		if args == "" {
+			return parts
+		}
+		part, rest, _ := strings.Cut(args, " ")
+		parts = append(parts, part)
+		args = rest
+	}
+	if args = strings.TrimSpace(args); args != "" {
+		parts = append(parts, args)
+	}
+	return parts
+}
+
+func shortHash(hash string) string {
+	if len(hash) > shortHashLen {
+		return hash[:shortHashLen]
+	}
+	return hash
+}
+
+func (n *Notifier) cmdHelp(ctx context.Context, args string) string {
+	return usage
+}
+
+func (n *Notifier) cmdSearch(ctx context.Context, args string) string {
+	parts := splitArgs(args, 2)
+	if len(parts) != 2 {
+		return "Usage: /search <indexer> <text>"
+	}
+
+	result, err := n.backend.ListResources(parts[0], &indexers.ListRequest{Keyword: parts[1]})
+	if err != nil {
+		return "Failed: " + err.Message
+	}
+	if len(result.Resources) == 0 {
+		return "Nothing found"
+	}
+
+	sb := &strings.Builder{}
+	for i, r := range result.Resources {
+		if i == maxSearchResults {
+			fmt.Fprintf(sb, "... and %d more\n", len(result.Resources)-maxSearchResults)
+			break
+		}
+		fmt.Fprintf(sb, "%s\n%s, %d seeders\n/get %s %s\n\n", r.Title, helpers.HumanSize(r.Size), r.Seeders, parts[0], r.ID)
+	}
+	return sb.String()
+}
+
+func (n *Notifier) cmdGet(ctx context.Context, args string) string {
+	parts := splitArgs(args, 2)
+	if len(parts) != 2 {
+		return "Usage: /get <indexer> <id>"
+	}
+
+	if err := n.backend.Download(parts[0], parts[1]); err != nil {
+		return "Failed: " + err.Message
+	}
+	return "Download started"
+}
+
+func (n *Notifier) cmdStatus(ctx context.Context, args string) string {
+	sb := &strings.Builder{}
+	for _, name := range n.backend.DownloaderNames() {
+		statuses, err := n.backend.DownloadStatuses(name, "downloading")
+		if err != nil {
+			fmt.Fprintf(sb, "%s: failed: %s\n\n", name, err.Message)
+			continue
+		}
+		if len(statuses) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(sb, "%s:\n", name)
+		for _, s := range statuses {
+			fmt.Fprintf(sb, "- %s %.1f%%\n", s.ResTitle, float64(s.DownloadProgress)/10)
+		}
+		sb.WriteString("\n")
+	}
+
+	if sb.Len() == 0 {
+		return "Nothing downloading"
+	}
+	return sb.String()
+}
+
+func (n *Notifier) cmdPlans(ctx context.Context, args string) string {
+	sb := &strings.Builder{}
+	for _, name := range n.backend.DownloaderNames() {
+		statuses, err := n.backend.DownloadStatuses(name, "planned")
+		if err != nil {
+			fmt.Fprintf(sb, "%s: failed: %s\n\n", name, err.Message)
+			continue
+		}
+
+		for _, s := range statuses {
+			sb.WriteString(renderPlan(&s))
+			fmt.Fprintf(sb, "/accept %s\n\n", shortHash(s.ID))
+		}
+	}
+
+	if sb.Len() == 0 {
+		return "No plan waiting for review"
+	}
+	return sb.String()
+}
+
+func renderPlan(s *db.DownloadStatus) string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "[%s] %s\n", shortHash(s.ID), s.ResTitle)
+	if s.OrganizePlans == nil {
+		return sb.String()
+	}
+	if s.OrganizePlans.Error != "" {
+		fmt.Fprintf(sb, "error: %s\n", s.OrganizePlans.Error)
+	}
+	for i, a := range s.OrganizePlans.Plan {
+		if i == maxPlanActions {
+			fmt.Fprintf(sb, "... and %d more\n", len(s.OrganizePlans.Plan)-maxPlanActions)
+			break
+		}
+		if a.Target != "" {
+			fmt.Fprintf(sb, "%s: %s -> %s\n", a.Action, a.File, a.Target)
+		} else {
+			fmt.Fprintf(sb, "%s: %s\n", a.Action, a.File)
+		}
+	}
+	return sb.String()
+}
+
+func (n *Notifier) cmdAccept(ctx context.Context, args string) string {
+	parts := splitArgs(args, 1)
+	if len(parts) != 1 {
+		return "Usage: /accept <hash>"
+	}
+
+	s, err := n.backend.FindDownloadStatus(parts[0])
+	if err != nil {
+		return "Failed: " + err.Message
+	}
+
+	failed, err := n.backend.AcceptPlan(s)
+	if err != nil {
+		return "Failed: " + err.Message
+	}
+	if failed == nil {
+		return "Organized " + s.ResTitle
+	}
+
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "Partially organized %s, failed moves:\n", s.ResTitle)
+	for _, f := range failed.FailedMoves {
+		fmt.Fprintf(sb, "- %s: %s\n", f.File, f.Reason)
+	}
+	return sb.String()
+}
+
+func (n *Notifier) cmdRePlan(ctx context.Context, args string) string {
+	parts := splitArgs(args, 2)
+	if len(parts) == 0 {
+		return "Usage: /replan <hash> [hint]"
+	}
+
+	s, err := n.backend.FindDownloadStatus(parts[0])
+	if err != nil {
+		return "Failed: " + err.Message
+	}
+
+	hint := ""
+	if len(parts) == 2 {
+		hint = parts[1]
+	}
+
+	if _, err := n.backend.RePlan(s, hint); err != nil {
+		return "Failed: " + err.Message
+	}
+	return renderPlan(s) + fmt.Sprintf("/accept %s", shortHash(s.ID))
+}
+
+func (n *Notifier) cmdSubscribe(ctx context.Context, args string) string {
+	parts := splitArgs(args, 3)
+	if len(parts) != 3 {
+		return "Usage: /subscribe <indexer> <download|notification> <text>"
+	}
+
+	if err := n.backend.RegisterSearch(&db.RSSSearch{
+		Indexer: parts[0],
+		Text:    parts[2],
+		Action:  parts[1],
+	}); err != nil {
+		return "Failed: " + err.Message
+	}
+	return fmt.Sprintf("Subscribed to \"%s\" on %s", parts[2], parts[0])
+}
@@ -2,26 +2,41 @@ package telegram
 
 import (
 	"context"
+	"slices"
+	"strconv"
 
 	"github.com/autoget-project/autoget/backend/internal/notify"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	logger = log.With().Str("component", "telegram").Logger()
 )
 
 type Config struct {
 	Token  string `yaml:"token"`
 	ChatID string `yaml:"chat_id"`
+
+	// AllowedUserIDs can use the bot from any chat, besides ChatID.
+	AllowedUserIDs []int64 `yaml:"allowed_user_ids"`
 }
 
 var _ notify.INotifier = (*Notifier)(nil)
 
 type Notifier struct {
-	config *Config
-	bot    *bot.Bot
+	config  *Config
+	bot     *bot.Bot
+	backend Backend
 }
 
 func New(config *Config) (*Notifier, error) {
-	b, err := bot.New(config.Token)
+	return newNotifier(config)
+}
+
+func newNotifier(config *Config, options ...bot.Option) (*Notifier, error) {
+	b, err := bot.New(config.Token, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -32,6 +47,16 @@ func New(config *Config) (*Notifier, error) {
 	}, nil
 }
 
+// Start polls telegram for updates and dispatches commands and button taps
+// to backend.
+// It blocks until ctx is done.
+func (n *Notifier) Start(ctx context.Context, backend Backend) {
+	n.backend = backend
+	n.bot.RegisterHandler(bot.HandlerTypeCallbackQueryData, callbackPrefix, bot.MatchTypePrefix, n.handleCallback)
+	n.registerCommands()
+	n.bot.Start(ctx)
+}
+
 func (n *Notifier) SendMessage(message string) error {
 	_, err := n.bot.SendMessage(context.Background(), &bot.SendMessageParams{
 		ChatID: n.config.ChatID,
@@ -50,3 +75,22 @@ func (n *Notifier) SendMarkdownMessage(message string) error {
 
 	return err
 }
+
+func (n *Notifier) SendRSSMatch(match *notify.RSSMatch) error {
+	_, err := n.bot.SendMessage(context.Background(), &bot.SendMessageParams{
+		ChatID:      n.config.ChatID,
+		Text:        renderRSSMatch(match),
+		ReplyMarkup: rssMatchKeyboard(match.SearchID, match.ResID),
+	})
+
+	return err
+}
+
+// isAllowed checks if the update comes from the configured chat or an
+// allowed user.
+func (n *Notifier) isAllowed(chatID int64, userID int64) bool {
+	if strconv.FormatInt(chatID, 10) == n.config.ChatID {
+		return true
+	}
+	return slices.Contains(n.config.AllowedUserIDs, userID)
+}
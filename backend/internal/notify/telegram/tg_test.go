@@ -1,9 +1,24 @@
 package telegram
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
+	"strings"
 	"testing"
 
+	"github.com/autoget-project/autoget/backend/indexers"
+	"github.com/autoget-project/autoget/backend/internal/db"
+	"github.com/autoget-project/autoget/backend/internal/errors"
+	"github.com/autoget-project/autoget/backend/internal/notify"
+	"github.com/autoget-project/autoget/backend/organizer"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -41,3 +56,470 @@ func TestSendMarkdownMessage(t *testing.T) {
 	bot.SendMarkdownMessage(`*title*:
   test message`)
 }
+
+type telegramRequest struct {
+	method string
+	form   map[string]string
+}
+
+// fake telegram bot api server
+type fakeTelegram struct {
+	reqs []*telegramRequest
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &telegramRequest{
+		method: path.Base(r.URL.Path),
+		form:   map[string]string{},
+	}
+	if err := r.ParseMultipartForm(1 << 20); err == nil {
+		for k, v := range r.MultipartForm.Value {
+			req.form[k] = v[0]
+		}
+	}
+	f.reqs = append(f.reqs, req)
+
+	w.Header().Set("Content-Type", "application/json")
+	if req.method == "answerCallbackQuery" {
+		w.Write([]byte(`{"ok":true,"result":true}`))
+		return
+	}
+	w.Write([]byte(`{"ok":true,"result":{"message_id":1,"chat":{"id":100}}}`))
+}
+
+func (f *fakeTelegram) methods() []string {
+	methods := []string{}
+	for _, r := range f.reqs {
+		methods = append(methods, r.method)
+	}
+	return methods
+}
+
+type fakeBackend struct {
+	calls     []string
+	detail    *indexers.ResourceDetail
+	returnErr error
+
+	listResult  *indexers.ListResult
+	statuses    map[string][]db.DownloadStatus
+	status      *db.DownloadStatus
+	executeResp *organizer.ExecuteResponse
+	httpErr     *errors.HTTPStatusError
+}
+
+func (f *fakeBackend) DownloadRSSMatch(searchID uint, resID string) error {
+	f.calls = append(f.calls, fmt.Sprintf("download:%d:%s", searchID, resID))
+	return f.returnErr
+}
+
+func (f *fakeBackend) RSSMatchDetail(searchID uint, resID string) (*indexers.ResourceDetail, error) {
+	f.calls = append(f.calls, fmt.Sprintf("detail:%d:%s", searchID, resID))
+	return f.detail, f.returnErr
+}
+
+func (f *fakeBackend) IgnoreRSSMatch(searchID uint, resID string) error {
+	f.calls = append(f.calls, fmt.Sprintf("ignore:%d:%s", searchID, resID))
+	return f.returnErr
+}
+
+func (f *fakeBackend) Unsubscribe(searchID uint) error {
+	f.calls = append(f.calls, fmt.Sprintf("unsubscribe:%d", searchID))
+	return f.returnErr
+}
+
+func (f *fakeBackend) ListResources(indexer string, req *indexers.ListRequest) (*indexers.ListResult, *errors.HTTPStatusError) {
+	f.calls = append(f.calls, fmt.Sprintf("list:%s:%s", indexer, req.Keyword))
+	return f.listResult, f.httpErr
+}
+
+func (f *fakeBackend) Download(indexer string, resID string) *errors.HTTPStatusError {
+	f.calls = append(f.calls, fmt.Sprintf("download:%s:%s", indexer, resID))
+	return f.httpErr
+}
+
+func (f *fakeBackend) DownloaderNames() []string {
+	return []string{"transmission"}
+}
+
+func (f *fakeBackend) DownloadStatuses(downloader string, state string) ([]db.DownloadStatus, *errors.HTTPStatusError) {
+	return f.statuses[state], f.httpErr
+}
+
+func (f *fakeBackend) FindDownloadStatus(hashPrefix string) (*db.DownloadStatus, *errors.HTTPStatusError) {
+	f.calls = append(f.calls, fmt.Sprintf("find:%s", hashPrefix))
+	if f.status == nil {
+		return nil, errors.NewHTTPStatusError(http.StatusNotFound, "Download not found")
+	}
+	return f.status, nil
+}
+
+func (f *fakeBackend) AcceptPlan(downloadStatus *db.DownloadStatus) (*organizer.ExecuteResponse, *errors.HTTPStatusError) {
+	f.calls = append(f.calls, fmt.Sprintf("accept:%s", downloadStatus.ID))
+	return f.executeResp, f.httpErr
+}
+
+func (f *fakeBackend) RePlan(downloadStatus *db.DownloadStatus, userHint string) (*organizer.PlanResponse, *errors.HTTPStatusError) {
+	f.calls = append(f.calls, fmt.Sprintf("replan:%s:%s", downloadStatus.ID, userHint))
+	return downloadStatus.OrganizePlans, f.httpErr
+}
+
+func (f *fakeBackend) RegisterSearch(search *db.RSSSearch) *errors.HTTPStatusError {
+	f.calls = append(f.calls, fmt.Sprintf("subscribe:%s:%s:%s", search.Indexer, search.Action, search.Text))
+	return f.httpErr
+}
+
+func fakeNotifier(t *testing.T) (*Notifier, *fakeTelegram, *fakeBackend) {
+	t.Helper()
+
+	fake := &fakeTelegram{}
+	serv := httptest.NewServer(fake)
+	t.Cleanup(serv.Close)
+
+	n, err := newNotifier(&Config{Token: "token", ChatID: "100"}, bot.WithServerURL(serv.URL), bot.WithSkipGetMe())
+	require.NoError(t, err)
+
+	backend := &fakeBackend{}
+	n.backend = backend
+	return n, fake, backend
+}
+
+func callbackUpdate(chatID int64, data string) *models.Update {
+	return &models.Update{
+		CallbackQuery: &models.CallbackQuery{
+			ID:   "query",
+			Data: data,
+			Message: models.MaybeInaccessibleMessage{
+				Type: models.MaybeInaccessibleMessageTypeMessage,
+				Message: &models.Message{
+					ID:   1,
+					Chat: models.Chat{ID: chatID},
+					Text: "match",
+				},
+			},
+		},
+	}
+}
+
+func TestSendRSSMatch(t *testing.T) {
+	n, fake, _ := fakeNotifier(t)
+
+	require.NoError(t, n.SendRSSMatch(&notify.RSSMatch{
+		SearchID:   12,
+		SearchText: "frieren",
+		Indexer:    "nyaa",
+		ResID:      "123",
+		Title:      "[Sub] Frieren - 01",
+		Category:   "Anime",
+		URL:        "https://nyaa.si/download/123.torrent",
+	}))
+
+	require.Len(t, fake.reqs, 1)
+	assert.Equal(t, "sendMessage", fake.reqs[0].method)
+	assert.Contains(t, fake.reqs[0].form["text"], "[nyaa] New match for \"frieren\"")
+	assert.Contains(t, fake.reqs[0].form["text"], "[Sub] Frieren - 01")
+
+	keyboard := &models.InlineKeyboardMarkup{}
+	require.NoError(t, json.Unmarshal([]byte(fake.reqs[0].form["reply_markup"]), keyboard))
+	assert.Equal(t, rssMatchKeyboard(12, "123"), keyboard)
+	assert.Equal(t, "rss:dl:12:123", keyboard.InlineKeyboard[0][0].CallbackData)
+}
+
+func TestHandleCallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantCall    string
+		wantMethods []string
+	}{
+		{
+			name:        "download",
+			data:        callbackData(actionDownload, 12, "123"),
+			wantCall:    "download:12:123",
+			wantMethods: []string{"answerCallbackQuery", "editMessageText"},
+		},
+		{
+			name:        "download latest match",
+			data:        "rss:dl:12",
+			wantCall:    "download:12:",
+			wantMethods: []string{"answerCallbackQuery", "editMessageText"},
+		},
+		{
+			name:        "detail",
+			data:        callbackData(actionDetail, 12, "123"),
+			wantCall:    "detail:12:123",
+			wantMethods: []string{"answerCallbackQuery", "sendMessage"},
+		},
+		{
+			name:        "ignore",
+			data:        callbackData(actionIgnore, 12, "123"),
+			wantCall:    "ignore:12:123",
+			wantMethods: []string{"answerCallbackQuery", "editMessageText"},
+		},
+		{
+			name:        "unsubscribe",
+			data:        callbackData(actionUnsubscribe, 12, "123"),
+			wantCall:    "unsubscribe:12",
+			wantMethods: []string{"answerCallbackQuery", "editMessageText"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, fake, backend := fakeNotifier(t)
+			backend.detail = &indexers.ResourceDetail{
+				ListResourceItem: indexers.ListResourceItem{Title: "title", Size: 2048},
+			}
+
+			n.handleCallback(context.Background(), n.bot, callbackUpdate(100, tt.data))
+
+			assert.Equal(t, []string{tt.wantCall}, backend.calls)
+			assert.Equal(t, tt.wantMethods, fake.methods())
+		})
+	}
+}
+
+func TestHandleCallback_Error(t *testing.T) {
+	tests := []struct {
+		name       string
+		chatID     int64
+		data       string
+		backendErr error
+		wantAnswer string
+	}{
+		{
+			name:       "other chat",
+			chatID:     200,
+			data:       callbackData(actionDownload, 12, "123"),
+			wantAnswer: "Not allowed",
+		},
+		{
+			name:       "invalid data",
+			chatID:     100,
+			data:       "rss:dl",
+			wantAnswer: "invalid callback data: rss:dl",
+		},
+		{
+			name:       "backend error",
+			chatID:     100,
+			data:       callbackData(actionDownload, 12, "123"),
+			backendErr: fmt.Errorf("boom"),
+			wantAnswer: "Failed: boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, fake, backend := fakeNotifier(t)
+			backend.returnErr = tt.backendErr
+
+			n.handleCallback(context.Background(), n.bot, callbackUpdate(tt.chatID, tt.data))
+
+			require.Len(t, fake.reqs, 1)
+			assert.Equal(t, "answerCallbackQuery", fake.reqs[0].method)
+			assert.Equal(t, tt.wantAnswer, fake.reqs[0].form["text"])
+		})
+	}
+}
+
+func commandUpdate(chatID int64, userID int64, text string) *models.Update {
+	return &models.Update{
+		Message: &models.Message{
+			ID:   1,
+			Chat: models.Chat{ID: chatID},
+			From: &models.User{ID: userID},
+			Text: text,
+		},
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   func(n *Notifier) commandHandler
+		text      string
+		setup     func(b *fakeBackend)
+		wantCalls []string
+		wantReply string
+	}{
+		{
+			name:    "search",
+			handler: func(n *Notifier) commandHandler { return n.cmdSearch },
+			text:    "/search nyaa frieren 1080p",
+			setup: func(b *fakeBackend) {
+				b.listResult = &indexers.ListResult{
+					Resources: []indexers.ListResourceItem{
+						{ID: "123", Title: "Frieren - 01", Size: 1024, Seeders: 5},
+					},
+				}
+			},
+			wantCalls: []string{"list:nyaa:frieren 1080p"},
+			wantReply: "Frieren - 01\n1.00 KiB, 5 seeders\n/get nyaa 123\n\n",
+		},
+		{
+			name:      "get",
+			handler:   func(n *Notifier) commandHandler { return n.cmdGet },
+			text:      "/get nyaa 123",
+			wantCalls: []string{"download:nyaa:123"},
+			wantReply: "Download started",
+		},
+		{
+			name:    "status",
+			handler: func(n *Notifier) commandHandler { return n.cmdStatus },
+			text:    "/status",
+			setup: func(b *fakeBackend) {
+				b.statuses = map[string][]db.DownloadStatus{
+					"downloading": {{ID: "hash", ResTitle: "Frieren - 01", DownloadProgress: 455}},
+				}
+			},
+			wantReply: "transmission:\n- Frieren - 01 45.5%\n\n",
+		},
+		{
+			name:    "plans",
+			handler: func(n *Notifier) commandHandler { return n.cmdPlans },
+			text:    "/plans",
+			setup: func(b *fakeBackend) {
+				b.statuses = map[string][]db.DownloadStatus{
+					"planned": {{
+						ID:       "0123456789abcdef",
+						ResTitle: "Frieren - 01",
+						OrganizePlans: &organizer.PlanResponse{
+							Plan: []organizer.PlanAction{
+								{File: "01.mkv", Action: organizer.ActionMove, Target: "/tv/Frieren/S01E01.mkv"},
+							},
+						},
+					}},
+				}
+			},
+			wantReply: "[01234567] Frieren - 01\nmove: 01.mkv -> /tv/Frieren/S01E01.mkv\n/accept 01234567\n\n",
+		},
+		{
+			name:    "accept",
+			handler: func(n *Notifier) commandHandler { return n.cmdAccept },
+			text:    "/accept 01234567",
+			setup: func(b *fakeBackend) {
+				b.status = &db.DownloadStatus{ID: "0123456789abcdef", ResTitle: "Frieren - 01"}
+			},
+			wantCalls: []string{"find:01234567", "accept:0123456789abcdef"},
+			wantReply: "Organized Frieren - 01",
+		},
+		{
+			name:    "replan with hint",
+			handler: func(n *Notifier) commandHandler { return n.cmdRePlan },
+			text:    "/replan 01234567 it is season 2",
+			setup: func(b *fakeBackend) {
+				b.status = &db.DownloadStatus{ID: "0123456789abcdef", ResTitle: "Frieren - 01"}
+			},
+			wantCalls: []string{"find:01234567", "replan:0123456789abcdef:it is season 2"},
+			wantReply: "[01234567] Frieren - 01\n/accept 01234567",
+		},
+		{
+			name:      "subscribe",
+			handler:   func(n *Notifier) commandHandler { return n.cmdSubscribe },
+			text:      "/subscribe nyaa notification frieren 1080p",
+			wantCalls: []string{"subscribe:nyaa:notification:frieren 1080p"},
+			wantReply: "Subscribed to \"frieren 1080p\" on nyaa",
+		},
+		{
+			name: "long reply",
+			handler: func(n *Notifier) commandHandler {
+				return func(context.Context, string) string { return "a" + strings.Repeat("é", maxMessageLen) }
+			},
+			text: "/status",
+			// cut before the rune at maxMessageLen, not in it.
+			wantReply: "a" + strings.Repeat("é", maxMessageLen/2-1) + "\n...",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, fake, backend := fakeNotifier(t)
+			if tt.setup != nil {
+				tt.setup(backend)
+			}
+
+			n.command(tt.handler(n))(context.Background(), n.bot, commandUpdate(100, 1, tt.text))
+
+			assert.Equal(t, tt.wantCalls, backend.calls)
+			require.Len(t, fake.reqs, 1)
+			assert.Equal(t, "sendMessage", fake.reqs[0].method)
+			assert.Equal(t, tt.wantReply, fake.reqs[0].form["text"])
+		})
+	}
+}
+
+func TestCommands_Error(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   func(n *Notifier) commandHandler
+		text      string
+		httpErr   *errors.HTTPStatusError
+		wantReply string
+	}{
+		{
+			name:      "search missing text",
+			handler:   func(n *Notifier) commandHandler { return n.cmdSearch },
+			text:      "/search nyaa",
+			wantReply: "Usage: /search <indexer> <text>",
+		},
+		{
+			name:      "get backend error",
+			handler:   func(n *Notifier) commandHandler { return n.cmdGet },
+			text:      "/get nyaa 123",
+			httpErr:   errors.NewHTTPStatusError(http.StatusConflict, "duplicate download"),
+			wantReply: "Failed: duplicate download",
+		},
+		{
+			name:      "accept unknown hash",
+			handler:   func(n *Notifier) commandHandler { return n.cmdAccept },
+			text:      "/accept 01234567",
+			wantReply: "Failed: Download not found",
+		},
+		{
+			name:      "subscribe missing text",
+			handler:   func(n *Notifier) commandHandler { return n.cmdSubscribe },
+			text:      "/subscribe nyaa download",
+			wantReply: "Usage: /subscribe <indexer> <download|notification> <text>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, fake, backend := fakeNotifier(t)
+			backend.httpErr = tt.httpErr
+
+			n.command(tt.handler(n))(context.Background(), n.bot, commandUpdate(100, 1, tt.text))
+
+			require.Len(t, fake.reqs, 1)
+			assert.Equal(t, tt.wantReply, fake.reqs[0].form["text"])
+		})
+	}
+}
+
+func TestCommands_AccessControl(t *testing.T) {
+	tests := []struct {
+		name      string
+		chatID    int64
+		userID    int64
+		wantReply bool
+	}{
+		{name: "configured chat", chatID: 100, userID: 1, wantReply: true},
+		{name: "allowed user", chatID: 300, userID: 42, wantReply: true},
+		{name: "unknown chat and user", chatID: 300, userID: 1, wantReply: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, fake, _ := fakeNotifier(t)
+			n.config.AllowedUserIDs = []int64{42}
+
+			n.command(n.cmdHelp)(context.Background(), n.bot, commandUpdate(tt.chatID, tt.userID, "/help"))
+
+			if tt.wantReply {
+				require.Len(t, fake.reqs, 1)
+				assert.Equal(t, usage, fake.reqs[0].form["text"])
+			} else {
+				assert.Empty(t, fake.reqs)
+			}
+		})
+	}
+}